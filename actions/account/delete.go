@@ -0,0 +1,278 @@
+package account
+
+import (
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+
+    "actions/config"
+    "actions/integrations"
+    "actions/models"
+    "actions/notify"
+    "actions/oauth"
+    "actions/services"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+    "github.com/go-redis/redis/v8"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// The confirmation is unknown, expired, already used or for another deletion
+var ErrInvalidConfirmation = errors.New("invalid or expired deletion confirmation")
+
+func confirmationKey(apiKey string) string {
+    return "account:delete:" + apiKey
+}
+
+/*
+RequestDeletion returns a confirmation token the user sends back to delete
+their account. It is kept in the session Redis and expires with
+AccountDeletionConfirmationExpiration; a new request replaces it.
+*/
+func RequestDeletion(apiKey string) (string, time.Time, error) {
+    confirmation, err := utils.GenerateSessionKey(config.AccountDeletionConfirmationLength, config.OAuthSessionCharset)
+    if err != nil {
+        return "", time.Time{}, fmt.Errorf("failed to generate confirmation: %w", err)
+    }
+
+    expiresAt := time.Now().UTC().Add(config.AccountDeletionConfirmationExpiration)
+    err = config.RedisSessionCache.Set(config.RedisSessionCacheCtx, confirmationKey(apiKey), confirmation, config.AccountDeletionConfirmationExpiration).Err()
+    if err != nil {
+        return "", time.Time{}, fmt.Errorf("failed to store confirmation: %w", err)
+    }
+    return confirmation, expiresAt, nil
+}
+
+// store is one place user data is kept, purge deletes it and returns how much there was
+type store struct {
+    name    string
+    purge   func() (int, error)
+}
+
+/*
+Delete removes everything held about the user once the confirmation matches,
+which consumes it either way. Each store is purged and then purged again:
+the deletion is verified when the second pass finds nothing. The user
+document goes early, so the API key stops working while the rest is deleted.
+
+An audit record is written before anything is deleted and completed with the
+steps. Data written by requests still in flight (a detail view synced to
+user-logs) is caught by a second run after UserLogsRepurgeDelay, which updates
+the record.
+*/
+func Delete(apiKey, confirmation string) (models.AccountDeletion, error) {
+    expected, err := config.RedisSessionCache.GetDel(config.RedisSessionCacheCtx, confirmationKey(apiKey)).Result()
+    if err == redis.Nil {
+        return models.AccountDeletion{}, ErrInvalidConfirmation
+    }
+    if err != nil {
+        return models.AccountDeletion{}, fmt.Errorf("failed to read confirmation: %w", err)
+    }
+    if subtle.ConstantTimeCompare([]byte(expected), []byte(confirmation)) != 1 {
+        return models.AccountDeletion{}, ErrInvalidConfirmation
+    }
+
+    return erase(apiKey, "user-request")
+}
+
+// erase deletes the user's data from every store, recording why and what was deleted
+func erase(apiKey, reason string) (models.AccountDeletion, error) {
+    subject := sha256.Sum256([]byte(apiKey))
+    deletion := models.AccountDeletion{
+        Reason:      reason,
+        Subject:     hex.EncodeToString(subject[:]),
+        RequestedAt: time.Now().UTC(),
+        Steps:       []models.DeletionStep{},
+    }
+    auditRef := config.FirebaseClient.Collection(config.AccountDeletionsCollection).NewDoc()
+    deletion.ID = auditRef.ID
+    if _, err := auditRef.Create(config.FirebaseCtx, deletion); err != nil {
+        return models.AccountDeletion{}, fmt.Errorf("failed to record deletion: %w", err)
+    }
+
+    stores, err := storesOf(apiKey)
+    if err != nil {
+        return models.AccountDeletion{}, err
+    }
+
+    deletion.Steps, deletion.Complete = run(stores)
+    deletion.CompletedAt = time.Now().UTC()
+    if _, err := auditRef.Set(config.FirebaseCtx, deletion); err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to complete deletion record %s", deletion.ID), "red", err)
+    }
+    utils.LogMessage(fmt.Sprintf("Deleted account %s (complete: %t)", deletion.ID, deletion.Complete), "green")
+
+    time.AfterFunc(config.UserLogsRepurgeDelay, func() {
+        recheck(auditRef, deletion, stores)
+    })
+    return deletion, nil
+}
+
+// run purges every store twice, in order, and reports whether all of them were verified
+func run(stores []store) ([]models.DeletionStep, bool) {
+    steps := make([]models.DeletionStep, 0, len(stores))
+    complete := true
+    for _, current := range stores {
+        step := models.DeletionStep{Store: current.name}
+        deleted, err := current.purge()
+        step.Deleted = deleted
+        if err == nil {
+            var remaining int
+            remaining, err = current.purge()
+            step.Deleted += remaining
+            step.Verified = err == nil && remaining == 0
+        }
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to delete user data from %s", current.name), "red", err)
+            step.Error = err.Error()
+        }
+        complete = complete && step.Verified
+        steps = append(steps, step)
+    }
+    return steps, complete
+}
+
+// recheck runs the deletion again and records what it found in the audit record
+func recheck(auditRef *firestore.DocumentRef, deletion models.AccountDeletion, stores []store) {
+    steps, complete := run(stores)
+    for index, step := range steps {
+        if step.Deleted > 0 {
+            utils.LogMessage(fmt.Sprintf("Deletion %s recheck removed %d more from %s", deletion.ID, step.Deleted, step.Store), "green")
+        }
+        // The first run's counts stay, the recheck decides what is verified
+        steps[index].Deleted += deletion.Steps[index].Deleted
+    }
+
+    rechecked := time.Now().UTC()
+    deletion.Steps = steps
+    deletion.Complete = complete
+    deletion.RecheckedAt = &rechecked
+    if _, err := auditRef.Set(config.FirebaseCtx, deletion); err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to record recheck of deletion %s", deletion.ID), "red", err)
+    }
+}
+
+/*
+storesOf lists where the user's data is kept, in deletion order: integrations
+are disconnected while their tokens can still be read, then the user document
+goes and the cached status with it, then everything keyed by the API key.
+*/
+func storesOf(apiKey string) ([]store, error) {
+    collections, err := collectionsOf(apiKey)
+    if err != nil {
+        return nil, err
+    }
+
+    stores := []store{
+        {name: "integrations", purge: func() (int, error) { return disconnectAll(apiKey) }},
+        {name: "oauth-sessions", purge: func() (int, error) { return oauth.DropSessions(apiKey) }},
+        {name: "user", purge: func() (int, error) { return deleteUser(apiKey) }},
+        {name: "device-registrations", purge: func() (int, error) { return deleteRegistrations(apiKey) }},
+        {name: "user-cache", purge: func() (int, error) { return dropCaches(apiKey) }},
+    }
+    for _, collection := range collections {
+        collection := collection
+        stores = append(stores, store{
+            name:  "firestore:" + collection.ID,
+            purge: func() (int, error) { return deleteCollection(collection) },
+        })
+    }
+    stores = append(stores,
+        store{name: "notifications", purge: func() (int, error) { return notify.Forget(apiKey) }},
+        store{name: "user-logs", purge: func() (int, error) { return services.PurgeDetailLogs(apiKey) }},
+    )
+    return stores, nil
+}
+
+// disconnectAll revokes and deletes every integration the user connected
+func disconnectAll(apiKey string) (int, error) {
+    disconnected := 0
+    for _, integration := range integrations.All() {
+        provider := integration.OAuth()
+        if provider == nil {
+            continue
+        }
+
+        _, err := oauth.Connection(apiKey, *provider)
+        if err == oauth.ErrNotConnected || status.Code(err) == codes.NotFound {
+            continue
+        }
+        if err != nil {
+            return disconnected, fmt.Errorf("failed to read %s connection: %w", integration.Name(), err)
+        }
+        if err := oauth.Disconnect(apiKey, *provider); err != nil {
+            return disconnected, err
+        }
+        disconnected++
+    }
+    return disconnected, nil
+}
+
+func deleteUser(apiKey string) (int, error) {
+    _, err := userRef(apiKey).Get(config.FirebaseCtx)
+    if status.Code(err) == codes.NotFound {
+        return 0, nil
+    }
+    if err != nil {
+        return 0, err
+    }
+    if _, err := userRef(apiKey).Delete(config.FirebaseCtx); err != nil {
+        return 0, err
+    }
+    return 1, nil
+}
+
+/*
+dropCaches tells feed-api the user is gone and their history with it. The
+status a request re-caches meanwhile says the user doesn't exist, so only a
+cached existing user counts as left over.
+*/
+func dropCaches(apiKey string) (int, error) {
+    cached, err := services.GetCachedUserStatus(config.RedisAPICacheCtx, apiKey)
+    if err != nil && err != redis.Nil {
+        return 0, fmt.Errorf("failed to read cached user status: %w", err)
+    }
+    if err := services.PublishUserInvalidation(apiKey); err != nil {
+        return 0, err
+    }
+    services.PublishHistoryInvalidation(apiKey)
+
+    if cached != nil && cached.Exists {
+        return 1, nil
+    }
+    return 0, nil
+}
+
+func deleteCollection(collection *firestore.CollectionRef) (int, error) {
+    docs, err := collection.Select().Documents(config.FirebaseCtx).GetAll()
+    if err != nil {
+        return 0, err
+    }
+    if len(docs) == 0 {
+        return 0, nil
+    }
+
+    writer := config.FirebaseClient.BulkWriter(config.FirebaseCtx)
+    jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+    for _, doc := range docs {
+        job, err := writer.Delete(doc.Ref)
+        if err != nil {
+            writer.End()
+            return 0, err
+        }
+        jobs = append(jobs, job)
+    }
+    writer.End()
+
+    for _, job := range jobs {
+        if _, err := job.Results(); err != nil {
+            return 0, err
+        }
+    }
+    return len(docs), nil
+}
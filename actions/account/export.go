@@ -0,0 +1,235 @@
+package account
+
+import (
+    "archive/zip"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+
+    "actions/config"
+    "actions/integrations"
+    "actions/models"
+
+    "cloud.google.com/go/firestore"
+    "github.com/minio/minio-go/v7"
+    "google.golang.org/api/iterator"
+)
+
+// Fields of the user document holding secrets, exported through integrations.json instead
+var secretFields = []string{config.IntegrationsField, config.LegacyNotionCredentialsField}
+
+/*
+Sub-collections of the user document every export and deletion covers, even
+when listing them fails. Others found next to them are covered too.
+*/
+var userCollections = []string{config.BookmarksCollection, config.DevicesCollection, config.HistoryCollection}
+
+// Archive is everything held about a user, collected before anything is sent
+type Archive struct {
+    apiKey      string
+    generatedAt time.Time
+    // Contents by file name
+    files       map[string]interface{}
+    // user-logs objects, copied as they are
+    logs        []minio.ObjectInfo
+}
+
+func userRef(apiKey string) *firestore.DocumentRef {
+    return config.FirebaseClient.Collection("users").Doc(apiKey)
+}
+
+/*
+Collect reads the user document, its sub-collections, the integrations and
+the list of user-logs objects. Secrets (integration tokens) are left out;
+which integrations are connected is exported instead.
+*/
+func Collect(apiKey string) (*Archive, error) {
+    archive := &Archive{apiKey: apiKey, generatedAt: time.Now().UTC(), files: make(map[string]interface{})}
+
+    doc, err := userRef(apiKey).Get(config.FirebaseCtx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read user: %w", err)
+    }
+    profile := exportValue(doc.Data()).(map[string]interface{})
+    for _, field := range secretFields {
+        delete(profile, field)
+    }
+    archive.files["profile.json"] = profile
+
+    connected := []models.IntegrationStatus{}
+    for _, integration := range integrations.All() {
+        if status := integrations.Status(apiKey, integration); status.Connected {
+            connected = append(connected, status)
+        }
+    }
+    archive.files["integrations.json"] = connected
+
+    collections, err := collectionsOf(apiKey)
+    if err != nil {
+        return nil, err
+    }
+    for _, collection := range collections {
+        docs, err := collection.Documents(config.FirebaseCtx).GetAll()
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s: %w", collection.ID, err)
+        }
+        entries := make([]map[string]interface{}, 0, len(docs))
+        for _, doc := range docs {
+            entry := exportValue(doc.Data()).(map[string]interface{})
+            entry["id"] = doc.Ref.ID
+            entries = append(entries, entry)
+        }
+        archive.files[collection.ID+".json"] = entries
+    }
+
+    registrations, err := config.FirebaseClient.Collection(config.DeviceRegistrationsCollection).
+        Where("apiKey", "==", apiKey).
+        Documents(config.FirebaseCtx).
+        GetAll()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read device registrations: %w", err)
+    }
+    devices := make([]map[string]interface{}, 0, len(registrations))
+    for _, doc := range registrations {
+        var registration models.DeviceRegistration
+        if err := doc.DataTo(&registration); err != nil {
+            return nil, err
+        }
+        devices = append(devices, map[string]interface{}{"platform": registration.Platform, "createdAt": registration.CreatedAt})
+    }
+    archive.files["device-registrations.json"] = devices
+
+    for object := range config.MinIOClient.ListObjects(config.MinIOCtx, config.UserLogsBucket, minio.ListObjectsOptions{Prefix: apiKey + "/", Recursive: true}) {
+        if object.Err != nil {
+            if minio.ToErrorResponse(object.Err).Code == "NoSuchBucket" {
+                break
+            }
+            return nil, fmt.Errorf("failed to list user logs: %w", object.Err)
+        }
+        archive.logs = append(archive.logs, object)
+    }
+
+    return archive, nil
+}
+
+// collectionsOf returns the sub-collections of the user document, the known ones included
+func collectionsOf(apiKey string) ([]*firestore.CollectionRef, error) {
+    found := make(map[string]*firestore.CollectionRef)
+    for _, name := range userCollections {
+        found[name] = userRef(apiKey).Collection(name)
+    }
+
+    collections := userRef(apiKey).Collections(config.FirebaseCtx)
+    for {
+        collection, err := collections.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to list user collections: %w", err)
+        }
+        found[collection.ID] = collection
+    }
+
+    names := make([]string, 0, len(found))
+    for name := range found {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    refs := make([]*firestore.CollectionRef, 0, len(names))
+    for _, name := range names {
+        refs = append(refs, found[name])
+    }
+    return refs, nil
+}
+
+// Write sends the archive as a zip: a manifest, one JSON file per store and the user logs under user-logs/
+func (archive *Archive) Write(writer io.Writer) error {
+    zipWriter := zip.NewWriter(writer)
+
+    names := make([]string, 0, len(archive.files))
+    for name := range archive.files {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    manifest := map[string]interface{}{
+        "generatedAt": archive.generatedAt,
+        "files":       names,
+        "userLogs":    len(archive.logs),
+    }
+    if err := writeJSON(zipWriter, "manifest.json", manifest); err != nil {
+        return err
+    }
+    for _, name := range names {
+        if err := writeJSON(zipWriter, name, archive.files[name]); err != nil {
+            return err
+        }
+    }
+
+    for _, object := range archive.logs {
+        if err := copyLog(zipWriter, object); err != nil {
+            return err
+        }
+    }
+
+    return zipWriter.Close()
+}
+
+func writeJSON(zipWriter *zip.Writer, name string, content interface{}) error {
+    file, err := zipWriter.Create(name)
+    if err != nil {
+        return err
+    }
+    encoder := json.NewEncoder(file)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(content); err != nil {
+        return fmt.Errorf("failed to write %s: %w", name, err)
+    }
+    return nil
+}
+
+func copyLog(zipWriter *zip.Writer, object minio.ObjectInfo) error {
+    reader, err := config.MinIOClient.GetObject(config.MinIOCtx, config.UserLogsBucket, object.Key, minio.GetObjectOptions{})
+    if err != nil {
+        return fmt.Errorf("failed to read %s: %w", object.Key, err)
+    }
+    defer reader.Close()
+
+    // The API key prefix is left out of the archive
+    name := "user-logs/" + object.Key[strings.Index(object.Key, "/")+1:]
+    file, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: object.LastModified})
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(file, reader); err != nil {
+        return fmt.Errorf("failed to copy %s: %w", object.Key, err)
+    }
+    return nil
+}
+
+// exportValue turns Firestore values JSON can't represent into plain ones, references into their path
+func exportValue(value interface{}) interface{} {
+    switch typed := value.(type) {
+    case map[string]interface{}:
+        exported := make(map[string]interface{}, len(typed))
+        for key, item := range typed {
+            exported[key] = exportValue(item)
+        }
+        return exported
+    case []interface{}:
+        exported := make([]interface{}, len(typed))
+        for index, item := range typed {
+            exported[index] = exportValue(item)
+        }
+        return exported
+    case *firestore.DocumentRef:
+        return typed.Path
+    default:
+        return value
+    }
+}
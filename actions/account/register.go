@@ -0,0 +1,175 @@
+package account
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+
+    "actions/config"
+    "actions/models"
+    "actions/services"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// The device ID isn't the one the account was registered with
+var ErrDeviceMismatch = errors.New("account was not registered by this device")
+
+// Registrations are keyed by a hash of the install ID, the ID itself is never stored
+func registrationRef(deviceID string) *firestore.DocumentRef {
+    hash := sha256.Sum256([]byte(deviceID))
+    return config.FirebaseClient.Collection(config.DeviceRegistrationsCollection).Doc(hex.EncodeToString(hash[:]))
+}
+
+/*
+AllowRegistration counts a sign up from clientIP and reports whether it is
+within RegistrationsPerIP for the current RegistrationRateWindow. When it
+isn't, the time until the window ends is returned for Retry-After. Without
+the API cache Redis sign ups aren't limited.
+*/
+func AllowRegistration(clientIP string) (bool, time.Duration, error) {
+    if config.RedisAPICache == nil {
+        utils.LogMessage("API cache Redis unavailable, sign ups are not rate limited", "red")
+        return true, 0, nil
+    }
+
+    key := "register:ip:" + clientIP
+    count, err := config.RedisAPICache.Incr(config.RedisAPICacheCtx, key).Result()
+    if err != nil {
+        return false, 0, fmt.Errorf("failed to count sign up: %w", err)
+    }
+    if count == 1 {
+        if err := config.RedisAPICache.Expire(config.RedisAPICacheCtx, key, config.RegistrationRateWindow).Err(); err != nil {
+            return false, 0, fmt.Errorf("failed to start sign up window: %w", err)
+        }
+    }
+    if count <= config.RegistrationsPerIP {
+        return true, 0, nil
+    }
+
+    ttl, err := config.RedisAPICache.TTL(config.RedisAPICacheCtx, key).Result()
+    if err != nil {
+        return false, 0, fmt.Errorf("failed to read sign up window: %w", err)
+    }
+    // A counter left without expiry (the process stopped after INCR) would block the IP for good
+    if ttl < 0 {
+        ttl = config.RegistrationRateWindow
+        config.RedisAPICache.Expire(config.RedisAPICacheCtx, key, ttl)
+    }
+    return false, ttl, nil
+}
+
+/*
+Register signs a device up and returns its API key. A device signing up again
+gets the key it was given before, as long as the account still exists; a
+deleted account is replaced by a new one. Created reports a new account.
+*/
+func Register(request models.RegistrationRequest) (string, bool, error) {
+    indexRef := registrationRef(request.DeviceID)
+    var apiKey string
+    var created bool
+
+    err := config.FirebaseClient.RunTransaction(config.FirebaseCtx, func(ctx context.Context, tx *firestore.Transaction) error {
+        apiKey, created = "", false
+
+        indexDoc, err := tx.Get(indexRef)
+        if err != nil && status.Code(err) != codes.NotFound {
+            return err
+        }
+        if err == nil {
+            var registration models.DeviceRegistration
+            if err := indexDoc.DataTo(&registration); err != nil {
+                return err
+            }
+            userDoc, err := tx.Get(userRef(registration.APIKey))
+            if err != nil && status.Code(err) != codes.NotFound {
+                return err
+            }
+            if err == nil && userDoc.Exists() {
+                apiKey = registration.APIKey
+                return nil
+            }
+        }
+
+        apiKey, err = utils.GenerateSessionKey(config.APIKeyLength, config.APIKeyCharset)
+        if err != nil {
+            return fmt.Errorf("failed to generate api key: %w", err)
+        }
+        created = true
+
+        now := time.Now().UTC()
+        user := map[string]interface{}{
+            "premium-status": false,
+            "createdAt":      now,
+            "platform":       request.Platform,
+            "country":        request.Country,
+            "categories":     request.Categories,
+        }
+        if request.Language != "" {
+            user["language"] = request.Language
+        }
+        // A minted key colliding with an existing user fails the sign up instead of sharing the account
+        if err := tx.Create(userRef(apiKey), user); err != nil {
+            return err
+        }
+        return tx.Set(indexRef, models.DeviceRegistration{APIKey: apiKey, Platform: request.Platform, CreatedAt: now})
+    })
+    if err != nil {
+        return "", false, fmt.Errorf("failed to register device: %w", err)
+    }
+
+    // A lookup of the key before it existed may have cached it as unknown
+    if err := services.PublishUserInvalidation(apiKey); err != nil {
+        utils.LogMessage("Failed to invalidate user status after sign up", "red", err)
+    }
+    return apiKey, created, nil
+}
+
+/*
+Deregister deletes the account of the device, like a confirmed deletion: the
+install ID the account was registered with stands for the confirmation.
+Accounts created before sign up have no device and go through /account-delete.
+*/
+func Deregister(apiKey, deviceID string) (models.AccountDeletion, error) {
+    indexDoc, err := registrationRef(deviceID).Get(config.FirebaseCtx)
+    if status.Code(err) == codes.NotFound {
+        return models.AccountDeletion{}, ErrDeviceMismatch
+    }
+    if err != nil {
+        return models.AccountDeletion{}, err
+    }
+
+    var registration models.DeviceRegistration
+    if err := indexDoc.DataTo(&registration); err != nil {
+        return models.AccountDeletion{}, err
+    }
+    if registration.APIKey != apiKey {
+        return models.AccountDeletion{}, ErrDeviceMismatch
+    }
+
+    return erase(apiKey, "deregistration")
+}
+
+// deleteRegistrations deletes the sign ups that point at the user's API key
+func deleteRegistrations(apiKey string) (int, error) {
+    docs, err := config.FirebaseClient.Collection(config.DeviceRegistrationsCollection).
+        Where("apiKey", "==", apiKey).
+        Select().
+        Documents(config.FirebaseCtx).
+        GetAll()
+    if err != nil {
+        return 0, err
+    }
+    for _, doc := range docs {
+        if _, err := doc.Ref.Delete(config.FirebaseCtx); err != nil {
+            return 0, err
+        }
+    }
+    return len(docs), nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"cloud.google.com/go/firestore"
+	firebase "firebase.google.com/go"
 	"github.com/go-redis/redis/v8"
 	"github.com/minio/minio-go/v7"
 )
@@ -17,14 +18,31 @@ var (
     RedisSessionCacheCtx context.Context
     RedisSessionCacheCtxCancel context.CancelFunc
 
+    RedisNewsCacheCtx context.Context
+    RedisNewsCacheCtxCancel context.CancelFunc
+
+    RedisLogCtx context.Context
+    RedisLogCtxCancel context.CancelFunc
+
     MinIOCtx = context.Background()
 
     FirebaseCtx context.Context
 
     RedisAPICache *redis.Client
     RedisSessionCache *redis.Client
+    // Curated feeds, read by the notifier
+    RedisNewsCache *redis.Client
+    // Detail view counters feed-api keeps until they're synced to user-logs
+    RedisLog *redis.Client
+    FirebaseApp *firebase.App
     FirebaseClient *firestore.Client
     MinIOClient *minio.Client
+
+    // Discover categories of the curator, what users can pick as interests
+    InterestCategories = []string{
+        "gainers", "losers", "software", "finance", "stocks",
+        "bonds", "corporate", "banking", "technology", "tax", "geopolitics",
+    }
     
     Once sync.Once
 )
@@ -36,7 +54,78 @@ const (
     Logfile = "actions.log"
     FirebaseConfigFile = "./secrets/stockic-b6c89-firebase-adminsdk-wr64l-a8e3bdf5e7.json"
 
-    NotionSessionExpiration = 15 * time.Minute
-    NotionSessionCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-    NotionSessionKeyLength = 32
+    // OAuth states are single use and expire with the sign in session
+    OAuthSessionExpiration = 15 * time.Minute
+    OAuthSessionCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+    OAuthSessionKeyLength = 32
+    // Characters allowed in a PKCE code verifier (RFC 7636)
+    PKCEVerifierCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._~"
+    PKCEVerifierLength = 64
+    // Encrypted tokens and account details live in the user document under "integrations.<provider>"
+    IntegrationsField = "integrations"
+    // Plaintext Notion token response stored before tokens were encrypted, migrated on first use
+    LegacyNotionCredentialsField = "NotionCredentials"
+    NotionTargetField = "notionTarget"
+    NotionExportsField = "notionExports"
+
+    // Published by the curator on the news cache when it promotes a feed version
+    FeedUpdatesChannel = "feed-updates"
+    FeedCurrentKey = "feed:current"
+    // Hash of feed-api moderation overrides by services.OverrideKey, hidden articles are never notified
+    ModerationOverridesKey = "moderation:overrides:url"
+
+    // Bookmarks live in users/<X-API-Key>/bookmarks, one document per article
+    BookmarksCollection = "bookmarks"
+    // Before sub-documents, bookmarks were an array of IDs in the user document
+    LegacyBookmarksField = "bookmarks"
+    DefaultBookmarkCollection = "default"
+    MaxBookmarkCollectionLength = 64
+    MaxBookmarkNoteLength = 2000
+    DefaultBookmarksPageSize = 20
+    MaxBookmarksPageSize = 100
+    // Bookmarks a bulk update or removal may name
+    MaxBookmarksPerRequest = 100
+
+    // Device tokens live in users/<X-API-Key>/devices, notification settings in the user document
+    DevicesCollection = "devices"
+    NotificationSettingsField = "notifications"
+    MaxDevicesPerUser = 10
+    MaxWatchlistCompanies = 50
+
+    // feed-api drops its cached status of the user on this channel of the API cache
+    UserUpdatesChannel = "user-updates"
+
+    // Reading history lives in users/<X-API-Key>/history, one document per article
+    HistoryCollection = "history"
+    // feed-api drops its cached read state of the user on this channel of the API cache
+    HistoryUpdatesChannel = "history-updates"
+    DefaultHistoryPageSize = 20
+    MaxHistoryPageSize = 100
+    // Progress from which an article no longer shows in "continue reading"
+    FinishedProgress = 0.9
+    // Dwell time one report may add, longer ones are an app left open
+    MaxDwellPerReport = 2 * time.Hour
+    // Per-user detail logs synced from RedisLog, under <X-API-Key>/
+    UserLogsBucket = "user-logs"
+    // Counters being synced while history is cleared land in user-logs shortly after
+    UserLogsRepurgeDelay = time.Minute
+
+    // One document per account deletion, with what was deleted from each store
+    AccountDeletionsCollection = "account-deletions"
+    // A deletion is confirmed with a token the user asked for shortly before
+    AccountDeletionConfirmationExpiration = 15 * time.Minute
+    AccountDeletionConfirmationLength = 32
+
+    // API keys minted on sign up, the user document is users/<API key>
+    APIKeyLength = 40
+    APIKeyCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+    // Install IDs are secrets of the app, short ones could be guessed
+    MinDeviceIDLength = 32
+    MaxDeviceIDLength = 256
+    DeviceRegistrationsCollection = "device-registrations"
+    // Sign ups a client IP may make per window, counted in the API cache Redis
+    RegistrationsPerIP = 10
+    RegistrationRateWindow = time.Hour
+    // Country of users who haven't picked one, also the default headlines country of notifications
+    DefaultCountry = "us"
 )
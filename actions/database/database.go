@@ -38,6 +38,8 @@ func Initialize() {
 
     config.RedisAPICacheCtx, config.RedisAPICacheCtxCancel = context.WithCancel(context.Background())
     config.RedisSessionCacheCtx, config.RedisSessionCacheCtxCancel = context.WithCancel(context.Background())
+    config.RedisNewsCacheCtx, config.RedisNewsCacheCtxCancel = context.WithCancel(context.Background())
+    config.RedisLogCtx, config.RedisLogCtxCancel = context.WithCancel(context.Background())
     config.FirebaseCtx = context.Background()
 
     initRedisClients()
@@ -69,6 +71,28 @@ func initRedisClients() {
     if err != nil {
         utils.LogMessage("Session Redis Server Setup Failed!", "red", err)
     }
+
+    // Same news cache feed-api serves from, read for notifications, Notion export and bookmark snapshots
+    config.RedisNewsCache, err = RedisInit(
+        config.RedisNewsCacheCtx,
+        "NEWS_CACHING_ADDRESS",
+        "NEWS_CACHING_DB",
+        "NEWS_CACHING_PASSWORD",
+    )
+    if err != nil {
+        utils.LogMessage("News Cache Server Setup Failed, notifications, Notion export and bookmark snapshots disabled", "red", err)
+    }
+
+    // feed-api's detail view counters, dropped when a user clears their history
+    config.RedisLog, err = RedisInit(
+        config.RedisLogCtx,
+        "LOGREDIS_ADDRESS",
+        "LOGREDIS_DB",
+        "LOGREDIS_PASSWORD",
+    )
+    if err != nil {
+        utils.LogMessage("Log Redis Server Setup Failed, pending detail logs won't be cleared", "red", err)
+    }
 }
 
 func initFirebase() {
@@ -132,6 +156,8 @@ func InitializeFirebase(ctx context.Context, credentialsPath string, once *sync.
             log.Fatalf("Failed to initialize Firebase app: %v", err)
         }
 
+        config.FirebaseApp = app
+
         client, err = app.Firestore(ctx)
         if err != nil {
             log.Fatalf("Failed to create Firestore client: %v", err)
@@ -225,3 +251,64 @@ func UploadLogDataToMinIO(minioClient *minio.Client, BucketName, localFilePath s
     
     return nil
 }
+
+/*
+RemoveMinIOPrefix deletes every object under the prefix and returns how many
+there were, a missing bucket has nothing to delete.
+*/
+func RemoveMinIOPrefix(minioClient *minio.Client, BucketName, prefix string) (int, error) {
+    objects := minioClient.ListObjects(config.MinIOCtx, BucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+
+    // ListObjects reports its errors through the channel, RemoveObjects only takes objects to delete
+    listErr := make(chan error, 1)
+    toRemove := make(chan minio.ObjectInfo)
+    listed := 0
+    go func() {
+        defer close(toRemove)
+        for object := range objects {
+            if object.Err != nil {
+                listErr <- object.Err
+                return
+            }
+            listed++
+            toRemove <- object
+        }
+    }()
+
+    // Drained to the end, so the listing isn't left blocked
+    var removeErr error
+    for result := range minioClient.RemoveObjects(config.MinIOCtx, BucketName, toRemove, minio.RemoveObjectsOptions{}) {
+        if removeErr == nil {
+            removeErr = fmt.Errorf("error removing %s: %w", result.ObjectName, result.Err)
+        }
+    }
+    if removeErr != nil {
+        return 0, removeErr
+    }
+
+    select {
+    case err := <-listErr:
+        if minio.ToErrorResponse(err).Code == "NoSuchBucket" {
+            return 0, nil
+        }
+        return listed, fmt.Errorf("error listing %s: %w", prefix, err)
+    default:
+        return listed, nil
+    }
+}
+
+// DeleteRedisKeys deletes the keys matching the pattern and returns how many there were
+func DeleteRedisKeys(redisContext context.Context, rdb *redis.Client, pattern string) (int, error) {
+    deleted := 0
+    keys := rdb.Scan(redisContext, 0, pattern, 100).Iterator()
+    for keys.Next(redisContext) {
+        if err := rdb.Del(redisContext, keys.Val()).Err(); err != nil {
+            return deleted, fmt.Errorf("error deleting %s: %w", keys.Val(), err)
+        }
+        deleted++
+    }
+    if err := keys.Err(); err != nil {
+        return deleted, fmt.Errorf("error scanning %s: %w", pattern, err)
+    }
+    return deleted, nil
+}
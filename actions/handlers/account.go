@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"actions/account"
+	"actions/models"
+	"actions/utils"
+)
+
+/*
+Downloads everything held about the user as a zip: the profile, bookmarks,
+devices, reading history and other sub-collections, the connected
+integrations (without their tokens) and the detail logs of user-logs.
+*/
+func AccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	archive, err := account.Collect(r.Header.Get("X-API-Key"))
+	if err != nil {
+		utils.LogMessage("Failed to collect account export", "red", err)
+		http.Error(w, "Failed to export account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="stockic-data-%s.zip"`, time.Now().UTC().Format("20060102")))
+	// Headers are sent, a failure can only cut the archive short
+	if err := archive.Write(w); err != nil {
+		utils.LogMessage("Failed to write account export", "red", err)
+	}
+}
+
+// First step of an account deletion, returns the confirmation /account-delete expects
+func AccountDeleteRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	confirmation, expiresAt, err := account.RequestDeletion(r.Header.Get("X-API-Key"))
+	if err != nil {
+		utils.LogMessage("Failed to request account deletion", "red", err)
+		http.Error(w, "Failed to request account deletion", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSON(w, models.AccountDeletionConfirmation{
+		Success:      true,
+		Message:      "Send the confirmation to /account-delete to delete the account",
+		Confirmation: confirmation,
+		ExpiresAt:    expiresAt,
+	}, http.StatusOK)
+}
+
+/*
+Deletes the account and everything held about the user, given the
+confirmation of /account-delete-request. Answers with the audit record: 200
+when every store was verified empty, 202 when some data is left for the
+recheck that follows.
+*/
+func AccountDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.AccountDeletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Confirmation == "" {
+		http.Error(w, "Invalid request body, a confirmation is required", http.StatusBadRequest)
+		return
+	}
+
+	deletion, err := account.Delete(r.Header.Get("X-API-Key"), req.Confirmation)
+	if errors.Is(err, account.ErrInvalidConfirmation) {
+		http.Error(w, "Invalid or expired confirmation, request a new one", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		utils.LogMessage("Failed to delete account", "red", err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if !deletion.Complete {
+		statusCode = http.StatusAccepted
+	}
+	sendJSON(w, deletion, statusCode)
+}
@@ -2,19 +2,23 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-    "encoding/base64"
-    "bytes"
+	"strconv"
 
 	"actions/config"
+	"actions/integrations"
 	"actions/models"
+	"actions/services"
 	"actions/utils"
-
-	"cloud.google.com/go/firestore"
 )
 
+/*
+AddBookmarksHandlers bookmarks {"NewsId": "<news-id>"}, optionally into a
+"collection" with a "note". Bookmarking an article again only updates the
+collection or note given.
+*/
 func AddBookmarksHandlers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -33,32 +37,26 @@ func AddBookmarksHandlers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userRef := config.FirebaseClient.Collection("users").Doc(userID)
-
-	_, err := userRef.Update(config.FirebaseCtx, []firestore.Update{
-		{
-			Path:  "bookmarks",
-			Value: firestore.ArrayUnion(req.NewsID),
-		},
-	})
-
+	bookmark, created, err := services.AddBookmark(userID, req.NewsID, req.Collection, req.Note)
 	if err != nil {
-		_, err = userRef.Set(config.FirebaseCtx, map[string]interface{}{
-			"bookmarks": []string{req.NewsID},
-		})
-		if err != nil {
-			http.Error(w, "Failed to create bookmark", http.StatusInternalServerError)
-			return
-		}
+		bookmarkError(w, "Failed to create bookmark", err)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-    if err = json.NewEncoder(w).Encode(map[string]string{
-		"message": "Bookmark added successfully",
-	}); err != nil {
-        utils.LogMessage("jsonError: Failed to encode JSON response: %v" + err.Error(), "red")
-        http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
-    }
+	// Only new bookmarks are exported, moving one between collections isn't a new export
+	if created {
+		go integrations.AutoExport(userID, req.NewsID)
+	}
+
+	statusCode := http.StatusOK
+	if created {
+		statusCode = http.StatusCreated
+	}
+	sendResponse(w, models.BookmarkResponse{
+		Success: true,
+		Message: "Bookmark added successfully",
+		Items:   []models.Bookmark{bookmark},
+	}, statusCode)
 }
 
 func Ping(w http.ResponseWriter, r *http.Request) {
@@ -72,6 +70,7 @@ func Ping(w http.ResponseWriter, r *http.Request) {
     }
 }
 
+// Removes {"NewsId": "<news-id>"} or every bookmark of {"NewsIds": [...]}
 func RemoveBookmarks(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -89,30 +88,30 @@ func RemoveBookmarks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	newsIDs, ok := bookmarkIDs(req)
+	if !ok {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
-	userRef := config.FirebaseClient.Collection("users").Doc(userID)
-
-	_, err := userRef.Update(config.FirebaseCtx, []firestore.Update{
-		{
-			Path:  "bookmarks",
-			Value: firestore.ArrayRemove(req.NewsID),
-		},
-	})
-	if err != nil {
+	if err := services.RemoveBookmarks(userID, newsIDs); err != nil {
 		utils.LogMessage("firebaseError: Failed to delete bookmark: "+err.Error(), "red")
 		http.Error(w, "Failed to delete bookmark", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	if err = json.NewEncoder(w).Encode(map[string]string{
-		"message": "Bookmark deleted successfully",
-	}); err != nil {
-		utils.LogMessage("jsonError: Failed to encode JSON response: "+err.Error(), "red")
-		http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
-	}
+	sendResponse(w, models.BookmarkResponse{
+		Success:   true,
+		Message:   "Bookmark deleted successfully",
+		Bookmarks: newsIDs,
+	}, http.StatusOK)
 }
 
+/*
+ListBookmarks returns the bookmarks newest first with their article, a page
+at a time: ?limit=<n> (20 by default, at most 100), ?cursor=<nextCursor of the
+previous page> and ?collection=<name> to list a single collection.
+*/
 func ListBookmarks(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		sendResponse(w, models.BookmarkResponse{
@@ -131,193 +130,161 @@ func ListBookmarks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	docRef := config.FirebaseClient.Collection("users").Doc(apiKey)
-	doc, err := docRef.Get(config.FirebaseCtx)
-	if err != nil {
-		utils.LogMessage("Failed to get user document", "red", err)
-		sendResponse(w, models.BookmarkResponse{
-			Success: false,
-			Message: "User not found",
-		}, http.StatusNotFound)
-		return
-	}
-
-	var bookmarks []string
-	bookmarksData, err := doc.DataAt("bookmarks")
-	if err != nil {
-		bookmarks = []string{}
-	} else {
-		bookmarksInterface, ok := bookmarksData.([]interface{})
-		if !ok {
-			utils.LogMessage("Failed to convert bookmarks data: invalid format", "red")
+	query := r.URL.Query()
+	limit := config.DefaultBookmarksPageSize
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
 			sendResponse(w, models.BookmarkResponse{
 				Success: false,
-				Message: "Internal server error",
-			}, http.StatusInternalServerError)
+				Message: "Invalid limit",
+			}, http.StatusBadRequest)
 			return
 		}
-
-		for _, newsID := range bookmarksInterface {
-			if strNewsID, ok := newsID.(string); ok {
-				bookmarks = append(bookmarks, strNewsID)
-			}
+		limit = parsed
+	}
+	collection := ""
+	if value := query.Get("collection"); value != "" {
+		name, err := services.NormalizeCollection(value)
+		if err != nil {
+			bookmarkError(w, "Failed to list bookmarks", err)
+			return
 		}
+		collection = name
 	}
 
+	items, nextCursor, err := services.ListBookmarks(apiKey, collection, limit, query.Get("cursor"))
+	if err != nil {
+		bookmarkError(w, "Failed to list bookmarks", err)
+		return
+	}
+
+	bookmarks := make([]string, 0, len(items))
+	for _, item := range items {
+		bookmarks = append(bookmarks, item.NewsID)
+	}
+	// Clients predating pagination ask without limit or cursor and read every ID from bookmarks
+	if query.Get("limit") == "" && query.Get("cursor") == "" {
+		bookmarks, err = services.BookmarkIDs(apiKey, collection)
+		if err != nil {
+			bookmarkError(w, "Failed to list bookmarks", err)
+			return
+		}
+	}
 	sendResponse(w, models.BookmarkResponse{
-		Success:   true,
-		Message:   "Bookmarks retrieved successfully",
-		Bookmarks: bookmarks,
+		Success:    true,
+		Message:    "Bookmarks retrieved successfully",
+		Bookmarks:  bookmarks,
+		Items:      items,
+		NextCursor: nextCursor,
 	}, http.StatusOK)
 }
 
-func FallbackHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	fmt.Fprintln(w, "Fallback Handler")
-}
-
-func sendResponse(w http.ResponseWriter, response models.BookmarkResponse, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-    if err := json.NewEncoder(w).Encode(response); err != nil {
-        utils.LogMessage("Failed sending response", "red", err)
-    }
-}
-
 /*
-This endpoint creates a sign in session for the user to proceed with oauth. 
-We set a random number for the state which is the session id for login.
-The session id (state) is stored in redis in format "session id": "X-API-Key". 
-The session id has a timeout specified in config module. 
-If the user allows access, we move ahead and Callback function gets the state. 
-We get the session id and find the X-API-Key from Redis and store it into firebase for the user.
-Incase data is not found in Redis, we pop up the page "Session Timeout, please try again."
+UpdateBookmarksHandler moves bookmarks between collections and edits their
+note: {"NewsId": "<news-id>"} or {"NewsIds": [...]} with a "collection"
+and/or a "note". Nothing is changed when one of them isn't bookmarked.
 */
-func OauthNotionCreateAuthSession(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    var jsonResponse models.OauthNotionResponse
-
-    if jsonResponse.OauthURL = os.Getenv("NOTION_OAUTH_URL"); jsonResponse.OauthURL != "" {
-        
-        /* Create a Session ID Token */
-        sessionToken, err := utils.GenerateSessionKey(config.NotionSessionKeyLength, config.NotionSessionCharset)
-        if err != nil {
-            utils.LogMessage("Failed to create Notion Session Token", "red", err)
-            jsonResponse.Success = false 
-            jsonResponse.OauthURL = "nil"
-            w.WriteHeader(http.StatusNotFound)
-            if err := json.NewEncoder(w).Encode(jsonResponse); err != nil {
-                utils.LogMessage("Failed to create Notion Session Token and Error sending response about failure", "red", err)
-            }
-        }
-
-        jsonResponse.Success = true
-        jsonResponse.OauthURL = jsonResponse.OauthURL + fmt.Sprintf("&state=%s", sessionToken)
-
-        apiKey := r.Header.Get("X-API-Key")
-        fmt.Println(sessionToken)
-
-        // Session stored in Redis -> sessionKey: apiKey
-        err = config.RedisSessionCache.Set(config.RedisAPICacheCtx, sessionToken, apiKey, config.NotionSessionExpiration).Err()
-        if err != nil {
-            utils.LogMessage("Error storing session information into session redis", "red", err)
-        }
-
-        w.WriteHeader(http.StatusOK)
-        if err := json.NewEncoder(w).Encode(jsonResponse); err != nil {
-            utils.LogMessage("Faild to send Notion Oauth URL : URL Found but Not Delivered", "red", err) 
-            w.WriteHeader(http.StatusNotFound)
-            fmt.Fprintln(w, "No Notion Oauth URL set in backend")
-        }
-    } else {
-        jsonResponse.Success = false 
-        jsonResponse.OauthURL = "URL not found"
-        utils.LogMessage("No Notion Oauth URL Found", "red")
-        w.WriteHeader(http.StatusNotFound)
-        if err := json.NewEncoder(w).Encode(jsonResponse); err != nil {
-            utils.LogMessage("No Notion Oauth URL Found and Error sending response about failure", "red", err)
-        }
-    }
-}
-
-func OauthNotionCallback(w http.ResponseWriter, r *http.Request) {
-    utils.LogMessage("Recieved callback", "green")
-    w.Header().Set("Content-Type", "application/json")
-    params := r.URL.Query()
-
-	NotionAuthcode := params.Get("code") 
-    if NotionAuthcode == "" {
-        utils.LogMessage("No Notion Auth Code in Callback", "red")
-    }
-
-    NotionAuthState := params.Get("state") 
-    if NotionAuthcode == "" {
-        utils.LogMessage("No Notion Auth Code in Callback", "red")
-    }
-
-    utils.LogMessage(fmt.Sprintf("Notion Auth Code: %s, Notion Auth State: %s", NotionAuthcode, NotionAuthState), "green")
-    
-    clientID := os.Getenv("NOTION_CLIENT_ID")
-    clientSecret := os.Getenv("NOTION_CLIENT_SECRET")
-    RedirectURI := os.Getenv("NOTION_REDIRECT_URI")
+func UpdateBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-    credentials := clientID + ":" + clientSecret
+	userID := r.Header.Get("X-API-Key")
 
-    encodedCredentials := base64.StdEncoding.EncodeToString([]byte(credentials))
-    
-	payload := map[string]string{
-		"grant_type":    "authorization_code",
-		"code":          NotionAuthcode,
-		"redirect_uri":  RedirectURI,
+	var req models.BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
-
-    jsonData, err := json.Marshal(payload)
-	if err != nil {
-		utils.LogMessage("Error encoding JSON", "red", err)
+	newsIDs, ok := bookmarkIDs(req)
+	if !ok || (req.Collection == nil && req.Note == nil) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-    url := "https://api.notion.com/v1/oauth/token"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		utils.LogMessage("Error creating request:", "red", err)
+	if err := services.UpdateBookmarks(userID, newsIDs, req.Collection, req.Note); err != nil {
+		bookmarkError(w, "Failed to update bookmarks", err)
 		return
 	}
 
-    req.Header.Set("Authorization", "Basic " + encodedCredentials)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Notion-Version", "2022-06-28")
+	sendResponse(w, models.BookmarkResponse{
+		Success:   true,
+		Message:   "Bookmarks updated successfully",
+		Bookmarks: newsIDs,
+	}, http.StatusOK)
+}
 
-    client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		utils.LogMessage("Error making request", "red", err)
-        http.Error(w, "Error making request to Notion", http.StatusInternalServerError)
+// Lists the user's bookmark collections with how many bookmarks each holds
+func BookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer resp.Body.Close()
 
-	var authResult map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&authResult); err != nil {
-		utils.LogMessage("Error decoding response", "red", err)
-        http.Error(w, "Error Decoding Notion Response" + err.Error(), http.StatusUnauthorized)
+	collections, err := services.ListCollections(r.Header.Get("X-API-Key"))
+	if err != nil {
+		bookmarkError(w, "Failed to list collections", err)
 		return
 	}
-	fmt.Println("Response Body:", authResult)
+	sendJSON(w, map[string]interface{}{"collections": collections}, http.StatusOK)
+}
 
-    apiKey, err := config.RedisSessionCache.Get(config.RedisSessionCacheCtx, NotionAuthState).Result()
-	if err != nil {
-		utils.LogMessage("Could not get key. Session might went expired", "red", err)
-        http.Error(w, "Session expired or invalid: "+err.Error(), http.StatusUnauthorized)
-        return
+// bookmarkIDs returns the deduplicated IDs a request names, NewsIds or else NewsId
+func bookmarkIDs(req models.BookmarkRequest) ([]string, bool) {
+	requested := req.NewsIDs
+	if len(requested) == 0 {
+		requested = []string{req.NewsID}
+	}
+	if len(requested) > config.MaxBookmarksPerRequest {
+		return nil, false
 	}
 
-    docRef := config.FirebaseClient.Collection("users").Doc(apiKey)
+	seen := make(map[string]bool)
+	newsIDs := []string{}
+	for _, newsID := range requested {
+		if !services.ValidNewsID(newsID) {
+			return nil, false
+		}
+		if !seen[newsID] {
+			seen[newsID] = true
+			newsIDs = append(newsIDs, newsID)
+		}
+	}
+	return newsIDs, true
+}
 
-	_, err = docRef.Set(config.FirebaseCtx, map[string]interface{}{
-		"NotionCredentials": authResult,
-	})
-	if err != nil {
-		utils.LogMessage("Failed to store data in Firestore", "red", err)
+// bookmarkError answers with the status matching a bookmark error
+func bookmarkError(w http.ResponseWriter, message string, err error) {
+	var statusCode int
+	switch {
+	case errors.Is(err, services.ErrBookmarkNotFound):
+		message, statusCode = "Bookmark not found", http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidNewsID):
+		message, statusCode = "Invalid NewsId", http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidCollection):
+		message, statusCode = fmt.Sprintf("Collection names are at most %d characters", config.MaxBookmarkCollectionLength), http.StatusBadRequest
+	case errors.Is(err, services.ErrNoteTooLong):
+		message, statusCode = fmt.Sprintf("Notes are at most %d characters", config.MaxBookmarkNoteLength), http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidCursor):
+		message, statusCode = "Invalid cursor", http.StatusBadRequest
+	default:
+		utils.LogMessage(message, "red", err)
+		statusCode = http.StatusInternalServerError
 	}
+	sendResponse(w, models.BookmarkResponse{Success: false, Message: message}, statusCode)
+}
+
+func FallbackHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, "Fallback Handler")
+}
+
+func sendResponse(w http.ResponseWriter, response models.BookmarkResponse, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+    if err := json.NewEncoder(w).Encode(response); err != nil {
+        utils.LogMessage("Failed sending response", "red", err)
+    }
 }
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"actions/config"
+	"actions/models"
+	"actions/services"
+	"actions/utils"
+)
+
+/*
+Reported by the app when the user leaves an article or puts the app in the
+background, with the seconds spent on it since the previous report.
+*/
+func RecordHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendJSON(w, models.HistoryResponse{Success: false, Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.HistoryRecordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSON(w, models.HistoryResponse{Success: false, Message: "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	entry, err := services.RecordRead(r.Header.Get("X-API-Key"), req)
+	if err != nil {
+		historyError(w, "Failed to record read", err)
+		return
+	}
+
+	sendJSON(w, models.HistoryResponse{
+		Success: true,
+		Message: "Read recorded successfully",
+		Items:   []models.HistoryEntry{entry},
+	}, http.StatusOK)
+}
+
+/*
+GET lists the reading history, last read first, paginated like bookmarks with
+?limit and ?cursor. ?filter=unfinished only lists the articles not read to the
+end, for "continue reading". DELETE clears the history along with the detail
+logs kept in user-logs.
+*/
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("X-API-Key")
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		limit := config.DefaultHistoryPageSize
+		if value := query.Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				sendJSON(w, models.HistoryResponse{Success: false, Message: "Invalid limit"}, http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		unfinished := false
+		switch query.Get("filter") {
+		case "":
+		case "unfinished":
+			unfinished = true
+		default:
+			sendJSON(w, models.HistoryResponse{Success: false, Message: "Invalid filter, expected unfinished"}, http.StatusBadRequest)
+			return
+		}
+
+		entries, nextCursor, err := services.ListHistory(apiKey, unfinished, limit, query.Get("cursor"))
+		if err != nil {
+			historyError(w, "Failed to list history", err)
+			return
+		}
+
+		sendJSON(w, models.HistoryResponse{
+			Success:    true,
+			Message:    "History fetched successfully",
+			Items:      entries,
+			NextCursor: nextCursor,
+		}, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := services.ClearHistory(apiKey); err != nil {
+			historyError(w, "Failed to clear history", err)
+			return
+		}
+		sendJSON(w, models.HistoryResponse{Success: true, Message: "History cleared successfully"}, http.StatusOK)
+
+	default:
+		sendJSON(w, models.HistoryResponse{Success: false, Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+func historyError(w http.ResponseWriter, message string, err error) {
+	var statusCode int
+	switch {
+	case errors.Is(err, services.ErrInvalidNewsID):
+		message, statusCode = "Invalid NewsId", http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidDwell):
+		message, statusCode = "dwellSeconds can't be negative", http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidProgress):
+		message, statusCode = "progress must be between 0 and 1", http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidCursor):
+		message, statusCode = "Invalid cursor", http.StatusBadRequest
+	default:
+		utils.LogMessage(message, "red", err)
+		statusCode = http.StatusInternalServerError
+	}
+	sendJSON(w, models.HistoryResponse{Success: false, Message: message}, statusCode)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"actions/config"
+	"actions/integrations"
+	"actions/middleware"
+	"actions/models"
+	"actions/notion"
+	"actions/oauth"
+	"actions/services"
+	"actions/utils"
+)
+
+// Lists every integration with whether the user connected it
+func ListIntegrationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	apiKey := r.Header.Get("X-API-Key")
+	statuses := []models.IntegrationStatus{}
+	for _, integration := range integrations.All() {
+		statuses = append(statuses, integrations.Status(apiKey, integration))
+	}
+	sendJSON(w, map[string]interface{}{"integrations": statuses}, http.StatusOK)
+}
+
+/*
+IntegrationHandler serves /integrations/<name>/<action>:
+  - connect: GET the authorization URL to connect the integration
+  - callback: where the provider redirects after the user granted access
+  - disconnect: DELETE the connection, revoking the token
+  - export: POST {"NewsId": "<news-id>"} to export a bookmarked article
+
+Every action but the callback, which the provider calls without an API key,
+goes through the request middleware.
+*/
+func IntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, config.VersionPrefix+"/integrations/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	integration, err := integrations.Get(parts[0])
+	if err != nil {
+		utils.DeliverJsonError(w, "Unknown integration", http.StatusNotFound)
+		return
+	}
+
+	switch parts[1] {
+	case "callback":
+		provider := integration.OAuth()
+		if provider == nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		oauthCallback(w, r, *provider)
+	case "connect":
+		middleware.RequestMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			connectIntegration(w, r, integration)
+		})(w, r)
+	case "disconnect":
+		middleware.RequestMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			disconnectIntegration(w, r, integration)
+		})(w, r)
+	case "export":
+		middleware.RequestMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			exportToIntegration(w, r, integration)
+		})(w, r)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func connectIntegration(w http.ResponseWriter, r *http.Request, integration integrations.Integration) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider := integration.OAuth()
+	if provider == nil {
+		utils.DeliverJsonError(w, integration.DisplayName()+" is not connected with a sign in", http.StatusBadRequest)
+		return
+	}
+	oauthCreateAuthSession(w, r, *provider)
+}
+
+func disconnectIntegration(w http.ResponseWriter, r *http.Request, integration integrations.Integration) {
+	provider := integration.OAuth()
+	if provider == nil {
+		utils.DeliverJsonError(w, integration.DisplayName()+" is not connected with a sign in", http.StatusBadRequest)
+		return
+	}
+	oauthDisconnect(w, r, *provider)
+}
+
+func exportToIntegration(w http.ResponseWriter, r *http.Request, integration integrations.Integration) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	exporter, err := integrations.Exporter(integration)
+	if err != nil {
+		integrationError(w, "Export not supported", err)
+		return
+	}
+
+	var req models.BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewsID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := exporter.ExportArticle(r.Header.Get("X-API-Key"), req.NewsID)
+	if err != nil {
+		integrationError(w, "Failed to export bookmark to "+integration.DisplayName(), err)
+		return
+	}
+
+	statusCode := http.StatusCreated
+	if result.AlreadyExported {
+		statusCode = http.StatusOK
+	}
+	sendJSON(w, result, statusCode)
+}
+
+// integrationError answers with the status matching an integration error
+func integrationError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, integrations.ErrNotSupported):
+		utils.DeliverJsonError(w, "Not supported by the integration", http.StatusBadRequest)
+	case errors.Is(err, oauth.ErrNotConnected), errors.Is(err, notion.ErrUnauthorized):
+		utils.DeliverJsonError(w, "Integration is not connected, connect it again", http.StatusConflict)
+	case errors.Is(err, integrations.ErrNoNotionTarget):
+		utils.DeliverJsonError(w, "No Notion database selected", http.StatusConflict)
+	case errors.Is(err, integrations.ErrNoTitleProperty):
+		utils.DeliverJsonError(w, "The Notion database has no title property", http.StatusBadRequest)
+	case errors.Is(err, notion.ErrNotFound):
+		utils.DeliverJsonError(w, "Notion database not found, share it with the integration", http.StatusNotFound)
+	case errors.Is(err, integrations.ErrNotBookmarked):
+		utils.DeliverJsonError(w, "Article is not bookmarked", http.StatusNotFound)
+	case errors.Is(err, services.ErrArticleNotFound):
+		utils.DeliverJsonError(w, "Article is no longer available", http.StatusNotFound)
+	default:
+		utils.LogMessage(message, "red", err)
+		utils.DeliverJsonError(w, message, http.StatusBadGateway)
+	}
+}
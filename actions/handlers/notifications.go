@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"actions/config"
+	"actions/models"
+	"actions/services"
+	"actions/utils"
+)
+
+var (
+    devicePlatforms = map[string]bool{"android": true, "ios": true, "web": true}
+    countryPattern = regexp.MustCompile(`^[a-z]{2}$`)
+)
+
+// Registers the device's push token for the user, apps call it on every launch
+func RegisterDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.DeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	req.Platform = strings.ToLower(strings.TrimSpace(req.Platform))
+	if req.Token == "" || !devicePlatforms[req.Platform] {
+		http.Error(w, "A token and a platform (android, ios or web) are required", http.StatusBadRequest)
+		return
+	}
+
+	apiKey := r.Header.Get("X-API-Key")
+	if err := services.RegisterDevice(apiKey, models.Device{Token: req.Token, Platform: req.Platform}); err != nil {
+		utils.LogMessage("Failed to register device", "red", err)
+		http.Error(w, "Failed to register device", http.StatusInternalServerError)
+		return
+	}
+
+	sendMessage(w, "Device registered successfully")
+}
+
+func RemoveDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.DeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Token) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RemoveDevice(r.Header.Get("X-API-Key"), strings.TrimSpace(req.Token)); err != nil {
+		utils.LogMessage("Failed to remove device", "red", err)
+		http.Error(w, "Failed to remove device", http.StatusInternalServerError)
+		return
+	}
+
+	sendMessage(w, "Device removed successfully")
+}
+
+/*
+GET returns the user's notification settings, the defaults when never saved.
+PUT replaces them: the country must be a lowercase ISO 3166-1 alpha-2 code
+and the watchlist holds at most MaxWatchlistCompanies entries.
+*/
+func NotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("X-API-Key")
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := services.GetNotificationSettings(apiKey)
+		if err != nil {
+			utils.LogMessage("Failed to get notification settings", "red", err)
+			http.Error(w, "Failed to get notification settings", http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, settings, http.StatusOK)
+
+	case http.MethodPut:
+		var settings models.NotificationSettings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		settings, problem := normalizeNotificationSettings(settings)
+		if problem != "" {
+			http.Error(w, problem, http.StatusBadRequest)
+			return
+		}
+
+		if err := services.SaveNotificationSettings(apiKey, settings); err != nil {
+			utils.LogMessage("Failed to save notification settings", "red", err)
+			http.Error(w, "Failed to save notification settings", http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, settings, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+/*
+normalizeNotificationSettings lowercases the country and trims and
+deduplicates the watchlist, returning what is wrong with the settings if
+anything.
+*/
+func normalizeNotificationSettings(settings models.NotificationSettings) (models.NotificationSettings, string) {
+	settings.Country = strings.ToLower(strings.TrimSpace(settings.Country))
+	if !countryPattern.MatchString(settings.Country) {
+		return settings, "Invalid country, expected a two letter country code"
+	}
+
+	companies := []string{}
+	seen := make(map[string]bool)
+	for _, company := range settings.Companies {
+		company = strings.TrimSpace(company)
+		if company == "" || seen[strings.ToLower(company)] {
+			continue
+		}
+		seen[strings.ToLower(company)] = true
+		companies = append(companies, company)
+	}
+	if len(companies) > config.MaxWatchlistCompanies {
+		return settings, fmt.Sprintf("At most %d watchlist companies are allowed", config.MaxWatchlistCompanies)
+	}
+	settings.Companies = companies
+	return settings, ""
+}
+
+func sendMessage(w http.ResponseWriter, message string) {
+	sendJSON(w, map[string]string{"message": message}, http.StatusOK)
+}
+
+func sendJSON(w http.ResponseWriter, response interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		utils.LogMessage("Failed sending response", "red", err)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"actions/integrations"
+	"actions/models"
+)
+
+var notionIntegration = &integrations.Notion{}
+
+// Lists the Notion databases the user shared with the integration
+func NotionDatabasesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	databases, err := notionIntegration.Databases(r.Header.Get("X-API-Key"))
+	if err != nil {
+		integrationError(w, "Failed to list Notion databases", err)
+		return
+	}
+	sendJSON(w, map[string]interface{}{"databases": databases}, http.StatusOK)
+}
+
+/*
+GET returns the database bookmarks are exported to. PUT selects it with
+{"databaseID": "<id>", "autoSync": true|false}; with autoSync every new
+bookmark is exported as it is added.
+*/
+func NotionTargetHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("X-API-Key")
+
+	switch r.Method {
+	case http.MethodGet:
+		target, err := notionIntegration.Target(apiKey)
+		if err != nil {
+			integrationError(w, "Failed to get Notion database", err)
+			return
+		}
+		if target == nil {
+			integrationError(w, "Failed to get Notion database", integrations.ErrNoNotionTarget)
+			return
+		}
+		sendJSON(w, target, http.StatusOK)
+
+	case http.MethodPut:
+		var req models.NotionTargetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.DatabaseID) == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		// Only an ID, not a path the client could steer the request with
+		if strings.ContainsAny(req.DatabaseID, "/?#") {
+			http.Error(w, "Invalid database ID", http.StatusBadRequest)
+			return
+		}
+
+		target, err := notionIntegration.SetTarget(apiKey, req)
+		if err != nil {
+			integrationError(w, "Failed to select Notion database", err)
+			return
+		}
+		sendJSON(w, target, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Predates /integrations/notion/export, the result also carries pageID for app versions reading it
+func NotionExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportToIntegration(w, r, notionIntegration)
+}
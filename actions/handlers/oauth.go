@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"actions/models"
+	"actions/oauth"
+	"actions/utils"
+)
+
+// Deep link the result page offers to return to the app, e.g. stockic://integrations
+const OAuthAppRedirectEnv = "OAUTH_APP_REDIRECT"
+
+// Shown in the in-app browser at the end of a sign in
+var oauthResultPage = template.Must(template.New("oauth-result").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; background: #f6f7f9; color: #1d1d1f; }
+main { max-width: 24rem; padding: 2rem; text-align: center; }
+h1 { font-size: 1.4rem; color: {{if .Success}}#1b7f3b{{else}}#b3261e{{end}}; }
+a { display: inline-block; margin-top: 1rem; padding: 0.7rem 1.4rem; border-radius: 0.5rem; background: #1d1d1f; color: #fff; text-decoration: none; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .ReturnURL}}<a href="{{.ReturnURL}}">Return to Stockic</a>{{else}}<p>You can close this window.</p>{{end}}
+</main>
+</body>
+</html>
+`))
+
+type oauthResult struct {
+	Success		bool
+	Title		string
+	Message		string
+	// Set from configuration, so custom app schemes are trusted
+	ReturnURL	template.URL
+}
+
+/*
+These endpoints predate /integrations and stay for app versions and the
+redirect URI registered with Notion.
+*/
+func OauthNotionCreateAuthSession(w http.ResponseWriter, r *http.Request) {
+	oauthCreateAuthSession(w, r, *notionIntegration.OAuth())
+}
+
+func OauthNotionCallback(w http.ResponseWriter, r *http.Request) {
+	oauthCallback(w, r, *notionIntegration.OAuth())
+}
+
+func OauthNotionDisconnect(w http.ResponseWriter, r *http.Request) {
+	disconnectIntegration(w, r, notionIntegration)
+}
+
+/*
+oauthCreateAuthSession starts a sign in and returns the authorization URL for
+the in-app browser. The state in the URL is single use and tied to the
+user's API key; the callback consumes it.
+*/
+func oauthCreateAuthSession(w http.ResponseWriter, r *http.Request, provider oauth.Provider) {
+	w.Header().Set("Content-Type", "application/json")
+
+	authURL, err := oauth.Begin(r.Header.Get("X-API-Key"), provider)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, oauth.ErrNotConfigured) {
+			statusCode = http.StatusNotFound
+		}
+		utils.LogMessage("Failed to create "+provider.Name+" sign in session", "red", err)
+		w.WriteHeader(statusCode)
+		if err := json.NewEncoder(w).Encode(models.OauthResponse{Success: false, OauthURL: ""}); err != nil {
+			utils.LogMessage("Failed sending response", "red", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(models.OauthResponse{Success: true, OauthURL: authURL}); err != nil {
+		utils.LogMessage("Failed sending response", "red", err)
+	}
+}
+
+func oauthCallback(w http.ResponseWriter, r *http.Request, provider oauth.Provider) {
+	params := r.URL.Query()
+	err := oauth.Complete(provider, params.Get("state"), params.Get("code"), params.Get("error"))
+
+	switch {
+	case err == nil:
+		utils.LogMessage("Connected "+provider.Name, "green")
+		renderOAuthResult(w, provider, http.StatusOK, oauthResult{
+			Success: true,
+			Title:   provider.DisplayName + " connected",
+			Message: "You can go back to the app now.",
+		})
+	case errors.Is(err, oauth.ErrInvalidState):
+		renderOAuthResult(w, provider, http.StatusBadRequest, oauthResult{
+			Title:   "Session expired",
+			Message: "This sign in link has expired or was already used. Please start again from the app.",
+		})
+	case params.Get("error") != "":
+		renderOAuthResult(w, provider, http.StatusOK, oauthResult{
+			Title:   provider.DisplayName + " not connected",
+			Message: "Access was not granted. You can connect " + provider.DisplayName + " from the app at any time.",
+		})
+	default:
+		utils.LogMessage("Failed to complete "+provider.Name+" sign in", "red", err)
+		renderOAuthResult(w, provider, http.StatusBadGateway, oauthResult{
+			Title:   "Something went wrong",
+			Message: "We couldn't connect " + provider.DisplayName + ". Please try again from the app.",
+		})
+	}
+}
+
+func oauthDisconnect(w http.ResponseWriter, r *http.Request, provider oauth.Provider) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := oauth.Disconnect(r.Header.Get("X-API-Key"), provider); err != nil {
+		utils.LogMessage("Failed to disconnect "+provider.Name, "red", err)
+		http.Error(w, "Failed to disconnect", http.StatusInternalServerError)
+		return
+	}
+	sendMessage(w, "Disconnected successfully")
+}
+
+func renderOAuthResult(w http.ResponseWriter, provider oauth.Provider, statusCode int, result oauthResult) {
+	if appRedirect := os.Getenv(OAuthAppRedirectEnv); appRedirect != "" {
+		if returnURL, err := url.Parse(appRedirect); err == nil {
+			query := returnURL.Query()
+			query.Set("provider", provider.Name)
+			query.Set("success", strconv.FormatBool(result.Success))
+			returnURL.RawQuery = query.Encode()
+			result.ReturnURL = template.URL(returnURL.String())
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.WriteHeader(statusCode)
+	if err := oauthResultPage.Execute(w, result); err != nil {
+		utils.LogMessage("Failed to render oauth result page", "red", err)
+	}
+}
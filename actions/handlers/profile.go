@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"actions/account"
+	"actions/config"
+	"actions/models"
+	"actions/services"
+	"actions/utils"
+)
+
+// ISO 639 primary language subtags, as feed-api accepts them
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+/*
+Device-based sign up, the only endpoint without an API key. Returns 201 with
+a new API key, or 200 with the key the device was given before.
+*/
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.RegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.DeviceID) < config.MinDeviceIDLength || len(req.DeviceID) > config.MaxDeviceIDLength {
+		http.Error(w, fmt.Sprintf("The deviceId must be a random install ID of %d to %d characters", config.MinDeviceIDLength, config.MaxDeviceIDLength), http.StatusBadRequest)
+		return
+	}
+	req.Platform = strings.ToLower(strings.TrimSpace(req.Platform))
+	if !devicePlatforms[req.Platform] {
+		http.Error(w, "A platform (android, ios or web) is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Country == "" {
+		req.Country = config.DefaultCountry
+	}
+	if req.Categories == nil {
+		req.Categories = []string{}
+	}
+	update, problem := normalizeProfileUpdate(models.ProfileUpdate{Country: &req.Country, Language: &req.Language, Categories: &req.Categories})
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+	req.Country, req.Language, req.Categories = *update.Country, *update.Language, *update.Categories
+
+	clientIP := utils.GetClientIP(r)
+	allowed, retryAfter, err := account.AllowRegistration(clientIP)
+	if err != nil {
+		utils.LogMessage("Failed to rate limit sign up", "red", err)
+		http.Error(w, "Failed to register, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if !allowed {
+		utils.LogMessage(fmt.Sprintf("Sign up rate limit reached for %s", clientIP), "red")
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		http.Error(w, "Too many sign ups from this address, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	apiKey, created, err := account.Register(req)
+	if err != nil {
+		utils.LogMessage("Failed to register device", "red", err)
+		http.Error(w, "Failed to register", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := services.GetProfile(apiKey)
+	if err != nil {
+		utils.LogMessage("Failed to read profile after sign up", "red", err)
+	}
+
+	statusCode, message := http.StatusOK, "Device already registered"
+	if created {
+		statusCode, message = http.StatusCreated, "Registered successfully"
+	}
+	sendJSON(w, models.RegistrationResponse{
+		Success: true,
+		Message: message,
+		APIKey:  apiKey,
+		Profile: profile,
+	}, statusCode)
+}
+
+/*
+GET returns the user's profile. PATCH changes the fields given: country,
+language (empty to clear it), categories of interest and notification
+settings, validated like /notifications-settings. Changes are picked up by
+feed-api right away.
+*/
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey := r.Header.Get("X-API-Key")
+
+	switch r.Method {
+	case http.MethodGet:
+		profile, err := services.GetProfile(apiKey)
+		if err != nil {
+			utils.LogMessage("Failed to get profile", "red", err)
+			http.Error(w, "Failed to get profile", http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, profile, http.StatusOK)
+
+	case http.MethodPatch:
+		var update models.ProfileUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		update, problem := normalizeProfileUpdate(update)
+		if problem != "" {
+			http.Error(w, problem, http.StatusBadRequest)
+			return
+		}
+
+		profile, err := services.UpdateProfile(apiKey, update)
+		if err != nil {
+			utils.LogMessage("Failed to update profile", "red", err)
+			http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, profile, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+/*
+Deletes the account of the device that registered it, with everything held
+about the user, as /account-delete does. Answers with the audit record.
+*/
+func DeregisterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.DeregistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DeviceID == "" {
+		http.Error(w, "Invalid request body, the deviceId is required", http.StatusBadRequest)
+		return
+	}
+
+	deletion, err := account.Deregister(r.Header.Get("X-API-Key"), req.DeviceID)
+	if errors.Is(err, account.ErrDeviceMismatch) {
+		http.Error(w, "The account was not registered by this device, delete it through /account-delete", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		utils.LogMessage("Failed to deregister", "red", err)
+		http.Error(w, "Failed to deregister", http.StatusInternalServerError)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if !deletion.Complete {
+		statusCode = http.StatusAccepted
+	}
+	sendJSON(w, deletion, statusCode)
+}
+
+// normalizeProfileUpdate validates the fields given, returning what is wrong with them if anything
+func normalizeProfileUpdate(update models.ProfileUpdate) (models.ProfileUpdate, string) {
+	if update.Country != nil {
+		country := strings.ToLower(strings.TrimSpace(*update.Country))
+		if !countryPattern.MatchString(country) {
+			return update, "Invalid country, expected a two letter country code"
+		}
+		update.Country = &country
+	}
+
+	if update.Language != nil {
+		language := strings.ToLower(strings.TrimSpace(*update.Language))
+		if language != "" && !languagePattern.MatchString(language) {
+			return update, "Invalid language, expected an ISO 639-1 code"
+		}
+		update.Language = &language
+	}
+
+	if update.Categories != nil {
+		known := make(map[string]bool, len(config.InterestCategories))
+		for _, category := range config.InterestCategories {
+			known[category] = true
+		}
+
+		categories := []string{}
+		seen := make(map[string]bool)
+		for _, category := range *update.Categories {
+			category = strings.ToLower(strings.TrimSpace(category))
+			if !known[category] {
+				return update, fmt.Sprintf("Unknown category %q, expected one of %s", category, strings.Join(config.InterestCategories, ", "))
+			}
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+		update.Categories = &categories
+	}
+
+	if update.Notifications != nil {
+		settings, problem := normalizeNotificationSettings(*update.Notifications)
+		if problem != "" {
+			return update, problem
+		}
+		update.Notifications = &settings
+	}
+	return update, ""
+}
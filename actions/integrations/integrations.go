@@ -0,0 +1,127 @@
+package integrations
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+
+    "actions/models"
+    "actions/oauth"
+    "actions/utils"
+)
+
+const (
+    // The integration can export a bookmarked article
+    CapabilityExportArticle = "export-article"
+)
+
+var (
+    ErrUnknownIntegration = errors.New("unknown integration")
+    // The integration doesn't have the capability asked for
+    ErrNotSupported = errors.New("not supported by the integration")
+    ErrNotBookmarked = errors.New("article is not bookmarked")
+)
+
+/*
+Integration is a third-party service users connect their account to. Each
+declares how it is connected and what it can do; the shared /integrations
+endpoints do the rest.
+*/
+type Integration interface {
+    Name() string
+    DisplayName() string
+    // OAuth flow that connects a user, nil for integrations configured without OAuth
+    OAuth() *oauth.Provider
+    Capabilities() []string
+}
+
+// ArticleExporter is an integration with CapabilityExportArticle
+type ArticleExporter interface {
+    Integration
+    // ExportArticle exports a bookmarked article, once: exporting it again returns the first export
+    ExportArticle(apiKey, newsID string) (models.ExportResult, error)
+    // AutoExport reports whether the user wants every new bookmark exported as it is added
+    AutoExport(apiKey string) bool
+}
+
+var registry = make(map[string]Integration)
+
+// Every available integration, a new provider only has to be added here
+func init() {
+    Register(&Notion{})
+}
+
+func Register(integration Integration) {
+    registry[integration.Name()] = integration
+}
+
+func Get(name string) (Integration, error) {
+    integration, found := registry[name]
+    if !found {
+        return nil, ErrUnknownIntegration
+    }
+    return integration, nil
+}
+
+// All returns the integrations by name
+func All() []Integration {
+    integrations := make([]Integration, 0, len(registry))
+    for _, integration := range registry {
+        integrations = append(integrations, integration)
+    }
+    sort.Slice(integrations, func(i, j int) bool {
+        return integrations[i].Name() < integrations[j].Name()
+    })
+    return integrations
+}
+
+func Configured(integration Integration) bool {
+    provider := integration.OAuth()
+    return provider == nil || provider.Configured()
+}
+
+// Status describes an integration and whether the user connected it
+func Status(apiKey string, integration Integration) models.IntegrationStatus {
+    status := models.IntegrationStatus{
+        Name:         integration.Name(),
+        DisplayName:  integration.DisplayName(),
+        Capabilities: integration.Capabilities(),
+        Configured:   Configured(integration),
+    }
+
+    if provider := integration.OAuth(); provider != nil {
+        connection, err := oauth.Connection(apiKey, *provider)
+        if err == nil {
+            status.Connected = true
+            status.Account = connection.Account
+            if !connection.ConnectedAt.IsZero() {
+                status.ConnectedAt = &connection.ConnectedAt
+            }
+        } else if err != oauth.ErrNotConnected {
+            utils.LogMessage(fmt.Sprintf("Failed to read %s connection", integration.Name()), "red", err)
+        }
+    }
+    return status
+}
+
+func Exporter(integration Integration) (ArticleExporter, error) {
+    exporter, supported := integration.(ArticleExporter)
+    if !supported {
+        return nil, ErrNotSupported
+    }
+    return exporter, nil
+}
+
+// AutoExport exports a new bookmark to every integration the user turned auto-export on for
+func AutoExport(apiKey, newsID string) {
+    for _, integration := range All() {
+        exporter, err := Exporter(integration)
+        if err != nil || !exporter.AutoExport(apiKey) {
+            continue
+        }
+
+        if _, err := exporter.ExportArticle(apiKey, newsID); err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to auto-export bookmark %s to %s", newsID, integration.Name()), "red", err)
+        }
+    }
+}
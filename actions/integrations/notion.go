@@ -0,0 +1,205 @@
+package integrations
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "time"
+
+    "actions/config"
+    "actions/models"
+    "actions/notion"
+    "actions/oauth"
+    "actions/services"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+)
+
+var (
+    ErrNoNotionTarget = errors.New("no notion database selected")
+    ErrNoTitleProperty = errors.New("notion database has no title property")
+)
+
+// Replaced by a client for a stub server in tests
+var NotionClient notion.Client = notion.NewClient()
+
+// Notion exports bookmarked articles as pages of a database the user picks
+type Notion struct{}
+
+func (*Notion) Name() string {
+    return "notion"
+}
+
+func (*Notion) DisplayName() string {
+    return "Notion"
+}
+
+func (*Notion) Capabilities() []string {
+    return []string{CapabilityExportArticle}
+}
+
+/*
+OAuth reads NOTION_CLIENT_ID, NOTION_CLIENT_SECRET and NOTION_REDIRECT_URI.
+NOTION_OAUTH_URL, the authorization URL copied from the integration settings,
+may already carry the client ID and redirect URI; the rest is added. Notion
+takes JSON token requests and doesn't support PKCE or scopes.
+*/
+func (*Notion) OAuth() *oauth.Provider {
+    return &oauth.Provider{
+        Name:         "notion",
+        DisplayName:  "Notion",
+        AuthURL:      envOr("NOTION_OAUTH_URL", "https://api.notion.com/v1/oauth/authorize"),
+        TokenURL:     envOr("NOTION_TOKEN_URL", "https://api.notion.com/v1/oauth/token"),
+        RevokeURL:    envOr("NOTION_REVOKE_URL", "https://api.notion.com/v1/oauth/revoke"),
+        ClientID:     os.Getenv("NOTION_CLIENT_ID"),
+        ClientSecret: os.Getenv("NOTION_CLIENT_SECRET"),
+        RedirectURI:  os.Getenv("NOTION_REDIRECT_URI"),
+        AuthParams:   map[string]string{"owner": "user"},
+        JSONRequests: true,
+        Headers:      map[string]string{"Notion-Version": notion.APIVersion},
+        LegacyField:  config.LegacyNotionCredentialsField,
+    }
+}
+
+func (integration *Notion) token(apiKey string) (string, error) {
+    return oauth.AccessToken(apiKey, *integration.OAuth())
+}
+
+// notionUser is what the export reads from the user document
+type notionUser struct {
+    Target      *models.NotionTarget            `firestore:"notionTarget"`
+    Exports     map[string]models.NotionExport  `firestore:"notionExports"`
+}
+
+func getNotionUser(apiKey string) (notionUser, error) {
+    var user notionUser
+    doc, err := config.FirebaseClient.Collection("users").Doc(apiKey).Get(config.FirebaseCtx)
+    if err != nil {
+        return user, err
+    }
+    if err := doc.DataTo(&user); err != nil {
+        return user, err
+    }
+    return user, nil
+}
+
+// Databases returns the databases the user shared with the integration
+func (integration *Notion) Databases(apiKey string) ([]notion.Database, error) {
+    token, err := integration.token(apiKey)
+    if err != nil {
+        return nil, err
+    }
+    return NotionClient.SearchDatabases(token)
+}
+
+// Target returns the selected database, nil when none was selected
+func (integration *Notion) Target(apiKey string) (*models.NotionTarget, error) {
+    user, err := getNotionUser(apiKey)
+    if err != nil {
+        return nil, err
+    }
+    return user.Target, nil
+}
+
+// SetTarget selects the database bookmarks are exported to, after checking the integration can write to it
+func (integration *Notion) SetTarget(apiKey string, request models.NotionTargetRequest) (models.NotionTarget, error) {
+    token, err := integration.token(apiKey)
+    if err != nil {
+        return models.NotionTarget{}, err
+    }
+
+    database, err := NotionClient.GetDatabase(token, request.DatabaseID)
+    if err != nil {
+        return models.NotionTarget{}, err
+    }
+    hasTitle := false
+    for _, propertyType := range database.Properties {
+        hasTitle = hasTitle || propertyType == "title"
+    }
+    if !hasTitle {
+        return models.NotionTarget{}, ErrNoTitleProperty
+    }
+
+    target := models.NotionTarget{
+        DatabaseID:    database.ID,
+        DatabaseTitle: database.Title,
+        AutoSync:      request.AutoSync,
+        UpdatedAt:     time.Now().UTC(),
+    }
+    _, err = config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, []firestore.Update{
+        {Path: config.NotionTargetField, Value: target},
+    })
+    return target, err
+}
+
+func (integration *Notion) AutoExport(apiKey string) bool {
+    target, err := integration.Target(apiKey)
+    return err == nil && target != nil && target.AutoSync
+}
+
+// ExportArticle creates a page for a bookmarked article in the user's Notion database
+func (integration *Notion) ExportArticle(apiKey, newsID string) (models.ExportResult, error) {
+    result := models.ExportResult{Integration: integration.Name(), NewsID: newsID}
+
+    bookmark, err := services.GetBookmark(apiKey, newsID)
+    if err != nil {
+        if errors.Is(err, services.ErrBookmarkNotFound) {
+            return result, ErrNotBookmarked
+        }
+        return result, err
+    }
+    user, err := getNotionUser(apiKey)
+    if err != nil {
+        return result, err
+    }
+    if export, found := user.Exports[newsID]; found {
+        result.ID, result.PageID, result.URL, result.AlreadyExported = export.PageID, export.PageID, export.URL, true
+        return result, nil
+    }
+    if user.Target == nil {
+        return result, ErrNoNotionTarget
+    }
+    token, err := integration.token(apiKey)
+    if err != nil {
+        return result, err
+    }
+
+    // Bookmarks outlive the feeds, an article no longer served is exported as it was bookmarked
+    article, err := services.FindArticle(newsID)
+    if errors.Is(err, services.ErrArticleNotFound) && bookmark.Article != nil {
+        article, err = services.FromSnapshot(*bookmark.Article), nil
+    }
+    if err != nil {
+        return result, err
+    }
+    // The schema is read on every export, properties may have been renamed since the database was selected
+    database, err := NotionClient.GetDatabase(token, user.Target.DatabaseID)
+    if err != nil {
+        return result, err
+    }
+
+    page, err := NotionClient.CreatePage(token, notion.BuildPage(database, article))
+    if err != nil {
+        return result, err
+    }
+
+    export := models.NotionExport{PageID: page.ID, URL: page.URL, ExportedAt: time.Now().UTC()}
+    _, err = config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, []firestore.Update{
+        {FieldPath: firestore.FieldPath{config.NotionExportsField, newsID}, Value: export},
+    })
+    if err != nil {
+        // The page exists, only a later export would duplicate it
+        utils.LogMessage(fmt.Sprintf("Failed to record Notion export of %s", newsID), "red", err)
+    }
+
+    result.ID, result.PageID, result.URL = page.ID, page.ID, page.URL
+    return result, nil
+}
+
+func envOr(name, fallback string) string {
+    if value := os.Getenv(name); value != "" {
+        return value
+    }
+    return fallback
+}
@@ -10,6 +10,7 @@ import (
 	"actions/services"
     "actions/middleware"
     "actions/handlers"
+    "actions/notify"
 )
 
 // Firebase is gonna be used since it's user specific data
@@ -20,6 +21,7 @@ func init() {
 
 func main() {   
     go services.PushAppLogToMinIO()
+    go notify.Run()
 
     setupRoutes()
 
@@ -35,7 +37,26 @@ func setupRoutes() {
     http.HandleFunc(config.VersionPrefix + "/bookmarks-add", middleware.RequestMiddleware(handlers.AddBookmarksHandlers))
     http.HandleFunc(config.VersionPrefix + "/bookmarks-remove", middleware.RequestMiddleware(handlers.RemoveBookmarks))
     http.HandleFunc(config.VersionPrefix + "/bookmarks-list", middleware.RequestMiddleware(handlers.ListBookmarks))
+    http.HandleFunc(config.VersionPrefix + "/bookmarks-update", middleware.RequestMiddleware(handlers.UpdateBookmarksHandler))
+    http.HandleFunc(config.VersionPrefix + "/bookmarks-collections", middleware.RequestMiddleware(handlers.BookmarkCollectionsHandler))
     http.HandleFunc(config.VersionPrefix + "/notion/oauth/auth-session", middleware.RequestMiddleware(handlers.OauthNotionCreateAuthSession))
     http.HandleFunc(config.VersionPrefix + "/notion/oauth/callback", handlers.OauthNotionCallback)
+    http.HandleFunc(config.VersionPrefix + "/notion/oauth/disconnect", middleware.RequestMiddleware(handlers.OauthNotionDisconnect))
+    http.HandleFunc(config.VersionPrefix + "/integrations", middleware.RequestMiddleware(handlers.ListIntegrationsHandler))
+    http.HandleFunc(config.VersionPrefix + "/integrations/", handlers.IntegrationHandler)
+    http.HandleFunc(config.VersionPrefix + "/notion/databases", middleware.RequestMiddleware(handlers.NotionDatabasesHandler))
+    http.HandleFunc(config.VersionPrefix + "/notion/target", middleware.RequestMiddleware(handlers.NotionTargetHandler))
+    http.HandleFunc(config.VersionPrefix + "/notion/export", middleware.RequestMiddleware(handlers.NotionExportHandler))
+    http.HandleFunc(config.VersionPrefix + "/devices-register", middleware.RequestMiddleware(handlers.RegisterDeviceHandler))
+    http.HandleFunc(config.VersionPrefix + "/devices-remove", middleware.RequestMiddleware(handlers.RemoveDeviceHandler))
+    http.HandleFunc(config.VersionPrefix + "/notifications-settings", middleware.RequestMiddleware(handlers.NotificationSettingsHandler))
+    http.HandleFunc(config.VersionPrefix + "/history-record", middleware.RequestMiddleware(handlers.RecordHistoryHandler))
+    http.HandleFunc(config.VersionPrefix + "/history", middleware.RequestMiddleware(handlers.HistoryHandler))
+    http.HandleFunc(config.VersionPrefix + "/register", handlers.RegisterHandler)
+    http.HandleFunc(config.VersionPrefix + "/deregister", middleware.RequestMiddleware(handlers.DeregisterHandler))
+    http.HandleFunc(config.VersionPrefix + "/profile", middleware.RequestMiddleware(handlers.ProfileHandler))
+    http.HandleFunc(config.VersionPrefix + "/account-export", middleware.RequestMiddleware(handlers.AccountExportHandler))
+    http.HandleFunc(config.VersionPrefix + "/account-delete-request", middleware.RequestMiddleware(handlers.AccountDeleteRequestHandler))
+    http.HandleFunc(config.VersionPrefix + "/account-delete", middleware.RequestMiddleware(handlers.AccountDeleteHandler))
     http.HandleFunc("/", handlers.FallbackHandler)
 }
@@ -1,5 +1,9 @@
 package models
 
+import (
+    "time"
+)
+
 type Greet struct {
     Response    string  `json:"response"`
 }
@@ -10,16 +14,341 @@ type UserStatus struct {
 }
 
 type BookmarkRequest struct {
-    NewsID string `json:"NewsId"`
+    NewsID      string      `json:"NewsId"`
+    // Bulk updates and removals, in place of NewsId
+    NewsIDs     []string    `json:"NewsIds,omitempty"`
+    // Left unchanged when absent
+    Collection  *string     `json:"collection,omitempty"`
+    Note        *string     `json:"note,omitempty"`
 }
 
 type BookmarkResponse struct {
-    Success   bool     `json:"success"`
-    Message   string   `json:"message"`
-    Bookmarks []string `json:"bookmarks,omitempty"`
+    Success     bool        `json:"success"`
+    Message     string      `json:"message"`
+    // IDs of the listed bookmarks, for clients predating items. Every ID when no limit or cursor was given
+    Bookmarks   []string    `json:"bookmarks,omitempty"`
+    Items       []Bookmark  `json:"items,omitempty"`
+    NextCursor  string      `json:"nextCursor,omitempty"`
+}
+
+// Stored in users/<X-API-Key>/bookmarks/<NewsId>
+type Bookmark struct {
+    NewsID      string              `json:"NewsId" firestore:"newsID"`
+    Collection  string              `json:"collection" firestore:"collection"`
+    Note        string              `json:"note" firestore:"note"`
+    CreatedAt   time.Time           `json:"createdAt" firestore:"createdAt"`
+    UpdatedAt   time.Time           `json:"updatedAt" firestore:"updatedAt"`
+    // The article when it was bookmarked, curated articles expire from the feeds. Nil when it wasn't available.
+    Article     *ArticleSnapshot    `json:"article" firestore:"article"`
+}
+
+/*
+ArticleSnapshot is the part of a curated article a bookmark keeps. Firestore
+has no nested arrays, so highlights are stored as start and end pairs.
+*/
+type ArticleSnapshot struct {
+    StockicID           string          `json:"stockicID" firestore:"stockicID"`
+    Source              string          `json:"source" firestore:"source"`
+    Author              string          `json:"author" firestore:"author"`
+    Title               string          `json:"title" firestore:"title"`
+    URL                 string          `json:"url" firestore:"url"`
+    URLToImage          string          `json:"urlToImage" firestore:"urlToImage"`
+    PublishedAt         string          `json:"publishedAt" firestore:"publishedAt"`
+    SummarizedContent   string          `json:"content" firestore:"content"`
+    CompaniesTags       []string        `json:"companyTags" firestore:"companyTags"`
+    Highlights          []Highlight     `json:"highlights" firestore:"highlights"`
+    HighlightsUnit      string          `json:"highlightsUnit" firestore:"highlightsUnit"`
+    Sentiment           string          `json:"sentiment,omitempty" firestore:"sentiment,omitempty"`
+    StoryID             string          `json:"storyID,omitempty" firestore:"storyID,omitempty"`
+}
+
+type Highlight struct {
+    Start   int `json:"start" firestore:"start"`
+    End     int `json:"end" firestore:"end"`
+}
+
+type BookmarkCollection struct {
+    Name    string  `json:"name"`
+    Count   int     `json:"count"`
+}
+
+// Reported by the app when the user leaves an article
+type HistoryRecordRequest struct {
+    NewsID          string      `json:"NewsId"`
+    // Seconds spent on the article since the last report
+    DwellSeconds    int64       `json:"dwellSeconds"`
+    // How far the user scrolled, 0 to 1. Left unchanged when absent.
+    Progress        *float64    `json:"progress,omitempty"`
+}
+
+type HistoryResponse struct {
+    Success     bool            `json:"success"`
+    Message     string          `json:"message"`
+    Items       []HistoryEntry  `json:"items,omitempty"`
+    NextCursor  string          `json:"nextCursor,omitempty"`
+}
+
+// Stored in users/<X-API-Key>/history/<NewsId>, feed-api creates it on the first detail view
+type HistoryEntry struct {
+    NewsID          string      `json:"NewsId" firestore:"newsID"`
+    Title           string      `json:"title" firestore:"title"`
+    Source          string      `json:"source" firestore:"source"`
+    URLToImage      string      `json:"urlToImage" firestore:"urlToImage"`
+    FirstReadAt     time.Time   `json:"firstReadAt" firestore:"firstReadAt"`
+    LastReadAt      time.Time   `json:"lastReadAt" firestore:"lastReadAt"`
+    Views           int64       `json:"views" firestore:"views"`
+    DwellSeconds    int64       `json:"dwellSeconds" firestore:"dwellSeconds"`
+    Progress        float64     `json:"progress" firestore:"progress"`
+    Finished        bool        `json:"finished" firestore:"finished"`
+}
+
+// Device-based sign up, the app's install ID stands for the device
+type RegistrationRequest struct {
+    // Random ID the app generates on install and keeps private, signing up again with it returns the same API key
+    DeviceID    string      `json:"deviceId"`
+    // android, ios or web
+    Platform    string      `json:"platform"`
+    Country     string      `json:"country,omitempty"`
+    Language    string      `json:"language,omitempty"`
+    Categories  []string    `json:"categories,omitempty"`
 }
 
-type OauthNotionResponse struct {
+type RegistrationResponse struct {
+    Success     bool        `json:"success"`
+    Message     string      `json:"message"`
+    APIKey      string      `json:"apiKey"`
+    Profile     Profile     `json:"profile"`
+}
+
+// Stored in device-registrations/<sha256 of the device ID>, so a device signing up again gets its API key back
+type DeviceRegistration struct {
+    APIKey      string      `firestore:"apiKey"`
+    Platform    string      `firestore:"platform"`
+    CreatedAt   time.Time   `firestore:"createdAt"`
+}
+
+type DeregistrationRequest struct {
+    // The install ID the account was registered with
+    DeviceID    string      `json:"deviceId"`
+}
+
+// What the user document holds about the user, as /profile serves it
+type Profile struct {
+    CreatedAt       *time.Time              `json:"createdAt,omitempty"`
+    Premium         bool                    `json:"premium"`
+    // ISO 3166-1 alpha-2, lowercase
+    Country         string                  `json:"country"`
+    // Preferred feed language (ISO 639-1), feed-api serves articles in it
+    Language        string                  `json:"language"`
+    // Discover categories the user is interested in
+    Categories      []string                `json:"categories"`
+    Notifications   NotificationSettings    `json:"notifications"`
+}
+
+// Fields left out are unchanged, an empty language clears it
+type ProfileUpdate struct {
+    Country         *string                 `json:"country,omitempty"`
+    Language        *string                 `json:"language,omitempty"`
+    Categories      *[]string               `json:"categories,omitempty"`
+    Notifications   *NotificationSettings   `json:"notifications,omitempty"`
+}
+
+type AccountDeletionRequest struct {
+    // Token returned by /account-delete-request
+    Confirmation    string  `json:"confirmation"`
+}
+
+type AccountDeletionConfirmation struct {
+    Success         bool        `json:"success"`
+    Message         string      `json:"message"`
+    Confirmation    string      `json:"confirmation"`
+    ExpiresAt       time.Time   `json:"expiresAt"`
+}
+
+// What an account deletion removed from one store, verified by a second pass finding nothing left
+type DeletionStep struct {
+    Store       string  `json:"store" firestore:"store"`
+    Deleted     int     `json:"deleted" firestore:"deleted"`
+    Verified    bool    `json:"verified" firestore:"verified"`
+    Error       string  `json:"error,omitempty" firestore:"error,omitempty"`
+}
+
+// Audit record of an account deletion in account-deletions/<ID>, it doesn't keep the API key
+type AccountDeletion struct {
+    ID          string          `json:"id" firestore:"-"`
+    // user-request (confirmed /account-delete) or deregistration
+    Reason      string          `json:"reason" firestore:"reason"`
+    // sha256 of the API key, hex encoded
+    Subject     string          `json:"subject" firestore:"subject"`
+    RequestedAt time.Time       `json:"requestedAt" firestore:"requestedAt"`
+    CompletedAt time.Time       `json:"completedAt" firestore:"completedAt"`
+    // Every step verified
+    Complete    bool            `json:"complete" firestore:"complete"`
+    Steps       []DeletionStep  `json:"steps" firestore:"steps"`
+    // Set by the second run that catches data written while deleting
+    RecheckedAt *time.Time      `json:"recheckedAt,omitempty" firestore:"recheckedAt,omitempty"`
+}
+
+// Authorization URL to open in the in-app browser to connect an integration
+type OauthResponse struct {
     Success   bool    `json:"success"`
     OauthURL  string  `json:"OauthURL"`
 }
+
+type DeviceRequest struct {
+    Token       string  `json:"token"`
+    // android, ios or web
+    Platform    string  `json:"platform"`
+}
+
+type Device struct {
+    Token       string      `json:"token" firestore:"token"`
+    Platform    string      `json:"platform" firestore:"platform"`
+    UpdatedAt   time.Time   `json:"updatedAt" firestore:"updatedAt"`
+}
+
+/*
+NotificationSettings are stored in the user document under "notifications".
+Users who never saved settings get DefaultNotificationSettings.
+*/
+type NotificationSettings struct {
+    Enabled     bool        `json:"enabled" firestore:"enabled"`
+    // Widely covered headlines in the user's country
+    Breaking    bool        `json:"breaking" firestore:"breaking"`
+    // Articles mentioning a company of the watchlist
+    Watchlist   bool        `json:"watchlist" firestore:"watchlist"`
+    // Articles with strongly positive or negative market sentiment
+    HighImpact  bool        `json:"highImpact" firestore:"highImpact"`
+    // Headlines country (ISO 3166-1 alpha-2, lowercase)
+    Country     string      `json:"country" firestore:"country"`
+    // Company names or tickers
+    Companies   []string    `json:"companies" firestore:"companies"`
+}
+
+func DefaultNotificationSettings() NotificationSettings {
+    return NotificationSettings{
+        Enabled:    true,
+        Breaking:   true,
+        Watchlist:  true,
+        HighImpact: true,
+        Country:    "us",
+        Companies:  []string{},
+    }
+}
+
+type Notification struct {
+    Title       string  `json:"title"`
+    Body        string  `json:"body"`
+    // Rule that matched: breaking, watchlist or high-impact
+    Rule        string  `json:"rule"`
+    StockicID   string  `json:"stockicID"`
+    StoryID     string  `json:"storyID,omitempty"`
+}
+
+// Fields of a curated article used by notifications and exports, as stored by the curator
+type FeedArticle struct {
+    StockicID           string          `json:"stockicID"`
+    Source              string          `json:"source"`
+    Author              string          `json:"author"`
+    Title               string          `json:"title"`
+    URL                 string          `json:"url"`
+    URLToImage          string          `json:"urlToImage"`
+    PublishedAt         string          `json:"publishedAt"`
+    SummarizedContent   string          `json:"content"`
+    CompaniesTags       []string        `json:"companyTags"`
+    // [start, end) ranges of the content in HighlightsUnit (utf16 or runes)
+    NewsHighlights      [][]int         `json:"highlightsIndex"`
+    HighlightsUnit      string          `json:"highlightsUnit"`
+    TrustScore          float64         `json:"trustScore"`
+    Sentiment           string          `json:"sentiment"`
+    SentimentScore      float64         `json:"sentimentScore"`
+    SentimentConfidence float64         `json:"sentimentConfidence"`
+    CompanyImpact       []CompanyImpact `json:"companyImpact"`
+    PriceChange         *PriceChange    `json:"priceChange,omitempty"`
+    StoryID             string          `json:"storyID,omitempty"`
+    StorySize           int             `json:"storySize,omitempty"`
+}
+
+type CompanyImpact struct {
+    Company     string  `json:"company"`
+    Impact      string  `json:"impact"`
+    Confidence  float64 `json:"confidence"`
+}
+
+type PriceChange struct {
+    Symbol          string  `json:"symbol"`
+    Name            string  `json:"name,omitempty"`
+    ChangePercent   float64 `json:"changePercent"`
+}
+
+type FeedResponse struct {
+    Articles    []FeedArticle   `json:"articles"`
+}
+
+// Moderation override written by feed-api, only what changes how an article is served
+type ArticleOverride struct {
+    Hidden              bool        `json:"hidden"`
+    Title               *string     `json:"title,omitempty"`
+    SummarizedContent   *string     `json:"content,omitempty"`
+    CompaniesTags       []string    `json:"companyTags,omitempty"`
+}
+
+// Notion database bookmarks are exported to, stored in the user document under "notionTarget"
+type NotionTarget struct {
+    DatabaseID      string      `json:"databaseID" firestore:"databaseID"`
+    DatabaseTitle   string      `json:"databaseTitle" firestore:"databaseTitle"`
+    // Export every new bookmark
+    AutoSync        bool        `json:"autoSync" firestore:"autoSync"`
+    UpdatedAt       time.Time   `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type NotionTargetRequest struct {
+    DatabaseID  string  `json:"databaseID"`
+    AutoSync    bool    `json:"autoSync"`
+}
+
+// Page created for a bookmark, stored in the user document under "notionExports.<NewsId>"
+type NotionExport struct {
+    PageID      string      `json:"pageID" firestore:"pageID"`
+    URL         string      `json:"url" firestore:"url"`
+    ExportedAt  time.Time   `json:"exportedAt" firestore:"exportedAt"`
+}
+
+// An article exported to an integration
+type ExportResult struct {
+    Integration     string  `json:"integration"`
+    NewsID          string  `json:"NewsId"`
+    // ID and link of what was created, a Notion page for Notion
+    ID              string  `json:"id"`
+    // Same as ID for Notion, kept for app versions reading the former Notion export response
+    PageID          string  `json:"pageID,omitempty"`
+    URL             string  `json:"url"`
+    AlreadyExported bool    `json:"alreadyExported"`
+}
+
+/*
+OAuthConnection is a user's connection to a provider, stored in the user
+document under "integrations.<provider>". Tokens are sealed with AES-GCM and
+never leave the service.
+*/
+type OAuthConnection struct {
+    Tokens      string                  `json:"-" firestore:"tokens"`
+    TokenType   string                  `json:"tokenType" firestore:"tokenType"`
+    // Zero when the access token doesn't expire
+    ExpiresAt   time.Time               `json:"expiresAt" firestore:"expiresAt"`
+    // Non-secret details of the connected account, such as Notion's workspace
+    Account     map[string]interface{}  `json:"account" firestore:"account"`
+    ConnectedAt time.Time               `json:"connectedAt" firestore:"connectedAt"`
+    UpdatedAt   time.Time               `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type IntegrationStatus struct {
+    Name            string                  `json:"name"`
+    DisplayName     string                  `json:"displayName"`
+    Capabilities    []string                `json:"capabilities"`
+    // Set up on this server, a user can connect it
+    Configured      bool                    `json:"configured"`
+    Connected       bool                    `json:"connected"`
+    Account         map[string]interface{}  `json:"account,omitempty"`
+    ConnectedAt     *time.Time              `json:"connectedAt,omitempty"`
+}
@@ -0,0 +1,195 @@
+package notify
+
+import (
+    "bytes"
+    "crypto/ecdsa"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "math/big"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+
+    "actions/models"
+)
+
+const (
+    APNsKeyFileEnv = "APNS_KEY_FILE"
+    APNsKeyIDEnv = "APNS_KEY_ID"
+    APNsTeamIDEnv = "APNS_TEAM_ID"
+    // App bundle ID
+    APNsTopicEnv = "APNS_TOPIC"
+    // "sandbox" for development builds, production otherwise
+    APNsEnvironmentEnv = "APNS_ENVIRONMENT"
+
+    apnsProductionHost = "https://api.push.apple.com"
+    apnsSandboxHost = "https://api.sandbox.push.apple.com"
+
+    // APNs rejects provider tokens older than an hour and throttles refreshes more often than every 20 minutes
+    apnsTokenLifetime = 50 * time.Minute
+    // apns-collapse-id is limited to 64 bytes
+    apnsMaxCollapseID = 64
+)
+
+/*
+APNsSender delivers to iOS devices registered with native APNs tokens,
+authenticating with a token-based (.p8) provider key. Go's HTTP client
+negotiates the HTTP/2 APNs requires.
+*/
+type APNsSender struct {
+    client  *http.Client
+    host    string
+    topic   string
+    keyID   string
+    teamID  string
+    key     *ecdsa.PrivateKey
+
+    mutex       sync.Mutex
+    token       string
+    issuedAt    time.Time
+}
+
+type apnsPayload struct {
+    APS struct {
+        Alert struct {
+            Title   string  `json:"title"`
+            Body    string  `json:"body"`
+        } `json:"alert"`
+        Sound   string  `json:"sound"`
+    } `json:"aps"`
+    Data    map[string]string `json:"data"`
+}
+
+func NewAPNsSender() (*APNsSender, error) {
+    sender := &APNsSender{
+        client: &http.Client{Timeout: 10 * time.Second},
+        host:   apnsProductionHost,
+        topic:  os.Getenv(APNsTopicEnv),
+        keyID:  os.Getenv(APNsKeyIDEnv),
+        teamID: os.Getenv(APNsTeamIDEnv),
+    }
+    if os.Getenv(APNsEnvironmentEnv) == "sandbox" {
+        sender.host = apnsSandboxHost
+    }
+    if sender.topic == "" || sender.keyID == "" || sender.teamID == "" {
+        return nil, fmt.Errorf("%s, %s and %s are required for APNs", APNsTopicEnv, APNsKeyIDEnv, APNsTeamIDEnv)
+    }
+
+    keyPEM, err := os.ReadFile(os.Getenv(APNsKeyFileEnv))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read APNs key: %w", err)
+    }
+    block, _ := pem.Decode(keyPEM)
+    if block == nil {
+        return nil, fmt.Errorf("APNs key is not PEM encoded")
+    }
+    parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse APNs key: %w", err)
+    }
+    key, ok := parsedKey.(*ecdsa.PrivateKey)
+    if !ok {
+        return nil, fmt.Errorf("APNs key is not an ECDSA key")
+    }
+    sender.key = key
+
+    return sender, nil
+}
+
+func (sender *APNsSender) Name() string {
+    return "apns"
+}
+
+func (sender *APNsSender) Send(device models.Device, notification models.Notification) error {
+    var payload apnsPayload
+    payload.APS.Alert.Title = notification.Title
+    payload.APS.Alert.Body = notification.Body
+    payload.APS.Sound = "default"
+    payload.Data = notificationData(notification)
+
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    bearer, err := sender.providerToken()
+    if err != nil {
+        return err
+    }
+
+    request, err := http.NewRequest(http.MethodPost, sender.host+"/3/device/"+device.Token, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Authorization", "bearer "+bearer)
+    request.Header.Set("apns-topic", sender.topic)
+    request.Header.Set("apns-push-type", "alert")
+    request.Header.Set("apns-priority", "10")
+    collapseID := notification.StoryID
+    if collapseID == "" {
+        collapseID = notification.StockicID
+    }
+    if len(collapseID) <= apnsMaxCollapseID {
+        request.Header.Set("apns-collapse-id", collapseID)
+    }
+
+    response, err := sender.client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode == http.StatusOK {
+        return nil
+    }
+
+    var failure struct {
+        Reason  string  `json:"reason"`
+    }
+    json.NewDecoder(response.Body).Decode(&failure)
+
+    // 410: the app was uninstalled, BadDeviceToken: wrong environment or garbage token
+    if response.StatusCode == http.StatusGone || failure.Reason == "BadDeviceToken" || failure.Reason == "Unregistered" {
+        return ErrInvalidToken
+    }
+    return fmt.Errorf("APNs returned %d: %s", response.StatusCode, failure.Reason)
+}
+
+// providerToken returns the ES256 JWT APNs authenticates the provider with, reused until it nears expiry
+func (sender *APNsSender) providerToken() (string, error) {
+    sender.mutex.Lock()
+    defer sender.mutex.Unlock()
+
+    if sender.token != "" && time.Since(sender.issuedAt) < apnsTokenLifetime {
+        return sender.token, nil
+    }
+
+    issuedAt := time.Now()
+    header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": sender.keyID})
+    claims, _ := json.Marshal(map[string]interface{}{"iss": sender.teamID, "iat": issuedAt.Unix()})
+    signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+    digest := sha256.Sum256([]byte(signingInput))
+    r, s, err := ecdsa.Sign(rand.Reader, sender.key, digest[:])
+    if err != nil {
+        return "", fmt.Errorf("failed to sign APNs token: %w", err)
+    }
+
+    // JWS wants r and s as fixed-size big-endian integers, not ASN.1
+    signature := append(fixedBytes(r, 32), fixedBytes(s, 32)...)
+    sender.token = signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+    sender.issuedAt = issuedAt
+
+    return sender.token, nil
+}
+
+func fixedBytes(value *big.Int, size int) []byte {
+    buffer := make([]byte, size)
+    return value.FillBytes(buffer)
+}
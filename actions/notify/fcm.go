@@ -0,0 +1,68 @@
+package notify
+
+import (
+    "fmt"
+
+    "actions/config"
+    "actions/models"
+
+    "firebase.google.com/go/messaging"
+)
+
+// FCMSender delivers through Firebase Cloud Messaging with the service account Firestore uses
+type FCMSender struct {
+    client  *messaging.Client
+}
+
+func NewFCMSender() (*FCMSender, error) {
+    if config.FirebaseApp == nil {
+        return nil, fmt.Errorf("firebase app is not initialized")
+    }
+
+    client, err := config.FirebaseApp.Messaging(config.FirebaseCtx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create FCM client: %w", err)
+    }
+    return &FCMSender{client: client}, nil
+}
+
+func (sender *FCMSender) Name() string {
+    return "fcm"
+}
+
+func (sender *FCMSender) Send(device models.Device, notification models.Notification) error {
+    collapseKey := notification.StoryID
+    if collapseKey == "" {
+        collapseKey = notification.StockicID
+    }
+
+    _, err := sender.client.Send(config.FirebaseCtx, &messaging.Message{
+        Token: device.Token,
+        Notification: &messaging.Notification{
+            Title: notification.Title,
+            Body:  notification.Body,
+        },
+        Data: notificationData(notification),
+        Android: &messaging.AndroidConfig{
+            // A later notification about the same story replaces the earlier one on the device
+            CollapseKey: collapseKey,
+            Priority:    "high",
+        },
+    })
+    if messaging.IsRegistrationTokenNotRegistered(err) {
+        return ErrInvalidToken
+    }
+    return err
+}
+
+// Data the app uses to open the article when the notification is tapped
+func notificationData(notification models.Notification) map[string]string {
+    data := map[string]string{
+        "rule":      notification.Rule,
+        "stockicID": notification.StockicID,
+    }
+    if notification.StoryID != "" {
+        data["storyID"] = notification.StoryID
+    }
+    return data
+}
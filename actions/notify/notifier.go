@@ -0,0 +1,525 @@
+package notify
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "actions/config"
+    "actions/database"
+    "actions/models"
+    "actions/services"
+    "actions/utils"
+
+    "github.com/go-redis/redis/v8"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+const (
+    MaxPerHourEnv = "NOTIFY_MAX_PER_HOUR"
+    MaxPerDayEnv = "NOTIFY_MAX_PER_DAY"
+
+    DefaultMaxPerHour = 3
+    DefaultMaxPerDay = 10
+
+    // An article is evaluated once, the first time a promoted version serves it
+    seenArticleTTL = 7 * 24 * time.Hour
+    // A story notified to a user isn't notified again while it keeps growing
+    sentTTL = 48 * time.Hour
+    // Set after the first run, which only records the articles already served
+    initializedKey = "notify:initialized"
+    // Hash of the notifications that failed for a user, evaluated again with the next version
+    retryKey = "notify:retry"
+    // Feed versions a failed notification is retried with before it's dropped
+    maxRetries = 3
+)
+
+// Feeds searched for new articles, headlines first so breaking news is matched against its country
+var notifiedFeeds = []string{"headlines", "discover"}
+
+// Rules in the order a rate limited user gets them
+var rulePriority = map[string]int{RuleWatchlist: 0, RuleBreaking: 1, RuleHighImpact: 2}
+
+type Notifier struct {
+    sender      Sender
+    rules       Rules
+    maxPerHour  int
+    maxPerDay   int
+}
+
+/*
+Run notifies users of the articles of every feed version the curator
+promotes, until the subscription closes. Notifier state (seen articles, sent
+stories, rate counters) is kept in the API cache Redis under notify:*.
+*/
+func Run() {
+    if config.RedisNewsCache == nil || config.RedisAPICache == nil {
+        utils.LogMessage("Redis unavailable, notifications disabled", "red")
+        return
+    }
+
+    sender, err := NewSender()
+    if err != nil {
+        utils.LogMessage("Failed to create notification sender, notifications disabled", "red", err)
+        return
+    }
+
+    notifier := &Notifier{
+        sender:     sender,
+        rules:      LoadRules(),
+        maxPerHour: envInt(MaxPerHourEnv, DefaultMaxPerHour),
+        maxPerDay:  envInt(MaxPerDayEnv, DefaultMaxPerDay),
+    }
+
+    subscription := config.RedisNewsCache.Subscribe(config.RedisNewsCacheCtx, config.FeedUpdatesChannel)
+    defer subscription.Close()
+    utils.LogMessage(fmt.Sprintf("Notifier subscribed to feed updates, sending with %s", sender.Name()), "green")
+
+    // Catches up on a version promoted while the service was down
+    notifier.Process()
+
+    for message := range subscription.Channel() {
+        utils.LogMessage(fmt.Sprintf("Feed update received (%s), evaluating notifications", message.Payload), "green")
+        notifier.Process()
+    }
+}
+
+type pending struct {
+    notification    models.Notification
+    priority        int
+}
+
+/*
+Process evaluates the articles new in the current feed version for every user
+with a device. Articles are claimed as seen up front so a second notifier
+doesn't evaluate them too. A user the articles could not be sent to gets them
+again with the next version, up to maxRetries times; other users are never
+sent them twice. Users already notified are skipped by firstNotification.
+*/
+func (notifier *Notifier) Process() {
+    candidates, err := newCandidates()
+    if err != nil {
+        utils.LogMessage("Failed to load new articles for notifications", "red", err)
+        return
+    }
+    retries, err := takeRetries()
+    if err != nil {
+        utils.LogMessage("Failed to load notifications to retry", "red", err)
+    }
+    if len(candidates) == 0 && len(retries) == 0 {
+        return
+    }
+
+    subscribers, err := services.ListDevicesByUser()
+    if err != nil {
+        utils.LogMessage("Failed to list devices for notifications", "red", err)
+        releaseArticles(candidates)
+        restoreRetries(retries)
+        return
+    }
+
+    isNew := make(map[string]bool, len(candidates))
+    for _, candidate := range candidates {
+        isNew[candidate.Article.StockicID] = true
+    }
+
+    now := time.Now().UTC()
+    sent := 0
+    failed := make(map[string]string)
+    for apiKey, devices := range subscribers {
+        userCandidates := append([]Candidate{}, candidates...)
+        attempts := make(map[string]int)
+        for _, entry := range retries[apiKey] {
+            if !isNew[entry.Candidate.Article.StockicID] {
+                userCandidates = append(userCandidates, entry.Candidate)
+                attempts[entry.Candidate.Article.StockicID] = entry.Attempts
+            }
+        }
+        if len(userCandidates) == 0 {
+            continue
+        }
+
+        settings, err := services.GetNotificationSettings(apiKey)
+        // Deleted while their devices were listed
+        if status.Code(err) == codes.NotFound {
+            continue
+        }
+        if err != nil {
+            utils.LogMessage("Failed to load notification settings of a user", "red", err)
+            for _, candidate := range userCandidates {
+                scheduleRetry(failed, apiKey, candidate, attempts[candidate.Article.StockicID]+1)
+            }
+            continue
+        }
+        if !settings.Enabled {
+            continue
+        }
+
+        byID := make(map[string]Candidate, len(userCandidates))
+        var matched []pending
+        for _, candidate := range userCandidates {
+            byID[candidate.Article.StockicID] = candidate
+            if notification, found := notifier.rules.Evaluate(candidate, settings, now); found {
+                matched = append(matched, pending{notification: notification, priority: rulePriority[notification.Rule]})
+            }
+        }
+        sort.SliceStable(matched, func(i, j int) bool {
+            return matched[i].priority < matched[j].priority
+        })
+
+        for _, match := range matched {
+            if !notifier.allowed(apiKey, now) {
+                break
+            }
+            if !firstNotification(apiKey, match.notification) {
+                continue
+            }
+            delivered, err := notifier.deliver(apiKey, devices, match.notification)
+            if err != nil {
+                forgetNotification(apiKey, match.notification)
+                stockicID := match.notification.StockicID
+                scheduleRetry(failed, apiKey, byID[stockicID], attempts[stockicID]+1)
+                continue
+            }
+            if delivered {
+                countNotification(apiKey, now)
+                sent++
+            }
+        }
+    }
+
+    if len(failed) > 0 {
+        if err := config.RedisAPICache.HSet(config.RedisAPICacheCtx, retryKey, failed).Err(); err != nil {
+            utils.LogMessage("Failed to record notifications to retry, they won't be sent", "red", err)
+        } else {
+            utils.LogMessage(fmt.Sprintf("%d notifications failed, retrying them with the next feed version", len(failed)), "red")
+        }
+    }
+
+    utils.LogMessage(fmt.Sprintf("Sent %d notifications for %d new articles", sent, len(candidates)), "green")
+}
+
+// An article a user couldn't be notified of, kept in the retryKey hash under retryField
+type retryEntry struct {
+    Candidate   Candidate   `json:"candidate"`
+    Attempts    int         `json:"attempts"`
+}
+
+func retryField(apiKey string, stockicID string) string {
+    return apiKey + ":" + stockicID
+}
+
+// scheduleRetry records the candidate for the user, unless it already failed maxRetries times
+func scheduleRetry(failed map[string]string, apiKey string, candidate Candidate, attempts int) {
+    if attempts > maxRetries || candidate.Article.StockicID == "" {
+        return
+    }
+    entryJSON, err := json.Marshal(retryEntry{Candidate: candidate, Attempts: attempts})
+    if err != nil {
+        utils.LogMessage("Failed to encode notification to retry", "red", err)
+        return
+    }
+    failed[retryField(apiKey, candidate.Article.StockicID)] = string(entryJSON)
+}
+
+/*
+takeRetries removes the notifications to retry and returns them by user, with
+the articles as currently served. Articles not served anymore or hidden since
+are dropped.
+*/
+func takeRetries() (map[string][]retryEntry, error) {
+    entries, err := config.RedisAPICache.HGetAll(config.RedisAPICacheCtx, retryKey).Result()
+    if err != nil || len(entries) == 0 {
+        return nil, err
+    }
+
+    decoded := make(map[string]retryEntry, len(entries))
+    var ids []string
+    for field, entryJSON := range entries {
+        var entry retryEntry
+        if json.Unmarshal([]byte(entryJSON), &entry) != nil {
+            continue
+        }
+        decoded[field] = entry
+        ids = append(ids, entry.Candidate.Article.StockicID)
+    }
+    articles, err := services.FindArticles(ids)
+    if err != nil {
+        return nil, err
+    }
+
+    fields := make([]string, 0, len(entries))
+    for field := range entries {
+        fields = append(fields, field)
+    }
+    if err := config.RedisAPICache.HDel(config.RedisAPICacheCtx, retryKey, fields...).Err(); err != nil {
+        return nil, err
+    }
+
+    retries := make(map[string][]retryEntry)
+    for field, entry := range decoded {
+        article, served := articles[entry.Candidate.Article.StockicID]
+        if !served {
+            continue
+        }
+        entry.Candidate.Article = article
+        apiKey := field[:strings.LastIndex(field, ":")]
+        retries[apiKey] = append(retries[apiKey], entry)
+    }
+    return retries, nil
+}
+
+// restoreRetries puts back retries taken by a run that couldn't evaluate them
+func restoreRetries(retries map[string][]retryEntry) {
+    failed := make(map[string]string)
+    for apiKey, entries := range retries {
+        for _, entry := range entries {
+            scheduleRetry(failed, apiKey, entry.Candidate, entry.Attempts)
+        }
+    }
+    if len(failed) == 0 {
+        return
+    }
+    if err := config.RedisAPICache.HSet(config.RedisAPICacheCtx, retryKey, failed).Err(); err != nil {
+        utils.LogMessage("Failed to restore notifications to retry", "red", err)
+    }
+}
+
+/*
+newCandidates returns the articles of the current version not seen in an
+earlier one, once each, with moderation edits applied. On the very first run
+every served article is only recorded, so deploying the notifier doesn't flood
+users with old news.
+*/
+func newCandidates() ([]Candidate, error) {
+    version, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, config.FeedCurrentKey).Result()
+    if err == redis.Nil {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    overrides, err := config.RedisNewsCache.HGetAll(config.RedisNewsCacheCtx, config.ModerationOverridesKey).Result()
+    if err != nil {
+        return nil, fmt.Errorf("failed to load moderation overrides: %w", err)
+    }
+
+    var served []Candidate
+    included := make(map[string]bool)
+    for _, feedName := range notifiedFeeds {
+        feedJSON, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, fmt.Sprintf("feed:%s:%s", version, feedName)).Bytes()
+        if err != nil {
+            return nil, fmt.Errorf("failed to load %s of version %s: %w", feedName, version, err)
+        }
+
+        var feed map[string]models.FeedResponse
+        if err := json.Unmarshal(feedJSON, &feed); err != nil {
+            return nil, fmt.Errorf("failed to decode %s of version %s: %w", feedName, version, err)
+        }
+
+        keys := make([]string, 0, len(feed))
+        for key := range feed {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+
+        for _, key := range keys {
+            for _, article := range feed[key].Articles {
+                if article.StockicID == "" || included[article.StockicID] {
+                    continue
+                }
+                included[article.StockicID] = true
+
+                // Users are notified of the text feed-api serves, never of hidden articles
+                article, err := services.ApplyOverride(article, overrides[services.OverrideKey(article.URL)])
+                if err == services.ErrArticleNotFound {
+                    continue
+                }
+                if err != nil {
+                    utils.LogMessage("Skipping article with an invalid moderation override", "red", err)
+                    continue
+                }
+                served = append(served, Candidate{Article: article, Feed: feedName, Key: key})
+            }
+        }
+    }
+
+    initialized, err := config.RedisAPICache.Exists(config.RedisAPICacheCtx, initializedKey).Result()
+    if err != nil {
+        return nil, err
+    }
+
+    pipe := config.RedisAPICache.Pipeline()
+    marks := make([]*redis.BoolCmd, len(served))
+    for index, candidate := range served {
+        marks[index] = pipe.SetNX(config.RedisAPICacheCtx, seenArticleKey(candidate.Article.StockicID), version, seenArticleTTL)
+    }
+    if _, err := pipe.Exec(config.RedisAPICacheCtx); err != nil {
+        return nil, fmt.Errorf("failed to mark articles as seen: %w", err)
+    }
+
+    if initialized == 0 {
+        config.RedisAPICache.Set(config.RedisAPICacheCtx, initializedKey, version, 0)
+        utils.LogMessage(fmt.Sprintf("Recorded %d served articles, notifying from the next feed version", len(served)), "green")
+        return nil, nil
+    }
+
+    var candidates []Candidate
+    for index, candidate := range served {
+        if marks[index].Val() {
+            candidates = append(candidates, candidate)
+        }
+    }
+    return candidates, nil
+}
+
+func seenArticleKey(stockicID string) string {
+    return "notify:article:" + stockicID
+}
+
+// releaseArticles drops the seen marks of candidates that couldn't be evaluated
+func releaseArticles(candidates []Candidate) {
+    if len(candidates) == 0 {
+        return
+    }
+    keys := make([]string, 0, len(candidates))
+    for _, candidate := range candidates {
+        keys = append(keys, seenArticleKey(candidate.Article.StockicID))
+    }
+    if err := config.RedisAPICache.Del(config.RedisAPICacheCtx, keys...).Err(); err != nil {
+        utils.LogMessage("Failed to release articles for notifications, they won't be evaluated again", "red", err)
+    }
+}
+
+func rateKeys(apiKey string, now time.Time) (string, string) {
+    return fmt.Sprintf("notify:rate:%s:h:%s", apiKey, now.Format("2006010215")),
+        fmt.Sprintf("notify:rate:%s:d:%s", apiKey, now.Format("20060102"))
+}
+
+// allowed reports whether the user is still under the hourly and daily limits
+func (notifier *Notifier) allowed(apiKey string, now time.Time) bool {
+    hourKey, dayKey := rateKeys(apiKey, now)
+    counts, err := config.RedisAPICache.MGet(config.RedisAPICacheCtx, hourKey, dayKey).Result()
+    if err != nil {
+        utils.LogMessage("Failed to read notification rate, skipping user", "red", err)
+        return false
+    }
+
+    count := func(value interface{}) int {
+        text, _ := value.(string)
+        number, _ := strconv.Atoi(text)
+        return number
+    }
+    return count(counts[0]) < notifier.maxPerHour && count(counts[1]) < notifier.maxPerDay
+}
+
+func countNotification(apiKey string, now time.Time) {
+    hourKey, dayKey := rateKeys(apiKey, now)
+    pipe := config.RedisAPICache.Pipeline()
+    pipe.Incr(config.RedisAPICacheCtx, hourKey)
+    pipe.Expire(config.RedisAPICacheCtx, hourKey, time.Hour)
+    pipe.Incr(config.RedisAPICacheCtx, dayKey)
+    pipe.Expire(config.RedisAPICacheCtx, dayKey, 24*time.Hour)
+    if _, err := pipe.Exec(config.RedisAPICacheCtx); err != nil {
+        utils.LogMessage("Failed to count notification", "red", err)
+    }
+}
+
+// Forget deletes the rate counters, sent stories and retries kept for the user, returning how many there were
+func Forget(apiKey string) (int, error) {
+    forgotten := 0
+    for _, prefix := range []string{"notify:rate:", "notify:sent:"} {
+        deleted, err := database.DeleteRedisKeys(config.RedisAPICacheCtx, config.RedisAPICache, prefix+utils.EscapeRedisPattern(apiKey)+":*")
+        forgotten += deleted
+        if err != nil {
+            return forgotten, err
+        }
+    }
+
+    var fields []string
+    iter := config.RedisAPICache.HScan(config.RedisAPICacheCtx, retryKey, 0, utils.EscapeRedisPattern(apiKey)+":*", 100).Iterator()
+    for index := 0; iter.Next(config.RedisAPICacheCtx); index++ {
+        // HScan yields fields and values alternately
+        if index%2 == 0 {
+            fields = append(fields, iter.Val())
+        }
+    }
+    if err := iter.Err(); err != nil {
+        return forgotten, err
+    }
+    if len(fields) > 0 {
+        if err := config.RedisAPICache.HDel(config.RedisAPICacheCtx, retryKey, fields...).Err(); err != nil {
+            return forgotten, err
+        }
+        forgotten += len(fields)
+    }
+    return forgotten, nil
+}
+
+func sentKey(apiKey string, notification models.Notification) string {
+    subject := notification.StoryID
+    if subject == "" {
+        subject = notification.StockicID
+    }
+    return "notify:sent:" + apiKey + ":" + subject
+}
+
+// firstNotification claims the story, or the article outside a story, for the user
+func firstNotification(apiKey string, notification models.Notification) bool {
+    claimed, err := config.RedisAPICache.SetNX(config.RedisAPICacheCtx, sentKey(apiKey, notification), notification.StockicID, sentTTL).Result()
+    if err != nil {
+        utils.LogMessage("Failed to deduplicate notification, skipping it", "red", err)
+        return false
+    }
+    return claimed
+}
+
+// forgetNotification releases the claim of a notification that couldn't be delivered
+func forgetNotification(apiKey string, notification models.Notification) {
+    if err := config.RedisAPICache.Del(config.RedisAPICacheCtx, sentKey(apiKey, notification)).Err(); err != nil {
+        utils.LogMessage("Failed to release undelivered notification", "red", err)
+    }
+}
+
+/*
+deliver sends to every device of the user, dropping devices the push service
+rejected for good. It fails when no device got the notification and one of
+them may still get it later.
+*/
+func (notifier *Notifier) deliver(apiKey string, devices []models.Device, notification models.Notification) (bool, error) {
+    delivered := false
+    var lastErr error
+    for _, device := range devices {
+        err := notifier.sender.Send(device, notification)
+        if errors.Is(err, ErrInvalidToken) {
+            if err := services.RemoveDevice(apiKey, device.Token); err != nil {
+                utils.LogMessage("Failed to remove invalid device", "red", err)
+            }
+            continue
+        }
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to send %s notification to a %s device", notification.Rule, device.Platform), "red", err)
+            lastErr = err
+            continue
+        }
+        delivered = true
+    }
+    if !delivered && lastErr != nil {
+        return false, lastErr
+    }
+    return delivered, nil
+}
+
+func envInt(name string, fallback int) int {
+    if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+        return value
+    }
+    return fallback
+}
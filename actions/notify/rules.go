@@ -0,0 +1,165 @@
+package notify
+
+import (
+    "math"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+
+    "actions/models"
+)
+
+const (
+    RuleWatchlist = "watchlist"
+    RuleBreaking = "breaking"
+    RuleHighImpact = "high-impact"
+
+    BreakingMinSourcesEnv = "NOTIFY_BREAKING_MIN_SOURCES"
+    BreakingWindowEnv = "NOTIFY_BREAKING_WINDOW_HOURS"
+    ImpactScoreEnv = "NOTIFY_IMPACT_SCORE"
+    ImpactConfidenceEnv = "NOTIFY_IMPACT_CONFIDENCE"
+
+    // A headline is breaking when this many articles cover its story
+    DefaultBreakingMinSources = 3
+    // The curator runs daily, so a day old article is still news
+    DefaultBreakingWindow = 24 * time.Hour
+    DefaultImpactScore = 0.6
+    DefaultImpactConfidence = 0.5
+
+    maxBodyLength = 180
+)
+
+// Sentence end followed by the capital of the next sentence, so "3.5%" doesn't cut the sentence
+var sentenceEnd = regexp.MustCompile(`[.!?]["')]?\s+\p{Lu}`)
+
+/*
+Candidate is a newly curated article and where it is served: the feed
+("headlines" or "discover") and the country or category within it.
+*/
+type Candidate struct {
+    Article models.FeedArticle
+    Feed    string
+    Key     string
+}
+
+type Rules struct {
+    BreakingMinSources  int
+    BreakingWindow      time.Duration
+    ImpactScore         float64
+    ImpactConfidence    float64
+}
+
+func LoadRules() Rules {
+    rules := Rules{
+        BreakingMinSources: DefaultBreakingMinSources,
+        BreakingWindow:     DefaultBreakingWindow,
+        ImpactScore:        DefaultImpactScore,
+        ImpactConfidence:   DefaultImpactConfidence,
+    }
+    if value, err := strconv.Atoi(os.Getenv(BreakingMinSourcesEnv)); err == nil && value > 0 {
+        rules.BreakingMinSources = value
+    }
+    if value, err := strconv.ParseFloat(os.Getenv(BreakingWindowEnv), 64); err == nil && value > 0 {
+        rules.BreakingWindow = time.Duration(value * float64(time.Hour))
+    }
+    if value, err := strconv.ParseFloat(os.Getenv(ImpactScoreEnv), 64); err == nil && value > 0 {
+        rules.ImpactScore = value
+    }
+    if value, err := strconv.ParseFloat(os.Getenv(ImpactConfidenceEnv), 64); err == nil && value >= 0 {
+        rules.ImpactConfidence = value
+    }
+    return rules
+}
+
+/*
+Evaluate decides whether a candidate is worth a notification to a user, and
+returns it. Rules are tried from the most personal to the most general:
+watchlist, breaking, high impact. An article yields at most one notification.
+*/
+func (rules Rules) Evaluate(candidate Candidate, settings models.NotificationSettings, now time.Time) (models.Notification, bool) {
+    article := candidate.Article
+    notification := models.Notification{
+        Title:     article.Title,
+        Body:      summaryLine(article.SummarizedContent),
+        StockicID: article.StockicID,
+        StoryID:   article.StoryID,
+    }
+
+    if settings.Watchlist {
+        if company, found := watchlistMatch(article, settings.Companies); found {
+            notification.Rule = RuleWatchlist
+            notification.Title = company + ": " + article.Title
+            return notification, true
+        }
+    }
+
+    if settings.Breaking && candidate.Feed == "headlines" && candidate.Key == settings.Country && article.StorySize >= rules.BreakingMinSources {
+        publishedAt, err := time.Parse(time.RFC3339, article.PublishedAt)
+        if err == nil && now.Sub(publishedAt) <= rules.BreakingWindow {
+            notification.Rule = RuleBreaking
+            notification.Title = "Breaking: " + article.Title
+            return notification, true
+        }
+    }
+
+    if settings.HighImpact && math.Abs(article.SentimentScore) >= rules.ImpactScore && article.SentimentConfidence >= rules.ImpactConfidence {
+        // Only the news the user reads: their country's headlines or discover
+        if candidate.Feed == "discover" || candidate.Key == settings.Country {
+            notification.Rule = RuleHighImpact
+            return notification, true
+        }
+    }
+
+    return models.Notification{}, false
+}
+
+// watchlistMatch returns the watchlist entry the article is about, matching names and tickers case-insensitively
+func watchlistMatch(article models.FeedArticle, watchlist []string) (string, bool) {
+    mentioned := make(map[string]bool)
+    for _, company := range article.CompaniesTags {
+        mentioned[strings.ToLower(strings.TrimSpace(company))] = true
+    }
+    for _, impact := range article.CompanyImpact {
+        mentioned[strings.ToLower(strings.TrimSpace(impact.Company))] = true
+    }
+    if article.PriceChange != nil {
+        mentioned[strings.ToLower(article.PriceChange.Symbol)] = true
+        mentioned[strings.ToLower(article.PriceChange.Name)] = true
+    }
+    delete(mentioned, "")
+
+    for _, entry := range watchlist {
+        if mentioned[strings.ToLower(strings.TrimSpace(entry))] {
+            return entry, true
+        }
+    }
+    return "", false
+}
+
+// summaryLine is the first sentence of the summary, cut to fit a notification
+func summaryLine(summary string) string {
+    summary = strings.TrimSpace(summary)
+    for _, location := range sentenceEnd.FindAllStringIndex(summary, -1) {
+        // Abbreviations like "U.S." or "Inc." followed by a name aren't the end
+        words := strings.Fields(summary[:location[0]])
+        if len(words) == 0 || isAbbreviation(words[len(words)-1]) {
+            continue
+        }
+        summary = strings.TrimSpace(summary[:location[1]-1])
+        break
+    }
+
+    runes := []rune(summary)
+    if len(runes) > maxBodyLength {
+        summary = strings.TrimSpace(string(runes[:maxBodyLength-1])) + "…"
+    }
+    return summary
+}
+
+func isAbbreviation(word string) bool {
+    return len([]rune(word)) <= 1 || strings.Contains(word, ".") || abbreviations[strings.ToLower(word)]
+}
+
+var abbreviations = map[string]bool{"inc": true, "corp": true, "co": true, "ltd": true, "mr": true, "ms": true, "mrs": true, "dr": true, "st": true, "jr": true}
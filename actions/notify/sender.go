@@ -0,0 +1,129 @@
+package notify
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    "actions/models"
+    "actions/utils"
+)
+
+const (
+    SenderEnv = "NOTIFICATION_SENDER"
+    FileEnv = "NOTIFICATION_FILE"
+
+    // Writes notifications to a JSON lines file instead of delivering them
+    SenderFile = "file"
+    // FCM for Android and web, APNs for iOS when configured (FCM otherwise)
+    SenderPush = "push"
+
+    DefaultFile = "notifications.jsonl"
+)
+
+// Returned by a sender when the push service says the token will never work again, the device is then dropped
+var ErrInvalidToken = errors.New("device token is no longer valid")
+
+type Sender interface {
+    Name() string
+    Send(device models.Device, notification models.Notification) error
+}
+
+/*
+NewSender returns the sender selected by NOTIFICATION_SENDER. The file sender
+is the default so a development setup never reaches real devices.
+*/
+func NewSender() (Sender, error) {
+    switch sender := os.Getenv(SenderEnv); sender {
+    case "", SenderFile:
+        path := os.Getenv(FileEnv)
+        if path == "" {
+            path = DefaultFile
+        }
+        return &FileSender{Path: path}, nil
+    case SenderPush:
+        return NewPushSender()
+    default:
+        return nil, fmt.Errorf("unknown notification sender %q", sender)
+    }
+}
+
+/*
+PushSender routes each device to the push service of its platform. iOS
+devices registered through the Firebase SDK hold FCM tokens, so they go
+through FCM unless APNs credentials are configured.
+*/
+type PushSender struct {
+    fcm     *FCMSender
+    apns    *APNsSender
+}
+
+func NewPushSender() (*PushSender, error) {
+    fcm, err := NewFCMSender()
+    if err != nil {
+        return nil, err
+    }
+
+    sender := &PushSender{fcm: fcm}
+    if os.Getenv(APNsKeyFileEnv) != "" {
+        if sender.apns, err = NewAPNsSender(); err != nil {
+            return nil, err
+        }
+    }
+    return sender, nil
+}
+
+func (sender *PushSender) Name() string {
+    if sender.apns != nil {
+        return "push:fcm+apns"
+    }
+    return "push:fcm"
+}
+
+func (sender *PushSender) Send(device models.Device, notification models.Notification) error {
+    if device.Platform == "ios" && sender.apns != nil {
+        return sender.apns.Send(device, notification)
+    }
+    return sender.fcm.Send(device, notification)
+}
+
+// FileSender appends every notification to a JSON lines file, for tests and local development
+type FileSender struct {
+    Path    string
+    mutex   sync.Mutex
+}
+
+type fileRecord struct {
+    SentAt          time.Time           `json:"sentAt"`
+    Device          models.Device       `json:"device"`
+    Notification    models.Notification `json:"notification"`
+}
+
+func (sender *FileSender) Name() string {
+    return "file:" + sender.Path
+}
+
+func (sender *FileSender) Send(device models.Device, notification models.Notification) error {
+    record, err := json.Marshal(fileRecord{SentAt: time.Now().UTC(), Device: device, Notification: notification})
+    if err != nil {
+        return err
+    }
+
+    sender.mutex.Lock()
+    defer sender.mutex.Unlock()
+
+    file, err := os.OpenFile(sender.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    if _, err := file.Write(append(record, '\n')); err != nil {
+        utils.LogMessage("Failed to write notification file", "red", err)
+        return err
+    }
+    return nil
+}
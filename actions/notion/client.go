@@ -0,0 +1,188 @@
+package notion
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+)
+
+const (
+    APIURLEnv = "NOTION_API_URL"
+
+    DefaultAPIURL = "https://api.notion.com/v1"
+    APIVersion = "2022-06-28"
+
+    requestTimeout = 15 * time.Second
+    searchPageSize = 100
+)
+
+var (
+    // The user revoked the integration or the token expired, they have to connect Notion again
+    ErrUnauthorized = errors.New("notion access was revoked")
+    // The object doesn't exist or wasn't shared with the integration
+    ErrNotFound = errors.New("notion object not found")
+)
+
+/*
+Client is the part of the Notion API the export uses. HTTPClient talks to
+the API at NOTION_API_URL, which can point at a local stub server in tests.
+*/
+type Client interface {
+    SearchDatabases(token string) ([]Database, error)
+    GetDatabase(token, databaseID string) (Database, error)
+    CreatePage(token string, page Page) (CreatedPage, error)
+}
+
+type Database struct {
+    ID          string              `json:"id"`
+    Title       string              `json:"title"`
+    URL         string              `json:"url"`
+    // Property name to its type (title, rich_text, url, select, multi_select, date, ...)
+    Properties  map[string]string   `json:"properties"`
+}
+
+type CreatedPage struct {
+    ID  string  `json:"id"`
+    URL string  `json:"url"`
+}
+
+type HTTPClient struct {
+    BaseURL string
+    HTTP    *http.Client
+}
+
+func NewClient() Client {
+    baseURL := os.Getenv(APIURLEnv)
+    if baseURL == "" {
+        baseURL = DefaultAPIURL
+    }
+    return &HTTPClient{
+        BaseURL: strings.TrimRight(baseURL, "/"),
+        HTTP:    &http.Client{Timeout: requestTimeout},
+    }
+}
+
+// Databases as returned by the API, titles are rich text
+type rawDatabase struct {
+    ID          string  `json:"id"`
+    URL         string  `json:"url"`
+    Title       []struct {
+        PlainText   string  `json:"plain_text"`
+    }                   `json:"title"`
+    Properties  map[string]struct {
+        Type    string  `json:"type"`
+    }                   `json:"properties"`
+}
+
+func (raw rawDatabase) database() Database {
+    database := Database{ID: raw.ID, URL: raw.URL, Properties: make(map[string]string, len(raw.Properties))}
+    for _, part := range raw.Title {
+        database.Title += part.PlainText
+    }
+    for name, property := range raw.Properties {
+        database.Properties[name] = property.Type
+    }
+    return database
+}
+
+// SearchDatabases returns every database shared with the integration
+func (client *HTTPClient) SearchDatabases(token string) ([]Database, error) {
+    databases := []Database{}
+    cursor := ""
+    for {
+        request := map[string]interface{}{
+            "filter":    map[string]string{"property": "object", "value": "database"},
+            "page_size": searchPageSize,
+        }
+        if cursor != "" {
+            request["start_cursor"] = cursor
+        }
+
+        var response struct {
+            Results     []rawDatabase   `json:"results"`
+            HasMore     bool            `json:"has_more"`
+            NextCursor  string          `json:"next_cursor"`
+        }
+        if err := client.do(token, http.MethodPost, "/search", request, &response); err != nil {
+            return nil, err
+        }
+
+        for _, raw := range response.Results {
+            databases = append(databases, raw.database())
+        }
+        if !response.HasMore || response.NextCursor == "" {
+            return databases, nil
+        }
+        cursor = response.NextCursor
+    }
+}
+
+func (client *HTTPClient) GetDatabase(token, databaseID string) (Database, error) {
+    var raw rawDatabase
+    if err := client.do(token, http.MethodGet, "/databases/"+databaseID, nil, &raw); err != nil {
+        return Database{}, err
+    }
+    return raw.database(), nil
+}
+
+func (client *HTTPClient) CreatePage(token string, page Page) (CreatedPage, error) {
+    var created CreatedPage
+    if err := client.do(token, http.MethodPost, "/pages", page, &created); err != nil {
+        return CreatedPage{}, err
+    }
+    return created, nil
+}
+
+func (client *HTTPClient) do(token, method, path string, body, result interface{}) error {
+    var reader io.Reader
+    if body != nil {
+        payload, err := json.Marshal(body)
+        if err != nil {
+            return err
+        }
+        reader = bytes.NewReader(payload)
+    }
+
+    request, err := http.NewRequest(method, client.BaseURL+path, reader)
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Authorization", "Bearer "+token)
+    request.Header.Set("Notion-Version", APIVersion)
+    if body != nil {
+        request.Header.Set("Content-Type", "application/json")
+    }
+
+    response, err := client.HTTP.Do(request)
+    if err != nil {
+        return fmt.Errorf("notion request failed: %w", err)
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode != http.StatusOK {
+        var apiError struct {
+            Code    string  `json:"code"`
+            Message string  `json:"message"`
+        }
+        json.NewDecoder(io.LimitReader(response.Body, 1<<16)).Decode(&apiError)
+
+        switch response.StatusCode {
+        case http.StatusUnauthorized:
+            return ErrUnauthorized
+        case http.StatusNotFound:
+            return ErrNotFound
+        }
+        return fmt.Errorf("notion %s %s returned %d %s: %s", method, path, response.StatusCode, apiError.Code, apiError.Message)
+    }
+
+    if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+        return fmt.Errorf("failed to decode notion response: %w", err)
+    }
+    return nil
+}
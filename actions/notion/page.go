@@ -0,0 +1,233 @@
+package notion
+
+import (
+    "sort"
+    "strings"
+
+    "actions/models"
+)
+
+const (
+    // API limits: characters per text object, text objects per block, names of select options
+    maxTextLength = 2000
+    maxRichText = 100
+    maxOptionLength = 100
+)
+
+type Page struct {
+    Parent      Parent                  `json:"parent"`
+    Properties  map[string]interface{}  `json:"properties"`
+    Children    []Block                 `json:"children,omitempty"`
+}
+
+type Parent struct {
+    DatabaseID  string  `json:"database_id"`
+}
+
+type Block struct {
+    Object      string          `json:"object"`
+    Type        string          `json:"type"`
+    Paragraph   *RichTextBlock  `json:"paragraph,omitempty"`
+    Bookmark    *BookmarkBlock  `json:"bookmark,omitempty"`
+}
+
+type RichTextBlock struct {
+    RichText    []RichText  `json:"rich_text"`
+}
+
+type BookmarkBlock struct {
+    URL string  `json:"url"`
+}
+
+type RichText struct {
+    Type        string          `json:"type"`
+    Text        Text            `json:"text"`
+    Annotations *Annotations    `json:"annotations,omitempty"`
+}
+
+type Text struct {
+    Content string  `json:"content"`
+    Link    *Link   `json:"link,omitempty"`
+}
+
+type Link struct {
+    URL string  `json:"url"`
+}
+
+type Annotations struct {
+    Bold    bool    `json:"bold"`
+}
+
+/*
+BuildPage turns an article into a page of the database. The title goes in
+the database's title property. Source, link, tags and publication date fill
+properties of the right type when the database has them (matched by name,
+case-insensitively), and are always repeated in the page body under the
+summary, whose highlights are bold.
+*/
+func BuildPage(database Database, article models.FeedArticle) Page {
+    page := Page{
+        Parent:     Parent{DatabaseID: database.ID},
+        Properties: make(map[string]interface{}),
+    }
+
+    if name := propertyOfType(database, "title"); name != "" {
+        page.Properties[name] = map[string]interface{}{"title": plainText(article.Title, nil)}
+    }
+    if name := propertyNamed(database, "url", "url", "link", "source url"); name != "" && article.URL != "" {
+        page.Properties[name] = map[string]interface{}{"url": article.URL}
+    }
+    if name := propertyNamed(database, "select", "source", "publisher"); name != "" && article.Source != "" {
+        page.Properties[name] = map[string]interface{}{"select": map[string]string{"name": optionName(article.Source)}}
+    } else if name := propertyNamed(database, "rich_text", "source", "publisher"); name != "" && article.Source != "" {
+        page.Properties[name] = map[string]interface{}{"rich_text": plainText(article.Source, nil)}
+    }
+    if name := propertyNamed(database, "multi_select", "tags", "companies"); name != "" && len(article.CompaniesTags) > 0 {
+        options := []map[string]string{}
+        seen := make(map[string]bool)
+        for _, tag := range article.CompaniesTags {
+            if tag = optionName(tag); tag != "" && !seen[tag] {
+                seen[tag] = true
+                options = append(options, map[string]string{"name": tag})
+            }
+        }
+        page.Properties[name] = map[string]interface{}{"multi_select": options}
+    }
+    if name := propertyNamed(database, "date", "published", "published at", "date"); name != "" && article.PublishedAt != "" {
+        page.Properties[name] = map[string]interface{}{"date": map[string]string{"start": article.PublishedAt}}
+    }
+
+    summary := highlightedText(article.SummarizedContent, article.NewsHighlights, article.HighlightsUnit)
+    for len(summary) > 0 {
+        count := len(summary)
+        if count > maxRichText {
+            count = maxRichText
+        }
+        page.Children = append(page.Children, paragraph(summary[:count]))
+        summary = summary[count:]
+    }
+
+    if len(article.CompaniesTags) > 0 {
+        page.Children = append(page.Children, paragraph(plainText("Tags: "+strings.Join(article.CompaniesTags, ", "), nil)))
+    }
+    if article.Source != "" {
+        page.Children = append(page.Children, paragraph(plainText("Source: "+article.Source, nil)))
+    }
+    if article.URL != "" {
+        page.Children = append(page.Children, paragraph(plainText("Read the original article", &Link{URL: article.URL})))
+        page.Children = append(page.Children, Block{Object: "block", Type: "bookmark", Bookmark: &BookmarkBlock{URL: article.URL}})
+    }
+
+    return page
+}
+
+/*
+highlightedText splits the summary into text objects at the highlight ranges,
+the highlighted ones bold. Ranges are in the unit the curator used, UTF-16
+code units unless it says runes; invalid or overlapping ranges are skipped.
+*/
+func highlightedText(content string, highlights [][]int, unit string) []RichText {
+    text := []rune(content)
+
+    // Offsets in the article's unit to rune indexes
+    toRune := func(offset int) int { return offset }
+    if unit != "runes" {
+        runeAt := make([]int, 0, len(text)+1)
+        for index, character := range text {
+            runeAt = append(runeAt, index)
+            // Outside the basic plane a character is a surrogate pair, two units
+            if character > 0xFFFF {
+                runeAt = append(runeAt, index)
+            }
+        }
+        runeAt = append(runeAt, len(text))
+        toRune = func(offset int) int {
+            if offset < 0 || offset >= len(runeAt) {
+                return -1
+            }
+            return runeAt[offset]
+        }
+    }
+
+    ranges := make([][2]int, 0, len(highlights))
+    for _, highlight := range highlights {
+        if len(highlight) != 2 {
+            continue
+        }
+        start, end := toRune(highlight[0]), toRune(highlight[1])
+        if start < 0 || end > len(text) || start >= end {
+            continue
+        }
+        ranges = append(ranges, [2]int{start, end})
+    }
+    sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+    var parts []RichText
+    position := 0
+    for _, span := range ranges {
+        if span[0] < position {
+            continue
+        }
+        parts = append(parts, plainText(string(text[position:span[0]]), nil)...)
+        for _, part := range plainText(string(text[span[0]:span[1]]), nil) {
+            part.Annotations = &Annotations{Bold: true}
+            parts = append(parts, part)
+        }
+        position = span[1]
+    }
+    return append(parts, plainText(string(text[position:]), nil)...)
+}
+
+// plainText returns the text as text objects of at most maxTextLength characters
+func plainText(content string, link *Link) []RichText {
+    var parts []RichText
+    text := []rune(content)
+    for len(text) > 0 {
+        count := len(text)
+        if count > maxTextLength {
+            count = maxTextLength
+        }
+        parts = append(parts, RichText{Type: "text", Text: Text{Content: string(text[:count]), Link: link}})
+        text = text[count:]
+    }
+    return parts
+}
+
+func paragraph(parts []RichText) Block {
+    return Block{Object: "block", Type: "paragraph", Paragraph: &RichTextBlock{RichText: parts}}
+}
+
+func propertyOfType(database Database, propertyType string) string {
+    names := make([]string, 0, len(database.Properties))
+    for name, candidate := range database.Properties {
+        if candidate == propertyType {
+            names = append(names, name)
+        }
+    }
+    if len(names) == 0 {
+        return ""
+    }
+    sort.Strings(names)
+    return names[0]
+}
+
+// propertyNamed returns the property of the given type with one of the names, in order of preference
+func propertyNamed(database Database, propertyType string, names ...string) string {
+    for _, wanted := range names {
+        for name, candidate := range database.Properties {
+            if candidate == propertyType && strings.EqualFold(strings.TrimSpace(name), wanted) {
+                return name
+            }
+        }
+    }
+    return ""
+}
+
+// Select option names can't contain commas
+func optionName(name string) string {
+    name = strings.Join(strings.Fields(strings.ReplaceAll(name, ",", " ")), " ")
+    if runes := []rune(name); len(runes) > maxOptionLength {
+        name = string(runes[:maxOptionLength])
+    }
+    return name
+}
@@ -0,0 +1,75 @@
+package oauth
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+const (
+    // Base64 of a 32 byte AES-256 key
+    TokenKeyEnv = "OAUTH_TOKEN_KEY"
+
+    sealedPrefix = "v1:"
+)
+
+var ErrNoTokenKey = errors.New(TokenKeyEnv + " is not set or is not a base64 encoded 32 byte key")
+
+func tokenCipher() (cipher.AEAD, error) {
+    key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(os.Getenv(TokenKeyEnv)))
+    if err != nil || len(key) != 32 {
+        return nil, ErrNoTokenKey
+    }
+
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+/*
+seal encrypts with AES-256-GCM. The user and provider are authenticated as
+additional data, so a sealed token copied to another user or provider
+doesn't open.
+*/
+func seal(plaintext []byte, binding string) (string, error) {
+    aead, err := tokenCipher()
+    if err != nil {
+        return "", err
+    }
+
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return "", err
+    }
+
+    sealed := aead.Seal(nonce, nonce, plaintext, []byte(binding))
+    return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(sealed, binding string) ([]byte, error) {
+    aead, err := tokenCipher()
+    if err != nil {
+        return nil, err
+    }
+
+    if !strings.HasPrefix(sealed, sealedPrefix) {
+        return nil, errors.New("unknown sealed token format")
+    }
+    raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+    if err != nil || len(raw) < aead.NonceSize() {
+        return nil, errors.New("malformed sealed token")
+    }
+
+    plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(binding))
+    if err != nil {
+        return nil, fmt.Errorf("failed to decrypt token: %w", err)
+    }
+    return plaintext, nil
+}
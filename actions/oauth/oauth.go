@@ -0,0 +1,230 @@
+package oauth
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+const requestTimeout = 15 * time.Second
+
+var (
+    // The provider isn't configured on this server
+    ErrNotConfigured = errors.New("oauth provider is not configured")
+    // The user never connected the provider, disconnected it or the grant was revoked
+    ErrNotConnected = errors.New("oauth provider is not connected")
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+/*
+Provider describes an OAuth 2.0 authorization code flow, integrations
+declare their own. Providers differ in small ways: Notion takes JSON bodies
+with the client credentials in HTTP Basic auth and doesn't support PKCE, most
+others take form posts.
+*/
+type Provider struct {
+    Name            string
+    DisplayName     string
+    AuthURL         string
+    TokenURL        string
+    // Empty when the provider has no revocation endpoint
+    RevokeURL       string
+    ClientID        string
+    ClientSecret    string
+    RedirectURI     string
+    Scopes          []string
+    // Extra authorization parameters, such as Notion's owner=user
+    AuthParams      map[string]string
+    PKCE            bool
+    JSONRequests    bool
+    // Sent with every token request, such as Notion-Version
+    Headers         map[string]string
+    // User document field of credentials stored before this module, migrated on first use
+    LegacyField     string
+}
+
+func (provider Provider) Configured() bool {
+    return provider.AuthURL != "" && provider.TokenURL != "" && provider.ClientID != "" && provider.ClientSecret != "" && provider.RedirectURI != ""
+}
+
+// AuthorizationURL is where the user grants access, challenge is empty without PKCE
+func (provider Provider) AuthorizationURL(state, challenge string) (string, error) {
+    authURL, err := url.Parse(provider.AuthURL)
+    if err != nil {
+        return "", fmt.Errorf("invalid %s authorization URL: %w", provider.Name, err)
+    }
+
+    query := authURL.Query()
+    query.Set("response_type", "code")
+    query.Set("client_id", provider.ClientID)
+    query.Set("redirect_uri", provider.RedirectURI)
+    query.Set("state", state)
+    if len(provider.Scopes) > 0 {
+        query.Set("scope", strings.Join(provider.Scopes, " "))
+    }
+    for name, value := range provider.AuthParams {
+        query.Set(name, value)
+    }
+    if challenge != "" {
+        query.Set("code_challenge", challenge)
+        query.Set("code_challenge_method", "S256")
+    }
+
+    authURL.RawQuery = query.Encode()
+    return authURL.String(), nil
+}
+
+// Token is a token endpoint response
+type Token struct {
+    AccessToken     string
+    RefreshToken    string
+    TokenType       string
+    // Zero when the token doesn't expire
+    ExpiresAt       time.Time
+    // The rest of the response, such as Notion's workspace and bot details
+    Extra           map[string]interface{}
+}
+
+// Exchange trades the authorization code for tokens, verifier is empty without PKCE
+func (provider Provider) Exchange(code, verifier string) (Token, error) {
+    parameters := map[string]string{
+        "grant_type":   "authorization_code",
+        "code":         code,
+        "redirect_uri": provider.RedirectURI,
+    }
+    if verifier != "" {
+        parameters["code_verifier"] = verifier
+    }
+    return provider.tokenRequest(parameters)
+}
+
+// Refresh gets a new access token. A rejected refresh token means the user has to connect again.
+func (provider Provider) Refresh(refreshToken string) (Token, error) {
+    token, err := provider.tokenRequest(map[string]string{
+        "grant_type":    "refresh_token",
+        "refresh_token": refreshToken,
+    })
+    if err != nil {
+        return Token{}, err
+    }
+    // Providers that don't rotate refresh tokens leave it out of the response
+    if token.RefreshToken == "" {
+        token.RefreshToken = refreshToken
+    }
+    return token, nil
+}
+
+// Revoke invalidates the token at the provider, a no-op for providers without revocation
+func (provider Provider) Revoke(token string) error {
+    if provider.RevokeURL == "" {
+        return nil
+    }
+
+    response, err := provider.post(provider.RevokeURL, map[string]string{"token": token})
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+
+    // An already invalid token is as good as revoked
+    if response.StatusCode >= 300 && response.StatusCode != http.StatusBadRequest && response.StatusCode != http.StatusUnauthorized {
+        return fmt.Errorf("%s revocation returned %d", provider.Name, response.StatusCode)
+    }
+    return nil
+}
+
+func (provider Provider) tokenRequest(parameters map[string]string) (Token, error) {
+    response, err := provider.post(provider.TokenURL, parameters)
+    if err != nil {
+        return Token{}, err
+    }
+    defer response.Body.Close()
+
+    var body map[string]interface{}
+    if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&body); err != nil {
+        return Token{}, fmt.Errorf("failed to decode %s token response (%d): %w", provider.Name, response.StatusCode, err)
+    }
+
+    if response.StatusCode != http.StatusOK {
+        code, _ := body["error"].(string)
+        if code == "invalid_grant" && parameters["grant_type"] == "refresh_token" {
+            return Token{}, ErrNotConnected
+        }
+        description, _ := body["error_description"].(string)
+        return Token{}, fmt.Errorf("%s token request returned %d %s: %s", provider.Name, response.StatusCode, code, description)
+    }
+
+    token := Token{Extra: make(map[string]interface{})}
+    for name, value := range body {
+        switch name {
+        case "access_token":
+            token.AccessToken, _ = value.(string)
+        case "refresh_token":
+            token.RefreshToken, _ = value.(string)
+        case "token_type":
+            token.TokenType, _ = value.(string)
+        case "expires_in":
+            if seconds, ok := value.(float64); ok && seconds > 0 {
+                token.ExpiresAt = time.Now().UTC().Add(time.Duration(seconds) * time.Second)
+            }
+        case "id_token":
+            // Secret enough not to keep in the clear, and unused
+        default:
+            token.Extra[name] = value
+        }
+    }
+    if token.AccessToken == "" {
+        return Token{}, fmt.Errorf("%s token response has no access token", provider.Name)
+    }
+    return token, nil
+}
+
+func (provider Provider) post(endpoint string, parameters map[string]string) (*http.Response, error) {
+    var request *http.Request
+    var err error
+    if provider.JSONRequests {
+        payload, _ := json.Marshal(parameters)
+        request, err = http.NewRequest(http.MethodPost, endpoint, strings.NewReader(string(payload)))
+        if err == nil {
+            request.Header.Set("Content-Type", "application/json")
+        }
+    } else {
+        form := url.Values{}
+        for name, value := range parameters {
+            form.Set(name, value)
+        }
+        request, err = http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+        if err == nil {
+            request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        }
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    request.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+    request.Header.Set("Accept", "application/json")
+    for name, value := range provider.Headers {
+        request.Header.Set(name, value)
+    }
+
+    response, err := httpClient.Do(request)
+    if err != nil {
+        return nil, fmt.Errorf("%s request to %s failed: %w", provider.Name, endpoint, err)
+    }
+    return response, nil
+}
+
+// codeChallenge is the S256 PKCE challenge of a verifier
+func codeChallenge(verifier string) string {
+    hash := sha256.Sum256([]byte(verifier))
+    return base64.RawURLEncoding.EncodeToString(hash[:])
+}
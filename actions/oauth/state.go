@@ -0,0 +1,148 @@
+package oauth
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    "actions/config"
+    "actions/utils"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// The state is unknown, expired or was already used
+var ErrInvalidState = errors.New("oauth session expired or already used")
+
+// session is what a state stands for until the callback consumes it
+type session struct {
+    APIKey      string  `json:"apiKey"`
+    Provider    string  `json:"provider"`
+    // PKCE code verifier, empty when the provider doesn't support PKCE
+    Verifier    string  `json:"verifier,omitempty"`
+}
+
+func stateKey(state string) string {
+    return "oauth:state:" + state
+}
+
+/*
+Begin starts a sign in for the user and returns the authorization URL. The
+state is stored in the session Redis with the user's API key and the PKCE
+verifier, and expires with OAuthSessionExpiration.
+*/
+func Begin(apiKey string, provider Provider) (string, error) {
+    if !provider.Configured() {
+        return "", ErrNotConfigured
+    }
+    // Tokens couldn't be stored at the end of the sign in
+    if _, err := tokenCipher(); err != nil {
+        return "", fmt.Errorf("%w: %v", ErrNotConfigured, err)
+    }
+
+    state, err := utils.GenerateSessionKey(config.OAuthSessionKeyLength, config.OAuthSessionCharset)
+    if err != nil {
+        return "", fmt.Errorf("failed to generate oauth state: %w", err)
+    }
+
+    current := session{APIKey: apiKey, Provider: provider.Name}
+    challenge := ""
+    if provider.PKCE {
+        if current.Verifier, err = utils.GenerateSessionKey(config.PKCEVerifierLength, config.PKCEVerifierCharset); err != nil {
+            return "", fmt.Errorf("failed to generate pkce verifier: %w", err)
+        }
+        challenge = codeChallenge(current.Verifier)
+    }
+
+    authURL, err := provider.AuthorizationURL(state, challenge)
+    if err != nil {
+        return "", err
+    }
+
+    sessionJSON, err := json.Marshal(current)
+    if err != nil {
+        return "", err
+    }
+    err = config.RedisSessionCache.Set(config.RedisSessionCacheCtx, stateKey(state), sessionJSON, config.OAuthSessionExpiration).Err()
+    if err != nil {
+        return "", fmt.Errorf("failed to store oauth session: %w", err)
+    }
+
+    return authURL, nil
+}
+
+// consume returns the session of a state and deletes it in the same command, so a state works once
+func consume(state string) (session, error) {
+    var current session
+    if state == "" {
+        return current, ErrInvalidState
+    }
+
+    sessionJSON, err := config.RedisSessionCache.GetDel(config.RedisSessionCacheCtx, stateKey(state)).Bytes()
+    if err == redis.Nil {
+        return current, ErrInvalidState
+    }
+    if err != nil {
+        return current, fmt.Errorf("failed to read oauth session: %w", err)
+    }
+
+    if err := json.Unmarshal(sessionJSON, &current); err != nil {
+        return current, fmt.Errorf("invalid oauth session: %w", err)
+    }
+    return current, nil
+}
+
+/*
+Complete finishes the sign in the callback was called for: the state is
+consumed, the code exchanged and the tokens stored encrypted for the user.
+An error from the provider (the user denied access) still consumes the state.
+*/
+func Complete(provider Provider, state, code, providerError string) error {
+    current, err := consume(state)
+    if err != nil {
+        return err
+    }
+    if current.Provider != provider.Name {
+        return ErrInvalidState
+    }
+    if providerError != "" {
+        return fmt.Errorf("%s returned %s", provider.Name, providerError)
+    }
+    if code == "" {
+        return fmt.Errorf("%s callback without a code", provider.Name)
+    }
+
+    token, err := provider.Exchange(code, current.Verifier)
+    if err != nil {
+        return err
+    }
+    return Save(current.APIKey, provider, token)
+}
+
+// DropSessions deletes the user's sign ins in progress and returns how many there were
+func DropSessions(apiKey string) (int, error) {
+    dropped := 0
+    states := config.RedisSessionCache.Scan(config.RedisSessionCacheCtx, 0, stateKey("*"), 100).Iterator()
+    for states.Next(config.RedisSessionCacheCtx) {
+        sessionJSON, err := config.RedisSessionCache.Get(config.RedisSessionCacheCtx, states.Val()).Bytes()
+        if err == redis.Nil {
+            continue
+        }
+        if err != nil {
+            return dropped, fmt.Errorf("failed to read oauth session: %w", err)
+        }
+
+        var current session
+        if json.Unmarshal(sessionJSON, &current) != nil || current.APIKey != apiKey {
+            continue
+        }
+        if err := config.RedisSessionCache.Del(config.RedisSessionCacheCtx, states.Val()).Err(); err != nil {
+            return dropped, fmt.Errorf("failed to delete oauth session: %w", err)
+        }
+        dropped++
+    }
+    if err := states.Err(); err != nil {
+        return dropped, fmt.Errorf("failed to list oauth sessions: %w", err)
+    }
+    return dropped, nil
+}
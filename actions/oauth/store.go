@@ -0,0 +1,177 @@
+package oauth
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "actions/config"
+    "actions/models"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+)
+
+// Access tokens expiring sooner than this are refreshed before use
+const refreshMargin = time.Minute
+
+// secrets are sealed together, everything else in the connection is in the clear
+type secrets struct {
+    AccessToken     string  `json:"accessToken"`
+    RefreshToken    string  `json:"refreshToken,omitempty"`
+}
+
+func binding(apiKey string, provider Provider) string {
+    return apiKey + "/" + provider.Name
+}
+
+func connectionPath(provider Provider) firestore.FieldPath {
+    return firestore.FieldPath{config.IntegrationsField, provider.Name}
+}
+
+// Save stores a new connection for the user, replacing any earlier one and its legacy credentials
+func Save(apiKey string, provider Provider, token Token) error {
+    return store(apiKey, provider, token, time.Now().UTC())
+}
+
+/*
+store updates only the provider's field of the user document, bookmarks,
+premium status and other integrations are left untouched.
+*/
+func store(apiKey string, provider Provider, token Token, connectedAt time.Time) error {
+    plaintext, err := json.Marshal(secrets{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken})
+    if err != nil {
+        return err
+    }
+    sealed, err := seal(plaintext, binding(apiKey, provider))
+    if err != nil {
+        return err
+    }
+
+    connection := models.OAuthConnection{
+        Tokens:      sealed,
+        TokenType:   token.TokenType,
+        ExpiresAt:   token.ExpiresAt,
+        Account:     token.Extra,
+        ConnectedAt: connectedAt,
+        UpdatedAt:   time.Now().UTC(),
+    }
+    updates := []firestore.Update{{FieldPath: connectionPath(provider), Value: connection}}
+    if provider.LegacyField != "" {
+        updates = append(updates, firestore.Update{Path: provider.LegacyField, Value: firestore.Delete})
+    }
+
+    if _, err := config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, updates); err != nil {
+        return fmt.Errorf("failed to store %s connection: %w", provider.Name, err)
+    }
+    return nil
+}
+
+// connection returns the user's stored connection and sealed secrets, migrating legacy plaintext credentials
+func connection(apiKey string, provider Provider) (models.OAuthConnection, secrets, error) {
+    doc, err := config.FirebaseClient.Collection("users").Doc(apiKey).Get(config.FirebaseCtx)
+    if err != nil {
+        return models.OAuthConnection{}, secrets{}, err
+    }
+
+    var user struct {
+        Integrations    map[string]models.OAuthConnection   `firestore:"integrations"`
+    }
+    if err := doc.DataTo(&user); err != nil {
+        return models.OAuthConnection{}, secrets{}, err
+    }
+
+    stored, found := user.Integrations[provider.Name]
+    if !found {
+        return migrateLegacy(apiKey, provider, doc.Data())
+    }
+
+    plaintext, err := open(stored.Tokens, binding(apiKey, provider))
+    if err != nil {
+        return models.OAuthConnection{}, secrets{}, err
+    }
+    var tokens secrets
+    if err := json.Unmarshal(plaintext, &tokens); err != nil {
+        return models.OAuthConnection{}, secrets{}, fmt.Errorf("invalid %s tokens: %w", provider.Name, err)
+    }
+    return stored, tokens, nil
+}
+
+func migrateLegacy(apiKey string, provider Provider, data map[string]interface{}) (models.OAuthConnection, secrets, error) {
+    legacy, _ := data[provider.LegacyField].(map[string]interface{})
+    accessToken, _ := legacy["access_token"].(string)
+    if provider.LegacyField == "" || accessToken == "" {
+        return models.OAuthConnection{}, secrets{}, ErrNotConnected
+    }
+
+    token := Token{AccessToken: accessToken, Extra: make(map[string]interface{})}
+    token.TokenType, _ = legacy["token_type"].(string)
+    token.RefreshToken, _ = legacy["refresh_token"].(string)
+    for name, value := range legacy {
+        if name != "access_token" && name != "refresh_token" && name != "token_type" {
+            token.Extra[name] = value
+        }
+    }
+
+    if err := Save(apiKey, provider, token); err != nil {
+        return models.OAuthConnection{}, secrets{}, err
+    }
+    utils.LogMessage(fmt.Sprintf("Migrated legacy %s credentials to encrypted storage", provider.Name), "green")
+    return models.OAuthConnection{TokenType: token.TokenType, Account: token.Extra}, secrets{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken}, nil
+}
+
+// Connection returns the non-secret details of the user's connection, ErrNotConnected without one
+func Connection(apiKey string, provider Provider) (models.OAuthConnection, error) {
+    stored, _, err := connection(apiKey, provider)
+    return stored, err
+}
+
+// AccessToken returns a usable access token for the user, refreshing it when it is about to expire
+func AccessToken(apiKey string, provider Provider) (string, error) {
+    stored, tokens, err := connection(apiKey, provider)
+    if err != nil {
+        return "", err
+    }
+    if stored.ExpiresAt.IsZero() || time.Until(stored.ExpiresAt) > refreshMargin {
+        return tokens.AccessToken, nil
+    }
+    if tokens.RefreshToken == "" {
+        return "", ErrNotConnected
+    }
+
+    token, err := provider.Refresh(tokens.RefreshToken)
+    if err != nil {
+        return "", err
+    }
+    if len(token.Extra) == 0 {
+        token.Extra = stored.Account
+    }
+    if err := store(apiKey, provider, token, stored.ConnectedAt); err != nil {
+        return "", err
+    }
+    return token.AccessToken, nil
+}
+
+/*
+Disconnect revokes the user's token at the provider and deletes it. A failed
+revocation is logged and the token is deleted anyway: the user asked for the
+connection to be gone.
+*/
+func Disconnect(apiKey string, provider Provider) error {
+    if _, tokens, err := connection(apiKey, provider); err == nil {
+        if err := provider.Revoke(tokens.AccessToken); err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to revoke %s token", provider.Name), "red", err)
+        }
+    } else if err != ErrNotConnected {
+        utils.LogMessage(fmt.Sprintf("Failed to read %s connection, deleting it without revoking", provider.Name), "red", err)
+    }
+
+    updates := []firestore.Update{{FieldPath: connectionPath(provider), Value: firestore.Delete}}
+    if provider.LegacyField != "" {
+        updates = append(updates, firestore.Update{Path: provider.LegacyField, Value: firestore.Delete})
+    }
+    if _, err := config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, updates); err != nil {
+        return fmt.Errorf("failed to delete %s connection: %w", provider.Name, err)
+    }
+    return nil
+}
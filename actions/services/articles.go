@@ -0,0 +1,143 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    "actions/config"
+    "actions/models"
+
+    "github.com/go-redis/redis/v8"
+)
+
+// The article isn't in the served feeds anymore, or was hidden by a moderator
+var ErrArticleNotFound = errors.New("article not found")
+
+/*
+FindArticle returns a curated article from the current feed version as
+feed-api serves it, with moderation edits applied.
+*/
+func FindArticle(stockicID string) (models.FeedArticle, error) {
+    articles, err := FindArticles([]string{stockicID})
+    if err != nil {
+        return models.FeedArticle{}, err
+    }
+    article, found := articles[stockicID]
+    if !found {
+        return models.FeedArticle{}, ErrArticleNotFound
+    }
+    return article, nil
+}
+
+/*
+FindArticles looks the articles up in one read of the current feed version,
+returning those served by StockicID. Articles not served anymore or hidden by
+a moderator are left out.
+*/
+func FindArticles(stockicIDs []string) (map[string]models.FeedArticle, error) {
+    if config.RedisNewsCache == nil {
+        return nil, errors.New("news cache unavailable")
+    }
+
+    found := make(map[string]models.FeedArticle)
+    version, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, config.FeedCurrentKey).Result()
+    if err == redis.Nil {
+        return found, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    wanted := make(map[string]bool, len(stockicIDs))
+    for _, stockicID := range stockicIDs {
+        wanted[stockicID] = true
+    }
+
+    for _, feedName := range []string{"headlines", "discover"} {
+        feedJSON, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, fmt.Sprintf("feed:%s:%s", version, feedName)).Bytes()
+        if err != nil {
+            return nil, fmt.Errorf("failed to load %s of version %s: %w", feedName, version, err)
+        }
+
+        var feed map[string]models.FeedResponse
+        if err := json.Unmarshal(feedJSON, &feed); err != nil {
+            return nil, fmt.Errorf("failed to decode %s of version %s: %w", feedName, version, err)
+        }
+
+        for _, response := range feed {
+            for _, article := range response.Articles {
+                if _, seen := found[article.StockicID]; wanted[article.StockicID] && !seen {
+                    found[article.StockicID] = article
+                }
+            }
+        }
+    }
+    if len(found) == 0 {
+        return found, nil
+    }
+
+    ids := make([]string, 0, len(found))
+    keys := make([]string, 0, len(found))
+    for stockicID, article := range found {
+        ids = append(ids, stockicID)
+        keys = append(keys, OverrideKey(article.URL))
+    }
+    overrides, err := config.RedisNewsCache.HMGet(config.RedisNewsCacheCtx, config.ModerationOverridesKey, keys...).Result()
+    if err != nil {
+        return nil, err
+    }
+    for index, stockicID := range ids {
+        overrideJSON, _ := overrides[index].(string)
+        article, err := ApplyOverride(found[stockicID], overrideJSON)
+        if err == ErrArticleNotFound {
+            delete(found, stockicID)
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+        found[stockicID] = article
+    }
+    return found, nil
+}
+
+// OverrideKey is the field of the article's moderation override, a hash of its URL as feed-api keys them
+func OverrideKey(url string) string {
+    hash := sha256.Sum256([]byte(url))
+    return hex.EncodeToString(hash[:])
+}
+
+/*
+ApplyOverride applies the moderation override of the article, none when
+overrideJSON is empty, the way feed-api does. Hidden articles return
+ErrArticleNotFound.
+*/
+func ApplyOverride(article models.FeedArticle, overrideJSON string) (models.FeedArticle, error) {
+    if overrideJSON == "" {
+        return article, nil
+    }
+
+    var override models.ArticleOverride
+    if err := json.Unmarshal([]byte(overrideJSON), &override); err != nil {
+        return models.FeedArticle{}, fmt.Errorf("invalid moderation override for %s: %w", article.StockicID, err)
+    }
+    if override.Hidden {
+        return models.FeedArticle{}, ErrArticleNotFound
+    }
+
+    if override.Title != nil {
+        article.Title = *override.Title
+    }
+    // Highlight offsets were computed on the curated text
+    if override.SummarizedContent != nil {
+        article.SummarizedContent = *override.SummarizedContent
+        article.NewsHighlights = [][]int{}
+    }
+    if override.CompaniesTags != nil {
+        article.CompaniesTags = override.CompaniesTags
+    }
+    return article, nil
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+    "context"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "actions/config"
+    "actions/models"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+    "google.golang.org/api/iterator"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+var (
+    ErrBookmarkNotFound = errors.New("bookmark not found")
+    ErrInvalidNewsID = errors.New("invalid news ID")
+    ErrInvalidCollection = errors.New("invalid collection name")
+    ErrNoteTooLong = errors.New("note is too long")
+    ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+func bookmarksRef(apiKey string) *firestore.CollectionRef {
+    return config.FirebaseClient.Collection("users").Doc(apiKey).Collection(config.BookmarksCollection)
+}
+
+// News IDs are document IDs, so they can't hold a path
+func ValidNewsID(newsID string) bool {
+    return newsID != "" && len(newsID) <= 256 && !strings.ContainsAny(newsID, "/") && newsID != "." && newsID != ".."
+}
+
+// NormalizeCollection trims a collection name, the default collection when empty
+func NormalizeCollection(name string) (string, error) {
+    name = strings.TrimSpace(name)
+    if name == "" {
+        return config.DefaultBookmarkCollection, nil
+    }
+    if len([]rune(name)) > config.MaxBookmarkCollectionLength {
+        return "", ErrInvalidCollection
+    }
+    return name, nil
+}
+
+// Snapshot keeps what a bookmark shows of an article
+func Snapshot(article models.FeedArticle) *models.ArticleSnapshot {
+    snapshot := &models.ArticleSnapshot{
+        StockicID:         article.StockicID,
+        Source:            article.Source,
+        Author:            article.Author,
+        Title:             article.Title,
+        URL:               article.URL,
+        URLToImage:        article.URLToImage,
+        PublishedAt:       article.PublishedAt,
+        SummarizedContent: article.SummarizedContent,
+        CompaniesTags:     article.CompaniesTags,
+        Highlights:        []models.Highlight{},
+        HighlightsUnit:    article.HighlightsUnit,
+        Sentiment:         article.Sentiment,
+        StoryID:           article.StoryID,
+    }
+    for _, highlight := range article.NewsHighlights {
+        if len(highlight) == 2 {
+            snapshot.Highlights = append(snapshot.Highlights, models.Highlight{Start: highlight[0], End: highlight[1]})
+        }
+    }
+    return snapshot
+}
+
+// FromSnapshot is the article a bookmark kept, for articles no longer served
+func FromSnapshot(snapshot models.ArticleSnapshot) models.FeedArticle {
+    article := models.FeedArticle{
+        StockicID:         snapshot.StockicID,
+        Source:            snapshot.Source,
+        Author:            snapshot.Author,
+        Title:             snapshot.Title,
+        URL:               snapshot.URL,
+        URLToImage:        snapshot.URLToImage,
+        PublishedAt:       snapshot.PublishedAt,
+        SummarizedContent: snapshot.SummarizedContent,
+        CompaniesTags:     snapshot.CompaniesTags,
+        NewsHighlights:    [][]int{},
+        HighlightsUnit:    snapshot.HighlightsUnit,
+        Sentiment:         snapshot.Sentiment,
+        StoryID:           snapshot.StoryID,
+    }
+    for _, highlight := range snapshot.Highlights {
+        article.NewsHighlights = append(article.NewsHighlights, []int{highlight.Start, highlight.End})
+    }
+    return article
+}
+
+// snapshotOf returns the article's snapshot, nil when it isn't served anymore
+func snapshotOf(newsID string) *models.ArticleSnapshot {
+    article, err := FindArticle(newsID)
+    if err != nil {
+        if err != ErrArticleNotFound {
+            utils.LogMessage(fmt.Sprintf("Failed to load article %s to snapshot it", newsID), "red", err)
+        }
+        return nil
+    }
+    return Snapshot(article)
+}
+
+/*
+migrateLegacyBookmarks moves the bookmarks of the user document's array into
+sub-documents, keeping their order, and removes the array. It runs before
+every bookmark operation and is a single read once a user is migrated.
+*/
+func migrateLegacyBookmarks(apiKey string) error {
+    userRef := config.FirebaseClient.Collection("users").Doc(apiKey)
+    doc, err := userRef.Get(config.FirebaseCtx)
+    if err != nil {
+        return err
+    }
+
+    legacy, _ := doc.Data()[config.LegacyBookmarksField].([]interface{})
+    if legacy == nil {
+        return nil
+    }
+
+    // Snapshots of every legacy bookmark come from a single read of the feeds
+    newsIDs := make([]string, 0, len(legacy))
+    for _, value := range legacy {
+        if newsID, ok := value.(string); ok && ValidNewsID(newsID) {
+            newsIDs = append(newsIDs, newsID)
+        }
+    }
+    articles, err := FindArticles(newsIDs)
+    if err != nil {
+        utils.LogMessage("Failed to load articles to snapshot migrated bookmarks", "red", err)
+    }
+
+    // Newest last in the array, so the first bookmark gets the earliest time
+    now := time.Now().UTC()
+    writer := config.FirebaseClient.BulkWriter(config.FirebaseCtx)
+    var jobs []*firestore.BulkWriterJob
+    for index, value := range legacy {
+        newsID, ok := value.(string)
+        if !ok || !ValidNewsID(newsID) {
+            continue
+        }
+
+        createdAt := now.Add(time.Duration(index-len(legacy)) * time.Millisecond)
+        bookmark := models.Bookmark{
+            NewsID:     newsID,
+            Collection: config.DefaultBookmarkCollection,
+            CreatedAt:  createdAt,
+            UpdatedAt:  createdAt,
+        }
+        if article, found := articles[newsID]; found {
+            bookmark.Article = Snapshot(article)
+        }
+        job, err := writer.Create(bookmarksRef(apiKey).Doc(newsID), bookmark)
+        if err != nil {
+            writer.End()
+            return err
+        }
+        jobs = append(jobs, job)
+    }
+    writer.End()
+
+    for _, job := range jobs {
+        // Already migrated by a concurrent request
+        if _, err := job.Results(); err != nil && status.Code(err) != codes.AlreadyExists {
+            return fmt.Errorf("failed to migrate bookmarks: %w", err)
+        }
+    }
+
+    _, err = userRef.Update(config.FirebaseCtx, []firestore.Update{
+        {Path: config.LegacyBookmarksField, Value: firestore.Delete},
+    })
+    if err != nil {
+        return err
+    }
+
+    utils.LogMessage(fmt.Sprintf("Migrated %d bookmarks to sub-documents", len(jobs)), "green")
+    return nil
+}
+
+/*
+AddBookmark bookmarks an article with a snapshot of it. Bookmarking it again
+keeps its creation time and only changes the collection or note given.
+created reports whether the bookmark is new.
+*/
+func AddBookmark(apiKey, newsID string, collection, note *string) (models.Bookmark, bool, error) {
+    if !ValidNewsID(newsID) {
+        return models.Bookmark{}, false, ErrInvalidNewsID
+    }
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return models.Bookmark{}, false, err
+    }
+
+    now := time.Now().UTC()
+    bookmark := models.Bookmark{NewsID: newsID, Collection: config.DefaultBookmarkCollection, CreatedAt: now, UpdatedAt: now}
+    if collection != nil {
+        name, err := NormalizeCollection(*collection)
+        if err != nil {
+            return models.Bookmark{}, false, err
+        }
+        bookmark.Collection = name
+    }
+    if note != nil {
+        if len([]rune(*note)) > config.MaxBookmarkNoteLength {
+            return models.Bookmark{}, false, ErrNoteTooLong
+        }
+        bookmark.Note = *note
+    }
+    bookmark.Article = snapshotOf(newsID)
+
+    _, err := bookmarksRef(apiKey).Doc(newsID).Create(config.FirebaseCtx, bookmark)
+    if status.Code(err) == codes.AlreadyExists {
+        if collection != nil || note != nil {
+            if err := UpdateBookmarks(apiKey, []string{newsID}, collection, note); err != nil {
+                return models.Bookmark{}, false, err
+            }
+        }
+        existing, err := GetBookmark(apiKey, newsID)
+        return existing, false, err
+    }
+    if err != nil {
+        return models.Bookmark{}, false, err
+    }
+    return bookmark, true, nil
+}
+
+func GetBookmark(apiKey, newsID string) (models.Bookmark, error) {
+    if !ValidNewsID(newsID) {
+        return models.Bookmark{}, ErrBookmarkNotFound
+    }
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return models.Bookmark{}, err
+    }
+
+    doc, err := bookmarksRef(apiKey).Doc(newsID).Get(config.FirebaseCtx)
+    if status.Code(err) == codes.NotFound {
+        return models.Bookmark{}, ErrBookmarkNotFound
+    }
+    if err != nil {
+        return models.Bookmark{}, err
+    }
+
+    var bookmark models.Bookmark
+    if err := doc.DataTo(&bookmark); err != nil {
+        return models.Bookmark{}, err
+    }
+    return bookmark, nil
+}
+
+/*
+ListBookmarks returns a page of bookmarks, newest first, optionally of one
+collection. The cursor is the nextCursor of the previous page, empty for the
+first one; the returned cursor is empty on the last page.
+*/
+func ListBookmarks(apiKey, collection string, limit int, cursor string) ([]models.Bookmark, string, error) {
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return nil, "", err
+    }
+    if limit <= 0 {
+        limit = config.DefaultBookmarksPageSize
+    }
+    if limit > config.MaxBookmarksPageSize {
+        limit = config.MaxBookmarksPageSize
+    }
+
+    query := bookmarksRef(apiKey).Query
+    if collection != "" {
+        query = query.Where("collection", "==", collection)
+    }
+    query = query.OrderBy("createdAt", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+    if cursor != "" {
+        createdAt, newsID, err := decodeCursor(cursor)
+        if err != nil {
+            return nil, "", err
+        }
+        query = query.StartAfter(createdAt, newsID)
+    }
+
+    docs, err := query.Limit(limit + 1).Documents(config.FirebaseCtx).GetAll()
+    if err != nil {
+        return nil, "", err
+    }
+
+    bookmarks := make([]models.Bookmark, 0, len(docs))
+    for _, doc := range docs {
+        var bookmark models.Bookmark
+        if err := doc.DataTo(&bookmark); err != nil {
+            return nil, "", err
+        }
+        bookmarks = append(bookmarks, bookmark)
+    }
+
+    nextCursor := ""
+    if len(bookmarks) > limit {
+        bookmarks = bookmarks[:limit]
+        last := bookmarks[limit-1]
+        nextCursor = encodeCursor(last.CreatedAt, last.NewsID)
+    }
+    return bookmarks, nextCursor, nil
+}
+
+/*
+BookmarkIDs returns the IDs of all the user's bookmarks, newest first, for
+clients predating pagination that expect every bookmark in one response.
+*/
+func BookmarkIDs(apiKey, collection string) ([]string, error) {
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return nil, err
+    }
+
+    query := bookmarksRef(apiKey).Select()
+    if collection != "" {
+        query = query.Where("collection", "==", collection)
+    }
+    docs, err := query.OrderBy("createdAt", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc).Documents(config.FirebaseCtx).GetAll()
+    if err != nil {
+        return nil, err
+    }
+
+    newsIDs := make([]string, 0, len(docs))
+    for _, doc := range docs {
+        newsIDs = append(newsIDs, doc.Ref.ID)
+    }
+    return newsIDs, nil
+}
+
+func encodeCursor(createdAt time.Time, newsID string) string {
+    return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(createdAt.UnixNano(), 10) + ":" + newsID))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return time.Time{}, "", ErrInvalidCursor
+    }
+    nanos, newsID, found := strings.Cut(string(raw), ":")
+    unixNano, err := strconv.ParseInt(nanos, 10, 64)
+    if !found || err != nil || !ValidNewsID(newsID) {
+        return time.Time{}, "", ErrInvalidCursor
+    }
+    return time.Unix(0, unixNano).UTC(), newsID, nil
+}
+
+// UpdateBookmarks moves bookmarks to a collection and/or sets their note, all of them or none when one is missing
+func UpdateBookmarks(apiKey string, newsIDs []string, collection, note *string) error {
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return err
+    }
+
+    updates := []firestore.Update{{Path: "updatedAt", Value: time.Now().UTC()}}
+    if collection != nil {
+        name, err := NormalizeCollection(*collection)
+        if err != nil {
+            return err
+        }
+        updates = append(updates, firestore.Update{Path: "collection", Value: name})
+    }
+    if note != nil {
+        if len([]rune(*note)) > config.MaxBookmarkNoteLength {
+            return ErrNoteTooLong
+        }
+        updates = append(updates, firestore.Update{Path: "note", Value: *note})
+    }
+
+    return config.FirebaseClient.RunTransaction(config.FirebaseCtx, func(ctx context.Context, transaction *firestore.Transaction) error {
+        refs := make([]*firestore.DocumentRef, 0, len(newsIDs))
+        for _, newsID := range newsIDs {
+            if !ValidNewsID(newsID) {
+                return ErrBookmarkNotFound
+            }
+            refs = append(refs, bookmarksRef(apiKey).Doc(newsID))
+        }
+
+        docs, err := transaction.GetAll(refs)
+        if err != nil {
+            return err
+        }
+        for _, doc := range docs {
+            if !doc.Exists() {
+                return ErrBookmarkNotFound
+            }
+        }
+        for _, ref := range refs {
+            if err := transaction.Update(ref, updates); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// RemoveBookmarks deletes bookmarks, IDs that aren't bookmarked are ignored
+func RemoveBookmarks(apiKey string, newsIDs []string) error {
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return err
+    }
+
+    writer := config.FirebaseClient.BulkWriter(config.FirebaseCtx)
+    var jobs []*firestore.BulkWriterJob
+    for _, newsID := range newsIDs {
+        if !ValidNewsID(newsID) {
+            continue
+        }
+        job, err := writer.Delete(bookmarksRef(apiKey).Doc(newsID))
+        if err != nil {
+            writer.End()
+            return err
+        }
+        jobs = append(jobs, job)
+    }
+    writer.End()
+
+    for _, job := range jobs {
+        if _, err := job.Results(); err != nil {
+            return fmt.Errorf("failed to remove bookmarks: %w", err)
+        }
+    }
+    return nil
+}
+
+// ListCollections returns the user's collections with their bookmark counts, by name
+func ListCollections(apiKey string) ([]models.BookmarkCollection, error) {
+    if err := migrateLegacyBookmarks(apiKey); err != nil {
+        return nil, err
+    }
+
+    iter := bookmarksRef(apiKey).Select("collection").Documents(config.FirebaseCtx)
+    defer iter.Stop()
+
+    counts := make(map[string]int)
+    for {
+        doc, err := iter.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        name, _ := doc.Data()["collection"].(string)
+        if name == "" {
+            name = config.DefaultBookmarkCollection
+        }
+        counts[name]++
+    }
+
+    collections := make([]models.BookmarkCollection, 0, len(counts))
+    for name, count := range counts {
+        collections = append(collections, models.BookmarkCollection{Name: name, Count: count})
+    }
+    sort.Slice(collections, func(i, j int) bool {
+        return collections[i].Name < collections[j].Name
+    })
+    return collections, nil
+}
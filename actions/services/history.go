@@ -0,0 +1,219 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "actions/config"
+    "actions/database"
+    "actions/models"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+    "google.golang.org/api/iterator"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+var (
+    ErrInvalidDwell = errors.New("invalid dwell time")
+    ErrInvalidProgress = errors.New("invalid progress")
+)
+
+func historyRef(apiKey string) *firestore.CollectionRef {
+    return config.FirebaseClient.Collection("users").Doc(apiKey).Collection(config.HistoryCollection)
+}
+
+/*
+RecordRead adds what the app reports of a read to the user's history: the
+dwell time is added up, the progress is the latest one and an article stays
+finished once it reached FinishedProgress. feed-api creates the entry on the
+detail view; reads it didn't see (offline, shared links) create it here.
+*/
+func RecordRead(apiKey string, request models.HistoryRecordRequest) (models.HistoryEntry, error) {
+    if !ValidNewsID(request.NewsID) {
+        return models.HistoryEntry{}, ErrInvalidNewsID
+    }
+    if request.DwellSeconds < 0 {
+        return models.HistoryEntry{}, ErrInvalidDwell
+    }
+    if request.Progress != nil && (*request.Progress < 0 || *request.Progress > 1) {
+        return models.HistoryEntry{}, ErrInvalidProgress
+    }
+
+    dwell := request.DwellSeconds
+    if maxDwell := int64(config.MaxDwellPerReport.Seconds()); dwell > maxDwell {
+        dwell = maxDwell
+    }
+
+    ref := historyRef(apiKey).Doc(request.NewsID)
+    var entry models.HistoryEntry
+    err := config.FirebaseClient.RunTransaction(config.FirebaseCtx, func(ctx context.Context, tx *firestore.Transaction) error {
+        now := time.Now().UTC()
+        doc, err := tx.Get(ref)
+        if status.Code(err) == codes.NotFound {
+            entry = models.HistoryEntry{
+                NewsID:      request.NewsID,
+                FirstReadAt: now,
+                Views:       1,
+            }
+            if snapshot := snapshotOf(request.NewsID); snapshot != nil {
+                entry.Title = snapshot.Title
+                entry.Source = snapshot.Source
+                entry.URLToImage = snapshot.URLToImage
+            }
+        } else if err != nil {
+            return err
+        } else if err := doc.DataTo(&entry); err != nil {
+            return err
+        }
+
+        entry.LastReadAt = now
+        entry.DwellSeconds += dwell
+        if request.Progress != nil {
+            entry.Progress = *request.Progress
+            entry.Finished = entry.Finished || entry.Progress >= config.FinishedProgress
+        }
+        return tx.Set(ref, entry)
+    })
+    if err != nil {
+        return models.HistoryEntry{}, err
+    }
+
+    PublishHistoryInvalidation(apiKey)
+    return entry, nil
+}
+
+/*
+ListHistory returns a page of the user's history, last read first. Unfinished
+only keeps the articles not read to the end, for "continue reading". Cursors
+work as in ListBookmarks.
+*/
+func ListHistory(apiKey string, unfinished bool, limit int, cursor string) ([]models.HistoryEntry, string, error) {
+    if limit <= 0 {
+        limit = config.DefaultHistoryPageSize
+    }
+    if limit > config.MaxHistoryPageSize {
+        limit = config.MaxHistoryPageSize
+    }
+
+    query := historyRef(apiKey).Query
+    if unfinished {
+        query = query.Where("finished", "==", false)
+    }
+    query = query.OrderBy("lastReadAt", firestore.Desc).OrderBy(firestore.DocumentID, firestore.Desc)
+    if cursor != "" {
+        lastReadAt, newsID, err := decodeCursor(cursor)
+        if err != nil {
+            return nil, "", err
+        }
+        query = query.StartAfter(lastReadAt, newsID)
+    }
+
+    docs, err := query.Limit(limit + 1).Documents(config.FirebaseCtx).GetAll()
+    if err != nil {
+        return nil, "", err
+    }
+
+    entries := make([]models.HistoryEntry, 0, len(docs))
+    for _, doc := range docs {
+        var entry models.HistoryEntry
+        if err := doc.DataTo(&entry); err != nil {
+            return nil, "", err
+        }
+        entries = append(entries, entry)
+    }
+
+    nextCursor := ""
+    if len(entries) > limit {
+        entries = entries[:limit]
+        last := entries[limit-1]
+        nextCursor = encodeCursor(last.LastReadAt, last.NewsID)
+    }
+    return entries, nextCursor, nil
+}
+
+/*
+ClearHistory deletes the user's reading history and the detail logs kept of
+their reads: the counters feed-api hasn't synced yet and the user-logs objects.
+A sync running meanwhile can still upload counters it already took, so
+user-logs is purged again after UserLogsRepurgeDelay.
+*/
+func ClearHistory(apiKey string) error {
+    if apiKey == "" {
+        return errors.New("missing API key")
+    }
+
+    writer := config.FirebaseClient.BulkWriter(config.FirebaseCtx)
+    var jobs []*firestore.BulkWriterJob
+    refs := historyRef(apiKey).DocumentRefs(config.FirebaseCtx)
+    for {
+        ref, err := refs.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            writer.End()
+            return err
+        }
+        job, err := writer.Delete(ref)
+        if err != nil {
+            writer.End()
+            return err
+        }
+        jobs = append(jobs, job)
+    }
+    writer.End()
+
+    for _, job := range jobs {
+        if _, err := job.Results(); err != nil {
+            return fmt.Errorf("failed to clear history: %w", err)
+        }
+    }
+    PublishHistoryInvalidation(apiKey)
+
+    if _, err := PurgeDetailLogs(apiKey); err != nil {
+        return err
+    }
+    time.AfterFunc(config.UserLogsRepurgeDelay, func() {
+        if _, err := PurgeDetailLogs(apiKey); err != nil {
+            utils.LogMessage("Failed to purge user logs again after clearing history", "red", err)
+        }
+    })
+    return nil
+}
+
+// PurgeDetailLogs drops the user's pending detail view counters and their user-logs objects, returning how many
+func PurgeDetailLogs(apiKey string) (int, error) {
+    purged := 0
+    if config.RedisLog != nil {
+        pattern := "endpoint:/detail/news:*/user:" + utils.EscapeRedisPattern(apiKey)
+        deleted, err := database.DeleteRedisKeys(config.RedisLogCtx, config.RedisLog, pattern)
+        if err != nil {
+            return deleted, fmt.Errorf("failed to drop pending detail logs: %w", err)
+        }
+        purged += deleted
+    } else {
+        utils.LogMessage("Log Redis unavailable, pending detail logs are synced to user-logs", "red")
+    }
+
+    removed, err := database.RemoveMinIOPrefix(config.MinIOClient, config.UserLogsBucket, apiKey+"/")
+    purged += removed
+    if err != nil {
+        return purged, fmt.Errorf("failed to purge user logs: %w", err)
+    }
+    return purged, nil
+}
+
+// Tells feed-api to drop its cached read state of the user
+func PublishHistoryInvalidation(apiKey string) {
+    if config.RedisAPICache == nil {
+        return
+    }
+    err := config.RedisAPICache.Publish(config.RedisAPICacheCtx, config.HistoryUpdatesChannel, apiKey).Err()
+    if err != nil {
+        utils.LogMessage("Failed to publish history invalidation, read markers update when feed-api's cache expires", "red", err)
+    }
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "time"
+
+    "actions/config"
+    "actions/models"
+
+    "cloud.google.com/go/firestore"
+    "google.golang.org/api/iterator"
+)
+
+// Device documents are keyed by a hash of the token, tokens are long and may contain '/'
+func deviceDocID(token string) string {
+    hash := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(hash[:16])
+}
+
+func devicesRef(apiKey string) *firestore.CollectionRef {
+    return config.FirebaseClient.Collection("users").Doc(apiKey).Collection(config.DevicesCollection)
+}
+
+/*
+RegisterDevice stores a push token for the user, refreshing it when it's
+already known. Apps re-register on every launch, so a user's oldest device
+is dropped past MaxDevicesPerUser: it most likely no longer exists.
+*/
+func RegisterDevice(apiKey string, device models.Device) error {
+    device.UpdatedAt = time.Now().UTC()
+    if _, err := devicesRef(apiKey).Doc(deviceDocID(device.Token)).Set(config.FirebaseCtx, device); err != nil {
+        return err
+    }
+
+    stale, err := devicesRef(apiKey).OrderBy("updatedAt", firestore.Desc).Offset(config.MaxDevicesPerUser).Documents(config.FirebaseCtx).GetAll()
+    if err != nil {
+        return fmt.Errorf("failed to list devices: %w", err)
+    }
+    for _, doc := range stale {
+        if _, err := doc.Ref.Delete(config.FirebaseCtx); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func RemoveDevice(apiKey, token string) error {
+    _, err := devicesRef(apiKey).Doc(deviceDocID(token)).Delete(config.FirebaseCtx)
+    return err
+}
+
+// ListDevicesByUser returns every registered device grouped by the user's API key
+func ListDevicesByUser() (map[string][]models.Device, error) {
+    iter := config.FirebaseClient.CollectionGroup(config.DevicesCollection).Documents(config.FirebaseCtx)
+    defer iter.Stop()
+
+    devices := make(map[string][]models.Device)
+    for {
+        doc, err := iter.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        // Only users/<X-API-Key>/devices, a devices collection elsewhere isn't ours
+        user := doc.Ref.Parent.Parent
+        if user == nil || user.Parent.ID != "users" {
+            continue
+        }
+
+        var device models.Device
+        if err := doc.DataTo(&device); err != nil || device.Token == "" {
+            continue
+        }
+        devices[user.ID] = append(devices[user.ID], device)
+    }
+
+    return devices, nil
+}
+
+// GetNotificationSettings returns the user's settings, the defaults for the user's country when never saved
+func GetNotificationSettings(apiKey string) (models.NotificationSettings, error) {
+    profile, err := GetProfile(apiKey)
+    if err != nil {
+        return models.NotificationSettings{}, err
+    }
+    return profile.Notifications, nil
+}
+
+func SaveNotificationSettings(apiKey string, settings models.NotificationSettings) error {
+    _, err := config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, []firestore.Update{
+        {Path: config.NotificationSettingsField, Value: settings},
+    })
+    return err
+}
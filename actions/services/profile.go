@@ -0,0 +1,104 @@
+package services
+
+import (
+    "fmt"
+    "time"
+
+    "actions/config"
+    "actions/models"
+    "actions/utils"
+
+    "cloud.google.com/go/firestore"
+)
+
+// userProfile is the part of the user document the profile is made of
+type userProfile struct {
+    CreatedAt       *time.Time                      `firestore:"createdAt"`
+    Country         string                          `firestore:"country"`
+    Language        string                          `firestore:"language"`
+    Categories      []string                        `firestore:"categories"`
+    Notifications   *models.NotificationSettings    `firestore:"notifications"`
+}
+
+/*
+profileOf reads the profile from the user document. Users created before
+sign up have none of it set: their country is DefaultCountry and their
+notifications the defaults, for the headlines of their country.
+*/
+func profileOf(doc *firestore.DocumentSnapshot) (models.Profile, error) {
+    var user userProfile
+    if err := doc.DataTo(&user); err != nil {
+        return models.Profile{}, err
+    }
+
+    // Read like the middleware does, anything but true isn't premium
+    premium, _ := doc.Data()["premium-status"].(bool)
+    profile := models.Profile{
+        CreatedAt:  user.CreatedAt,
+        Premium:    premium,
+        Country:    user.Country,
+        Language:   user.Language,
+        Categories: user.Categories,
+    }
+    if profile.Country == "" {
+        profile.Country = config.DefaultCountry
+    }
+    if profile.Categories == nil {
+        profile.Categories = []string{}
+    }
+
+    if user.Notifications == nil {
+        profile.Notifications = models.DefaultNotificationSettings()
+        profile.Notifications.Country = profile.Country
+    } else {
+        profile.Notifications = *user.Notifications
+    }
+    if profile.Notifications.Companies == nil {
+        profile.Notifications.Companies = []string{}
+    }
+    return profile, nil
+}
+
+func GetProfile(apiKey string) (models.Profile, error) {
+    doc, err := config.FirebaseClient.Collection("users").Doc(apiKey).Get(config.FirebaseCtx)
+    if err != nil {
+        return models.Profile{}, err
+    }
+    return profileOf(doc)
+}
+
+/*
+UpdateProfile changes the fields of the update that are set, leaving the
+rest of the user document alone, and drops the user's cached status: feed-api
+serves articles in the language it caches.
+*/
+func UpdateProfile(apiKey string, update models.ProfileUpdate) (models.Profile, error) {
+    var updates []firestore.Update
+    if update.Country != nil {
+        updates = append(updates, firestore.Update{Path: "country", Value: *update.Country})
+    }
+    if update.Language != nil {
+        var language interface{} = *update.Language
+        if *update.Language == "" {
+            language = firestore.Delete
+        }
+        updates = append(updates, firestore.Update{Path: "language", Value: language})
+    }
+    if update.Categories != nil {
+        updates = append(updates, firestore.Update{Path: "categories", Value: *update.Categories})
+    }
+    if update.Notifications != nil {
+        updates = append(updates, firestore.Update{Path: config.NotificationSettingsField, Value: *update.Notifications})
+    }
+
+    if len(updates) > 0 {
+        if _, err := config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, updates); err != nil {
+            return models.Profile{}, fmt.Errorf("failed to update profile: %w", err)
+        }
+        if err := PublishUserInvalidation(apiKey); err != nil {
+            utils.LogMessage("Failed to invalidate user status after a profile change", "red", err)
+        }
+    }
+
+    return GetProfile(apiKey)
+}
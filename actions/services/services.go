@@ -147,3 +147,18 @@ func CacheUserStatus(ctx context.Context, apiKey string, status models.UserStatu
 
     return err
 }
+
+/*
+PublishUserInvalidation drops the cached status of a user from Redis and tells
+feed-api's replicas to drop their in-process copy, after the user's Firestore
+document was created, changed or deleted.
+*/
+func PublishUserInvalidation(apiKey string) error {
+    if err := config.RedisAPICache.Del(config.RedisAPICacheCtx, fmt.Sprintf("apikey:%s", apiKey)).Err(); err != nil {
+        return fmt.Errorf("failed to drop cached user status: %w", err)
+    }
+    if err := config.RedisAPICache.Publish(config.RedisAPICacheCtx, config.UserUpdatesChannel, apiKey).Err(); err != nil {
+        return fmt.Errorf("failed to publish user invalidation: %w", err)
+    }
+    return nil
+}
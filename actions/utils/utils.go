@@ -6,10 +6,17 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Redis MATCH patterns treat these as wildcards
+var redisPatternEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
 func LogMessage(message, color string, errs ...error) {
     var err error
     if len(errs) > 0 {
@@ -56,3 +63,93 @@ func GenerateSessionKey(length int, charset string) (string, error) {
 	}
 	return string(key), nil
 }
+
+// EscapeRedisPattern quotes a value for a Redis MATCH pattern, API keys are user input
+func EscapeRedisPattern(value string) string {
+    return redisPatternEscaper.Replace(value)
+}
+
+/*
+GetClientIP returns the address of the client that made the request. Behind
+nginx every request comes from the proxy, so when the direct peer is a trusted
+proxy (TRUSTED_PROXIES, comma separated CIDRs) the X-Forwarded-For chain is
+walked from the right and the first hop that isn't a trusted proxy is used.
+Entries left of that are client supplied and can't be trusted.
+*/
+func GetClientIP(request *http.Request) string {
+    ip := request.RemoteAddr
+    if strings.Contains(ip, ":") {
+        if host, _, err := net.SplitHostPort(ip); err == nil {
+            ip = host
+        }
+    }
+
+    if !isTrustedProxy(ip) {
+        return ip
+    }
+
+    forwardedFor := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(forwardedFor) - 1; i >= 0; i-- {
+        hop := strings.TrimSpace(forwardedFor[i])
+        if net.ParseIP(hop) == nil {
+            break
+        }
+        if !isTrustedProxy(hop) {
+            return hop
+        }
+        ip = hop
+    }
+
+    return ip
+}
+
+var (
+    trustedProxies     []*net.IPNet
+    trustedProxiesOnce sync.Once
+)
+
+func isTrustedProxy(ip string) bool {
+    trustedProxiesOnce.Do(func() {
+        trustedProxies = ParseCIDRList(os.Getenv("TRUSTED_PROXIES"))
+    })
+    return IPInNetworks(ip, trustedProxies)
+}
+
+// ParseCIDRList parses comma separated CIDRs; bare IPs are accepted as single-address networks
+func ParseCIDRList(value string) []*net.IPNet {
+    var networks []*net.IPNet
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+                entry += "/32"
+            } else {
+                entry += "/128"
+            }
+        }
+
+        _, network, err := net.ParseCIDR(entry)
+        if err != nil {
+            LogMessage(fmt.Sprintf("Ignoring invalid CIDR: %s", entry), "red", err)
+            continue
+        }
+        networks = append(networks, network)
+    }
+    return networks
+}
+
+func IPInNetworks(ip string, networks []*net.IPNet) bool {
+    parsed := net.ParseIP(ip)
+    if parsed == nil {
+        return false
+    }
+    for _, network := range networks {
+        if network.Contains(parsed) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,256 @@
+package abuse
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "feed-api/config"
+    "feed-api/models"
+    "feed-api/utils"
+
+    "github.com/go-redis/redis/v8"
+    "google.golang.org/api/iterator"
+)
+
+/*
+Every suspicious request adds points to the client IP's score. Scores decay
+exponentially, so occasional mistakes (a stale API key, a typo in a path)
+never add up to a ban, while a scanner crosses the threshold within a few
+requests. Crossing it bans the IP temporarily; each repeat offence within
+StrikeMemory doubles the ban, up to MaxBan.
+*/
+type Event string
+
+const (
+    EventUnknownPath    Event = "unknown-path"
+    EventMissingAPIKey  Event = "missing-api-key"
+    EventInvalidAPIKey  Event = "invalid-api-key"
+    EventInvalidAdminKey Event = "invalid-admin-key"
+
+    ScoreThreshold = 30.0
+    ScoreHalfLife = 10 * time.Minute
+
+    BaseBan = 15 * time.Minute
+    MaxBan = 7 * 24 * time.Hour
+    StrikeMemory = 30 * 24 * time.Hour
+
+    scoreKeyPrefix = "abuse:score:"
+    banKeyPrefix = "abuse:ban:"
+    strikesKeyPrefix = "abuse:strikes:"
+
+    // Ban records are kept in the same collection the old permanent blocks used
+    BlockedCollection = "blocked"
+)
+
+var eventWeights = map[Event]float64{
+    EventUnknownPath:     10,
+    EventMissingAPIKey:   3,
+    EventInvalidAPIKey:   5,
+    EventInvalidAdminKey: 15,
+}
+
+/*
+Decay and increment have to happen atomically, concurrent requests from the
+same IP would otherwise overwrite each other's points.
+KEYS[1] score hash, ARGV: weight, now (ms), half-life (ms), ttl (ms)
+*/
+var scoreScript = redis.NewScript(`
+local score = tonumber(redis.call("HGET", KEYS[1], "score") or "0")
+local updated = tonumber(redis.call("HGET", KEYS[1], "updated") or ARGV[2])
+local elapsed = math.max(0, tonumber(ARGV[2]) - updated)
+score = score * math.pow(0.5, elapsed / tonumber(ARGV[3])) + tonumber(ARGV[1])
+redis.call("HSET", KEYS[1], "score", tostring(score), "updated", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[4])
+return tostring(score)
+`)
+
+var (
+    allowlist     []*net.IPNet
+    allowlistOnce sync.Once
+)
+
+// Allowlisted networks (ABUSE_ALLOWLIST, comma separated CIDRs) are never scored or banned
+func IsAllowlisted(ip string) bool {
+    allowlistOnce.Do(func() {
+        allowlist = utils.ParseCIDRList(os.Getenv("ABUSE_ALLOWLIST"))
+    })
+    return utils.IPInNetworks(ip, allowlist)
+}
+
+/*
+Record adds an event to the IP's score and bans the IP once the score crosses
+the threshold. It returns the ban if one was issued.
+*/
+func Record(ip string, event Event) *models.Ban {
+    if ip == "" || IsAllowlisted(ip) {
+        return nil
+    }
+
+    weight, known := eventWeights[event]
+    if !known {
+        return nil
+    }
+
+    now := time.Now()
+    result, err := scoreScript.Run(config.RedisAPICacheCtx, config.RedisAPICache,
+        []string{scoreKeyPrefix + ip},
+        weight, now.UnixMilli(), ScoreHalfLife.Milliseconds(), (8 * ScoreHalfLife).Milliseconds(),
+    ).Text()
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to record abuse event %s for %s", event, ip), "red", err)
+        return nil
+    }
+
+    score, _ := strconv.ParseFloat(result, 64)
+    utils.LogMessage(fmt.Sprintf("Abuse event %s from %s, score %.1f", event, ip, score), "red")
+    if score < ScoreThreshold {
+        return nil
+    }
+
+    ban, err := banIP(ip, string(event), now)
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to ban %s", ip), "red", err)
+        return nil
+    }
+    return ban
+}
+
+func banIP(ip, reason string, now time.Time) (*models.Ban, error) {
+    strikes, err := config.RedisAPICache.Incr(config.RedisAPICacheCtx, strikesKeyPrefix+ip).Result()
+    if err != nil {
+        return nil, err
+    }
+    config.RedisAPICache.Expire(config.RedisAPICacheCtx, strikesKeyPrefix+ip, StrikeMemory)
+
+    duration := time.Duration(float64(BaseBan) * math.Pow(2, float64(strikes-1)))
+    if duration > MaxBan || duration <= 0 {
+        duration = MaxBan
+    }
+
+    ban := models.Ban{
+        IP:        ip,
+        Reason:    reason,
+        Strikes:   strikes,
+        BannedAt:  now.UTC(),
+        ExpiresAt: now.Add(duration).UTC(),
+    }
+
+    banJSON, err := json.Marshal(ban)
+    if err != nil {
+        return nil, err
+    }
+
+    pipe := config.RedisAPICache.TxPipeline()
+    pipe.Set(config.RedisAPICacheCtx, banKeyPrefix+ip, banJSON, duration)
+    pipe.Del(config.RedisAPICacheCtx, scoreKeyPrefix+ip)
+    if _, err := pipe.Exec(config.RedisAPICacheCtx); err != nil {
+        return nil, err
+    }
+
+    // Firestore keeps the record for auditing, Redis alone enforces it
+    _, err = config.FirebaseClient.Collection(BlockedCollection).Doc(ip).Set(config.FirebaseCtx, ban)
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to store ban record for %s in Firebase", ip), "red", err)
+    }
+
+    utils.LogMessage(fmt.Sprintf("Banned %s for %v (strike %d, %s)", ip, duration, strikes, reason), "red")
+    return &ban, nil
+}
+
+// ActiveBan returns the IP's current ban, or nil when it may make requests
+func ActiveBan(ip string) (*models.Ban, error) {
+    banJSON, err := config.RedisAPICache.Get(config.RedisAPICacheCtx, banKeyPrefix+ip).Result()
+    if err == redis.Nil {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    var ban models.Ban
+    if err := json.Unmarshal([]byte(banJSON), &ban); err != nil {
+        return nil, err
+    }
+    return &ban, nil
+}
+
+func Status(ip string) (*models.AbuseStatus, error) {
+    status := &models.AbuseStatus{IP: ip, Allowlisted: IsAllowlisted(ip)}
+
+    scoreFields, err := config.RedisAPICache.HGetAll(config.RedisAPICacheCtx, scoreKeyPrefix+ip).Result()
+    if err != nil {
+        return nil, err
+    }
+    if score, err := strconv.ParseFloat(scoreFields["score"], 64); err == nil {
+        updated, _ := strconv.ParseInt(scoreFields["updated"], 10, 64)
+        elapsed := time.Since(time.UnixMilli(updated))
+        status.Score = score * math.Pow(0.5, float64(elapsed)/float64(ScoreHalfLife))
+    }
+
+    strikes, err := config.RedisAPICache.Get(config.RedisAPICacheCtx, strikesKeyPrefix+ip).Int64()
+    if err != nil && err != redis.Nil {
+        return nil, err
+    }
+    status.Strikes = strikes
+
+    status.Ban, err = ActiveBan(ip)
+    return status, err
+}
+
+func ListBans() ([]models.Ban, error) {
+    bans := []models.Ban{}
+    iter := config.RedisAPICache.Scan(config.RedisAPICacheCtx, 0, banKeyPrefix+"*", 100).Iterator()
+    for iter.Next(config.RedisAPICacheCtx) {
+        ban, err := ActiveBan(strings.TrimPrefix(iter.Val(), banKeyPrefix))
+        if err != nil {
+            return nil, err
+        }
+        if ban != nil {
+            bans = append(bans, *ban)
+        }
+    }
+    return bans, iter.Err()
+}
+
+/*
+Unban lifts the ban and forgets the IP's score and strikes, so the next
+offence starts from the shortest ban again. It also removes the Firestore
+record, including permanent blocks from before bans expired.
+*/
+func Unban(ip string) error {
+    err := config.RedisAPICache.Del(config.RedisAPICacheCtx, banKeyPrefix+ip, scoreKeyPrefix+ip, strikesKeyPrefix+ip).Err()
+    if err != nil {
+        return err
+    }
+
+    _, err = config.FirebaseClient.Collection(BlockedCollection).Doc(ip).Delete(config.FirebaseCtx)
+    if err != nil {
+        return fmt.Errorf("failed to delete ban record from Firebase: %w", err)
+    }
+
+    // Legacy blocks were added with generated document IDs
+    iter := config.FirebaseClient.Collection(BlockedCollection).Where("ip", "==", ip).Documents(config.FirebaseCtx)
+    defer iter.Stop()
+    for {
+        doc, err := iter.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("failed to read legacy blocks from Firebase: %w", err)
+        }
+        if _, err := doc.Ref.Delete(config.FirebaseCtx); err != nil {
+            return fmt.Errorf("failed to delete legacy block from Firebase: %w", err)
+        }
+    }
+
+    utils.LogMessage(fmt.Sprintf("Unbanned %s", ip), "green")
+    return nil
+}
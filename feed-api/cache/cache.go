@@ -0,0 +1,177 @@
+package cache
+
+import (
+    "container/list"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+/*
+LRU is a size-bounded in-process cache with a per-entry TTL. It sits in front
+of Redis for values that are read on every request (decoded feeds, user
+statuses), so a hit costs neither a network round trip nor a JSON decode.
+Values are shared between requests and must be treated as read-only.
+*/
+type LRU[V any] struct {
+    mutex       sync.Mutex
+    capacity    int
+    ttl         time.Duration
+    items       map[string]*list.Element
+    order       *list.List
+    layer       *Layer
+}
+
+type entry[V any] struct {
+    key         string
+    value       V
+    expiresAt   time.Time
+}
+
+func NewLRU[V any](capacity int, ttl time.Duration, layer *Layer) *LRU[V] {
+    return &LRU[V]{
+        capacity: capacity,
+        ttl:      ttl,
+        items:    make(map[string]*list.Element),
+        order:    list.New(),
+        layer:    layer,
+    }
+}
+
+func (lru *LRU[V]) Get(key string) (V, bool) {
+    lru.mutex.Lock()
+    defer lru.mutex.Unlock()
+
+    var zero V
+    element, found := lru.items[key]
+    if !found {
+        lru.layer.Miss()
+        return zero, false
+    }
+
+    cached := element.Value.(*entry[V])
+    if time.Now().After(cached.expiresAt) {
+        lru.order.Remove(element)
+        delete(lru.items, key)
+        lru.layer.Miss()
+        return zero, false
+    }
+
+    lru.order.MoveToFront(element)
+    lru.layer.Hit()
+    return cached.value, true
+}
+
+func (lru *LRU[V]) Set(key string, value V) {
+    lru.mutex.Lock()
+    defer lru.mutex.Unlock()
+
+    expiresAt := time.Now().Add(lru.ttl)
+    if element, found := lru.items[key]; found {
+        cached := element.Value.(*entry[V])
+        cached.value, cached.expiresAt = value, expiresAt
+        lru.order.MoveToFront(element)
+        return
+    }
+
+    lru.items[key] = lru.order.PushFront(&entry[V]{key: key, value: value, expiresAt: expiresAt})
+
+    for lru.order.Len() > lru.capacity {
+        oldest := lru.order.Back()
+        lru.order.Remove(oldest)
+        delete(lru.items, oldest.Value.(*entry[V]).key)
+        lru.layer.Evict()
+    }
+}
+
+func (lru *LRU[V]) Delete(key string) {
+    lru.mutex.Lock()
+    defer lru.mutex.Unlock()
+
+    if element, found := lru.items[key]; found {
+        lru.order.Remove(element)
+        delete(lru.items, key)
+    }
+}
+
+func (lru *LRU[V]) Purge() {
+    lru.mutex.Lock()
+    defer lru.mutex.Unlock()
+
+    lru.items = make(map[string]*list.Element)
+    lru.order.Init()
+    lru.layer.Invalidate()
+}
+
+func (lru *LRU[V]) Len() int {
+    lru.mutex.Lock()
+    defer lru.mutex.Unlock()
+    return lru.order.Len()
+}
+
+/*
+Layer counts what happens at one level of a lookup chain (in-process, Redis,
+Firestore). The counters are cumulative since startup.
+*/
+type Layer struct {
+    name            string
+    hits            atomic.Uint64
+    misses          atomic.Uint64
+    errors          atomic.Uint64
+    evictions       atomic.Uint64
+    invalidations   atomic.Uint64
+}
+
+type LayerStats struct {
+    Hits            uint64  `json:"hits"`
+    Misses          uint64  `json:"misses"`
+    Errors          uint64  `json:"errors"`
+    Evictions       uint64  `json:"evictions"`
+    Invalidations   uint64  `json:"invalidations"`
+    HitRatio        float64 `json:"hitRatio"`
+}
+
+var (
+    layersMutex sync.Mutex
+    layers      = make(map[string]*Layer)
+)
+
+// NewLayer registers a named layer; asking for the same name twice returns the same counters
+func NewLayer(name string) *Layer {
+    layersMutex.Lock()
+    defer layersMutex.Unlock()
+
+    if layer, exists := layers[name]; exists {
+        return layer
+    }
+    layer := &Layer{name: name}
+    layers[name] = layer
+    return layer
+}
+
+func (layer *Layer) Hit()        { layer.hits.Add(1) }
+func (layer *Layer) Miss()       { layer.misses.Add(1) }
+func (layer *Layer) Error()      { layer.errors.Add(1) }
+func (layer *Layer) Evict()      { layer.evictions.Add(1) }
+func (layer *Layer) Invalidate() { layer.invalidations.Add(1) }
+
+func Snapshot() map[string]LayerStats {
+    layersMutex.Lock()
+    defer layersMutex.Unlock()
+
+    snapshot := make(map[string]LayerStats, len(layers))
+    for name, layer := range layers {
+        stats := LayerStats{
+            Hits:          layer.hits.Load(),
+            Misses:        layer.misses.Load(),
+            Errors:        layer.errors.Load(),
+            Evictions:     layer.evictions.Load(),
+            Invalidations: layer.invalidations.Load(),
+        }
+        if lookups := stats.Hits + stats.Misses; lookups > 0 {
+            stats.HitRatio = float64(stats.Hits) / float64(lookups)
+        }
+        snapshot[name] = stats
+    }
+    return snapshot
+}
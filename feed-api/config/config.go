@@ -35,7 +35,54 @@ var (
 
 const (
     APIKeyCacheExpiration = 24 * time.Hour
+
+    // In-process caches in front of Redis. TTLs only bound staleness when an invalidation message is missed.
+    FeedMemoryCacheTTL = 10 * time.Minute
+    FeedMemoryCacheSize = 16
+    UserStatusMemoryCacheTTL = 2 * time.Minute
+    UserStatusMemoryCacheSize = 50000
+    // Archived articles never change, IDs missing from the archive are retried after a few minutes
+    ArchivedArticleCacheTTL = 6 * time.Hour
+    ArchivedArticleCacheSize = 5000
+    MissingArticleCacheTTL = 5 * time.Minute
+    // Read state of a user's recent history, dropped on history-updates
+    ReadStateCacheTTL = 2 * time.Minute
+    ReadStateCacheSize = 20000
+
+    // Published by the curator (news cache) when a new feed is stored and by feed-api on moderation changes
+    FeedUpdatesChannel = "feed-updates"
+    // Published on the API cache with the API key whose status changed
+    UserUpdatesChannel = "user-updates"
+    // Published on the API cache with the API key whose reading history changed, by feed-api and actions
+    HistoryUpdatesChannel = "history-updates"
+
+    // The curator promotes a version by pointing feed:current at it, feeds live under feed:<version>:<feed>
+    FeedCurrentKey = "feed:current"
+    FeedUpdatedAtKey = "feed:updated-at"
+    // Bumped by moderation changes, combined with the feed version for HTTP caching
+    ModerationVersionKey = "moderation:version"
+    ModerationUpdatedAtKey = "moderation:updated-at"
+    // Clients reuse a feed page this long before revalidating it with If-None-Match
+    FeedMaxAge = 60 * time.Second
+
+    // The curator stores every summarized article as articles/<stockicID>.json in its archive bucket
+    ArticleArchiveBucket = "summarized-news-archive"
+    ArticleIndexPrefix = "articles/"
+
     VersionPrefix = "/api/v2"
     Logfile = "feed-api.log"
     FirebaseConfigFile = "./secrets/stockic-b6c89-firebase-adminsdk-wr64l-a8e3bdf5e7.json"
+
+    // Moderation overrides live in Firestore and are mirrored into the news cache for serving
+    AdminKeyEnv = "FEED_API_ADMIN_KEY"
+    // By URL hash, renamed from the StockicID keyed hash so it's rebuilt (and migrated) from Firestore
+    ModerationOverridesKey = "moderation:overrides:url"
+    ModerationOverridesSyncedKey = "moderation:overrides:url:synced"
+    ModerationOverridesCollection = "moderation-overrides"
+    ModerationAuditCollection = "moderation-audit"
+
+    // Reading history lives in users/<X-API-Key>/history, one document per article
+    HistoryCollection = "history"
+    // Articles marked read on feeds, the most recently read ones
+    ReadStateLimit = 500
 )
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"feed-api/abuse"
+	"feed-api/models"
+	"feed-api/services"
+	"feed-api/utils"
+)
+
+/*
+AdminArticlesHandler serves the moderation API under /admin/articles:
+
+    GET    /admin/articles?feed=<headlines|discover>&key=<country|category>
+    GET    /admin/articles/<id>
+    PATCH  /admin/articles/<id>                 {"title", "content", "companyTags"}
+    DELETE /admin/articles/<id>                 drops every override of the article
+    POST   /admin/articles/<id>/<action>        hide, unhide, pin, unpin, category {"category"}
+
+Listings show the curated articles, hidden ones included, next to their override.
+*/
+func AdminArticlesHandler(httpHandler http.ResponseWriter, request *http.Request) {
+    pathParts := strings.Split(strings.TrimSuffix(request.URL.Path, "/"), "/")
+    // "", api, v2, admin, articles, <id>, <action>
+    if len(pathParts) < 5 || len(pathParts) > 7 {
+        utils.DeliverJsonError(httpHandler, "Invalid URL", http.StatusBadRequest)
+        return
+    }
+
+    if len(pathParts) == 5 {
+        if request.Method != http.MethodGet {
+            utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        listAdminArticles(httpHandler, request)
+        return
+    }
+
+    stockicID := pathParts[5]
+    placements, err := findCuratedArticle(stockicID)
+    if err != nil {
+        utils.LogMessage("Failed to load curated feeds for moderation", "red", err)
+        utils.DeliverJsonError(httpHandler, "Failed to fetch news", http.StatusInternalServerError)
+        return
+    }
+    if len(placements) == 0 {
+        utils.DeliverJsonError(httpHandler, "Article not found", http.StatusNotFound)
+        return
+    }
+
+    // Placements are the same article, overrides follow its URL across curator runs
+    url := placements[0].Article.URL
+    before, err := services.GetOverride(url)
+    if err != nil {
+        utils.LogMessage("Failed to load moderation override", "red", err)
+        utils.DeliverJsonError(httpHandler, "Failed to load moderation state", http.StatusInternalServerError)
+        return
+    }
+
+    override := models.ArticleOverride{StockicID: stockicID, URL: url}
+    if before != nil {
+        override = *before
+        override.StockicID = stockicID
+    }
+
+    actor := request.Header.Get("X-Admin-User")
+    clientIP := utils.GetClientIP(request)
+
+    if len(pathParts) == 6 {
+        switch request.Method {
+        case http.MethodGet:
+            for i := range placements {
+                placements[i].Override = before
+            }
+            deliverAdminJSON(httpHandler, http.StatusOK, placements)
+
+        case http.MethodPatch:
+            var edit models.ArticleEditRequest
+            if err := json.NewDecoder(request.Body).Decode(&edit); err != nil {
+                utils.DeliverJsonError(httpHandler, "Invalid request body", http.StatusBadRequest)
+                return
+            }
+            if edit.Title == nil && edit.SummarizedContent == nil && edit.CompaniesTags == nil {
+                utils.DeliverJsonError(httpHandler, "Nothing to edit", http.StatusBadRequest)
+                return
+            }
+
+            if edit.Title != nil {
+                override.Title = edit.Title
+            }
+            if edit.SummarizedContent != nil {
+                override.SummarizedContent = edit.SummarizedContent
+            }
+            if edit.CompaniesTags != nil {
+                override.CompaniesTags = edit.CompaniesTags
+            }
+            saveAdminOverride(httpHandler, override, before, "edit", actor, clientIP)
+
+        case http.MethodDelete:
+            if before == nil {
+                utils.DeliverJsonError(httpHandler, "Article has no override", http.StatusNotFound)
+                return
+            }
+            if err := services.DeleteOverride(stockicID, before, actor, clientIP); err != nil {
+                utils.LogMessage("Failed to delete moderation override", "red", err)
+                utils.DeliverJsonError(httpHandler, "Failed to restore article", http.StatusInternalServerError)
+                return
+            }
+            deliverAdminJSON(httpHandler, http.StatusOK, map[string]string{"message": "Article restored"})
+
+        default:
+            utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+        }
+        return
+    }
+
+    if request.Method != http.MethodPost {
+        utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    action := pathParts[6]
+    switch action {
+    case "hide":
+        override.Hidden = true
+    case "unhide":
+        override.Hidden = false
+    case "pin":
+        override.Pinned = true
+    case "unpin":
+        override.Pinned = false
+    case "category":
+        var categoryRequest models.CategoryRequest
+        if err := json.NewDecoder(request.Body).Decode(&categoryRequest); err != nil {
+            utils.DeliverJsonError(httpHandler, "Invalid request body", http.StatusBadRequest)
+            return
+        }
+
+        discover, err := services.LoadFeed("discover")
+        if err != nil {
+            utils.DeliverJsonError(httpHandler, "Failed to fetch category news", http.StatusInternalServerError)
+            return
+        }
+        if _, exists := discover[categoryRequest.Category]; !exists && categoryRequest.Category != "" {
+            utils.DeliverJsonError(httpHandler, "Category not found", http.StatusBadRequest)
+            return
+        }
+        override.Category = categoryRequest.Category
+    default:
+        utils.DeliverJsonError(httpHandler, "Unknown moderation action", http.StatusBadRequest)
+        return
+    }
+
+    saveAdminOverride(httpHandler, override, before, action, actor, clientIP)
+}
+
+// AdminAuditHandler lists the moderation audit trail, newest first, optionally for one article (?id=)
+func AdminAuditHandler(httpHandler http.ResponseWriter, request *http.Request) {
+    if request.Method != http.MethodGet {
+        utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    limit := 50
+    if limitStr := request.URL.Query().Get("limit"); limitStr != "" {
+        parsed, err := strconv.Atoi(limitStr)
+        if err != nil || parsed < 1 || parsed > 500 {
+            utils.DeliverJsonError(httpHandler, "Invalid limit", http.StatusBadRequest)
+            return
+        }
+        limit = parsed
+    }
+
+    entries, err := services.ListModerationAudit(request.URL.Query().Get("id"), limit)
+    if err != nil {
+        utils.LogMessage("Failed to list moderation audit", "red", err)
+        utils.DeliverJsonError(httpHandler, "Failed to fetch audit trail", http.StatusInternalServerError)
+        return
+    }
+
+    deliverAdminJSON(httpHandler, http.StatusOK, entries)
+}
+
+/*
+AdminBlockedHandler manages abuse bans:
+
+    GET    /admin/blocked           active bans
+    GET    /admin/blocked/<ip>      score, strikes and ban of one IP
+    DELETE /admin/blocked/<ip>      lift the ban and reset the IP's history
+*/
+func AdminBlockedHandler(httpHandler http.ResponseWriter, request *http.Request) {
+    pathParts := strings.Split(strings.TrimSuffix(request.URL.Path, "/"), "/")
+    // "", api, v2, admin, blocked, <ip>
+    if len(pathParts) == 5 {
+        if request.Method != http.MethodGet {
+            utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+
+        bans, err := abuse.ListBans()
+        if err != nil {
+            utils.LogMessage("Failed to list bans", "red", err)
+            utils.DeliverJsonError(httpHandler, "Failed to list bans", http.StatusInternalServerError)
+            return
+        }
+        deliverAdminJSON(httpHandler, http.StatusOK, bans)
+        return
+    }
+
+    if len(pathParts) != 6 || net.ParseIP(pathParts[5]) == nil {
+        utils.DeliverJsonError(httpHandler, "Invalid IP", http.StatusBadRequest)
+        return
+    }
+    ip := pathParts[5]
+
+    switch request.Method {
+    case http.MethodGet:
+        status, err := abuse.Status(ip)
+        if err != nil {
+            utils.LogMessage("Failed to get abuse status", "red", err)
+            utils.DeliverJsonError(httpHandler, "Failed to get abuse status", http.StatusInternalServerError)
+            return
+        }
+        deliverAdminJSON(httpHandler, http.StatusOK, status)
+    case http.MethodDelete:
+        if err := abuse.Unban(ip); err != nil {
+            utils.LogMessage("Failed to unban", "red", err)
+            utils.DeliverJsonError(httpHandler, "Failed to unban", http.StatusInternalServerError)
+            return
+        }
+        utils.LogMessage(fmt.Sprintf("%s unbanned %s", request.Header.Get("X-Admin-User"), ip), "green")
+        deliverAdminJSON(httpHandler, http.StatusOK, map[string]string{"message": "IP unblocked"})
+    default:
+        utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+/*
+AdminCacheHandler exposes the in-process cache layers:
+
+    GET    /admin/cache     hits, misses, errors and evictions per layer
+    DELETE /admin/cache     purge the decoded feeds on every replica
+*/
+func AdminCacheHandler(httpHandler http.ResponseWriter, request *http.Request) {
+    switch request.Method {
+    case http.MethodGet:
+        deliverAdminJSON(httpHandler, http.StatusOK, services.GetCacheStats())
+    case http.MethodDelete:
+        services.PublishFeedInvalidation("admin:" + request.Header.Get("X-Admin-User"))
+        deliverAdminJSON(httpHandler, http.StatusOK, map[string]string{"message": "Feed caches purged"})
+    default:
+        utils.DeliverJsonError(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+func listAdminArticles(httpHandler http.ResponseWriter, request *http.Request) {
+    feeds := []string{"headlines", "discover"}
+    if feed := request.URL.Query().Get("feed"); feed != "" {
+        if feed != "headlines" && feed != "discover" {
+            utils.DeliverJsonError(httpHandler, "Unknown feed", http.StatusBadRequest)
+            return
+        }
+        feeds = []string{feed}
+    }
+    key := request.URL.Query().Get("key")
+
+    overrides, err := services.GetOverrides()
+    if err != nil {
+        utils.LogMessage("Failed to load moderation overrides", "red", err)
+        utils.DeliverJsonError(httpHandler, "Failed to load moderation state", http.StatusInternalServerError)
+        return
+    }
+
+    articles := []models.AdminArticle{}
+    for _, feedName := range feeds {
+        feed, err := services.LoadFeed(feedName)
+        if err != nil {
+            utils.DeliverJsonError(httpHandler, "Failed to fetch news", http.StatusInternalServerError)
+            return
+        }
+
+        for feedKey, response := range feed {
+            if key != "" && feedKey != key {
+                continue
+            }
+            for _, article := range response.Articles {
+                adminArticle := models.AdminArticle{Feed: feedName, Key: feedKey, Article: article}
+                if override, exists := overrides[services.OverrideKey(article.URL)]; exists {
+                    adminArticle.Override = &override
+                }
+                articles = append(articles, adminArticle)
+            }
+        }
+    }
+
+    deliverAdminJSON(httpHandler, http.StatusOK, articles)
+}
+
+// Every feed and key the curated (unmoderated) article appears under
+func findCuratedArticle(stockicID string) ([]models.AdminArticle, error) {
+    var placements []models.AdminArticle
+    for _, feedName := range []string{"headlines", "discover"} {
+        feed, err := services.LoadFeed(feedName)
+        if err != nil {
+            return nil, err
+        }
+
+        for feedKey, response := range feed {
+            for _, article := range response.Articles {
+                if article.StockicID == stockicID {
+                    placements = append(placements, models.AdminArticle{Feed: feedName, Key: feedKey, Article: article})
+                }
+            }
+        }
+    }
+
+    return placements, nil
+}
+
+func saveAdminOverride(httpHandler http.ResponseWriter, override models.ArticleOverride, before *models.ArticleOverride, action, actor, clientIP string) {
+    if err := services.SaveOverride(override, before, action, actor, clientIP); err != nil {
+        utils.LogMessage("Failed to save moderation override", "red", err)
+        utils.DeliverJsonError(httpHandler, "Failed to save moderation change", http.StatusInternalServerError)
+        return
+    }
+
+    deliverAdminJSON(httpHandler, http.StatusOK, override)
+}
+
+func deliverAdminJSON(httpHandler http.ResponseWriter, statusCode int, payload interface{}) {
+    httpHandler.Header().Set("Content-Type", "application/json")
+    httpHandler.WriteHeader(statusCode)
+    if err := json.NewEncoder(httpHandler).Encode(payload); err != nil {
+        utils.LogMessage("JSON Encoder in admin handler Failed", "red", err)
+    }
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 
+	"feed-api/abuse"
 	"feed-api/config"
 	"feed-api/models"
 	"feed-api/services"
@@ -45,19 +46,31 @@ func HeadlinesHandler(httpHandler http.ResponseWriter, request *http.Request) {
         return
     }
 
-    headlinesData, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, "headlines").Result()
+    collapse, validView := storiesView(request)
+    if !validView {
+        utils.DeliverJsonError(httpHandler, "Invalid view, expected articles or stories", http.StatusBadRequest)
+        return
+    }
+
+    readState := requestReadState(request)
+    if checkNotModified(httpHandler, request, readState) {
+        return
+    }
+
+    headlines, err := services.LoadModeratedFeed("headlines")
     if err != nil {
+        clearValidators(httpHandler)
         http.Error(httpHandler, "Failed to fetch headlines", http.StatusInternalServerError)
         return
     }
 
-    var headlines map[string]models.SummarizedResponse
-    if err := json.Unmarshal([]byte(headlinesData), &headlines); err != nil {
-        http.Error(httpHandler, "Failed to parse headlines data", http.StatusInternalServerError)
-        return
+    articles := headlines["us"].Articles
+    if collapse {
+        articles = services.CollapseStories(articles)
     }
 
-    response := services.PaginateArticles(headlines["us"].Articles, 1, pageSize)
+    response := services.PaginateArticles(articles, 1, pageSize)
+    response.Articles = withReadMarkers(services.LocalizeArticles(response.Articles, requestLanguages(request)), readState)
     
     httpHandler.Header().Set("Content-Type", "application/json")
     err = json.NewEncoder(httpHandler).Encode(response)
@@ -92,21 +105,33 @@ func NewsFeedHandler(httpHandler http.ResponseWriter, request *http.Request) {
         return
     }
 
+    collapse, validView := storiesView(request)
+    if !validView {
+        utils.DeliverJsonError(httpHandler, "Invalid view, expected articles or stories", http.StatusBadRequest)
+        return
+    }
+
+    readState := requestReadState(request)
+    if checkNotModified(httpHandler, request, readState) {
+        return
+    }
+
     // Fetch headlines from Redis
-    headlinesData, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, "headlines").Result()
+    headlines, err := services.LoadModeratedFeed("headlines")
     if err != nil {
+        clearValidators(httpHandler)
         http.Error(httpHandler, "Failed to fetch news", http.StatusInternalServerError)
         return
     }
 
-    var headlines map[string]models.SummarizedResponse
-    if err := json.Unmarshal([]byte(headlinesData), &headlines); err != nil {
-        http.Error(httpHandler, "Failed to parse news data", http.StatusInternalServerError)
-        return
+    articles := headlines["us"].Articles
+    if collapse {
+        articles = services.CollapseStories(articles)
     }
 
     // Return paginated articles
-    response := services.PaginateArticles(headlines["us"].Articles, page, pageSize)
+    response := services.PaginateArticles(articles, page, pageSize)
+    response.Articles = withReadMarkers(services.LocalizeArticles(response.Articles, requestLanguages(request)), readState)
     
     httpHandler.Header().Set("Content-Type", "application/json")
     err = json.NewEncoder(httpHandler).Encode(response)
@@ -147,19 +172,29 @@ func DiscoverHandler(httpHandler http.ResponseWriter, request *http.Request) {
         return
     }
 
-    discoverData, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, "discover").Result()
-    if err != nil {
-        http.Error(httpHandler, "Failed to fetch category news", http.StatusInternalServerError)
+    sentiment := request.URL.Query().Get("sentiment")
+    if sentiment != "" && sentiment != "positive" && sentiment != "neutral" && sentiment != "negative" {
+        utils.DeliverJsonError(httpHandler, "Invalid sentiment, expected positive, neutral or negative", http.StatusBadRequest)
         return
     }
 
-    var categorizedNews map[string]models.SummarizedResponse
-    if err := json.Unmarshal([]byte(discoverData), &categorizedNews); err != nil {
-        http.Error(httpHandler, "Failed to parse category news data", http.StatusInternalServerError)
+    collapse, validView := storiesView(request)
+    if !validView {
+        utils.DeliverJsonError(httpHandler, "Invalid view, expected articles or stories", http.StatusBadRequest)
         return
     }
 
-    fmt.Println(categorizedNews)
+    readState := requestReadState(request)
+    if checkNotModified(httpHandler, request, readState) {
+        return
+    }
+
+    categorizedNews, err := services.LoadModeratedFeed("discover")
+    if err != nil {
+        clearValidators(httpHandler)
+        http.Error(httpHandler, "Failed to fetch category news", http.StatusInternalServerError)
+        return
+    }
 
     categoryNews, exists := categorizedNews[category]
     if !exists {
@@ -167,7 +202,16 @@ func DiscoverHandler(httpHandler http.ResponseWriter, request *http.Request) {
         return
     }
 
-    response := services.PaginateArticles(categoryNews.Articles, page, pageSize)
+    articles := categoryNews.Articles
+    if sentiment != "" {
+        articles = services.FilterBySentiment(articles, sentiment)
+    }
+    if collapse {
+        articles = services.CollapseStories(articles)
+    }
+
+    response := services.PaginateArticles(articles, page, pageSize)
+    response.Articles = withReadMarkers(services.LocalizeArticles(response.Articles, requestLanguages(request)), readState)
     
     httpHandler.Header().Set("Content-Type", "application/json")
     err = json.NewEncoder(httpHandler).Encode(response)
@@ -190,24 +234,47 @@ func DetailHandler(httpHandler http.ResponseWriter, request *http.Request) {
 
     newsID := pathParts[len(pathParts)-1]
 
-    headlinesData, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, "headlines").Result()
+    headlinesData, err := services.LoadFeed("headlines")
     if err != nil {
         http.Error(httpHandler, "Failed to fetch headlines", http.StatusInternalServerError)
         return
     }
 
-    discoverData, err := config.RedisNewsCache.Get(config.RedisAPICacheCtx, "discover").Result()
+    discoverData, err := services.LoadFeed("discover")
     if err != nil {
         http.Error(httpHandler, "Failed to fetch discover news", http.StatusInternalServerError)
         return
     }
 
     article := services.FindArticleByID(newsID, headlinesData, discoverData)
+    if article == nil {
+        // Bookmarked and shared articles outlive the feed, older ones are read from the archive
+        article, err = services.GetArchivedArticle(newsID)
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to read archived article %s", newsID), "red", err)
+            http.Error(httpHandler, "Failed to fetch article", http.StatusInternalServerError)
+            return
+        }
+    }
     if article == nil {
         http.Error(httpHandler, "Article not found", http.StatusNotFound)
         return
     }
 
+    override, err := services.GetOverride(article.URL)
+    if err != nil {
+        utils.LogMessage("Failed to load moderation override, serving curated article", "red", err)
+    }
+
+    moderatedArticle, visible := services.ApplyArticleOverride(*article, override)
+    if !visible {
+        http.Error(httpHandler, "Article not found", http.StatusNotFound)
+        return
+    }
+    readArticle := moderatedArticle
+    moderatedArticle = services.LocalizeArticle(moderatedArticle, requestLanguages(request))
+    article = &moderatedArticle
+
     httpHandler.Header().Set("Content-Type", "application/json")
     err = json.NewEncoder(httpHandler).Encode(article)
     if err != nil {
@@ -217,6 +284,7 @@ func DetailHandler(httpHandler http.ResponseWriter, request *http.Request) {
     // Log Request
     utils.LogMessage("Started logging detail request", "green")
     apiKey := request.Header.Get("X-API-Key")
+    go services.RecordView(apiKey, readArticle)
     redisKey := "endpoint:/detail/news:" + newsID + "/user:" + apiKey 
     utils.LogMessage(fmt.Sprintf("Redis Key:%s", redisKey), "green")
 
@@ -234,30 +302,74 @@ func DetailHandler(httpHandler http.ResponseWriter, request *http.Request) {
     */
 }
 
+/*
+StoryHandler serves one story: the aggregated summary and every article of
+the story still visible after moderation.
+*/
+func StoryHandler(httpHandler http.ResponseWriter, request *http.Request) {
+    if request.Method != http.MethodGet {
+        http.Error(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    pathParts := strings.Split(request.URL.Path, "/")
+    if len(pathParts) < 5 || pathParts[4] == "" {
+        utils.DeliverJsonError(httpHandler, "Invalid URL", http.StatusBadRequest)
+        return
+    }
+
+    storyID := pathParts[4]
+
+    readState := requestReadState(request)
+    if checkNotModified(httpHandler, request, readState) {
+        return
+    }
+
+    story, err := services.GetStory(storyID, requestLanguages(request))
+    if err != nil {
+        clearValidators(httpHandler)
+        http.Error(httpHandler, "Failed to fetch story", http.StatusInternalServerError)
+        return
+    }
+    if story == nil {
+        clearValidators(httpHandler)
+        utils.DeliverJsonError(httpHandler, "Story not found", http.StatusNotFound)
+        return
+    }
+    story.Articles = withReadMarkers(story.Articles, readState)
+
+    httpHandler.Header().Set("Content-Type", "application/json")
+    err = json.NewEncoder(httpHandler).Encode(story)
+    if err != nil {
+        utils.LogMessage("JSON Encoder in storyHandler() Failed", "red", err)
+    }
+}
+
+// ?view=stories shows one card per story, the default ?view=articles every article
+func storiesView(request *http.Request) (bool, bool) {
+    switch request.URL.Query().Get("view") {
+    case "", "articles":
+        return false, true
+    case "stories":
+        return true, true
+    default:
+        return false, false
+    }
+}
+
+/*
+Unknown paths are only ever hit by scanners, but a single hit isn't enough to
+block: the client IP may be a shared NAT or the proxy itself. Each hit adds to
+the IP's abuse score and the global middleware enforces the resulting bans.
+*/
 func FallbackHandler(httpHandler http.ResponseWriter, request *http.Request) {
     clientIP := utils.GetClientIP(request)
-    utils.LogMessage(fmt.Sprintf("Intrusion IP detected: %s", clientIP), "red")
-	if services.IsBlocked(clientIP) {
-		http.Error(httpHandler, "You are Blocked", http.StatusForbidden)
-		return
-	}
-
-    /* Now this would have been practical if I want to unblock
-    suspected IPs after sometime like 1 hour. But since we know that
-    legit IPs don't have any chance of accessing invalid endpoints, we 
-    are blocking them permenantly and storing them in Firebase. 
-    We can allow them from backend only in case we need to. */
-    // blockIP(clientIP)
-
-    utils.LogMessage(fmt.Sprintf("IP: %s wasn't blocked", clientIP), "red")
-
-	err := services.SaveBlockedIPToFirebase(clientIP)
-	if err != nil {
-		utils.LogMessage("Failed to store blocked IP in Firebase", "red", err)
-		http.Error(httpHandler, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	http.Error(httpHandler, "Invalid Endpoint Accessed, You are Blocked", http.StatusNotFound)
-	utils.LogMessage(fmt.Sprintf("Blocked IP: %s\n", clientIP), "green")
+    utils.LogMessage(fmt.Sprintf("Intrusion IP detected: %s requested %s", clientIP, request.URL.Path), "red")
+
+    if ban := abuse.Record(clientIP, abuse.EventUnknownPath); ban != nil {
+        utils.DeliverJsonError(httpHandler, "Invalid Endpoint Accessed, You are Blocked", http.StatusForbidden)
+        return
+    }
+
+    utils.DeliverJsonError(httpHandler, "Invalid Endpoint", http.StatusNotFound)
 }
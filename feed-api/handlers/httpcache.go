@@ -0,0 +1,122 @@
+package handlers
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "feed-api/config"
+    "feed-api/models"
+    "feed-api/services"
+    "feed-api/utils"
+)
+
+/*
+checkNotModified sets the HTTP validators of a feed response and answers 304
+when the client's copy is still current, returning true if it did. The ETag is
+derived from the feed version, the request's path and query, the languages
+the articles are served in and the user's latest read, so it changes when the
+curator publishes, a moderator edits, the user picks another language or reads
+an article, and differs per page. It is weak because the same representation
+may be sent gzipped or not.
+
+Handlers call it before loading the feed: the version and read state are read
+first, so the content sent is never older than the ETag it is labelled with.
+Without a read state the response goes out without validators, its read
+markers can't be revalidated.
+*/
+func checkNotModified(httpHandler http.ResponseWriter, request *http.Request, readState *models.ReadState) bool {
+    if readState == nil {
+        return false
+    }
+
+    meta, err := services.GetFeedMeta()
+    if err != nil {
+        utils.LogMessage("Failed to read feed version, serving without validators", "red", err)
+        return false
+    }
+    if meta.Version == "" {
+        return false
+    }
+
+    etag := feedETag(meta.Version, request, requestLanguages(request), readState.UpdatedAt)
+    updatedAt := meta.UpdatedAt
+    if !updatedAt.IsZero() && readState.UpdatedAt.After(updatedAt) {
+        updatedAt = readState.UpdatedAt
+    }
+
+    header := httpHandler.Header()
+    header.Set("ETag", etag)
+    header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d, must-revalidate", int(config.FeedMaxAge.Seconds())))
+    header.Add("Vary", "X-API-Key")
+    header.Add("Vary", "Accept-Language")
+    if !updatedAt.IsZero() {
+        header.Set("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+    }
+
+    if !notModified(request, etag, updatedAt) {
+        return false
+    }
+
+    httpHandler.WriteHeader(http.StatusNotModified)
+    return true
+}
+
+// Failed responses must not be stored under the feed's validators
+func clearValidators(httpHandler http.ResponseWriter) {
+    header := httpHandler.Header()
+    header.Del("ETag")
+    header.Del("Last-Modified")
+    header.Set("Cache-Control", "no-store")
+}
+
+func feedETag(version string, request *http.Request, languages []string, lastReadAt time.Time) string {
+    hash := sha256.Sum256([]byte(version + "\n" + request.URL.Path + "?" + request.URL.RawQuery + "\n" + strings.Join(languages, ",") + "\n" + strconv.FormatInt(lastReadAt.UnixNano(), 10)))
+    return `W/"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// If-None-Match takes precedence over If-Modified-Since (RFC 9110 13.2.2)
+func notModified(request *http.Request, etag string, updatedAt time.Time) bool {
+    if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+        for _, candidate := range strings.Split(ifNoneMatch, ",") {
+            candidate = strings.TrimSpace(candidate)
+            if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+                return true
+            }
+        }
+        return false
+    }
+
+    if updatedAt.IsZero() {
+        return false
+    }
+
+    ifModifiedSince, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+    if err != nil {
+        return false
+    }
+
+    return !updatedAt.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// requestReadState returns the user's read state, nil when it couldn't be read
+func requestReadState(request *http.Request) *models.ReadState {
+    readState, err := services.GetReadState(request.Header.Get("X-API-Key"))
+    if err != nil {
+        utils.LogMessage("Failed to read reading history, serving without read markers", "red", err)
+        return nil
+    }
+    return &readState
+}
+
+// withReadMarkers marks the articles the user read, leaving them unmarked without a read state
+func withReadMarkers(articles []models.SummarizedArticle, readState *models.ReadState) []models.SummarizedArticle {
+    if readState == nil {
+        return articles
+    }
+    return services.MarkRead(articles, *readState)
+}
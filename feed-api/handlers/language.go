@@ -0,0 +1,132 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+
+    "feed-api/models"
+    "feed-api/services"
+    "feed-api/utils"
+)
+
+/*
+requestLanguages lists the languages to serve articles in, most preferred
+first: the language saved in the user's profile, then the Accept-Language
+header by q-value. Articles fall back to their own language when none match.
+*/
+func requestLanguages(request *http.Request) []string {
+    var languages []string
+    if language := services.GetUserStatus(request.Header.Get("X-API-Key")).Language; language != "" {
+        languages = append(languages, language)
+    }
+
+    for _, language := range parseAcceptLanguage(request.Header.Get("Accept-Language")) {
+        duplicate := false
+        for _, existing := range languages {
+            duplicate = duplicate || existing == language
+        }
+        if !duplicate {
+            languages = append(languages, language)
+        }
+    }
+
+    return languages
+}
+
+// parseAcceptLanguage returns the primary subtags of an Accept-Language header by descending q-value
+func parseAcceptLanguage(header string) []string {
+    type weighted struct {
+        language    string
+        quality     float64
+    }
+
+    var ranges []weighted
+    for _, part := range strings.Split(header, ",") {
+        fields := strings.Split(strings.TrimSpace(part), ";")
+        language := strings.ToLower(strings.TrimSpace(fields[0]))
+        if index := strings.Index(language, "-"); index >= 0 {
+            language = language[:index]
+        }
+        if !services.ValidLanguage(language) {
+            continue
+        }
+
+        quality := 1.0
+        for _, parameter := range fields[1:] {
+            parameter = strings.TrimSpace(parameter)
+            if strings.HasPrefix(parameter, "q=") {
+                if value, err := strconv.ParseFloat(parameter[2:], 64); err == nil {
+                    quality = value
+                }
+            }
+        }
+        if quality > 0 {
+            ranges = append(ranges, weighted{language, quality})
+        }
+    }
+
+    sort.SliceStable(ranges, func(i, j int) bool {
+        return ranges[i].quality > ranges[j].quality
+    })
+
+    languages := make([]string, 0, len(ranges))
+    seen := make(map[string]bool)
+    for _, entry := range ranges {
+        if !seen[entry.language] {
+            seen[entry.language] = true
+            languages = append(languages, entry.language)
+        }
+    }
+    return languages
+}
+
+/*
+PreferencesHandler reads (GET) and saves (PUT) the user's feed preferences.
+Only the language is stored for now; an empty language goes back to
+Accept-Language and the articles' own languages.
+*/
+func PreferencesHandler(httpHandler http.ResponseWriter, request *http.Request) {
+    apiKey := request.Header.Get("X-API-Key")
+
+    switch request.Method {
+    case http.MethodGet:
+        preferences := models.Preferences{Language: services.GetUserStatus(apiKey).Language}
+
+        httpHandler.Header().Set("Content-Type", "application/json")
+        if err := json.NewEncoder(httpHandler).Encode(preferences); err != nil {
+            utils.LogMessage("JSON Encoder in preferencesHandler() Failed", "red", err)
+        }
+
+    case http.MethodPut:
+        var preferences models.Preferences
+        decoder := json.NewDecoder(http.MaxBytesReader(httpHandler, request.Body, 1<<10))
+        decoder.DisallowUnknownFields()
+        if err := decoder.Decode(&preferences); err != nil {
+            utils.DeliverJsonError(httpHandler, "Invalid preferences", http.StatusBadRequest)
+            return
+        }
+
+        preferences.Language = strings.ToLower(strings.TrimSpace(preferences.Language))
+        if preferences.Language != "" && !services.ValidLanguage(preferences.Language) {
+            utils.DeliverJsonError(httpHandler, "Invalid language, expected an ISO 639-1 code such as en or de", http.StatusBadRequest)
+            return
+        }
+
+        if err := services.SetUserLanguage(apiKey, preferences.Language); err != nil {
+            utils.LogMessage("Failed to save user language", "red", err)
+            http.Error(httpHandler, "Failed to save preferences", http.StatusInternalServerError)
+            return
+        }
+
+        httpHandler.Header().Set("Content-Type", "application/json")
+        if err := json.NewEncoder(httpHandler).Encode(preferences); err != nil {
+            utils.LogMessage("JSON Encoder in preferencesHandler() Failed", "red", err)
+        }
+
+    default:
+        http.Error(httpHandler, "Method not allowed", http.StatusMethodNotAllowed)
+    }
+}
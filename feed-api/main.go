@@ -18,6 +18,7 @@ func init() {
 func main() {
     go services.SyncLogRedisToMinIO()
     go services.PushAppLogToMinIO()
+    go services.SubscribeInvalidations()
 
     defer config.RedisAPICacheCtxCancel()
     defer config.RedisNewsCacheCtxCancel()
@@ -27,7 +28,7 @@ func main() {
 
     port := ":8080"
     fmt.Printf("\033[36m Starting server on port %s...\033[0m \n", port)
-    err := http.ListenAndServe(port, nil)
+    err := http.ListenAndServe(port, middleware.AbuseMiddleware(middleware.CompressionMiddleware(http.DefaultServeMux)))
     if err != nil {
         fmt.Printf("\033[31m Could not start server: %s \033[0m \n", err)
     }
@@ -39,5 +40,13 @@ func setupRoutes() {
     http.HandleFunc(config.VersionPrefix + "/newsfeed/", middleware.RequestMiddleware(handlers.NewsFeedHandler))
     http.HandleFunc(config.VersionPrefix + "/discover/", middleware.RequestMiddleware(handlers.DiscoverHandler))
     http.HandleFunc(config.VersionPrefix + "/detail/", middleware.RequestMiddleware(handlers.DetailHandler))
+    http.HandleFunc(config.VersionPrefix + "/story/", middleware.RequestMiddleware(handlers.StoryHandler))
+    http.HandleFunc(config.VersionPrefix + "/preferences", middleware.RequestMiddleware(handlers.PreferencesHandler))
+    http.HandleFunc(config.VersionPrefix + "/admin/articles", middleware.AdminMiddleware(handlers.AdminArticlesHandler))
+    http.HandleFunc(config.VersionPrefix + "/admin/articles/", middleware.AdminMiddleware(handlers.AdminArticlesHandler))
+    http.HandleFunc(config.VersionPrefix + "/admin/audit", middleware.AdminMiddleware(handlers.AdminAuditHandler))
+    http.HandleFunc(config.VersionPrefix + "/admin/blocked", middleware.AdminMiddleware(handlers.AdminBlockedHandler))
+    http.HandleFunc(config.VersionPrefix + "/admin/blocked/", middleware.AdminMiddleware(handlers.AdminBlockedHandler))
+    http.HandleFunc(config.VersionPrefix + "/admin/cache", middleware.AdminMiddleware(handlers.AdminCacheHandler))
     http.HandleFunc("/", handlers.FallbackHandler)
 }
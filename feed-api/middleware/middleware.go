@@ -1,12 +1,23 @@
 package middleware
 
 import (
+	"compress/gzip"
+	"crypto/subtle"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"feed-api/abuse"
+	"feed-api/config"
 	"feed-api/services"
 	"feed-api/utils"
+
+	"github.com/andybalholm/brotli"
 )
 
 func RequestMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -17,6 +28,7 @@ func RequestMiddleware(next http.HandlerFunc) http.HandlerFunc {
         if apiKey == "" {
             http.Error(httpHandler, "No API Key", http.StatusNotFound)
             utils.LogMessage("User with no API Key tried to access", "red")
+            abuse.Record(utils.GetClientIP(request), abuse.EventMissingAPIKey)
             return
         }
 
@@ -24,6 +36,7 @@ func RequestMiddleware(next http.HandlerFunc) http.HandlerFunc {
         if !userExists {
             http.Error(httpHandler, "User doesn't exist", http.StatusNotFound)
             utils.LogMessage("User with no registeration tried to access", "red")
+            abuse.Record(utils.GetClientIP(request), abuse.EventInvalidAPIKey)
             return
         }
 
@@ -40,3 +53,200 @@ func RequestMiddleware(next http.HandlerFunc) http.HandlerFunc {
         utils.LogMessage(logStatement, "green")
     }
 }
+
+/*
+AdminMiddleware guards the moderation endpoints. Admins authenticate with the
+shared secret from FEED_API_ADMIN_KEY in X-Admin-Key, and name themselves in
+X-Admin-User for the audit trail. With no key configured every admin request
+is refused rather than left open.
+*/
+func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+    return func(httpHandler http.ResponseWriter, request *http.Request) {
+        startTime := time.Now()
+
+        adminKey := os.Getenv(config.AdminKeyEnv)
+        if adminKey == "" {
+            utils.DeliverJsonError(httpHandler, "Admin API is disabled", http.StatusForbidden)
+            return
+        }
+
+        providedKey := request.Header.Get("X-Admin-Key")
+        if subtle.ConstantTimeCompare([]byte(providedKey), []byte(adminKey)) != 1 {
+            utils.LogMessage(fmt.Sprintf("Invalid admin key from %s", utils.GetClientIP(request)), "red")
+            abuse.Record(utils.GetClientIP(request), abuse.EventInvalidAdminKey)
+            utils.DeliverJsonError(httpHandler, "Unauthorized", http.StatusUnauthorized)
+            return
+        }
+
+        if request.Header.Get("X-Admin-User") == "" {
+            utils.DeliverJsonError(httpHandler, "Missing X-Admin-User header", http.StatusBadRequest)
+            return
+        }
+
+        next.ServeHTTP(httpHandler, request)
+        duration := time.Since(startTime)
+        logStatement := fmt.Sprintf("Admin request to %s by %s took %v", request.URL.Path, request.Header.Get("X-Admin-User"), duration)
+        utils.LogMessage(logStatement, "green")
+    }
+}
+
+/*
+AbuseMiddleware wraps the whole mux so a banned IP is refused on every
+endpoint, not just the fallback. If the ban store can't be reached requests
+are let through: failing open keeps the API up when Redis is degraded.
+*/
+func AbuseMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(httpHandler http.ResponseWriter, request *http.Request) {
+        clientIP := utils.GetClientIP(request)
+        if abuse.IsAllowlisted(clientIP) {
+            next.ServeHTTP(httpHandler, request)
+            return
+        }
+
+        ban, err := abuse.ActiveBan(clientIP)
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to check ban for %s", clientIP), "red", err)
+        }
+        if ban != nil {
+            retryAfter := int(time.Until(ban.ExpiresAt).Seconds()) + 1
+            httpHandler.Header().Set("Retry-After", fmt.Sprintf("%d", retryAfter))
+            utils.DeliverJsonError(httpHandler, "You are Blocked", http.StatusForbidden)
+            return
+        }
+
+        next.ServeHTTP(httpHandler, request)
+    })
+}
+
+/*
+CompressionMiddleware compresses responses with brotli or gzip, whichever the
+client prefers in Accept-Encoding; brotli wins a tie, it is smaller for the
+same JSON. Bodiless responses (304, 204, HEAD) are passed through untouched.
+*/
+func CompressionMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(httpHandler http.ResponseWriter, request *http.Request) {
+        httpHandler.Header().Add("Vary", "Accept-Encoding")
+        coding := negotiateEncoding(request.Header.Get("Accept-Encoding"))
+        if request.Method == http.MethodHead || coding == "" {
+            next.ServeHTTP(httpHandler, request)
+            return
+        }
+
+        writer := &compressedResponseWriter{ResponseWriter: httpHandler, coding: coding}
+        defer writer.Close()
+        next.ServeHTTP(writer, request)
+    })
+}
+
+// Codings offered, in order of preference
+var offeredEncodings = []string{"br", "gzip"}
+
+// An encoder is reset onto each response and pooled after it
+type encoder interface {
+    io.WriteCloser
+    Reset(io.Writer)
+}
+
+var encoders = map[string]*sync.Pool{
+    "br": {
+        New: func() interface{} {
+            // Below the default level, which costs too much time on every response
+            return brotli.NewWriterLevel(io.Discard, 4)
+        },
+    },
+    "gzip": {
+        New: func() interface{} {
+            return gzip.NewWriter(io.Discard)
+        },
+    },
+}
+
+type compressedResponseWriter struct {
+    http.ResponseWriter
+    coding      string
+    encoder     encoder
+    wroteHeader bool
+}
+
+func (writer *compressedResponseWriter) WriteHeader(statusCode int) {
+    if writer.wroteHeader {
+        return
+    }
+    writer.wroteHeader = true
+
+    header := writer.Header()
+    bodiless := statusCode == http.StatusNotModified || statusCode == http.StatusNoContent || statusCode < 200
+    if !bodiless && header.Get("Content-Encoding") == "" {
+        header.Set("Content-Encoding", writer.coding)
+        header.Del("Content-Length")
+        writer.encoder = encoders[writer.coding].Get().(encoder)
+        writer.encoder.Reset(writer.ResponseWriter)
+    }
+
+    writer.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (writer *compressedResponseWriter) Write(data []byte) (int, error) {
+    if !writer.wroteHeader {
+        // Sniff before compression hides the body from http.DetectContentType
+        if writer.Header().Get("Content-Type") == "" {
+            writer.Header().Set("Content-Type", http.DetectContentType(data))
+        }
+        writer.WriteHeader(http.StatusOK)
+    }
+    if writer.encoder == nil {
+        return writer.ResponseWriter.Write(data)
+    }
+    return writer.encoder.Write(data)
+}
+
+func (writer *compressedResponseWriter) Close() {
+    if writer.encoder == nil {
+        return
+    }
+    if err := writer.encoder.Close(); err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to finish %s response", writer.coding), "red", err)
+    }
+    encoders[writer.coding].Put(writer.encoder)
+    writer.encoder = nil
+}
+
+// negotiateEncoding returns the offered coding the client accepts with the highest quality, none when it accepts neither
+func negotiateEncoding(acceptEncoding string) string {
+    chosen, best := "", 0.0
+    for _, coding := range offeredEncodings {
+        if quality := encodingQuality(acceptEncoding, coding); quality > best {
+            chosen, best = coding, quality
+        }
+    }
+    return chosen
+}
+
+// encodingQuality returns the quality the Accept-Encoding header gives coding, honouring q=0 and "*"
+func encodingQuality(acceptEncoding, coding string) float64 {
+    accepted := 0.0
+    for _, part := range strings.Split(acceptEncoding, ",") {
+        fields := strings.Split(part, ";")
+        name := strings.ToLower(strings.TrimSpace(fields[0]))
+        if name != coding && name != "*" {
+            continue
+        }
+
+        quality := 1.0
+        for _, param := range fields[1:] {
+            param = strings.TrimSpace(param)
+            if strings.HasPrefix(param, "q=") {
+                if value, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+                    quality = value
+                }
+            }
+        }
+
+        // An explicit entry for the coding overrides the wildcard
+        if name == coding {
+            return max(quality, 0)
+        }
+        accepted = max(quality, 0)
+    }
+    return accepted
+}
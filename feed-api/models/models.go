@@ -1,5 +1,9 @@
 package models
 
+import (
+    "time"
+)
+
 type SummarizedArticle struct {
     StockicID           string `json:"stockicID"`
     Source              string `json:"source"`
@@ -11,6 +15,75 @@ type SummarizedArticle struct {
     SummarizedContent   string `json:"content"`
     CompaniesTags       []string        `json:"companyTags"`
     NewsHighlights      [][]int         `json:"highlightsIndex"`
+    HighlightsUnit      string          `json:"highlightsUnit"`
+    TrustScore          float64         `json:"trustScore"`
+    Sentiment           string          `json:"sentiment"`
+    SentimentScore      float64         `json:"sentimentScore"`
+    SentimentConfidence float64         `json:"sentimentConfidence"`
+    CompanyImpact       []CompanyImpact `json:"companyImpact"`
+    PriceChange         *PriceChange    `json:"priceChange,omitempty"`
+    StoryID             string          `json:"storyID,omitempty"`
+    StorySize           int             `json:"storySize,omitempty"`
+    Language            string                  `json:"language,omitempty"`
+    Translations        map[string]Translation  `json:"translations,omitempty"`
+    // Whether the user read the article, set on feed responses only
+    Read                *bool                   `json:"read,omitempty"`
+}
+
+type Translation struct {
+    Title       string  `json:"title"`
+    Content     string  `json:"content"`
+    Provider    string  `json:"provider"`
+}
+
+// Story as clustered by the curator, articles are referenced by StockicID
+type Story struct {
+    ID                  string          `json:"id"`
+    Title               string          `json:"title"`
+    Summary             string          `json:"summary"`
+    Representative      string          `json:"representative"`
+    Sources             []string        `json:"sources"`
+    Companies           []string        `json:"companies"`
+    Articles            []StoryMember   `json:"articles"`
+    FirstPublishedAt    string          `json:"firstPublishedAt"`
+    LastPublishedAt     string          `json:"lastPublishedAt"`
+}
+
+type StoryMember struct {
+    StockicID   string      `json:"stockicID"`
+    Title       string      `json:"title"`
+    Source      string      `json:"source"`
+    URL         string      `json:"url"`
+    PublishedAt string      `json:"publishedAt"`
+    Feeds       []string    `json:"feeds"`
+}
+
+// Story as served by /story, with its moderated articles in full
+type StoryDetail struct {
+    ID                  string              `json:"id"`
+    Title               string              `json:"title"`
+    Summary             string              `json:"summary"`
+    Representative      string              `json:"representative"`
+    Sources             []string            `json:"sources"`
+    Companies           []string            `json:"companies"`
+    FirstPublishedAt    string              `json:"firstPublishedAt"`
+    LastPublishedAt     string              `json:"lastPublishedAt"`
+    TotalResults        int                 `json:"totalResults"`
+    Articles            []SummarizedArticle `json:"articles"`
+}
+
+type PriceChange struct {
+    Symbol          string  `json:"symbol"`
+    Name            string  `json:"name,omitempty"`
+    PreviousClose   float64 `json:"previousClose"`
+    Close           float64 `json:"close"`
+    ChangePercent   float64 `json:"changePercent"`
+}
+
+type CompanyImpact struct {
+    Company     string  `json:"company"`
+    Impact      string  `json:"impact"`
+    Confidence  float64 `json:"confidence"`
 }
 
 type SummarizedResponse struct {
@@ -26,4 +99,108 @@ type Greet struct {
 type UserStatus struct {
     Exists  bool `json:"exists"`
     Premium bool `json:"premium"`
+    // Preferred feed language (ISO 639-1), empty when the user hasn't chosen one
+    Language string `json:"language,omitempty"`
+}
+
+/*
+HistoryEntry is the user's reading of an article, in users/<X-API-Key>/history/<stockicID>.
+feed-api records the views, actions the dwell time and progress the client reports.
+*/
+type HistoryEntry struct {
+    NewsID          string      `json:"NewsId" firestore:"newsID"`
+    Title           string      `json:"title" firestore:"title"`
+    Source          string      `json:"source" firestore:"source"`
+    URLToImage      string      `json:"urlToImage" firestore:"urlToImage"`
+    FirstReadAt     time.Time   `json:"firstReadAt" firestore:"firstReadAt"`
+    LastReadAt      time.Time   `json:"lastReadAt" firestore:"lastReadAt"`
+    Views           int64       `json:"views" firestore:"views"`
+    DwellSeconds    int64       `json:"dwellSeconds" firestore:"dwellSeconds"`
+    Progress        float64     `json:"progress" firestore:"progress"`
+    Finished        bool        `json:"finished" firestore:"finished"`
+}
+
+// The articles a user read recently. UpdatedAt is their latest read, zero without history.
+type ReadState struct {
+    Read        map[string]bool
+    UpdatedAt   time.Time
+}
+
+type Preferences struct {
+    Language    string  `json:"language"`
+}
+
+/*
+FeedMeta identifies what feed-api currently serves: Version combines the
+curator's promoted feed version with the moderation version, UpdatedAt is
+when either last changed. A zero UpdatedAt means the curator hasn't recorded
+a curation time yet.
+*/
+type FeedMeta struct {
+    // Promoted curator version, empty before the first promotion
+    FeedVersion string
+    Version     string
+    UpdatedAt   time.Time
+}
+
+/*
+ArticleOverride is a moderator's change to a curated article. Overrides are
+keyed by StockicID so they keep applying after the curator rewrites the feed.
+Nil fields leave the curated value untouched.
+*/
+// Overrides apply by URL, StockicID is the article as last moderated
+type ArticleOverride struct {
+    StockicID           string      `json:"stockicID" firestore:"stockicID"`
+    URL                 string      `json:"url" firestore:"url"`
+    Hidden              bool        `json:"hidden" firestore:"hidden"`
+    Pinned              bool        `json:"pinned" firestore:"pinned"`
+    Category            string      `json:"category,omitempty" firestore:"category,omitempty"`
+    Title               *string     `json:"title,omitempty" firestore:"title,omitempty"`
+    SummarizedContent   *string     `json:"content,omitempty" firestore:"content,omitempty"`
+    CompaniesTags       []string    `json:"companyTags,omitempty" firestore:"companyTags,omitempty"`
+    UpdatedBy           string      `json:"updatedBy" firestore:"updatedBy"`
+    UpdatedAt           time.Time   `json:"updatedAt" firestore:"updatedAt"`
+}
+
+type ArticleEditRequest struct {
+    Title               *string     `json:"title"`
+    SummarizedContent   *string     `json:"content"`
+    CompaniesTags       []string    `json:"companyTags"`
+}
+
+type CategoryRequest struct {
+    Category string `json:"category"`
+}
+
+type AdminArticle struct {
+    Feed        string              `json:"feed"`
+    Key         string              `json:"key"`
+    Article     SummarizedArticle   `json:"article"`
+    Override    *ArticleOverride    `json:"override,omitempty"`
+}
+
+type ModerationAuditEntry struct {
+    StockicID   string              `json:"stockicID" firestore:"stockicID"`
+    Action      string              `json:"action" firestore:"action"`
+    Actor       string              `json:"actor" firestore:"actor"`
+    ClientIP    string              `json:"clientIP" firestore:"clientIP"`
+    Before      *ArticleOverride    `json:"before,omitempty" firestore:"before,omitempty"`
+    After       *ArticleOverride    `json:"after,omitempty" firestore:"after,omitempty"`
+    At          time.Time           `json:"at" firestore:"at"`
+}
+
+type Ban struct {
+    IP          string      `json:"ip" firestore:"ip"`
+    Reason      string      `json:"reason" firestore:"reason"`
+    Strikes     int64       `json:"strikes" firestore:"strikes"`
+    BannedAt    time.Time   `json:"bannedAt" firestore:"blockedAt"`
+    ExpiresAt   time.Time   `json:"expiresAt" firestore:"expiresAt"`
+}
+
+type AbuseStatus struct {
+    IP          string      `json:"ip"`
+    Allowlisted bool        `json:"allowlisted"`
+    Score       float64     `json:"score"`
+    Strikes     int64       `json:"strikes"`
+    Ban         *Ban        `json:"ban,omitempty"`
 }
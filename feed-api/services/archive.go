@@ -0,0 +1,71 @@
+package services
+
+import (
+    "encoding/json"
+    "regexp"
+
+    "feed-api/cache"
+    "feed-api/config"
+    "feed-api/models"
+
+    "github.com/minio/minio-go/v7"
+)
+
+var (
+    archivedArticleCache = cache.NewLRU[models.SummarizedArticle](config.ArchivedArticleCacheSize, config.ArchivedArticleCacheTTL, cache.NewLayer("archive-memory"))
+    missingArticleCache = cache.NewLRU[bool](config.ArchivedArticleCacheSize, config.MissingArticleCacheTTL, cache.NewLayer("archive-missing-memory"))
+    archiveLayer = cache.NewLayer("archive-minio")
+
+    // StockicIDs are hex SHA-256 digests, anything else can't be in the index
+    stockicIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+/*
+GetArchivedArticle returns an article the curator archived, for IDs that are
+no longer in the live feed, such as old bookmarks and shared links. It returns
+nil without an error when the article was never archived.
+*/
+func GetArchivedArticle(stockicID string) (*models.SummarizedArticle, error) {
+    if !stockicIDPattern.MatchString(stockicID) {
+        return nil, nil
+    }
+    if article, found := archivedArticleCache.Get(stockicID); found {
+        return &article, nil
+    }
+    if _, missing := missingArticleCache.Get(stockicID); missing {
+        return nil, nil
+    }
+
+    result, err, _ := lookups.Do("archive:"+stockicID, func() (interface{}, error) {
+        object, err := config.MinIOClient.GetObject(config.MinIOCtx, config.ArticleArchiveBucket, config.ArticleIndexPrefix+stockicID+".json", minio.GetObjectOptions{})
+        if err != nil {
+            archiveLayer.Error()
+            return nil, err
+        }
+        defer object.Close()
+
+        // GetObject is lazy, a missing object only shows up on the first read
+        var indexed struct {
+            Article models.SummarizedArticle `json:"article"`
+        }
+        if err := json.NewDecoder(object).Decode(&indexed); err != nil {
+            code := minio.ToErrorResponse(err).Code
+            if code == "NoSuchKey" || code == "NoSuchBucket" {
+                archiveLayer.Miss()
+                missingArticleCache.Set(stockicID, true)
+                return nil, nil
+            }
+            archiveLayer.Error()
+            return nil, err
+        }
+        archiveLayer.Hit()
+
+        archivedArticleCache.Set(stockicID, indexed.Article)
+        return &indexed.Article, nil
+    })
+    if err != nil || result == nil {
+        return nil, err
+    }
+
+    return result.(*models.SummarizedArticle), nil
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "feed-api/cache"
+    "feed-api/config"
+    "feed-api/models"
+    "feed-api/utils"
+
+    "github.com/go-redis/redis/v8"
+    "golang.org/x/sync/singleflight"
+)
+
+/*
+Lookups go in-process LRU -> Redis -> (Firestore for users). Concurrent misses
+for the same key are collapsed with singleflight so a cold cache or an
+invalidation doesn't send a burst of identical requests downstream.
+*/
+var (
+    feedCache = cache.NewLRU[map[string]models.SummarizedResponse](config.FeedMemoryCacheSize, config.FeedMemoryCacheTTL, cache.NewLayer("feed-memory"))
+    moderatedFeedCache = cache.NewLRU[map[string]models.SummarizedResponse](config.FeedMemoryCacheSize, config.FeedMemoryCacheTTL, cache.NewLayer("moderated-feed-memory"))
+    feedMetaCache = cache.NewLRU[models.FeedMeta](1, config.FeedMemoryCacheTTL, cache.NewLayer("feed-meta-memory"))
+    storiesCache = cache.NewLRU[map[string]models.Story](config.FeedMemoryCacheSize, config.FeedMemoryCacheTTL, cache.NewLayer("stories-memory"))
+    userStatusCache = cache.NewLRU[models.UserStatus](config.UserStatusMemoryCacheSize, config.UserStatusMemoryCacheTTL, cache.NewLayer("user-memory"))
+
+    feedRedisLayer = cache.NewLayer("feed-redis")
+    userRedisLayer = cache.NewLayer("user-redis")
+    userFirestoreLayer = cache.NewLayer("user-firestore")
+
+    lookups singleflight.Group
+)
+
+/*
+LoadFeed returns one of the curated feeds ("headlines" or "discover") of the
+version the curator promoted, decoded. Before the first promoted version the
+legacy unversioned key is read.
+*/
+func LoadFeed(redisKey string) (map[string]models.SummarizedResponse, error) {
+    meta, err := GetFeedMeta()
+    if err != nil {
+        return nil, err
+    }
+
+    storageKey := redisKey
+    if meta.FeedVersion != "" {
+        storageKey = fmt.Sprintf("feed:%s:%s", meta.FeedVersion, redisKey)
+    }
+
+    if feed, found := feedCache.Get(storageKey); found {
+        return feed, nil
+    }
+
+    result, err, _ := lookups.Do(storageKey, func() (interface{}, error) {
+        feedData, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, storageKey).Result()
+        if err == redis.Nil {
+            feedRedisLayer.Miss()
+            return nil, err
+        }
+        if err != nil {
+            feedRedisLayer.Error()
+            return nil, err
+        }
+        feedRedisLayer.Hit()
+
+        var feed map[string]models.SummarizedResponse
+        if err := json.Unmarshal([]byte(feedData), &feed); err != nil {
+            return nil, err
+        }
+
+        feedCache.Set(storageKey, feed)
+        return feed, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return result.(map[string]models.SummarizedResponse), nil
+}
+
+/*
+LoadStories returns the story clusters of the promoted version, keyed by
+story ID. Versions curated before clustering, and the legacy unversioned
+feeds, have no stories and yield an empty map.
+*/
+func LoadStories() (map[string]models.Story, error) {
+    meta, err := GetFeedMeta()
+    if err != nil {
+        return nil, err
+    }
+    if meta.FeedVersion == "" {
+        return map[string]models.Story{}, nil
+    }
+
+    storageKey := fmt.Sprintf("feed:%s:stories", meta.FeedVersion)
+    if stories, found := storiesCache.Get(storageKey); found {
+        return stories, nil
+    }
+
+    result, err, _ := lookups.Do(storageKey, func() (interface{}, error) {
+        storiesData, err := config.RedisNewsCache.Get(config.RedisNewsCacheCtx, storageKey).Result()
+        if err == redis.Nil {
+            feedRedisLayer.Miss()
+            stories := map[string]models.Story{}
+            storiesCache.Set(storageKey, stories)
+            return stories, nil
+        }
+        if err != nil {
+            feedRedisLayer.Error()
+            return nil, err
+        }
+        feedRedisLayer.Hit()
+
+        var stories map[string]models.Story
+        if err := json.Unmarshal([]byte(storiesData), &stories); err != nil {
+            return nil, err
+        }
+
+        storiesCache.Set(storageKey, stories)
+        return stories, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return result.(map[string]models.Story), nil
+}
+
+/*
+GetFeedMeta returns the version and last change of the served feeds. Version
+is empty when the curator hasn't recorded one yet, in which case responses
+can't be validated and are sent without caching headers.
+*/
+func GetFeedMeta() (models.FeedMeta, error) {
+    if meta, found := feedMetaCache.Get("meta"); found {
+        return meta, nil
+    }
+
+    result, err, _ := lookups.Do("feed-meta", func() (interface{}, error) {
+        values, err := config.RedisNewsCache.MGet(config.RedisNewsCacheCtx,
+            config.FeedCurrentKey, config.FeedUpdatedAtKey,
+            config.ModerationVersionKey, config.ModerationUpdatedAtKey).Result()
+        if err != nil {
+            feedRedisLayer.Error()
+            return nil, err
+        }
+
+        var meta models.FeedMeta
+        feedVersion, _ := values[0].(string)
+        meta.FeedVersion = feedVersion
+        if feedVersion != "" {
+            moderationVersion, _ := values[2].(string)
+            if moderationVersion == "" {
+                moderationVersion = "0"
+            }
+            meta.Version = feedVersion + "." + moderationVersion
+        }
+
+        // Last-Modified is the later of the curation and the last moderation change
+        for _, value := range []interface{}{values[1], values[3]} {
+            timestamp, _ := value.(string)
+            updatedAt, err := time.Parse(time.RFC3339, timestamp)
+            if err == nil && updatedAt.After(meta.UpdatedAt) {
+                meta.UpdatedAt = updatedAt
+            }
+        }
+
+        feedMetaCache.Set("meta", meta)
+        return meta, nil
+    })
+    if err != nil {
+        return models.FeedMeta{}, err
+    }
+
+    return result.(models.FeedMeta), nil
+}
+
+func PurgeFeedCaches() {
+    feedCache.Purge()
+    moderatedFeedCache.Purge()
+    feedMetaCache.Purge()
+    storiesCache.Purge()
+}
+
+func InvalidateUserStatus(apiKey string) {
+    userStatusCache.Delete(apiKey)
+}
+
+// Tells every feed-api replica (this one included) to drop its decoded feeds
+func PublishFeedInvalidation(reason string) {
+    err := config.RedisNewsCache.Publish(config.RedisNewsCacheCtx, config.FeedUpdatesChannel, reason).Err()
+    if err != nil {
+        utils.LogMessage("Failed to publish feed invalidation, purging local caches only", "red", err)
+        PurgeFeedCaches()
+    }
+}
+
+/*
+PublishUserInvalidation drops the cached status of a user from Redis and
+tells every replica (this one included) to drop its in-process copy, after
+the user's Firestore document changed.
+*/
+func PublishUserInvalidation(apiKey string) {
+    if err := config.RedisAPICache.Del(config.RedisAPICacheCtx, fmt.Sprintf("apikey:%s", apiKey)).Err(); err != nil {
+        utils.LogMessage("Failed to drop cached user status", "red", err)
+    }
+
+    err := config.RedisAPICache.Publish(config.RedisAPICacheCtx, config.UserUpdatesChannel, apiKey).Err()
+    if err != nil {
+        utils.LogMessage("Failed to publish user invalidation, dropping local status only", "red", err)
+        InvalidateUserStatus(apiKey)
+    }
+}
+
+/*
+SubscribeInvalidations keeps the in-process caches coherent with Redis: the
+curator announces new feeds on feed-updates, user changes (registration,
+premium, deletion) are announced on user-updates with the API key, and reading
+history changes on history-updates. go-redis
+resubscribes on its own after a disconnect; anything missed meanwhile expires
+with the cache TTL.
+*/
+func SubscribeInvalidations() {
+    feedUpdates := config.RedisNewsCache.Subscribe(config.RedisNewsCacheCtx, config.FeedUpdatesChannel)
+    userUpdates := config.RedisAPICache.Subscribe(config.RedisAPICacheCtx, config.UserUpdatesChannel, config.HistoryUpdatesChannel)
+    defer feedUpdates.Close()
+    defer userUpdates.Close()
+
+    utils.LogMessage("Subscribed to cache invalidation channels", "green")
+
+    feedMessages := feedUpdates.Channel()
+    userMessages := userUpdates.Channel()
+    for {
+        select {
+        case message, open := <-feedMessages:
+            if !open {
+                return
+            }
+            utils.LogMessage(fmt.Sprintf("Feed update received (%s), purging feed caches", message.Payload), "green")
+            PurgeFeedCaches()
+        case message, open := <-userMessages:
+            if !open {
+                return
+            }
+            if message.Channel == config.HistoryUpdatesChannel {
+                InvalidateReadState(message.Payload)
+            } else {
+                InvalidateUserStatus(message.Payload)
+            }
+        }
+    }
+}
+
+type CacheStats struct {
+    Layers              map[string]cache.LayerStats `json:"layers"`
+    FeedEntries         int                         `json:"feedEntries"`
+    ModeratedEntries    int                         `json:"moderatedFeedEntries"`
+    StoriesEntries      int                         `json:"storiesEntries"`
+    UserStatusEntries   int                         `json:"userStatusEntries"`
+    ReadStateEntries    int                         `json:"readStateEntries"`
+}
+
+func GetCacheStats() CacheStats {
+    return CacheStats{
+        Layers:            cache.Snapshot(),
+        FeedEntries:       feedCache.Len(),
+        ModeratedEntries:  moderatedFeedCache.Len(),
+        StoriesEntries:    storiesCache.Len(),
+        UserStatusEntries: userStatusCache.Len(),
+        ReadStateEntries:  readStateCache.Len(),
+    }
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+    "fmt"
+    "time"
+
+    "feed-api/cache"
+    "feed-api/config"
+    "feed-api/models"
+    "feed-api/utils"
+
+    "cloud.google.com/go/firestore"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+var (
+    readStateCache = cache.NewLRU[models.ReadState](config.ReadStateCacheSize, config.ReadStateCacheTTL, cache.NewLayer("read-state-memory"))
+    historyFirestoreLayer = cache.NewLayer("history-firestore")
+)
+
+func historyRef(apiKey string) *firestore.CollectionRef {
+    return config.FirebaseClient.Collection("users").Doc(apiKey).Collection(config.HistoryCollection)
+}
+
+/*
+RecordView adds a detail view to the user's reading history. The first view
+creates the entry with what the history list shows of the article; later
+ones only move it to the top. Dwell time and progress are reported by the
+client to actions.
+*/
+func RecordView(apiKey string, article models.SummarizedArticle) {
+    now := time.Now().UTC()
+    ref := historyRef(apiKey).Doc(article.StockicID)
+
+    _, err := ref.Create(config.FirebaseCtx, models.HistoryEntry{
+        NewsID:      article.StockicID,
+        Title:       article.Title,
+        Source:      article.Source,
+        URLToImage:  article.URLToImage,
+        FirstReadAt: now,
+        LastReadAt:  now,
+        Views:       1,
+    })
+    if status.Code(err) == codes.AlreadyExists {
+        _, err = ref.Update(config.FirebaseCtx, []firestore.Update{
+            {Path: "lastReadAt", Value: now},
+            {Path: "views", Value: firestore.Increment(1)},
+        })
+    }
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to record view of %s in reading history", article.StockicID), "red", err)
+        return
+    }
+
+    PublishHistoryInvalidation(apiKey)
+}
+
+/*
+GetReadState returns the articles the user read most recently, at most
+ReadStateLimit of them, which is as far back as feeds reach.
+*/
+func GetReadState(apiKey string) (models.ReadState, error) {
+    if state, found := readStateCache.Get(apiKey); found {
+        return state, nil
+    }
+
+    result, err, _ := lookups.Do("history:"+apiKey, func() (interface{}, error) {
+        docs, err := historyRef(apiKey).
+            Select("lastReadAt").
+            OrderBy("lastReadAt", firestore.Desc).
+            Limit(config.ReadStateLimit).
+            Documents(config.FirebaseCtx).
+            GetAll()
+        if err != nil {
+            historyFirestoreLayer.Error()
+            return nil, err
+        }
+        historyFirestoreLayer.Hit()
+
+        state := models.ReadState{Read: make(map[string]bool, len(docs))}
+        for index, doc := range docs {
+            state.Read[doc.Ref.ID] = true
+            if index == 0 {
+                if lastReadAt, ok := doc.Data()["lastReadAt"].(time.Time); ok {
+                    state.UpdatedAt = lastReadAt
+                }
+            }
+        }
+
+        readStateCache.Set(apiKey, state)
+        return state, nil
+    })
+    if err != nil {
+        return models.ReadState{}, err
+    }
+
+    return result.(models.ReadState), nil
+}
+
+// MarkRead returns a copy of the articles with their read marker set
+func MarkRead(articles []models.SummarizedArticle, state models.ReadState) []models.SummarizedArticle {
+    marked := make([]models.SummarizedArticle, len(articles))
+    for index, article := range articles {
+        read := state.Read[article.StockicID]
+        article.Read = &read
+        marked[index] = article
+    }
+    return marked
+}
+
+func InvalidateReadState(apiKey string) {
+    readStateCache.Delete(apiKey)
+}
+
+// Tells every replica (this one included) to drop the user's read state
+func PublishHistoryInvalidation(apiKey string) {
+    err := config.RedisAPICache.Publish(config.RedisAPICacheCtx, config.HistoryUpdatesChannel, apiKey).Err()
+    if err != nil {
+        utils.LogMessage("Failed to publish history invalidation, dropping local read state only", "red", err)
+        InvalidateReadState(apiKey)
+    }
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+    "regexp"
+
+    "feed-api/config"
+    "feed-api/models"
+
+    "cloud.google.com/go/firestore"
+)
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// ValidLanguage accepts ISO 639 primary language subtags ("en", "de", "ja")
+func ValidLanguage(language string) bool {
+    return languagePattern.MatchString(language)
+}
+
+/*
+LocalizeArticle serves the article in the first of the preferred languages
+it is available in, its own language or a curator translation. Translated
+content has no highlights, the offsets were computed on the original. The
+translations are left out, clients get the article in one language.
+*/
+func LocalizeArticle(article models.SummarizedArticle, languages []string) models.SummarizedArticle {
+    translations := article.Translations
+    article.Translations = nil
+
+    for _, language := range languages {
+        if article.Language == "" || language == article.Language {
+            return article
+        }
+
+        translation, found := translations[language]
+        if !found || translation.Content == "" {
+            continue
+        }
+
+        article.Title = translation.Title
+        article.SummarizedContent = translation.Content
+        article.NewsHighlights = [][]int{}
+        article.Language = language
+        return article
+    }
+
+    return article
+}
+
+// LocalizeArticles returns a localized copy, the feeds it comes from are shared between requests
+func LocalizeArticles(articles []models.SummarizedArticle, languages []string) []models.SummarizedArticle {
+    localized := make([]models.SummarizedArticle, len(articles))
+    for index, article := range articles {
+        localized[index] = LocalizeArticle(article, languages)
+    }
+    return localized
+}
+
+// SetUserLanguage stores the user's preferred feed language, an empty language clears it
+func SetUserLanguage(apiKey, language string) error {
+    var value interface{} = language
+    if language == "" {
+        value = firestore.Delete
+    }
+
+    _, err := config.FirebaseClient.Collection("users").Doc(apiKey).Update(config.FirebaseCtx, []firestore.Update{
+        {Path: "language", Value: value},
+    })
+    if err != nil {
+        return err
+    }
+
+    PublishUserInvalidation(apiKey)
+    return nil
+}
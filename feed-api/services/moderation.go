@@ -0,0 +1,392 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "time"
+
+    "feed-api/config"
+    "feed-api/models"
+    "feed-api/utils"
+
+    "cloud.google.com/go/firestore"
+    "google.golang.org/api/iterator"
+)
+
+/*
+OverrideKey identifies the article an override applies to. The StockicID
+hashes the AI summary and changes every time the curator summarizes the
+article again, the URL doesn't.
+*/
+func OverrideKey(url string) string {
+    hash := sha256.Sum256([]byte(url))
+    return hex.EncodeToString(hash[:])
+}
+
+/*
+Moderation overrides are stored in Firestore (moderation-overrides/<OverrideKey>)
+so they are durable, and mirrored into a hash in the news cache so serving a
+feed costs a single HGETALL. They are keyed by URL and the curator only ever
+writes the feed keys, which is why overrides survive a refresh. If the news
+cache loses the hash (restart, flush) it's rebuilt from Firestore on the next
+read. The map returned is keyed by OverrideKey.
+*/
+func GetOverrides() (map[string]models.ArticleOverride, error) {
+    synced, err := config.RedisNewsCache.Exists(config.RedisNewsCacheCtx, config.ModerationOverridesSyncedKey).Result()
+    if err != nil {
+        return nil, err
+    }
+
+    if synced == 0 {
+        if err := SyncOverridesFromFirestore(); err != nil {
+            return nil, err
+        }
+    }
+
+    rawOverrides, err := config.RedisNewsCache.HGetAll(config.RedisNewsCacheCtx, config.ModerationOverridesKey).Result()
+    if err != nil {
+        return nil, err
+    }
+
+    overrides := make(map[string]models.ArticleOverride, len(rawOverrides))
+    for key, rawOverride := range rawOverrides {
+        var override models.ArticleOverride
+        if err := json.Unmarshal([]byte(rawOverride), &override); err != nil {
+            utils.LogMessage(fmt.Sprintf("Skipping malformed override %s", key), "red", err)
+            continue
+        }
+        overrides[key] = override
+    }
+
+    return overrides, nil
+}
+
+func SyncOverridesFromFirestore() error {
+    utils.LogMessage("Rebuilding moderation overrides cache from Firestore", "green")
+
+    iter := config.FirebaseClient.Collection(config.ModerationOverridesCollection).Documents(config.FirebaseCtx)
+    defer iter.Stop()
+
+    pipe := config.RedisNewsCache.TxPipeline()
+    pipe.Del(config.RedisNewsCacheCtx, config.ModerationOverridesKey)
+
+    for {
+        doc, err := iter.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            return fmt.Errorf("failed to read moderation overrides: %w", err)
+        }
+
+        var override models.ArticleOverride
+        if err := doc.DataTo(&override); err != nil {
+            utils.LogMessage(fmt.Sprintf("Skipping malformed override document %s", doc.Ref.ID), "red", err)
+            continue
+        }
+        if override.URL == "" {
+            if err := migrateOverride(doc.Ref.ID, &override); err != nil {
+                utils.LogMessage(fmt.Sprintf("Skipping override %s made before overrides were keyed by URL", doc.Ref.ID), "red", err)
+                continue
+            }
+        }
+
+        overrideJSON, err := json.Marshal(override)
+        if err != nil {
+            return err
+        }
+        pipe.HSet(config.RedisNewsCacheCtx, config.ModerationOverridesKey, OverrideKey(override.URL), overrideJSON)
+    }
+
+    pipe.Set(config.RedisNewsCacheCtx, config.ModerationOverridesSyncedKey, time.Now().UTC().Format(time.RFC3339), 0)
+    _, err := pipe.Exec(config.RedisNewsCacheCtx)
+    return err
+}
+
+/*
+migrateOverride moves an override keyed by StockicID, as they were first
+stored, under the URL of its article. The article is looked up in the curated
+feeds, then in the archive; overrides of articles found in neither are left
+in place, they can't apply to anything served.
+*/
+func migrateOverride(docID string, override *models.ArticleOverride) error {
+    headlines, err := LoadFeed("headlines")
+    if err != nil {
+        return err
+    }
+    discover, err := LoadFeed("discover")
+    if err != nil {
+        return err
+    }
+
+    article := FindArticleByID(override.StockicID, headlines, discover)
+    if article == nil {
+        article, err = GetArchivedArticle(override.StockicID)
+        if err != nil {
+            return err
+        }
+    }
+    if article == nil || article.URL == "" {
+        return fmt.Errorf("article %s not found", override.StockicID)
+    }
+    override.URL = article.URL
+
+    collection := config.FirebaseClient.Collection(config.ModerationOverridesCollection)
+    if _, err := collection.Doc(OverrideKey(override.URL)).Set(config.FirebaseCtx, *override); err != nil {
+        return err
+    }
+    if _, err := collection.Doc(docID).Delete(config.FirebaseCtx); err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to delete migrated override document %s", docID), "red", err)
+    }
+    return nil
+}
+
+func GetOverride(url string) (*models.ArticleOverride, error) {
+    overrides, err := GetOverrides()
+    if err != nil {
+        return nil, err
+    }
+
+    override, exists := overrides[OverrideKey(url)]
+    if !exists {
+        return nil, nil
+    }
+    return &override, nil
+}
+
+/*
+SaveOverride persists an override, refreshes the serving cache and records
+the change in the audit trail. Firestore is written first so that a cache
+failure never leaves an override that disappears on the next resync.
+*/
+func SaveOverride(override models.ArticleOverride, before *models.ArticleOverride, action, actor, clientIP string) error {
+    override.UpdatedBy = actor
+    override.UpdatedAt = time.Now().UTC()
+
+    key := OverrideKey(override.URL)
+    _, err := config.FirebaseClient.Collection(config.ModerationOverridesCollection).Doc(key).Set(config.FirebaseCtx, override)
+    if err != nil {
+        return fmt.Errorf("failed to store override in Firebase: %w", err)
+    }
+
+    overrideJSON, err := json.Marshal(override)
+    if err != nil {
+        return err
+    }
+
+    err = config.RedisNewsCache.HSet(config.RedisNewsCacheCtx, config.ModerationOverridesKey, key, overrideJSON).Err()
+    if err != nil {
+        // Drop the marker so the next read rebuilds the hash from Firestore
+        config.RedisNewsCache.Del(config.RedisNewsCacheCtx, config.ModerationOverridesSyncedKey)
+        utils.LogMessage("Failed to cache moderation override", "red", err)
+    }
+
+    bumpModerationVersion()
+    PublishFeedInvalidation("moderation:" + override.StockicID)
+    recordModerationAudit(override.StockicID, action, actor, clientIP, before, &override)
+    return nil
+}
+
+func DeleteOverride(stockicID string, before *models.ArticleOverride, actor, clientIP string) error {
+    key := OverrideKey(before.URL)
+    _, err := config.FirebaseClient.Collection(config.ModerationOverridesCollection).Doc(key).Delete(config.FirebaseCtx)
+    if err != nil {
+        return fmt.Errorf("failed to delete override from Firebase: %w", err)
+    }
+
+    err = config.RedisNewsCache.HDel(config.RedisNewsCacheCtx, config.ModerationOverridesKey, key).Err()
+    if err != nil {
+        config.RedisNewsCache.Del(config.RedisNewsCacheCtx, config.ModerationOverridesSyncedKey)
+        utils.LogMessage("Failed to remove moderation override from cache", "red", err)
+    }
+
+    bumpModerationVersion()
+    PublishFeedInvalidation("moderation:" + stockicID)
+    recordModerationAudit(stockicID, "restore", actor, clientIP, before, nil)
+    return nil
+}
+
+// Moderation changes what the feeds serve, so HTTP validators must change with it
+func bumpModerationVersion() {
+    pipe := config.RedisNewsCache.TxPipeline()
+    pipe.Incr(config.RedisNewsCacheCtx, config.ModerationVersionKey)
+    pipe.Set(config.RedisNewsCacheCtx, config.ModerationUpdatedAtKey, time.Now().UTC().Format(time.RFC3339), 0)
+    if _, err := pipe.Exec(config.RedisNewsCacheCtx); err != nil {
+        utils.LogMessage("Failed to bump moderation version", "red", err)
+    }
+}
+
+func ListModerationAudit(stockicID string, limit int) ([]models.ModerationAuditEntry, error) {
+    query := config.FirebaseClient.Collection(config.ModerationAuditCollection).Query
+    if stockicID != "" {
+        query = query.Where("stockicID", "==", stockicID)
+    }
+
+    iter := query.OrderBy("at", firestore.Desc).Limit(limit).Documents(config.FirebaseCtx)
+    defer iter.Stop()
+
+    entries := []models.ModerationAuditEntry{}
+    for {
+        doc, err := iter.Next()
+        if err == iterator.Done {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+
+        var entry models.ModerationAuditEntry
+        if err := doc.DataTo(&entry); err != nil {
+            utils.LogMessage(fmt.Sprintf("Skipping malformed audit entry %s", doc.Ref.ID), "red", err)
+            continue
+        }
+        entries = append(entries, entry)
+    }
+
+    return entries, nil
+}
+
+// The audit trail is best effort: a failed write is logged but doesn't undo the moderation action
+func recordModerationAudit(stockicID, action, actor, clientIP string, before, after *models.ArticleOverride) {
+    entry := models.ModerationAuditEntry{
+        StockicID: stockicID,
+        Action:    action,
+        Actor:     actor,
+        ClientIP:  clientIP,
+        Before:    before,
+        After:     after,
+        At:        time.Now().UTC(),
+    }
+
+    _, _, err := config.FirebaseClient.Collection(config.ModerationAuditCollection).Add(config.FirebaseCtx, entry)
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to record moderation audit for %s", stockicID), "red", err)
+    }
+}
+
+/*
+ApplyArticleOverride returns the article as it should be served and whether
+it is visible at all. Editing the content invalidates the highlight offsets,
+which were computed against the curated text, so they are dropped.
+*/
+func ApplyArticleOverride(article models.SummarizedArticle, override *models.ArticleOverride) (models.SummarizedArticle, bool) {
+    if override == nil {
+        return article, true
+    }
+    if override.Hidden {
+        return article, false
+    }
+
+    if override.Title != nil {
+        article.Title = *override.Title
+    }
+    if override.SummarizedContent != nil {
+        article.SummarizedContent = *override.SummarizedContent
+        article.NewsHighlights = [][]int{}
+    }
+    if override.CompaniesTags != nil {
+        article.CompaniesTags = override.CompaniesTags
+    }
+    // Translations are of the curated text, localizing would put it back over the edit
+    if override.Title != nil || override.SummarizedContent != nil {
+        article.Translations = nil
+    }
+
+    return article, true
+}
+
+/*
+ApplyOverrides produces the served view of a feed: hidden articles are
+removed, edits are applied and pinned articles move to the top of their list
+while keeping their relative order. For the discover feed a category override
+moves the article into that category.
+*/
+func ApplyOverrides(feed map[string]models.SummarizedResponse, overrides map[string]models.ArticleOverride, discover bool) map[string]models.SummarizedResponse {
+    if len(overrides) == 0 {
+        return feed
+    }
+
+    moderated := make(map[string][]models.SummarizedArticle, len(feed))
+    pinned := make(map[string]bool)
+    for key, response := range feed {
+        if _, exists := moderated[key]; !exists {
+            moderated[key] = []models.SummarizedArticle{}
+        }
+
+        for _, article := range response.Articles {
+            var override *models.ArticleOverride
+            if found, exists := overrides[OverrideKey(article.URL)]; exists {
+                override = &found
+                pinned[article.StockicID] = found.Pinned
+            }
+
+            served, visible := ApplyArticleOverride(article, override)
+            if !visible {
+                continue
+            }
+
+            target := key
+            if discover && override != nil && override.Category != "" {
+                target = override.Category
+            }
+            moderated[target] = append(moderated[target], served)
+        }
+    }
+
+    result := make(map[string]models.SummarizedResponse, len(moderated))
+    for key, articles := range moderated {
+        sort.SliceStable(articles, func(i, j int) bool {
+            return pinned[articles[i].StockicID] && !pinned[articles[j].StockicID]
+        })
+
+        status := "ok"
+        if response, exists := feed[key]; exists && response.Status != "" {
+            status = response.Status
+        }
+
+        result[key] = models.SummarizedResponse{
+            Status:       status,
+            TotalResults: len(articles),
+            Articles:     articles,
+        }
+    }
+
+    return result
+}
+
+/*
+LoadModeratedFeed reads a curated feed ("headlines" or "discover") and
+applies moderation. If the overrides can't be read the curated feed is served
+as is, an unmoderated feed being better than no feed.
+*/
+func LoadModeratedFeed(redisKey string) (map[string]models.SummarizedResponse, error) {
+    // Keyed by version so a replica that missed an invalidation can't pair a new ETag with old content
+    meta, err := GetFeedMeta()
+    if err != nil {
+        return nil, err
+    }
+    cacheKey := meta.Version + ":" + redisKey
+
+    if moderated, found := moderatedFeedCache.Get(cacheKey); found {
+        return moderated, nil
+    }
+
+    feed, err := LoadFeed(redisKey)
+    if err != nil {
+        return nil, err
+    }
+
+    overrides, err := GetOverrides()
+    if err != nil {
+        // Not cached, so moderation is picked up again as soon as the overrides are readable
+        utils.LogMessage("Failed to load moderation overrides, serving curated feed", "red", err)
+        return feed, nil
+    }
+
+    moderated := ApplyOverrides(feed, overrides, redisKey == "discover")
+    moderatedFeedCache.Set(cacheKey, moderated)
+    return moderated, nil
+}
@@ -35,9 +35,36 @@ func PushAppLogToMinIO() {
 }
 
 func ValidateUserAPIKey(apiKey string) (bool, bool) {
+    userStatus := GetUserStatus(apiKey)
+    return userStatus.Exists, userStatus.Premium
+}
+
+func GetUserStatus(apiKey string) models.UserStatus {
+    // In-process cache first, then a single lookup per API key however many requests are waiting
+    if cachedStatus, found := userStatusCache.Get(apiKey); found {
+        return cachedStatus
+    }
+
+    result, _, _ := lookups.Do("apikey:"+apiKey, func() (interface{}, error) {
+        userStatus, cacheable := lookupUserStatus(apiKey)
+        if cacheable {
+            userStatusCache.Set(apiKey, userStatus)
+        }
+        return userStatus, nil
+    })
+
+    return result.(models.UserStatus)
+}
+
+/*
+lookupUserStatus resolves the user from Redis, then Firestore. The status is
+not cacheable when Firestore couldn't be reached, since we don't actually know
+whether the user exists.
+*/
+func lookupUserStatus(apiKey string) (models.UserStatus, bool) {
     // Check for Redis Cache -> If error == nil means Cache Hit for User -> Return the Existance and Premium Status
     if cachedStatus, err := GetCachedUserStatus(config.RedisAPICacheCtx, apiKey); err == nil {
-        return cachedStatus.Exists, cachedStatus.Premium
+        return *cachedStatus, true
     }
 
     // docRef is reference to the data specified by apiKey 
@@ -45,6 +72,11 @@ func ValidateUserAPIKey(apiKey string) (bool, bool) {
 
     // docSnapshot is contains data of the user associated with the API Key
 	docSnapshot, err := docRef.Get(config.FirebaseCtx)
+    if err == nil || status.Code(err) == codes.NotFound {
+        userFirestoreLayer.Hit()
+    } else {
+        userFirestoreLayer.Error()
+    }
 
     // If an error has been caught, it is now impossible to move forward and false, false is going to be served 
 	if err != nil {
@@ -58,7 +90,7 @@ func ValidateUserAPIKey(apiKey string) (bool, bool) {
                 utils.LogMessage("Failed to Cache", "red", err)
             }
 
-			return false, false
+			return models.UserStatus{Exists: false, Premium: false}, true
 		}
 
         /* 
@@ -69,7 +101,7 @@ func ValidateUserAPIKey(apiKey string) (bool, bool) {
         */
 
 		utils.LogMessage("Failed to get document: %v", "red", err)
-        return false, false 
+        return models.UserStatus{Exists: false, Premium: false}, false
 	}
 
     /*
@@ -83,42 +115,34 @@ func ValidateUserAPIKey(apiKey string) (bool, bool) {
         if err != nil {
             utils.LogMessage("Failed to Cache", "red", err)
         }
-		return false, false
+		return models.UserStatus{Exists: false, Premium: false}, true
 	}
 
-    // Check for premium status 
-	premiumStatus, ok := docSnapshot.Data()["premium-status"].(bool)
-	if !ok {
-        err = CacheUserStatus(config.RedisAPICacheCtx, apiKey, models.UserStatus{Exists: true, Premium: false})
-        if err != nil {
-            utils.LogMessage("Failed to Cache", "red", err)
-        }
-		return true, false
-	}
+    // Check for premium status and the preferred feed language, both optional
+	premiumStatus, _ := docSnapshot.Data()["premium-status"].(bool)
+    language, _ := docSnapshot.Data()["language"].(string)
+    userStatus := models.UserStatus{Exists: true, Premium: premiumStatus, Language: language}
 
     // If user exists, store it to cache
-    err = CacheUserStatus(config.RedisAPICacheCtx, apiKey, models.UserStatus{Exists: true, Premium: premiumStatus})
+    err = CacheUserStatus(config.RedisAPICacheCtx, apiKey, userStatus)
     if err != nil {
         utils.LogMessage("Failed to Cache", "red", err)
     }
 
-	return true, premiumStatus
+	return userStatus, true
 }
 
 func GetCachedUserStatus(ctx context.Context, apiKey string) (*models.UserStatus, error) {
-    pong, err := config.RedisAPICache.Ping(ctx).Result()
-    if err != nil {
-        utils.LogMessage("Redis connection error", "red", err)
-    } else {
-        utils.LogMessage(fmt.Sprintf("Redis ping response: %s", pong), "green", nil)
-    }
-
     val, err := config.RedisAPICache.Get(ctx, fmt.Sprintf("apikey:%s", apiKey)).Result()
     if err == redis.Nil {
+        userRedisLayer.Miss()
         return nil, err
     } else if err != nil {
+        userRedisLayer.Error()
+        utils.LogMessage("Redis connection error", "red", err)
         return nil, err
     }
+    userRedisLayer.Hit()
     
     var status models.UserStatus
     if err := json.Unmarshal([]byte(val), &status); err != nil {
@@ -129,13 +153,6 @@ func GetCachedUserStatus(ctx context.Context, apiKey string) (*models.UserStatus
 }
 
 func CacheUserStatus(ctx context.Context, apiKey string, status models.UserStatus) error {
-    pong, err := config.RedisAPICache.Ping(ctx).Result()
-    if err != nil {
-        utils.LogMessage("Redis connection error", "red", err)
-    } else {
-        utils.LogMessage(fmt.Sprintf("Redis ping response: %s", pong), "green")
-    }
-
     statusJson, err := json.Marshal(status)
     if err != nil {
         utils.LogMessage("Failed to marshal user status", "red", err)
@@ -234,12 +251,9 @@ func SyncLogRedisToMinIO() {
     }
 }
 
-func FindArticleByID(id, headlinesData, discoverData string) *models.SummarizedArticle {
-    var headlines, discover map[string]models.SummarizedResponse
-    
-    if err := json.Unmarshal([]byte(headlinesData), &headlines); err == nil {
-        // Search in headlines
-        for _, response := range headlines {
+func FindArticleByID(id string, feeds ...map[string]models.SummarizedResponse) *models.SummarizedArticle {
+    for _, feed := range feeds {
+        for _, response := range feed {
             for _, article := range response.Articles {
                 if article.StockicID == id {
                     return &article
@@ -248,18 +262,18 @@ func FindArticleByID(id, headlinesData, discoverData string) *models.SummarizedA
         }
     }
 
-    if err := json.Unmarshal([]byte(discoverData), &discover); err == nil {
-        // Search in discover news
-        for _, response := range discover {
-            for _, article := range response.Articles {
-                if article.StockicID == id {
-                    return &article
-                }
-            }
+    return nil
+}
+
+// Articles curated before sentiment scoring have no label and never match a filter
+func FilterBySentiment(articles []models.SummarizedArticle, sentiment string) []models.SummarizedArticle {
+    filtered := make([]models.SummarizedArticle, 0, len(articles))
+    for _, article := range articles {
+        if article.Sentiment == sentiment {
+            filtered = append(filtered, article)
         }
     }
-
-    return nil
+    return filtered
 }
 
 func PaginateArticles(articles []models.SummarizedArticle, page, pageSize int) *models.SummarizedResponse {
@@ -284,41 +298,3 @@ func PaginateArticles(articles []models.SummarizedArticle, page, pageSize int) *
         Articles:     articles[startIndex:endIndex],
     }
 }
-
-func IsBlocked(ip string) bool {
-    utils.LogMessage("isBlocked() checking for blocked IPs", "red")
-	if config.RedisAPICache.Exists(config.RedisAPICacheCtx, ip).Val() > 0 {
-        utils.LogMessage("Blocked Cache Hit!", "green")
-		return true
-	}
-
-	iter := config.FirebaseClient.Collection("blocked").Where("ip", "==", ip).Documents(config.FirebaseCtx)
-	defer iter.Stop()
-
-	if doc, err := iter.Next(); err == nil && doc.Exists() {
-		go func() {
-            err := config.RedisAPICache.Set(config.RedisAPICacheCtx, ip, "blocked", time.Hour).Err()
-            if err != nil {
-                utils.LogMessage("Failed to write firebase blocked IP to Redis", "red")
-            }
-		}()
-		return true
-	}
-
-	return false
-}
-
-func SaveBlockedIPToFirebase(ip string) error {
-    utils.LogMessage(fmt.Sprintf("Storing Blocked IP to Firebase: %s", ip), "green")
-	doc := map[string]interface{}{
-		"ip":        ip,
-		"blockedAt": time.Now(),
-	}
-
-    _, _, err := config.FirebaseClient.Collection("blocked").Add(config.FirebaseCtx, doc)
-	if err != nil {
-		return fmt.Errorf("failed to store IP in Firebase: %w", err)
-	}
-
-	return nil
-}
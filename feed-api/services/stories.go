@@ -0,0 +1,109 @@
+package services
+
+import (
+    "feed-api/models"
+    "feed-api/utils"
+)
+
+/*
+GetStory returns a story with its articles as currently served: hidden
+articles are left out and edits applied. When moderation hid the
+representative, the first visible article stands in for it and its summary
+replaces the aggregated one, which was built on the hidden text. The same
+happens when the representative is served translated, the aggregated summary
+being in the original languages, and when a moderator hid or edited any member,
+the aggregated title and summary holding sentences of its curated text. nil
+means the story doesn't exist or none of its articles is visible.
+*/
+func GetStory(storyID string, languages []string) (*models.StoryDetail, error) {
+    stories, err := LoadStories()
+    if err != nil {
+        return nil, err
+    }
+
+    story, exists := stories[storyID]
+    if !exists {
+        return nil, nil
+    }
+
+    headlines, err := LoadModeratedFeed("headlines")
+    if err != nil {
+        return nil, err
+    }
+    discover, err := LoadModeratedFeed("discover")
+    if err != nil {
+        return nil, err
+    }
+
+    // Unreadable overrides leave the feeds curated, the aggregated text matches them
+    overrides, err := GetOverrides()
+    if err != nil {
+        utils.LogMessage("Failed to load moderation overrides for story", "red", err)
+    }
+    moderated := false
+
+    detail := &models.StoryDetail{
+        ID:               story.ID,
+        Title:            story.Title,
+        Summary:          story.Summary,
+        Sources:          story.Sources,
+        Companies:        story.Companies,
+        FirstPublishedAt: story.FirstPublishedAt,
+        LastPublishedAt:  story.LastPublishedAt,
+        Articles:         []models.SummarizedArticle{},
+    }
+
+    representative := -1
+    for _, member := range story.Articles {
+        if override, exists := overrides[OverrideKey(member.URL)]; exists && (override.Hidden || override.Title != nil || override.SummarizedContent != nil) {
+            moderated = true
+        }
+
+        article := FindArticleByID(member.StockicID, headlines, discover)
+        if article == nil {
+            continue
+        }
+        localized := LocalizeArticle(*article, languages)
+        detail.Articles = append(detail.Articles, localized)
+        if member.StockicID == story.Representative {
+            representative = len(detail.Articles) - 1
+            moderated = moderated || localized.Language != article.Language
+        }
+    }
+
+    if len(detail.Articles) == 0 {
+        return nil, nil
+    }
+    if representative < 0 {
+        representative = 0
+        moderated = true
+    }
+    detail.Representative = detail.Articles[representative].StockicID
+    detail.Title = detail.Articles[representative].Title
+    if moderated {
+        detail.Summary = detail.Articles[representative].SummarizedContent
+    }
+    detail.TotalResults = len(detail.Articles)
+
+    return detail, nil
+}
+
+/*
+CollapseStories keeps one card per story: the highest-ranked article of each
+story stays where it is and the rest of the story is dropped from the list.
+Its storySize tells the client how many articles /story/<storyID> holds.
+*/
+func CollapseStories(articles []models.SummarizedArticle) []models.SummarizedArticle {
+    seen := make(map[string]bool)
+    collapsed := make([]models.SummarizedArticle, 0, len(articles))
+    for _, article := range articles {
+        if article.StoryID != "" {
+            if seen[article.StoryID] {
+                continue
+            }
+            seen[article.StoryID] = true
+        }
+        collapsed = append(collapsed, article)
+    }
+    return collapsed
+}
@@ -5,7 +5,9 @@ import (
     "log"
     "net"
     "net/http"
+    "os"
     "strings"
+    "sync"
     "time"
     "encoding/json"
 )
@@ -45,10 +47,87 @@ func DeliverJsonError(httpHandler http.ResponseWriter, message string, statusCod
     }
 }
 
+/*
+GetClientIP returns the address of the client that made the request. Behind
+nginx every request comes from the proxy, so when the direct peer is a trusted
+proxy (TRUSTED_PROXIES, comma separated CIDRs) the X-Forwarded-For chain is
+walked from the right and the first hop that isn't a trusted proxy is used.
+Entries left of that are client supplied and can't be trusted.
+*/
 func GetClientIP(request *http.Request) string {
     ip := request.RemoteAddr
     if strings.Contains(ip, ":") {
-        ip, _, _ = net.SplitHostPort(ip)
+        if host, _, err := net.SplitHostPort(ip); err == nil {
+            ip = host
+        }
     }
+
+    if !isTrustedProxy(ip) {
+        return ip
+    }
+
+    forwardedFor := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+    for i := len(forwardedFor) - 1; i >= 0; i-- {
+        hop := strings.TrimSpace(forwardedFor[i])
+        if net.ParseIP(hop) == nil {
+            break
+        }
+        if !isTrustedProxy(hop) {
+            return hop
+        }
+        ip = hop
+    }
+
     return ip
 }
+
+var (
+    trustedProxies     []*net.IPNet
+    trustedProxiesOnce sync.Once
+)
+
+func isTrustedProxy(ip string) bool {
+    trustedProxiesOnce.Do(func() {
+        trustedProxies = ParseCIDRList(os.Getenv("TRUSTED_PROXIES"))
+    })
+    return IPInNetworks(ip, trustedProxies)
+}
+
+// ParseCIDRList parses comma separated CIDRs; bare IPs are accepted as single-address networks
+func ParseCIDRList(value string) []*net.IPNet {
+    var networks []*net.IPNet
+    for _, entry := range strings.Split(value, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        if !strings.Contains(entry, "/") {
+            if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+                entry += "/32"
+            } else {
+                entry += "/128"
+            }
+        }
+
+        _, network, err := net.ParseCIDR(entry)
+        if err != nil {
+            LogMessage(fmt.Sprintf("Ignoring invalid CIDR: %s", entry), "red", err)
+            continue
+        }
+        networks = append(networks, network)
+    }
+    return networks
+}
+
+func IPInNetworks(ip string, networks []*net.IPNet) bool {
+    parsed := net.ParseIP(ip)
+    if parsed == nil {
+        return false
+    }
+    for _, network := range networks {
+        if network.Contains(parsed) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+
+    "feed-curator/database"
+    "feed-curator/extractor"
+    "feed-curator/feedstore"
+    "feed-curator/models"
+    "feed-curator/replay"
+    "feed-curator/utils"
+)
+
+const usage = `usage:
+    feed-curator                        run the daily curation loop
+    feed-curator versions               list retained feed versions
+    feed-curator rollback [<version>]   serve an older version (default: the previous one)
+    feed-curator promote <version>      serve a staged version, e.g. one staged by replay
+    feed-curator replay --from <ts> --to <ts> [--fulltext] [--archive] [--stage] [--publish]
+                                        run archived NewsAPI responses through the current pipeline
+    feed-curator index-archive [--from <ts>] [--to <ts>]
+                                        index the articles of older summarized archives by StockicID
+
+timestamps: 2006-01-02T15-04-05 (as in archive names), RFC 3339, or 2006-01-02 (whole day)`
+
+func runCommand(command string, args []string) int {
+    switch command {
+    case "versions":
+        versions, err := feedstore.ListVersions()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "failed to list feed versions: %v\n", err)
+            return 1
+        }
+
+        encoder := json.NewEncoder(os.Stdout)
+        encoder.SetIndent("", "  ")
+        encoder.Encode(versions)
+        return 0
+    case "rollback":
+        var target int64
+        if len(args) > 0 {
+            version, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil || version < 1 {
+                fmt.Fprintf(os.Stderr, "invalid version %q\n", args[0])
+                return 2
+            }
+            target = version
+        }
+
+        version, err := feedstore.Rollback(target)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "rollback failed: %v\n", err)
+            return 1
+        }
+
+        fmt.Printf("serving feed version %d\n", version)
+        return 0
+    case "promote":
+        if len(args) != 1 {
+            fmt.Fprintln(os.Stderr, usage)
+            return 2
+        }
+        version, err := strconv.ParseInt(args[0], 10, 64)
+        if err != nil || version < 1 {
+            fmt.Fprintf(os.Stderr, "invalid version %q\n", args[0])
+            return 2
+        }
+
+        if err := feedstore.Promote(version); err != nil {
+            fmt.Fprintf(os.Stderr, "promote failed: %v\n", err)
+            return 1
+        }
+
+        fmt.Printf("serving feed version %d\n", version)
+        return 0
+    case "replay":
+        return runReplay(args)
+    case "index-archive":
+        return runIndexArchive(args)
+    default:
+        fmt.Fprintln(os.Stderr, usage)
+        return 2
+    }
+}
+
+func runReplay(args []string) int {
+    flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+    from := flags.String("from", "", "first archive to replay")
+    to := flags.String("to", "", "last archive to replay (default: now)")
+    fullText := flags.Bool("fulltext", extractor.Enabled(), "extract full texts (cached in MinIO)")
+    archive := flags.Bool("archive", false, "overwrite the summarized archives of the replayed runs")
+    stage := flags.Bool("stage", false, "stage each run as a feed version kept for 24h")
+    publish := flags.Bool("publish", false, "validate and promote the most recent replayed run")
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+
+    if *from == "" {
+        fmt.Fprintln(os.Stderr, usage)
+        return 2
+    }
+    fromTime, err := parseReplayTime(*from, false)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "invalid --from: %v\n", err)
+        return 2
+    }
+    toTime := time.Now()
+    if *to != "" {
+        toTime, err = parseReplayTime(*to, true)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "invalid --to: %v\n", err)
+            return 2
+        }
+    }
+
+    results, err := replay.Replay(replay.Options{
+        From:     fromTime,
+        To:       toTime,
+        FullText: *fullText,
+        Archive:  *archive,
+        Stage:    *stage,
+        Publish:  *publish,
+    })
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+        return 1
+    }
+
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    encoder.Encode(results)
+
+    for _, result := range results {
+        if result.Error != "" {
+            return 1
+        }
+    }
+    return 0
+}
+
+/*
+runIndexArchive indexes the summarized archives written before articles
+were indexed as they are archived. Indexing an archive again is harmless.
+*/
+func runIndexArchive(args []string) int {
+    flags := flag.NewFlagSet("index-archive", flag.ContinueOnError)
+    from := flags.String("from", "", "first archive to index (default: the oldest)")
+    to := flags.String("to", "", "last archive to index (default: now)")
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+
+    var fromTime time.Time
+    var err error
+    if *from != "" {
+        fromTime, err = parseReplayTime(*from, false)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "invalid --from: %v\n", err)
+            return 2
+        }
+    }
+    toTime := time.Now()
+    if *to != "" {
+        toTime, err = parseReplayTime(*to, true)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "invalid --to: %v\n", err)
+            return 2
+        }
+    }
+
+    archives, err := database.ListSummarizedNewsArchives(models.MinIOClient, replay.SummarizedNewsBucket, fromTime, toTime)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "failed to list summarized archives: %v\n", err)
+        return 1
+    }
+
+    failed := 0
+    for _, archive := range archives {
+        newsData, err := database.GetSummarizedNewsArchive(models.MinIOClient, replay.SummarizedNewsBucket, archive.ObjectName)
+        if err == nil {
+            err = database.IndexSummarizedArticlesInMinIO(models.MinIOClient, newsData, replay.SummarizedNewsBucket, archive.ObjectName, archive.ArchivedAt)
+        }
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to index %s", archive.ObjectName), "red", err)
+            failed++
+        }
+    }
+
+    fmt.Printf("indexed %d of %d summarized archives\n", len(archives)-failed, len(archives))
+    if failed > 0 {
+        return 1
+    }
+    return 0
+}
+
+// A bare date covers the whole day when it ends the range
+func parseReplayTime(value string, endOfRange bool) (time.Time, error) {
+    if parsed, err := time.ParseInLocation(models.ArchiveTimeLayout, value, time.Local); err == nil {
+        return parsed, nil
+    }
+    if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+        return parsed, nil
+    }
+
+    parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+    }
+    if endOfRange {
+        parsed = parsed.Add(24*time.Hour - time.Second)
+    }
+    return parsed, nil
+}
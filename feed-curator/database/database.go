@@ -9,7 +9,11 @@ import (
     "bytes"
     "time"
     "path/filepath"
+    "sort"
+    "strings"
     "encoding/json"
+    "encoding/hex"
+    "crypto/sha256"
     
     "feed-curator/utils"
     "feed-curator/models"
@@ -21,12 +25,17 @@ import (
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
-func UploadNewsAPIResponseDataToMinIO(minioClient *minio.Client, jsonNewsData map[string]models.APIResponse, MinIOBucket string) error {
+func UploadNewsAPIResponseDataToMinIO(minioClient *minio.Client, jsonNewsData map[string]models.APIResponse, MinIOBucket, kind string) error {
+    return UploadNewsAPIResponseDataToMinIOAt(minioClient, jsonNewsData, MinIOBucket, kind, time.Now())
+}
+
+// The summarized archive of a response is written under the same kind and time, so a replay of it replaces that summary
+func UploadNewsAPIResponseDataToMinIOAt(minioClient *minio.Client, jsonNewsData map[string]models.APIResponse, MinIOBucket, kind string, archivedAt time.Time) error {
 
     utils.LogMessage("Started Uploading Archive News to MinIO", "green")
 	
     payload := map[string]interface{}{
-        "time":  time.Now().Format(time.RFC3339),
+        "time":  archivedAt.Format(time.RFC3339),
 		"news-data": jsonNewsData,
 	}
     
@@ -37,10 +46,9 @@ func UploadNewsAPIResponseDataToMinIO(minioClient *minio.Client, jsonNewsData ma
 
     reader := bytes.NewReader(payloadBytes)
 
-    currentTime := time.Now()
-    formattedTime := currentTime.Format("2006-01-02T15-04-05")
+    formattedTime := archivedAt.Format(models.ArchiveTimeLayout)
 
-    objectName := fmt.Sprintf("raw-news-%s.json", formattedTime)
+    objectName := fmt.Sprintf("raw-news-%s-%s.json", kind, formattedTime)
 	_, err = minioClient.PutObject(models.MinIOCtx, 
         MinIOBucket,                            // Bucket Name 
         objectName,                             // Object Name
@@ -57,12 +65,17 @@ func UploadNewsAPIResponseDataToMinIO(minioClient *minio.Client, jsonNewsData ma
 	return nil
 }
 
-func UploadNewsAPISummarizedDataToMinIO(minioClient *minio.Client, jsonNewsData map[string]models.SummarizedResponse, MinIOBucket string) error {
+func UploadNewsAPISummarizedDataToMinIO(minioClient *minio.Client, jsonNewsData map[string]models.SummarizedResponse, MinIOBucket, kind string) error {
+    return UploadNewsAPISummarizedDataToMinIOAt(minioClient, jsonNewsData, MinIOBucket, kind, time.Now())
+}
+
+// Written under the kind and time of the raw archive the summaries were produced from, a replay overwrites the original summary
+func UploadNewsAPISummarizedDataToMinIOAt(minioClient *minio.Client, jsonNewsData map[string]models.SummarizedResponse, MinIOBucket, kind string, archivedAt time.Time) error {
 
     utils.LogMessage("Started Uploading Archive News to MinIO", "green")
 	
     payload := map[string]interface{}{
-        "time":  time.Now().Format(time.RFC3339),
+        "time":  archivedAt.Format(time.RFC3339),
 		"news-data": jsonNewsData,
 	}
     
@@ -73,10 +86,9 @@ func UploadNewsAPISummarizedDataToMinIO(minioClient *minio.Client, jsonNewsData
 
     reader := bytes.NewReader(payloadBytes)
 
-    currentTime := time.Now()
-    formattedTime := currentTime.Format("2006-01-02T15-04-05")
+    formattedTime := archivedAt.Format(models.ArchiveTimeLayout)
 
-    objectName := fmt.Sprintf("summarized-news-%s.json", formattedTime)
+    objectName := fmt.Sprintf("summarized-news-%s-%s.json", kind, formattedTime)
 	_, err = minioClient.PutObject(models.MinIOCtx, 
         MinIOBucket,                            // Bucket Name 
         objectName,                             // Object Name
@@ -90,7 +102,175 @@ func UploadNewsAPISummarizedDataToMinIO(minioClient *minio.Client, jsonNewsData
         return fmt.Errorf("Error uploading file: %v", err)
     }
 
-	return nil
+    return IndexSummarizedArticlesInMinIO(minioClient, jsonNewsData, MinIOBucket, objectName, archivedAt)
+}
+
+/*
+IndexSummarizedArticlesInMinIO stores every article of a summarized archive
+on its own under articles/<stockicID>.json, next to the archive. feed-api
+reads it to serve articles that are no longer in the live feed. An article
+in several countries or categories is stored once.
+*/
+func IndexSummarizedArticlesInMinIO(minioClient *minio.Client, jsonNewsData map[string]models.SummarizedResponse, MinIOBucket, archive string, archivedAt time.Time) error {
+    indexed := make(map[string]bool)
+    failed := 0
+    var lastErr error
+
+    for _, response := range jsonNewsData {
+        for _, article := range response.Articles {
+            if article.StockicID == "" || indexed[article.StockicID] {
+                continue
+            }
+            indexed[article.StockicID] = true
+
+            payloadBytes, err := json.Marshal(models.IndexedArticle{
+                ArchivedAt: archivedAt.Format(time.RFC3339),
+                Archive:    archive,
+                Article:    article,
+            })
+            if err != nil {
+                return fmt.Errorf("failed to marshal article %s: %v", article.StockicID, err)
+            }
+
+            _, err = minioClient.PutObject(models.MinIOCtx,
+                MinIOBucket,
+                models.ArticleIndexPrefix+article.StockicID+".json",
+                bytes.NewReader(payloadBytes),
+                int64(len(payloadBytes)),
+                minio.PutObjectOptions{
+                    ContentType: "application/json",
+            })
+            if err != nil {
+                failed++
+                lastErr = err
+            }
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("failed to index %d of %d articles: %w", failed, len(indexed), lastErr)
+    }
+    utils.LogMessage(fmt.Sprintf("Indexed %d articles of %s", len(indexed), archive), "green")
+    return nil
+}
+
+// Experiments are grouped by stage and compared versions, one object per article and day
+func UploadPromptExperimentToMinIO(minioClient *minio.Client, experiment models.PromptExperiment, MinIOBucket string) error {
+    payloadBytes, err := json.Marshal(experiment)
+    if err != nil {
+        return fmt.Errorf("failed to marshal experiment: %v", err)
+    }
+
+    versions := make([]string, 0, len(experiment.Outputs))
+    for _, output := range experiment.Outputs {
+        versions = append(versions, output.PromptVersion)
+    }
+    hash := sha256.Sum256([]byte(experiment.ArticleURL))
+    objectName := fmt.Sprintf("%s/%s/%s/%s.json",
+        experiment.Stage,
+        strings.Join(versions, "-vs-"),
+        experiment.CreatedAt.Format("2006-01-02"),
+        hex.EncodeToString(hash[:8]),
+    )
+
+    _, err = minioClient.PutObject(models.MinIOCtx,
+        MinIOBucket,
+        objectName,
+        bytes.NewReader(payloadBytes),
+        int64(len(payloadBytes)),
+        minio.PutObjectOptions{
+            ContentType: "application/json",
+    })
+    if err != nil {
+        return fmt.Errorf("Error uploading file: %v", err)
+    }
+
+    return nil
+}
+
+/*
+ListRawNewsArchives returns the raw NewsAPI archives written between from
+and to (inclusive), oldest first. Object names carry the feed and the local
+time of the run, e.g. raw-news-headlines-2025-01-31T00-00-12.json; archives
+named before the feed was, e.g. raw-news-2025-01-31T00-00-12.json, are listed
+without a Kind.
+*/
+func ListRawNewsArchives(minioClient *minio.Client, MinIOBucket string, from, to time.Time) ([]models.RawArchive, error) {
+    return listArchives(minioClient, MinIOBucket, "raw-news-", from, to)
+}
+
+func ListSummarizedNewsArchives(minioClient *minio.Client, MinIOBucket string, from, to time.Time) ([]models.RawArchive, error) {
+    return listArchives(minioClient, MinIOBucket, "summarized-news-", from, to)
+}
+
+// listArchives returns the <prefix>[<kind>-]<timestamp>.json objects archived between from and to, oldest first
+func listArchives(minioClient *minio.Client, MinIOBucket, prefix string, from, to time.Time) ([]models.RawArchive, error) {
+    var archives []models.RawArchive
+
+    for object := range minioClient.ListObjects(models.MinIOCtx, MinIOBucket, minio.ListObjectsOptions{Prefix: prefix}) {
+        if object.Err != nil {
+            return nil, fmt.Errorf("failed to list %s: %w", MinIOBucket, object.Err)
+        }
+
+        stamp := strings.TrimSuffix(strings.TrimPrefix(object.Key, prefix), ".json")
+        kind := ""
+        for _, archiveKind := range []string{models.ArchiveHeadlines, models.ArchiveDiscover} {
+            if strings.HasPrefix(stamp, archiveKind+"-") {
+                kind = archiveKind
+                stamp = strings.TrimPrefix(stamp, archiveKind+"-")
+                break
+            }
+        }
+        archivedAt, err := time.ParseInLocation(models.ArchiveTimeLayout, stamp, time.Local)
+        if err != nil {
+            continue
+        }
+        if archivedAt.Before(from) || archivedAt.After(to) {
+            continue
+        }
+
+        archives = append(archives, models.RawArchive{ObjectName: object.Key, Kind: kind, ArchivedAt: archivedAt})
+    }
+
+    sort.Slice(archives, func(i, j int) bool {
+        return archives[i].ArchivedAt.Before(archives[j].ArchivedAt)
+    })
+
+    return archives, nil
+}
+
+func GetRawNewsArchive(minioClient *minio.Client, MinIOBucket, objectName string) (map[string]models.APIResponse, error) {
+    object, err := minioClient.GetObject(models.MinIOCtx, MinIOBucket, objectName, minio.GetObjectOptions{})
+    if err != nil {
+        return nil, fmt.Errorf("failed to get %s: %w", objectName, err)
+    }
+    defer object.Close()
+
+    var payload struct {
+        NewsData map[string]models.APIResponse `json:"news-data"`
+    }
+    if err := json.NewDecoder(object).Decode(&payload); err != nil {
+        return nil, fmt.Errorf("failed to decode %s: %w", objectName, err)
+    }
+
+    return payload.NewsData, nil
+}
+
+func GetSummarizedNewsArchive(minioClient *minio.Client, MinIOBucket, objectName string) (map[string]models.SummarizedResponse, error) {
+    object, err := minioClient.GetObject(models.MinIOCtx, MinIOBucket, objectName, minio.GetObjectOptions{})
+    if err != nil {
+        return nil, fmt.Errorf("failed to get %s: %w", objectName, err)
+    }
+    defer object.Close()
+
+    var payload struct {
+        NewsData map[string]models.SummarizedResponse `json:"news-data"`
+    }
+    if err := json.NewDecoder(object).Decode(&payload); err != nil {
+        return nil, fmt.Errorf("failed to decode %s: %w", objectName, err)
+    }
+
+    return payload.NewsData, nil
 }
 
 func UploadLogDataToMinIO(minioClient *minio.Client, BucketName, localFilePath string) error {
@@ -186,7 +366,7 @@ func RedisInit(redisContext context.Context, redisAddress, redisDB, redisPasswor
 }
 
 func InitMinIO() {
-    stores := []string{"raw-news-archive", "summarized-news-archive", "feed-curator-app-logs"}
+    stores := []string{"raw-news-archive", "summarized-news-archive", "feed-curator-app-logs", "article-fulltext-cache", "prompt-experiments"}
 
     models.MinIOClient = MinIOInit("MINIO_ENDPOINT", "MINIO_ACCESSKEY", "MINIO_SECRETKEY", stores)
 }
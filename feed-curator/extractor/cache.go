@@ -0,0 +1,67 @@
+package extractor
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+
+    "feed-curator/models"
+    "feed-curator/utils"
+
+    "github.com/minio/minio-go/v7"
+)
+
+const CacheBucket = "article-fulltext-cache"
+
+type Cache interface {
+    Get(articleURL string) (string, bool)
+    Set(articleURL, text string)
+}
+
+// MinIOCache keeps extracted texts in the article-fulltext-cache bucket, one object per URL
+type MinIOCache struct {
+    client *minio.Client
+    bucket string
+}
+
+func NewMinIOCache(client *minio.Client) *MinIOCache {
+    return &MinIOCache{client: client, bucket: CacheBucket}
+}
+
+func (cache *MinIOCache) Get(articleURL string) (string, bool) {
+    object, err := cache.client.GetObject(models.MinIOCtx, cache.bucket, cacheObjectName(articleURL), minio.GetObjectOptions{})
+    if err != nil {
+        return "", false
+    }
+    defer object.Close()
+
+    // A missing object only surfaces on the first read
+    text, err := io.ReadAll(object)
+    if err != nil || len(text) == 0 {
+        return "", false
+    }
+    return string(text), true
+}
+
+func (cache *MinIOCache) Set(articleURL, text string) {
+    _, err := cache.client.PutObject(models.MinIOCtx,
+        cache.bucket,
+        cacheObjectName(articleURL),
+        bytes.NewReader([]byte(text)),
+        int64(len(text)),
+        minio.PutObjectOptions{
+            ContentType:  "text/plain; charset=utf-8",
+            UserMetadata: map[string]string{"source-url": articleURL},
+        },
+    )
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to cache full text for %s", articleURL), "red", err)
+    }
+}
+
+func cacheObjectName(articleURL string) string {
+    hash := sha256.Sum256([]byte(articleURL))
+    return hex.EncodeToString(hash[:]) + ".txt"
+}
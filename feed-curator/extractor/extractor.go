@@ -0,0 +1,279 @@
+package extractor
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "net/url"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+
+    "feed-curator/models"
+    "feed-curator/utils"
+
+    "golang.org/x/net/html/charset"
+)
+
+const (
+    UserAgent = "StockicBot/1.0"
+
+    maxPageBytes = 5 << 20
+    defaultDomainInterval = 2 * time.Second
+    defaultWorkers = 8
+)
+
+var truncationMarker = regexp.MustCompile(`\s*\[\+\d+ chars\]\s*$`)
+
+/*
+Extractor fetches article pages and pulls out their body text. It is polite by
+construction: robots.txt is honoured per host (including Crawl-delay), requests
+to the same domain are spaced out, and successful extractions are cached so an
+article is only fetched once.
+*/
+type Extractor struct {
+    client          *http.Client
+    cache           Cache
+    domainInterval  time.Duration
+
+    robotsMutex     sync.Mutex
+    robots          map[string]*robotsEntry
+
+    paceMutex       sync.Mutex
+    nextRequest     map[string]time.Time
+}
+
+func New(cache Cache) *Extractor {
+    interval := defaultDomainInterval
+    if seconds, err := strconv.ParseFloat(os.Getenv("FULLTEXT_DOMAIN_INTERVAL"), 64); err == nil && seconds >= 0 {
+        interval = time.Duration(seconds * float64(time.Second))
+    }
+
+    return &Extractor{
+        client:         &http.Client{Timeout: 15 * time.Second},
+        cache:          cache,
+        domainInterval: interval,
+        robots:         make(map[string]*robotsEntry),
+        nextRequest:    make(map[string]time.Time),
+    }
+}
+
+func Enabled() bool {
+    return os.Getenv("FULLTEXT_EXTRACTION") != "false"
+}
+
+/*
+FullText returns the extracted body of the article at articleURL. Any failure
+(robots.txt, network, non-HTML, nothing readable, or a result shorter than the
+NewsAPI content) is returned as an error so the caller can fall back.
+*/
+func (extractor *Extractor) FullText(articleURL, newsAPIContent string) (string, error) {
+    if extractor.cache != nil {
+        if text, found := extractor.cache.Get(articleURL); found {
+            return text, nil
+        }
+    }
+
+    parsed, err := url.Parse(articleURL)
+    if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+        return "", fmt.Errorf("invalid article URL: %s", articleURL)
+    }
+
+    robots := extractor.robotsFor(parsed)
+    if !robots.allowed(parsed.EscapedPath()) {
+        return "", fmt.Errorf("disallowed by robots.txt: %s", articleURL)
+    }
+
+    extractor.wait(parsed.Hostname(), max(extractor.domainInterval, robots.crawlDelay))
+
+    page, err := extractor.get(articleURL)
+    if err != nil {
+        return "", err
+    }
+
+    text, err := Extract(bytes.NewReader(page))
+    if err != nil {
+        return "", err
+    }
+
+    newsAPIText := truncationMarker.ReplaceAllString(newsAPIContent, "")
+    if utf8.RuneCountInString(text) < utf8.RuneCountInString(newsAPIText) {
+        return "", fmt.Errorf("extracted text shorter than NewsAPI content: %s", articleURL)
+    }
+
+    if extractor.cache != nil {
+        extractor.cache.Set(articleURL, text)
+    }
+    return text, nil
+}
+
+/*
+EnrichArticles sets FullText on every article it can extract, in place.
+Articles appearing under several countries/categories are fetched once.
+Workers run in parallel, but the per-domain pacing keeps each site at one
+request per interval.
+*/
+func (extractor *Extractor) EnrichArticles(categorizedNews map[string]models.APIResponse) {
+    articlesByURL := make(map[string][]*models.Article)
+    for _, response := range categorizedNews {
+        for i := range response.Articles {
+            article := &response.Articles[i]
+            if article.URL != "" {
+                articlesByURL[article.URL] = append(articlesByURL[article.URL], article)
+            }
+        }
+    }
+
+    workers := defaultWorkers
+    if configured, err := strconv.Atoi(os.Getenv("FULLTEXT_WORKERS")); err == nil && configured > 0 {
+        workers = configured
+    }
+
+    urls := make(chan string)
+    var (
+        waitGroup   sync.WaitGroup
+        mutex       sync.Mutex
+        extracted   int
+    )
+
+    for worker := 0; worker < workers; worker++ {
+        waitGroup.Add(1)
+        go func() {
+            defer waitGroup.Done()
+            for articleURL := range urls {
+                text, err := extractor.FullText(articleURL, articlesByURL[articleURL][0].Content)
+                if err != nil {
+                    utils.LogMessage(fmt.Sprintf("Full text extraction failed, keeping NewsAPI content: %s", articleURL), "red", err)
+                    continue
+                }
+
+                mutex.Lock()
+                for _, article := range articlesByURL[articleURL] {
+                    article.FullText = text
+                }
+                extracted++
+                mutex.Unlock()
+            }
+        }()
+    }
+
+    for articleURL := range articlesByURL {
+        urls <- articleURL
+    }
+    close(urls)
+    waitGroup.Wait()
+
+    utils.LogMessage(fmt.Sprintf("Extracted full text for %d of %d articles", extracted, len(articlesByURL)), "green")
+}
+
+func (extractor *Extractor) get(pageURL string) ([]byte, error) {
+    request, err := http.NewRequest(http.MethodGet, pageURL, nil)
+    if err != nil {
+        return nil, err
+    }
+    request.Header.Set("User-Agent", UserAgent)
+    request.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+    response, err := extractor.client.Do(request)
+    if err != nil {
+        return nil, err
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("non-200 status code %d for %s", response.StatusCode, pageURL)
+    }
+
+    contentType := response.Header.Get("Content-Type")
+    mediaType, _, _ := mime.ParseMediaType(contentType)
+    if mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+        return nil, fmt.Errorf("unsupported content type %s for %s", mediaType, pageURL)
+    }
+
+    // Pages are decoded to UTF-8 from the header charset, a <meta> declaration or a sniffed encoding
+    body, err := charset.NewReader(io.LimitReader(response.Body, maxPageBytes), contentType)
+    if err != nil {
+        return nil, fmt.Errorf("unsupported charset for %s: %w", pageURL, err)
+    }
+    return io.ReadAll(body)
+}
+
+// robotsEntry is the robots.txt of a host, ready is closed once rules is set
+type robotsEntry struct {
+    ready   chan struct{}
+    rules   *robotsRules
+}
+
+/*
+robotsFor fetches and caches robots.txt per host. A missing robots.txt (4xx)
+allows everything; an unreachable one (network error, 5xx) is treated as a
+full disallow, as crawlers conventionally do. The first caller for a host
+fetches it, others for the same host wait for that fetch and the rest carry on.
+*/
+func (extractor *Extractor) robotsFor(pageURL *url.URL) *robotsRules {
+    extractor.robotsMutex.Lock()
+    entry, cached := extractor.robots[pageURL.Host]
+    if !cached {
+        entry = &robotsEntry{ready: make(chan struct{})}
+        extractor.robots[pageURL.Host] = entry
+    }
+    extractor.robotsMutex.Unlock()
+
+    if cached {
+        <-entry.ready
+        return entry.rules
+    }
+
+    entry.rules = extractor.fetchRobots(pageURL)
+    close(entry.ready)
+    return entry.rules
+}
+
+func (extractor *Extractor) fetchRobots(pageURL *url.URL) *robotsRules {
+    disallowAll := &robotsRules{rules: []robotsRule{{pattern: "/", allow: false}}}
+    robots := disallowAll
+
+    robotsURL := fmt.Sprintf("%s://%s/robots.txt", pageURL.Scheme, pageURL.Host)
+    extractor.wait(pageURL.Hostname(), extractor.domainInterval)
+
+    request, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+    if err == nil {
+        request.Header.Set("User-Agent", UserAgent)
+        response, err := extractor.client.Do(request)
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to fetch %s", robotsURL), "red", err)
+        } else {
+            switch {
+            case response.StatusCode == http.StatusOK:
+                robots = parseRobots(io.LimitReader(response.Body, 512<<10), UserAgent)
+            case response.StatusCode >= 400 && response.StatusCode < 500:
+                robots = &robotsRules{}
+            }
+            response.Body.Close()
+        }
+    }
+
+    return robots
+}
+
+// wait blocks until the domain may be requested again and reserves the next slot
+func (extractor *Extractor) wait(host string, interval time.Duration) {
+    host = strings.TrimPrefix(strings.ToLower(host), "www.")
+
+    extractor.paceMutex.Lock()
+    now := time.Now()
+    slot := extractor.nextRequest[host]
+    if slot.Before(now) {
+        slot = now
+    }
+    extractor.nextRequest[host] = slot.Add(interval)
+    extractor.paceMutex.Unlock()
+
+    time.Sleep(slot.Sub(now))
+}
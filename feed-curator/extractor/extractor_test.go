@@ -0,0 +1,208 @@
+package extractor
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+    t.Helper()
+    content, err := os.ReadFile(filepath.Join("testdata", name))
+    if err != nil {
+        t.Fatalf("failed to read fixture %s: %v", name, err)
+    }
+    return content
+}
+
+func newTestExtractor(t *testing.T) *Extractor {
+    t.Helper()
+    t.Setenv("FULLTEXT_DOMAIN_INTERVAL", "0")
+    return New(nil)
+}
+
+func TestExtract(t *testing.T) {
+    tests := []struct {
+        fixture     string
+        contains    []string
+        excludes    []string
+        err         error
+    }{
+        {
+            fixture: "article.html",
+            contains: []string{
+                "reported quarterly revenue of $35 billion",
+                "Data center sales, which now make up",
+                "Guidance",
+                "Shares rose 3 percent in extended trading",
+            },
+            excludes: []string{
+                "window.analytics",
+                "We use cookies",
+                "Advertisement",
+                "Most read",
+                "Rival chipmaker cuts forecast",
+                "valuation is still far too high",
+                "Copyright",
+            },
+        },
+        {
+            fixture: "navigation.html",
+            err:     ErrNoContent,
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.fixture, func(t *testing.T) {
+            text, err := Extract(strings.NewReader(string(readFixture(t, test.fixture))))
+            if test.err != nil {
+                if !errors.Is(err, test.err) {
+                    t.Fatalf("expected %v, got %v (text %q)", test.err, err, text)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            for _, expected := range test.contains {
+                if !strings.Contains(text, expected) {
+                    t.Errorf("text is missing %q:\n%s", expected, text)
+                }
+            }
+            for _, unexpected := range test.excludes {
+                if strings.Contains(text, unexpected) {
+                    t.Errorf("text contains boilerplate %q:\n%s", unexpected, text)
+                }
+            }
+        })
+    }
+}
+
+func TestFullTextDecodesCharset(t *testing.T) {
+    page := readFixture(t, "latin1.html")
+
+    tests := []struct {
+        name        string
+        contentType string
+    }{
+        {name: "meta declaration", contentType: "text/html"},
+        {name: "header charset", contentType: "text/html; charset=ISO-8859-1"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Path == "/robots.txt" {
+                    http.NotFound(w, r)
+                    return
+                }
+                w.Header().Set("Content-Type", test.contentType)
+                w.Write(page)
+            }))
+            defer server.Close()
+
+            text, err := newTestExtractor(t).FullText(server.URL+"/boerse", "")
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            for _, expected := range []string{"Die Börse in Frankfurt schloss am Freitag höher", "Münchener Rück"} {
+                if !strings.Contains(text, expected) {
+                    t.Errorf("text is missing %q:\n%s", expected, text)
+                }
+            }
+        })
+    }
+}
+
+func TestFullTextRobots(t *testing.T) {
+    page := readFixture(t, "article.html")
+    var robotsFetches int32
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/robots.txt" {
+            atomic.AddInt32(&robotsFetches, 1)
+            w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+            return
+        }
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.Write(page)
+    }))
+    defer server.Close()
+
+    extractor := newTestExtractor(t)
+
+    var waitGroup sync.WaitGroup
+    errs := make([]error, 8)
+    for index := range errs {
+        waitGroup.Add(1)
+        go func(index int) {
+            defer waitGroup.Done()
+            _, errs[index] = extractor.FullText(server.URL+"/news/"+string(rune('a'+index)), "")
+        }(index)
+    }
+    waitGroup.Wait()
+
+    for _, err := range errs {
+        if err != nil {
+            t.Errorf("unexpected error: %v", err)
+        }
+    }
+    if fetches := atomic.LoadInt32(&robotsFetches); fetches != 1 {
+        t.Errorf("robots.txt fetched %d times, expected once per host", fetches)
+    }
+
+    if _, err := extractor.FullText(server.URL+"/private/story", ""); err == nil {
+        t.Error("expected a path disallowed by robots.txt to be refused")
+    }
+}
+
+func TestParseRobots(t *testing.T) {
+    robotsTxt := `
+# Comments are ignored
+User-agent: Googlebot
+Disallow: /
+
+User-agent: StockicBot
+User-agent: OtherBot
+Disallow: /private/
+Allow: /private/press/
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+
+User-agent: *
+Disallow: /
+`
+    robots := parseRobots(strings.NewReader(robotsTxt), UserAgent)
+
+    tests := []struct {
+        path    string
+        allowed bool
+    }{
+        {path: "/news/story", allowed: true},
+        {path: "/private/story", allowed: false},
+        {path: "/private/press/release", allowed: true},
+        {path: "/reports/q3.pdf", allowed: false},
+        {path: "/reports/q3.pdf.html", allowed: true},
+    }
+    for _, test := range tests {
+        if allowed := robots.allowed(test.path); allowed != test.allowed {
+            t.Errorf("allowed(%q) = %t, expected %t", test.path, allowed, test.allowed)
+        }
+    }
+    if robots.crawlDelay.Seconds() != 1.5 {
+        t.Errorf("crawl delay = %s, expected 1.5s", robots.crawlDelay)
+    }
+
+    if wildcard := parseRobots(strings.NewReader("User-agent: *\nDisallow: /\n"), UserAgent); wildcard.allowed("/news") {
+        t.Error("expected the * group to apply when no group names the user agent")
+    }
+    if empty := parseRobots(strings.NewReader(""), UserAgent); !empty.allowed("/news") {
+        t.Error("expected an empty robots.txt to allow everything")
+    }
+}
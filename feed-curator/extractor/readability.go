@@ -0,0 +1,257 @@
+package extractor
+
+import (
+    "errors"
+    "io"
+    "regexp"
+    "sort"
+    "strings"
+
+    "golang.org/x/net/html"
+    "golang.org/x/net/html/atom"
+)
+
+var (
+    ErrNoContent = errors.New("no readable content found")
+
+    positiveHints = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text`)
+    negativeHints = regexp.MustCompile(`(?i)ad-|ads|banner|breadcrumb|comment|combx|community|cookie|footer|header|menu|meta|modal|nav|newsletter|outbrain|promo|related|share|shoutbox|sidebar|social|sponsor|subscribe|taboola|widget`)
+    whitespace = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// Elements that never hold article text
+var strippedElements = map[atom.Atom]bool{
+    atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+    atom.Nav: true, atom.Footer: true, atom.Header: true, atom.Aside: true,
+    atom.Form: true, atom.Button: true, atom.Svg: true, atom.Figure: true,
+    atom.Select: true, atom.Input: true, atom.Textarea: true,
+}
+
+// Elements whose text is collected as paragraphs
+var paragraphElements = map[atom.Atom]bool{
+    atom.P: true, atom.Pre: true, atom.Blockquote: true, atom.Li: true,
+    atom.H2: true, atom.H3: true,
+}
+
+const minParagraphLength = 25
+
+/*
+Extract returns the readable body text of an HTML document, paragraphs
+separated by blank lines. It follows the readability approach: boilerplate
+elements are dropped, every paragraph awards points to its parent and
+grandparent based on its length and comma count, candidates are weighted by
+class/id hints and link density, and the text of the best candidate plus its
+similarly scored siblings is kept.
+*/
+func Extract(reader io.Reader) (string, error) {
+    document, err := html.Parse(reader)
+    if err != nil {
+        return "", err
+    }
+
+    stripBoilerplate(document)
+
+    scores := make(map[*html.Node]float64)
+    var order []*html.Node
+    addScore := func(node *html.Node, score float64) {
+        if node == nil || node.Type != html.ElementNode {
+            return
+        }
+        if _, exists := scores[node]; !exists {
+            scores[node] = classWeight(node)
+            order = append(order, node)
+        }
+        scores[node] += score
+    }
+
+    walk(document, func(node *html.Node) bool {
+        if node.Type != html.ElementNode || node.DataAtom != atom.P && node.DataAtom != atom.Pre {
+            return true
+        }
+
+        text := nodeText(node)
+        if len(text) < minParagraphLength {
+            return false
+        }
+
+        score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+        addScore(node.Parent, score)
+        if node.Parent != nil {
+            addScore(node.Parent.Parent, score/2)
+        }
+        return false
+    })
+
+    if len(order) == 0 {
+        return "", ErrNoContent
+    }
+
+    for _, node := range order {
+        scores[node] *= 1 - linkDensity(node)
+    }
+
+    // Stable order keeps the first candidate in document order on ties
+    sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+    best := order[0]
+
+    // Siblings that score close to the winner are usually split article bodies
+    threshold := max(10, scores[best]*0.2)
+    var paragraphs []string
+    for _, node := range siblingsOf(best) {
+        if node != best {
+            if score, scored := scores[node]; !scored || score < threshold {
+                continue
+            }
+        }
+        paragraphs = append(paragraphs, collectParagraphs(node)...)
+    }
+
+    text := strings.TrimSpace(strings.Join(paragraphs, "\n\n"))
+    if text == "" {
+        return "", ErrNoContent
+    }
+    return text, nil
+}
+
+func stripBoilerplate(root *html.Node) {
+    var remove []*html.Node
+    walk(root, func(node *html.Node) bool {
+        if node.Type == html.CommentNode {
+            remove = append(remove, node)
+            return false
+        }
+        if node.Type != html.ElementNode {
+            return true
+        }
+        if strippedElements[node.DataAtom] || isHidden(node) {
+            remove = append(remove, node)
+            return false
+        }
+        // Clearly non-article blocks, unless they also look like the article
+        hints := attribute(node, "class") + " " + attribute(node, "id")
+        if node.DataAtom == atom.Div && negativeHints.MatchString(hints) && !positiveHints.MatchString(hints) {
+            remove = append(remove, node)
+            return false
+        }
+        return true
+    })
+
+    for _, node := range remove {
+        if node.Parent != nil {
+            node.Parent.RemoveChild(node)
+        }
+    }
+}
+
+func classWeight(node *html.Node) float64 {
+    weight := 0.0
+    for _, value := range []string{attribute(node, "class"), attribute(node, "id")} {
+        if value == "" {
+            continue
+        }
+        if negativeHints.MatchString(value) {
+            weight -= 25
+        }
+        if positiveHints.MatchString(value) {
+            weight += 25
+        }
+    }
+    if node.DataAtom == atom.Article {
+        weight += 25
+    }
+    return weight
+}
+
+func linkDensity(node *html.Node) float64 {
+    textLength := len(nodeText(node))
+    if textLength == 0 {
+        return 0
+    }
+
+    linkLength := 0
+    walk(node, func(child *html.Node) bool {
+        if child.Type == html.ElementNode && child.DataAtom == atom.A {
+            linkLength += len(nodeText(child))
+            return false
+        }
+        return true
+    })
+
+    return float64(linkLength) / float64(textLength)
+}
+
+func collectParagraphs(root *html.Node) []string {
+    var paragraphs []string
+    walk(root, func(node *html.Node) bool {
+        if node.Type != html.ElementNode || !paragraphElements[node.DataAtom] {
+            return true
+        }
+        text := nodeText(node)
+        if len(text) >= minParagraphLength || node.DataAtom == atom.H2 || node.DataAtom == atom.H3 {
+            if text != "" && linkDensity(node) < 0.5 {
+                paragraphs = append(paragraphs, text)
+            }
+        }
+        return false
+    })
+    return paragraphs
+}
+
+func siblingsOf(node *html.Node) []*html.Node {
+    if node.Parent == nil {
+        return []*html.Node{node}
+    }
+    var siblings []*html.Node
+    for sibling := node.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+        if sibling.Type == html.ElementNode {
+            siblings = append(siblings, sibling)
+        }
+    }
+    return siblings
+}
+
+func nodeText(root *html.Node) string {
+    var builder strings.Builder
+    walk(root, func(node *html.Node) bool {
+        if node.Type == html.TextNode {
+            builder.WriteString(node.Data)
+            builder.WriteByte(' ')
+        }
+        return true
+    })
+    return strings.TrimSpace(whitespace.ReplaceAllString(builder.String(), " "))
+}
+
+func isHidden(node *html.Node) bool {
+    if _, hidden := attributeValue(node, "hidden"); hidden {
+        return true
+    }
+    style := strings.ReplaceAll(strings.ToLower(attribute(node, "style")), " ", "")
+    return strings.Contains(style, "display:none") || attribute(node, "aria-hidden") == "true"
+}
+
+func attribute(node *html.Node, key string) string {
+    value, _ := attributeValue(node, key)
+    return value
+}
+
+func attributeValue(node *html.Node, key string) (string, bool) {
+    for _, attr := range node.Attr {
+        if attr.Key == key {
+            return attr.Val, true
+        }
+    }
+    return "", false
+}
+
+// walk visits nodes depth first; returning false skips the node's children
+func walk(node *html.Node, visit func(*html.Node) bool) {
+    if !visit(node) {
+        return
+    }
+    for child := node.FirstChild; child != nil; {
+        next := child.NextSibling
+        walk(child, visit)
+        child = next
+    }
+}
@@ -0,0 +1,113 @@
+package extractor
+
+import (
+    "bufio"
+    "io"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type robotsRule struct {
+    pattern string
+    allow   bool
+}
+
+// The part of a robots.txt that applies to our user agent
+type robotsRules struct {
+    rules      []robotsRule
+    crawlDelay time.Duration
+}
+
+/*
+parseRobots keeps the group addressed to userAgent, or the "*" group when
+there is none. Paths are matched by the longest rule, Allow winning ties,
+with "*" and a trailing "$" supported as in Google's robots.txt spec.
+*/
+func parseRobots(reader io.Reader, userAgent string) *robotsRules {
+    agentToken := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+
+    var (
+        specific, wildcard  *robotsRules
+        group               *robotsRules
+        inRules             bool
+    )
+
+    scanner := bufio.NewScanner(reader)
+    for scanner.Scan() {
+        line := scanner.Text()
+        if index := strings.Index(line, "#"); index >= 0 {
+            line = line[:index]
+        }
+        key, value, found := strings.Cut(line, ":")
+        if !found {
+            continue
+        }
+        key = strings.ToLower(strings.TrimSpace(key))
+        value = strings.TrimSpace(value)
+
+        switch key {
+        case "user-agent":
+            // Consecutive user-agent lines share a group, one after rules starts a new group
+            if group == nil || inRules {
+                group = &robotsRules{}
+                inRules = false
+            }
+
+            agent := strings.ToLower(value)
+            if agent == agentToken && specific == nil {
+                specific = group
+            } else if agent == "*" && wildcard == nil {
+                wildcard = group
+            }
+        case "allow", "disallow":
+            inRules = true
+            if group != nil && value != "" {
+                group.rules = append(group.rules, robotsRule{pattern: value, allow: key == "allow"})
+            }
+        case "crawl-delay":
+            inRules = true
+            if seconds, err := strconv.ParseFloat(value, 64); err == nil && group != nil {
+                group.crawlDelay = time.Duration(seconds * float64(time.Second))
+            }
+        }
+    }
+
+    if specific != nil {
+        return specific
+    }
+    if wildcard != nil {
+        return wildcard
+    }
+    return &robotsRules{}
+}
+
+func (robots *robotsRules) allowed(path string) bool {
+    best, allow := -1, true
+    for _, rule := range robots.rules {
+        if !robotsMatch(rule.pattern, path) {
+            continue
+        }
+        if len(rule.pattern) > best || len(rule.pattern) == best && rule.allow {
+            best, allow = len(rule.pattern), rule.allow
+        }
+    }
+    return allow
+}
+
+func robotsMatch(pattern, path string) bool {
+    anchored := strings.HasSuffix(pattern, "$")
+    parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+    for i, part := range parts {
+        parts[i] = regexp.QuoteMeta(part)
+    }
+
+    expression := "^" + strings.Join(parts, ".*")
+    if anchored {
+        expression += "$"
+    }
+
+    matched, err := regexp.MatchString(expression, path)
+    return err == nil && matched
+}
@@ -0,0 +1,398 @@
+package feedstore
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "feed-curator/models"
+    "feed-curator/stories"
+    "feed-curator/utils"
+
+    "github.com/go-redis/redis/v8"
+)
+
+const (
+    // Allocates version numbers, only ever incremented
+    SequenceKey = "feed:sequence"
+    // Version served by feed-api
+    CurrentKey = "feed:current"
+    // Promoted versions still kept in Redis, scored by version
+    VersionsKey = "feed:versions"
+    UpdatedAtKey = "feed:updated-at"
+
+    RetainVersionsEnv = "FEED_RETAIN_VERSIONS"
+    MinArticlesEnv = "FEED_MIN_ARTICLES"
+    MaxUnderfilledEnv = "FEED_MAX_UNDERFILLED"
+
+    DefaultRetainVersions = 5
+    DefaultMinArticles = 3
+    DefaultMaxUnderfilled = 0
+
+    // Rejected runs are kept this long for inspection
+    RejectedVersionTTL = 24 * time.Hour
+)
+
+// Feeds making up one version
+var FeedNames = []string{"headlines", "discover"}
+
+// Story clusters of a version, stored next to its feeds as a map of story ID to story
+const StoriesName = "stories"
+
+/*
+VersionMeta describes a staged version. Counts holds the number of usable
+articles per country (headlines) or category (discover).
+*/
+type VersionMeta struct {
+    Version     int64                       `json:"version"`
+    CreatedAt   time.Time                   `json:"createdAt"`
+    Source      string                      `json:"source"`
+    Counts      map[string]map[string]int   `json:"counts"`
+    Stories     int                         `json:"stories"`
+}
+
+type VersionInfo struct {
+    VersionMeta
+    Current     bool    `json:"current"`
+}
+
+/*
+Rules decide whether a run is good enough to serve. Every expected country
+and category must have MinArticles usable articles, MaxUnderfilled of them
+may fall short (NewsAPI is thin for some countries on quiet days).
+*/
+type Rules struct {
+    MinArticles     int
+    MaxUnderfilled  int
+}
+
+func FeedKey(version int64, feedName string) string {
+    return fmt.Sprintf("feed:%d:%s", version, feedName)
+}
+
+func metaKey(version int64) string {
+    return fmt.Sprintf("feed:%d:meta", version)
+}
+
+// Every key of a version. Versions staged before stories existed have no stories key, which EXPIRE, PERSIST and DEL ignore
+func versionKeys(version int64) []string {
+    keys := []string{metaKey(version), FeedKey(version, StoriesName)}
+    for _, feedName := range FeedNames {
+        keys = append(keys, FeedKey(version, feedName))
+    }
+    return keys
+}
+
+func LoadRules() Rules {
+    return Rules{
+        MinArticles:    envInt(MinArticlesEnv, DefaultMinArticles),
+        MaxUnderfilled: envInt(MaxUnderfilledEnv, DefaultMaxUnderfilled),
+    }
+}
+
+/*
+Validate checks one feed against the rules. An article only counts when it
+has a title and a summary: an AI outage yields articles with empty content,
+which must not replace good ones.
+*/
+func Validate(feedName string, feed map[string]models.SummarizedResponse, expectedKeys []string, rules Rules) error {
+    var underfilled []string
+    for _, key := range expectedKeys {
+        if count := usableArticles(feed[key]); count < rules.MinArticles {
+            underfilled = append(underfilled, fmt.Sprintf("%s=%d", key, count))
+        }
+    }
+
+    if len(underfilled) > rules.MaxUnderfilled {
+        return fmt.Errorf("%s has %d keys below %d articles (at most %d allowed): %s",
+            feedName, len(underfilled), rules.MinArticles, rules.MaxUnderfilled, strings.Join(underfilled, ", "))
+    }
+    if len(underfilled) > 0 {
+        utils.LogMessage(fmt.Sprintf("%s accepted with underfilled keys: %s", feedName, strings.Join(underfilled, ", ")), "red")
+    }
+
+    return nil
+}
+
+func usableArticles(response models.SummarizedResponse) int {
+    count := 0
+    for _, article := range response.Articles {
+        if strings.TrimSpace(article.Title) != "" && strings.TrimSpace(article.SummarizedContent) != "" {
+            count++
+        }
+    }
+    return count
+}
+
+/*
+Stage writes the feeds of a run under a new version without touching what
+is served. source says where the run came from ("fetch", "replay", ...). The
+articles are clustered into stories first, which tags them with their story.
+*/
+func Stage(feeds map[string]map[string]models.SummarizedResponse, source string) (int64, error) {
+    versionStories := stories.Cluster(feeds)
+
+    version, err := models.FreshNewsRedis.Incr(models.FreshNewsRedisCtx, SequenceKey).Result()
+    if err != nil {
+        return 0, fmt.Errorf("failed to allocate feed version: %w", err)
+    }
+
+    meta := VersionMeta{
+        Version:   version,
+        CreatedAt: time.Now().UTC(),
+        Source:    source,
+        Counts:    make(map[string]map[string]int),
+    }
+
+    pipe := models.FreshNewsRedis.TxPipeline()
+    for feedName, feed := range feeds {
+        feedJSON, err := json.Marshal(feed)
+        if err != nil {
+            return 0, fmt.Errorf("failed to serialize %s: %w", feedName, err)
+        }
+        pipe.Set(models.FreshNewsRedisCtx, FeedKey(version, feedName), feedJSON, 0)
+
+        meta.Counts[feedName] = make(map[string]int)
+        for key, response := range feed {
+            meta.Counts[feedName][key] = usableArticles(response)
+        }
+    }
+
+    storiesJSON, err := json.Marshal(versionStories)
+    if err != nil {
+        return 0, fmt.Errorf("failed to serialize stories: %w", err)
+    }
+    pipe.Set(models.FreshNewsRedisCtx, FeedKey(version, StoriesName), storiesJSON, 0)
+    meta.Stories = len(versionStories)
+
+    metaJSON, err := json.Marshal(meta)
+    if err != nil {
+        return 0, err
+    }
+    pipe.Set(models.FreshNewsRedisCtx, metaKey(version), metaJSON, 0)
+
+    if _, err := pipe.Exec(models.FreshNewsRedisCtx); err != nil {
+        return 0, fmt.Errorf("failed to stage feed version %d: %w", version, err)
+    }
+
+    utils.LogMessage(fmt.Sprintf("Staged feed version %d", version), "green")
+    return version, nil
+}
+
+/*
+Publish stages a run, validates every feed against its expected countries or
+categories and promotes it. A run failing validation is rejected and the
+served version stays untouched.
+*/
+func Publish(feeds map[string]map[string]models.SummarizedResponse, expectedKeys map[string][]string, source string) (int64, error) {
+    version, err := Stage(feeds, source)
+    if err != nil {
+        return 0, err
+    }
+
+    rules := LoadRules()
+    var failures []error
+    for _, feedName := range FeedNames {
+        if err := Validate(feedName, feeds[feedName], expectedKeys[feedName], rules); err != nil {
+            failures = append(failures, err)
+        }
+    }
+    if len(failures) > 0 {
+        Reject(version)
+        return version, fmt.Errorf("feed version %d rejected: %w", version, errors.Join(failures...))
+    }
+
+    return version, Promote(version)
+}
+
+// Reject keeps a staged version around for a day so the bad run can be inspected, then lets Redis drop it
+func Reject(version int64) {
+    pipe := models.FreshNewsRedis.Pipeline()
+    for _, key := range versionKeys(version) {
+        pipe.Expire(models.FreshNewsRedisCtx, key, RejectedVersionTTL)
+    }
+    if _, err := pipe.Exec(models.FreshNewsRedisCtx); err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to expire rejected feed version %d", version), "red", err)
+    }
+}
+
+/*
+Promote makes a staged version the served one. The pointer swap, the
+curation time and the version list are written in one MULTI, so readers see
+either the old version or the new one, never a mix of both feeds. Readers are
+then told to drop their caches and versions beyond the retention are deleted.
+*/
+func Promote(version int64) error {
+    if err := requireVersion(version); err != nil {
+        return err
+    }
+
+    pipe := models.FreshNewsRedis.TxPipeline()
+    // A rejected run promoted by hand must not expire while served
+    for _, key := range versionKeys(version) {
+        pipe.Persist(models.FreshNewsRedisCtx, key)
+    }
+    pipe.Set(models.FreshNewsRedisCtx, CurrentKey, version, 0)
+    pipe.Set(models.FreshNewsRedisCtx, UpdatedAtKey, time.Now().UTC().Format(time.RFC3339), 0)
+    pipe.ZAdd(models.FreshNewsRedisCtx, VersionsKey, &redis.Z{Score: float64(version), Member: version})
+    if _, err := pipe.Exec(models.FreshNewsRedisCtx); err != nil {
+        return fmt.Errorf("failed to promote feed version %d: %w", version, err)
+    }
+
+    utils.LogMessage(fmt.Sprintf("Promoted feed version %d", version), "green")
+    publishFeedUpdate(version)
+    prune(version)
+    return nil
+}
+
+/*
+Rollback serves an older retained version again. With target 0 the newest
+retained version below the current one is used. A later curator run promotes
+its own version as usual.
+*/
+func Rollback(target int64) (int64, error) {
+    current, err := Current()
+    if err != nil {
+        return 0, err
+    }
+
+    if target == 0 {
+        previous, err := models.FreshNewsRedis.ZRevRangeByScore(models.FreshNewsRedisCtx, VersionsKey, &redis.ZRangeBy{
+            Min:   "-inf",
+            Max:   fmt.Sprintf("(%d", current),
+            Count: 1,
+        }).Result()
+        if err != nil {
+            return 0, err
+        }
+        if len(previous) == 0 {
+            return 0, fmt.Errorf("no retained version older than %d", current)
+        }
+        target, _ = strconv.ParseInt(previous[0], 10, 64)
+    }
+
+    if target == current {
+        return 0, fmt.Errorf("version %d is already served", target)
+    }
+
+    if err := Promote(target); err != nil {
+        return 0, err
+    }
+
+    utils.LogMessage(fmt.Sprintf("Rolled back feed from version %d to %d", current, target), "green")
+    return target, nil
+}
+
+// Current returns the served version, 0 when nothing was promoted yet
+func Current() (int64, error) {
+    current, err := models.FreshNewsRedis.Get(models.FreshNewsRedisCtx, CurrentKey).Int64()
+    if err == redis.Nil {
+        return 0, nil
+    }
+    return current, err
+}
+
+// ListVersions returns the retained versions, newest first
+func ListVersions() ([]VersionInfo, error) {
+    current, err := Current()
+    if err != nil {
+        return nil, err
+    }
+
+    members, err := models.FreshNewsRedis.ZRevRange(models.FreshNewsRedisCtx, VersionsKey, 0, -1).Result()
+    if err != nil {
+        return nil, err
+    }
+
+    versions := make([]VersionInfo, 0, len(members))
+    for _, member := range members {
+        version, err := strconv.ParseInt(member, 10, 64)
+        if err != nil {
+            continue
+        }
+
+        info := VersionInfo{VersionMeta: VersionMeta{Version: version}, Current: version == current}
+        metaJSON, err := models.FreshNewsRedis.Get(models.FreshNewsRedisCtx, metaKey(version)).Result()
+        if err == nil {
+            json.Unmarshal([]byte(metaJSON), &info.VersionMeta)
+        }
+        versions = append(versions, info)
+    }
+
+    return versions, nil
+}
+
+func requireVersion(version int64) error {
+    keys := []string{metaKey(version)}
+    for _, feedName := range FeedNames {
+        keys = append(keys, FeedKey(version, feedName))
+    }
+
+    found, err := models.FreshNewsRedis.Exists(models.FreshNewsRedisCtx, keys...).Result()
+    if err != nil {
+        return err
+    }
+    if found != int64(len(keys)) {
+        return fmt.Errorf("feed version %d is incomplete or no longer retained", version)
+    }
+    return nil
+}
+
+// Announces the promoted version so feed-api replicas drop what they decoded from the previous one
+func publishFeedUpdate(version int64) {
+    payload := fmt.Sprintf("version %d", version)
+    err := models.FreshNewsRedis.Publish(models.FreshNewsRedisCtx, models.FeedUpdatesChannel, payload).Err()
+    if err != nil {
+        utils.LogMessage("Failed to publish feed update, readers will refresh on cache expiry", "red", err)
+        return
+    }
+
+    utils.LogMessage(fmt.Sprintf("Published feed update: %s", payload), "green")
+}
+
+// prune deletes retained versions beyond FEED_RETAIN_VERSIONS, never the served one
+func prune(current int64) {
+    retain := envInt(RetainVersionsEnv, DefaultRetainVersions)
+    if retain < 1 {
+        retain = 1
+    }
+
+    members, err := models.FreshNewsRedis.ZRevRange(models.FreshNewsRedisCtx, VersionsKey, int64(retain), -1).Result()
+    if err != nil {
+        utils.LogMessage("Failed to list feed versions for pruning", "red", err)
+        return
+    }
+
+    var expired []int64
+    for _, member := range members {
+        version, err := strconv.ParseInt(member, 10, 64)
+        if err == nil && version != current {
+            expired = append(expired, version)
+        }
+    }
+    sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+
+    for _, version := range expired {
+        pipe := models.FreshNewsRedis.TxPipeline()
+        pipe.Del(models.FreshNewsRedisCtx, versionKeys(version)...)
+        pipe.ZRem(models.FreshNewsRedisCtx, VersionsKey, version)
+        if _, err := pipe.Exec(models.FreshNewsRedisCtx); err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to prune feed version %d", version), "red", err)
+            continue
+        }
+        utils.LogMessage(fmt.Sprintf("Pruned feed version %d", version), "green")
+    }
+}
+
+func envInt(name string, fallback int) int {
+    value, err := strconv.Atoi(os.Getenv(name))
+    if err != nil {
+        return fallback
+    }
+    return value
+}
@@ -4,6 +4,7 @@ import (
     "fmt"
     "log" 
     "net/http"
+    "net/url"
     "os"
     "time"
     "io"
@@ -103,16 +104,40 @@ func FetchHeadlinesByCountry(countries []string, pageSize string) map[string]mod
     return countryHeadlines
 }
 
-func NewsDiscoveryByCategory(language, sortBy, from, to string) map[string]models.APIResponse {
-    discoverTags := []string{
-        "gainers", "losers", "software", "finance", "stocks",
-        "bonds", "corporate", "banking", "technology", "tax", "geopolitics",
+const DiscoverLanguageEnv = "DISCOVER_LANGUAGE"
+
+// DiscoverLanguage is the language discover news is searched in (ISO 639-1), English by default
+func DiscoverLanguage() string {
+    if language := os.Getenv(DiscoverLanguageEnv); language != "" {
+        return language
     }
+    return "en"
+}
 
+// Categories of the discover feed
+var DiscoverTags = []string{
+    "gainers", "losers", "software", "finance", "stocks",
+    "bonds", "corporate", "banking", "technology", "tax", "geopolitics",
+}
+
+/*
+NewsDiscoveryByCategory searches NewsAPI for every discover category. Given
+the day's movers, gainers and losers hold news about those companies instead
+of articles matching the words "gainers" and "losers"; without market data
+they fall back to the keyword search.
+*/
+func NewsDiscoveryByCategory(language, sortBy, from, to string, gainers, losers []models.PriceChange) map[string]models.APIResponse {
     categorizedResponses := make(map[string]models.APIResponse)
     pageSize := "20"
 
-    for _, category := range discoverTags {
+    movers := map[string][]models.PriceChange{"gainers": gainers, "losers": losers}
+
+    for _, category := range DiscoverTags {
+        if len(movers[category]) > 0 {
+            categorizedResponses[category] = FetchMoversNews(movers[category], language, sortBy, from, to)
+            continue
+        }
+
         page := 1
         var categoryArticles []models.Article
 
@@ -142,3 +167,51 @@ func NewsDiscoveryByCategory(language, sortBy, from, to string) map[string]model
 
     return categorizedResponses
 }
+
+// Articles kept per mover, so one heavily covered company doesn't fill the category
+const moverPageSize = "5"
+
+/*
+FetchMoversNews searches news mentioning each mover by name or ticker and
+tags every article with the price change it was fetched for. An article
+about several movers is kept once, under the first (biggest) one.
+*/
+func FetchMoversNews(movers []models.PriceChange, language, sortBy, from, to string) models.APIResponse {
+    var articles []models.Article
+    seen := make(map[string]bool)
+
+    for _, mover := range movers {
+        response, err := NewsAPIEverythingCaller(moverQuery(mover), "title,description", language, sortBy, from, to, "1", moverPageSize)
+        time.Sleep(1 * time.Second)
+        if err != nil {
+            log.Printf("Error fetching news for mover '%s': %v", mover.Symbol, err)
+            continue
+        }
+
+        for _, article := range response.Articles {
+            if seen[article.URL] {
+                continue
+            }
+            seen[article.URL] = true
+
+            priceChange := mover
+            article.PriceChange = &priceChange
+            articles = append(articles, article)
+        }
+    }
+
+    return models.APIResponse{
+        Status:       "ok",
+        TotalResults: len(articles),
+        Articles:     articles,
+    }
+}
+
+// Tickers alone match too much ("ON", "ALL"), so they're quoted and paired with the company name when known
+func moverQuery(mover models.PriceChange) string {
+    query := fmt.Sprintf("\"%s\"", mover.Symbol)
+    if mover.Name != "" {
+        query = fmt.Sprintf("\"%s\" OR %s", mover.Name, query)
+    }
+    return url.QueryEscape(query)
+}
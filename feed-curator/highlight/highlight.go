@@ -0,0 +1,293 @@
+package highlight
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "unicode"
+    "unicode/utf16"
+)
+
+/*
+Unit is what highlight offsets count. Mobile clients index strings by UTF-16
+code units (Swift's NSString, Java/Kotlin String), so that is the default;
+runes are available for clients that index by code point.
+*/
+type Unit string
+
+const (
+    UnitRunes Unit = "runes"
+    UnitUTF16 Unit = "utf16"
+
+    UnitEnv = "HIGHLIGHTS_UNIT"
+
+    // Share of a point's words a content window has to contain to count as a fuzzy match
+    fuzzyThreshold = 0.75
+)
+
+func ConfiguredUnit() Unit {
+    if Unit(os.Getenv(UnitEnv)) == UnitRunes {
+        return UnitRunes
+    }
+    return UnitUTF16
+}
+
+/*
+Locate finds each extracted point in the content and returns sorted,
+non-overlapping [start, end) ranges in the given unit. LLM-extracted points
+rarely match the text verbatim, so a point is first searched ignoring case,
+whitespace and quote style, then fuzzily as the run of content words that best
+covers the point's words. Points that can't be found are dropped; overlapping
+matches are merged.
+*/
+func Locate(content string, points []string, unit Unit) [][]int {
+    text := []rune(content)
+    normalized, positions := normalize(text)
+    words := tokenize(text)
+
+    var ranges [][2]int
+    for _, point := range points {
+        point = cleanPoint(point)
+        if point == "" {
+            continue
+        }
+
+        if start, end, found := exactMatch(normalized, positions, point); found {
+            ranges = append(ranges, [2]int{start, end})
+            continue
+        }
+
+        if start, end, found := fuzzyMatch(text, words, point); found {
+            ranges = append(ranges, [2]int{start, end})
+        }
+    }
+
+    return convert(text, mergeRanges(ranges), unit)
+}
+
+/*
+Validate checks that ranges can be used as-is by a client: every range is a
+[start, end) pair with 0 <= start < end <= length of the content in unit, the
+ranges are sorted and don't overlap, and UTF-16 offsets don't split a
+surrogate pair.
+*/
+func Validate(content string, ranges [][]int, unit Unit) error {
+    var units []uint16
+    length := len([]rune(content))
+    if unit == UnitUTF16 {
+        units = utf16.Encode([]rune(content))
+        length = len(units)
+    }
+
+    previousEnd := 0
+    for i, span := range ranges {
+        if len(span) != 2 {
+            return fmt.Errorf("range %d has %d offsets, expected 2", i, len(span))
+        }
+        start, end := span[0], span[1]
+        if start < 0 || end > length || start >= end {
+            return fmt.Errorf("range %d [%d, %d) is outside content of length %d %s", i, start, end, length, unit)
+        }
+        if start < previousEnd {
+            return fmt.Errorf("range %d [%d, %d) overlaps or precedes the previous range", i, start, end)
+        }
+        if unit == UnitUTF16 && (splitsSurrogate(units, start) || splitsSurrogate(units, end)) {
+            return fmt.Errorf("range %d [%d, %d) splits a surrogate pair", i, start, end)
+        }
+        previousEnd = end
+    }
+
+    return nil
+}
+
+// Strips list markers, markdown emphasis and wrapping quotes that LLMs add around points
+func cleanPoint(point string) string {
+    point = strings.TrimSpace(point)
+    point = strings.TrimLeft(point, "*-•·> \t")
+    point = strings.ReplaceAll(point, "**", "")
+    point = strings.ReplaceAll(point, "__", "")
+    point = strings.Trim(point, " \t\"'“”‘’`")
+    return strings.TrimRight(point, " .;:,")
+}
+
+/*
+normalize lowercases, unifies quotes/dashes and collapses whitespace runs to a
+single space. positions[i] is the index in the original runes of normalized
+rune i, with one extra entry marking the end.
+*/
+func normalize(text []rune) ([]rune, []int) {
+    var normalized []rune
+    var positions []int
+    previousSpace := true
+
+    for i, r := range text {
+        if unicode.IsSpace(r) {
+            if !previousSpace {
+                normalized = append(normalized, ' ')
+                positions = append(positions, i)
+            }
+            previousSpace = true
+            continue
+        }
+        previousSpace = false
+        normalized = append(normalized, foldRune(r))
+        positions = append(positions, i)
+    }
+
+    return normalized, append(positions, len(text))
+}
+
+func foldRune(r rune) rune {
+    switch r {
+    case '‘', '’', '‚', '′':
+        return '\''
+    case '“', '”', '„', '″':
+        return '"'
+    case '–', '—', '‒', '−':
+        return '-'
+    }
+    return unicode.ToLower(r)
+}
+
+func exactMatch(normalized []rune, positions []int, point string) (int, int, bool) {
+    needle, _ := normalize([]rune(point))
+    if len(needle) == 0 {
+        return 0, 0, false
+    }
+
+    index := strings.Index(string(normalized), string(needle))
+    if index < 0 {
+        return 0, 0, false
+    }
+
+    // Index is in bytes of the normalized string, convert back to runes
+    runeIndex := len([]rune(string(normalized)[:index]))
+    start := positions[runeIndex]
+    end := positions[runeIndex+len(needle)-1] + 1
+    return start, end, true
+}
+
+type word struct {
+    text       string
+    start, end int
+}
+
+// Words are runs of letters and digits, with their rune spans in the content
+func tokenize(text []rune) []word {
+    var words []word
+    start := -1
+    for i := 0; i <= len(text); i++ {
+        inWord := i < len(text) && (unicode.IsLetter(text[i]) || unicode.IsDigit(text[i]))
+        if inWord && start < 0 {
+            start = i
+        }
+        if !inWord && start >= 0 {
+            words = append(words, word{text: strings.ToLower(string(text[start:i])), start: start, end: i})
+            start = -1
+        }
+    }
+    return words
+}
+
+/*
+fuzzyMatch slides windows of roughly the point's length over the content
+words and scores each by the F1 of shared words. The best window is trimmed of
+edge words that aren't in the point, so the highlight starts and ends on
+meaningful words.
+*/
+func fuzzyMatch(text []rune, words []word, point string) (int, int, bool) {
+    pointWords := tokenize([]rune(point))
+    if len(pointWords) == 0 || len(words) == 0 {
+        return 0, 0, false
+    }
+
+    wanted := make(map[string]int)
+    for _, pointWord := range pointWords {
+        wanted[pointWord.text]++
+    }
+
+    minLength := max(1, len(pointWords)*4/5)
+    maxLength := len(pointWords)*5/4 + 1
+
+    bestScore, bestStart, bestEnd := 0.0, -1, -1
+    for start := range words {
+        remaining := make(map[string]int, len(wanted))
+        for key, count := range wanted {
+            remaining[key] = count
+        }
+
+        shared := 0
+        for length := 1; length <= maxLength && start+length <= len(words); length++ {
+            if remaining[words[start+length-1].text] > 0 {
+                remaining[words[start+length-1].text]--
+                shared++
+            }
+            if length < minLength || shared == 0 {
+                continue
+            }
+
+            precision := float64(shared) / float64(length)
+            recall := float64(shared) / float64(len(pointWords))
+            score := 2 * precision * recall / (precision + recall)
+            if score > bestScore {
+                bestScore, bestStart, bestEnd = score, start, start+length-1
+            }
+        }
+    }
+
+    if bestScore < fuzzyThreshold {
+        return 0, 0, false
+    }
+
+    for bestStart < bestEnd && wanted[words[bestStart].text] == 0 {
+        bestStart++
+    }
+    for bestEnd > bestStart && wanted[words[bestEnd].text] == 0 {
+        bestEnd--
+    }
+
+    return words[bestStart].start, words[bestEnd].end, true
+}
+
+func mergeRanges(ranges [][2]int) [][2]int {
+    sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+    var merged [][2]int
+    for _, span := range ranges {
+        last := len(merged) - 1
+        if last >= 0 && span[0] <= merged[last][1] {
+            merged[last][1] = max(merged[last][1], span[1])
+            continue
+        }
+        merged = append(merged, span)
+    }
+    return merged
+}
+
+// convert turns rune offsets into offsets of the requested unit
+func convert(text []rune, ranges [][2]int, unit Unit) [][]int {
+    result := [][]int{}
+
+    offsets := make([]int, len(text)+1)
+    for i, r := range text {
+        width := 1
+        if unit == UnitUTF16 {
+            width = utf16.RuneLen(r)
+            if width < 0 {
+                // Invalid runes are encoded as U+FFFD, a single unit
+                width = 1
+            }
+        }
+        offsets[i+1] = offsets[i] + width
+    }
+
+    for _, span := range ranges {
+        result = append(result, []int{offsets[span[0]], offsets[span[1]]})
+    }
+    return result
+}
+
+func splitsSurrogate(units []uint16, offset int) bool {
+    return offset > 0 && offset < len(units) && utf16.IsSurrogate(rune(units[offset])) && units[offset] >= 0xDC00
+}
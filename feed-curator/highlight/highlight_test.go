@@ -0,0 +1,192 @@
+package highlight
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestLocate(t *testing.T) {
+    earnings := "Revenue rose 20% to $5 billion. Shares fell."
+    rocket := "🚀 Launch succeeded. Rockets 🚀 landed safely."
+
+    tests := []struct {
+        name        string
+        content     string
+        points      []string
+        unit        Unit
+        expected    [][]int
+    }{
+        {
+            name:     "exact ignoring case",
+            content:  earnings,
+            points:   []string{"revenue rose 20%"},
+            unit:     UnitRunes,
+            expected: [][]int{{0, 16}},
+        },
+        {
+            name:     "list marker and emphasis stripped",
+            content:  earnings,
+            points:   []string{"- **Shares fell**."},
+            unit:     UnitRunes,
+            expected: [][]int{{32, 43}},
+        },
+        {
+            name:     "quote style and whitespace ignored",
+            content:  "The CEO said “we are  confident” today.",
+            points:   []string{"\"We are confident\""},
+            unit:     UnitRunes,
+            expected: [][]int{{14, 31}},
+        },
+        {
+            name:     "fuzzy match trimmed to point words",
+            content:  "Nvidia said on Wednesday that quarterly revenue more than doubled to a record.",
+            points:   []string{"Quarterly revenue doubled to a record"},
+            unit:     UnitRunes,
+            expected: [][]int{{30, 77}},
+        },
+        {
+            name:     "unknown point dropped",
+            content:  earnings,
+            points:   []string{"Apple launched a new phone", "  "},
+            unit:     UnitRunes,
+            expected: [][]int{},
+        },
+        {
+            name:     "overlapping points merged",
+            content:  "Profit rose sharply in the third quarter.",
+            points:   []string{"sharply in the third quarter", "Profit rose sharply"},
+            unit:     UnitRunes,
+            expected: [][]int{{0, 40}},
+        },
+        {
+            name:     "touching points merged",
+            content:  "Profit rose sharply in the third quarter.",
+            points:   []string{"Profit rose", "rose sharply"},
+            unit:     UnitRunes,
+            expected: [][]int{{0, 19}},
+        },
+        {
+            name:     "separate points sorted",
+            content:  earnings,
+            points:   []string{"Shares fell", "Revenue rose"},
+            unit:     UnitRunes,
+            expected: [][]int{{0, 12}, {32, 43}},
+        },
+        {
+            name:     "emoji counted as one rune",
+            content:  rocket,
+            points:   []string{"landed safely"},
+            unit:     UnitRunes,
+            expected: [][]int{{30, 43}},
+        },
+        {
+            name:     "emoji counted as two UTF-16 units",
+            content:  rocket,
+            points:   []string{"landed safely"},
+            unit:     UnitUTF16,
+            expected: [][]int{{32, 45}},
+        },
+        {
+            name:     "UTF-16 range covering an emoji",
+            content:  rocket,
+            points:   []string{"🚀 Launch succeeded"},
+            unit:     UnitUTF16,
+            expected: [][]int{{0, 19}},
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            ranges := Locate(test.content, test.points, test.unit)
+            if !reflect.DeepEqual(ranges, test.expected) {
+                t.Fatalf("Locate = %v, expected %v", ranges, test.expected)
+            }
+            if err := Validate(test.content, ranges, test.unit); err != nil {
+                t.Fatalf("Locate returned ranges Validate rejects: %v", err)
+            }
+        })
+    }
+}
+
+func TestConvert(t *testing.T) {
+    // "é" is one unit either way, "🚀" is one rune and a surrogate pair
+    text := []rune("é🚀x🚀")
+    ranges := [][2]int{{0, 1}, {1, 3}, {3, 4}}
+
+    tests := []struct {
+        unit        Unit
+        expected    [][]int
+    }{
+        {unit: UnitRunes, expected: [][]int{{0, 1}, {1, 3}, {3, 4}}},
+        {unit: UnitUTF16, expected: [][]int{{0, 1}, {1, 4}, {4, 6}}},
+    }
+
+    for _, test := range tests {
+        t.Run(string(test.unit), func(t *testing.T) {
+            if converted := convert(text, ranges, test.unit); !reflect.DeepEqual(converted, test.expected) {
+                t.Fatalf("convert = %v, expected %v", converted, test.expected)
+            }
+        })
+    }
+}
+
+func TestConfiguredUnit(t *testing.T) {
+    tests := []struct {
+        value       string
+        expected    Unit
+    }{
+        {value: "", expected: UnitUTF16},
+        {value: "runes", expected: UnitRunes},
+        {value: "utf16", expected: UnitUTF16},
+        {value: "bytes", expected: UnitUTF16},
+    }
+
+    for _, test := range tests {
+        t.Setenv(UnitEnv, test.value)
+        if unit := ConfiguredUnit(); unit != test.expected {
+            t.Errorf("ConfiguredUnit() with %q = %s, expected %s", test.value, unit, test.expected)
+        }
+    }
+}
+
+func TestValidate(t *testing.T) {
+    // 5 runes, 6 UTF-16 units
+    content := "🚀 go!"
+
+    tests := []struct {
+        name        string
+        ranges      [][]int
+        unit        Unit
+        rejection   string
+    }{
+        {name: "no ranges", ranges: nil, unit: UnitUTF16},
+        {name: "valid UTF-16", ranges: [][]int{{0, 2}, {3, 6}}, unit: UnitUTF16},
+        {name: "valid runes", ranges: [][]int{{0, 1}, {2, 5}}, unit: UnitRunes},
+        {name: "touching ranges", ranges: [][]int{{0, 2}, {2, 4}}, unit: UnitUTF16},
+        {name: "wrong offset count", ranges: [][]int{{0, 1, 2}}, unit: UnitRunes, rejection: "expected 2"},
+        {name: "negative start", ranges: [][]int{{-1, 2}}, unit: UnitRunes, rejection: "outside content"},
+        {name: "end past content", ranges: [][]int{{0, 6}}, unit: UnitRunes, rejection: "outside content"},
+        {name: "end past UTF-16 content", ranges: [][]int{{0, 7}}, unit: UnitUTF16, rejection: "outside content"},
+        {name: "empty range", ranges: [][]int{{2, 2}}, unit: UnitRunes, rejection: "outside content"},
+        {name: "overlapping", ranges: [][]int{{0, 3}, {2, 4}}, unit: UnitRunes, rejection: "overlaps"},
+        {name: "unsorted", ranges: [][]int{{3, 4}, {0, 2}}, unit: UnitRunes, rejection: "overlaps"},
+        {name: "start splits surrogate pair", ranges: [][]int{{1, 3}}, unit: UnitUTF16, rejection: "surrogate"},
+        {name: "end splits surrogate pair", ranges: [][]int{{0, 1}}, unit: UnitUTF16, rejection: "surrogate"},
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := Validate(content, test.ranges, test.unit)
+            if test.rejection == "" {
+                if err != nil {
+                    t.Fatalf("unexpected rejection: %v", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), test.rejection) {
+                t.Fatalf("expected a rejection containing %q, got %v", test.rejection, err)
+            }
+        })
+    }
+}
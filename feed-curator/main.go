@@ -7,10 +7,17 @@ import (
 	"time"
 
 	"feed-curator/database"
+	"feed-curator/extractor"
+	"feed-curator/feedstore"
 	"feed-curator/fetcher"
+	"feed-curator/marketdata"
 	"feed-curator/models"
+	"feed-curator/policy"
+	"feed-curator/prompts"
+	"feed-curator/sentiment"
 	"feed-curator/services"
 	"feed-curator/summarizer"
+	"feed-curator/translate"
 	"feed-curator/utils"
 )
 
@@ -33,6 +40,11 @@ func main() {
 
     defer models.FreshNewsRedisCtxCancel()
 
+    // Admin commands run once and exit, without arguments the curator runs its daily loop
+    if len(os.Args) > 1 {
+        os.Exit(runCommand(os.Args[1], os.Args[2:]))
+    }
+
     for {
         // Define country codes for each region (North America, Europe, Asia, Australia)
         northAmerica := []string{"us"}
@@ -72,7 +84,18 @@ func main() {
         today := time.Now().Format("2006-01-02")
 	    yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
         
-        categorizedDiscovery := fetcher.NewsDiscoveryByCategory("en", "publishedAt", yesterday, today)
+        // Gainers and losers follow the day's biggest movers, keyword search is the fallback
+        var gainers, losers []models.PriceChange
+        if provider, err := marketdata.New(); err != nil {
+            utils.LogMessage("Market data unavailable, searching gainers and losers by keyword", "red", err)
+        } else if gainers, losers, err = marketdata.LatestMovers(provider, time.Now()); err != nil {
+            utils.LogMessage("Market data unavailable, searching gainers and losers by keyword", "red", err)
+        } else {
+            utils.LogMessage(fmt.Sprintf("Market movers from %s: %d gainers, %d losers", provider.Name(), len(gainers), len(losers)), "green")
+        }
+
+        discoverLanguage := fetcher.DiscoverLanguage()
+        categorizedDiscovery := fetcher.NewsDiscoveryByCategory(discoverLanguage, "publishedAt", yesterday, today, gainers, losers)
 
         numberofarticles = 0
         for category, response := range categorizedDiscovery {
@@ -94,31 +117,51 @@ func main() {
 
         utils.LogMessage(fmt.Sprintf("Number of Discovery: %d", numberofarticles), "green")
 
-        // MinIO Setup
-        err := database.UploadNewsAPIResponseDataToMinIO(models.MinIOClient, categorizedHeadlines, "raw-news-archive")
+        // MinIO Setup, each summarized archive is written under the time of its raw archive
+        headlinesArchivedAt := time.Now()
+        err := database.UploadNewsAPIResponseDataToMinIOAt(models.MinIOClient, categorizedHeadlines, "raw-news-archive", models.ArchiveHeadlines, headlinesArchivedAt)
         if err != nil {
             utils.LogMessage("Failed to push News Archive MinIO - Raw News Headlines", "red")
         }
 
-        err = database.UploadNewsAPIResponseDataToMinIO(models.MinIOClient, categorizedDiscovery, "raw-news-archive")
+        discoverArchivedAt := time.Now()
+        err = database.UploadNewsAPIResponseDataToMinIOAt(models.MinIOClient, categorizedDiscovery, "raw-news-archive", models.ArchiveDiscover, discoverArchivedAt)
         if err != nil {
             utils.LogMessage("Failed to push News Archive MinIO - Raw News Discover", "red")
         }
 
+        // Raw archives above keep the NewsAPI payload as received, full texts are only used for curation
+        if extractor.Enabled() {
+            utils.LogMessage("Extracting full article texts", "green")
+            fullTextExtractor := extractor.New(extractor.NewMinIOCache(models.MinIOClient))
+            fullTextExtractor.EnrichArticles(categorizedHeadlines)
+            fullTextExtractor.EnrichArticles(categorizedDiscovery)
+        }
+
         utils.LogMessage("Feedling AI with all the news", "green")
 
-        summarizedHeadlines := summarizer.SummarizeCountryCategorizedHeadlines(categorizedHeadlines)
+        // Reloaded every run so source rules, prompts and the sentiment lexicon can change without a redeploy
+        sourcePolicy := policy.Load()
+        registry := prompts.Load()
+        analyzer := sentiment.New()
 
-        summarizedCategorized := summarizer.SummarizeCategorizedNews(categorizedDiscovery)
+        summarizedHeadlines := summarizer.SummarizeCountryCategorizedHeadlines(categorizedHeadlines, sourcePolicy, registry, analyzer)
 
-        err = database.UploadNewsAPISummarizedDataToMinIO(models.MinIOClient, summarizedHeadlines, "summarized-news-archive")
+        summarizedCategorized := summarizer.SummarizeCategorizedNews(categorizedDiscovery, sourcePolicy, registry, analyzer)
+
+        // Languages are set even with translation disabled, feed-api matches them against the reader's
+        translator := translate.New()
+        translate.LocalizeFeed(summarizedHeadlines, translate.CountryLanguage, translator, translate.Languages())
+        translate.LocalizeFeed(summarizedCategorized, func(string) string { return discoverLanguage }, translator, translate.Languages())
+
+        err = database.UploadNewsAPISummarizedDataToMinIOAt(models.MinIOClient, summarizedHeadlines, "summarized-news-archive", models.ArchiveHeadlines, headlinesArchivedAt)
         if err != nil {
-            utils.LogMessage("Failed to push News Archive MinIO - Summzarized News Headlines", "red")
+            utils.LogMessage("Failed to push News Archive MinIO - Summzarized News Headlines", "red", err)
         }
 
-        err = database.UploadNewsAPISummarizedDataToMinIO(models.MinIOClient, summarizedCategorized, "summarized-news-archive")
+        err = database.UploadNewsAPISummarizedDataToMinIOAt(models.MinIOClient, summarizedCategorized, "summarized-news-archive", models.ArchiveDiscover, discoverArchivedAt)
         if err != nil {
-            utils.LogMessage("Failed to push News Archive MinIO - Summarized News Discover", "red")
+            utils.LogMessage("Failed to push News Archive MinIO - Summarized News Discover", "red", err)
         }
 
         for category, summarizedResponse := range summarizedHeadlines {
@@ -135,14 +178,16 @@ func main() {
             }
         }
 
-        err = summarizer.StoreSummarizedRedis("headlines", summarizedHeadlines)
-        if err != nil {
-            utils.LogMessage("Failed to store headlines news in Redis", "red", err)
-        }
-
-        err = summarizer.StoreSummarizedRedis("discover", summarizedCategorized)
+        // Served only once both feeds pass validation, a bad run leaves the previous version live
+        _, err = feedstore.Publish(map[string]map[string]models.SummarizedResponse{
+            "headlines": summarizedHeadlines,
+            "discover":  summarizedCategorized,
+        }, map[string][]string{
+            "headlines": allCountries,
+            "discover":  fetcher.DiscoverTags,
+        }, "fetch")
         if err != nil {
-            utils.LogMessage("Failed to store discover news in Redis", "red", err)
+            utils.LogMessage("Failed to publish curated feeds, previous version is still served", "red", err)
         }
 
         currentTime := time.Now()
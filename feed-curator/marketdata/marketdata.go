@@ -0,0 +1,221 @@
+package marketdata
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "feed-curator/models"
+)
+
+const (
+    ProviderEnv = "MARKET_DATA_PROVIDER"
+    FileEnv = "MARKET_DATA_FILE"
+    MoversCountEnv = "MARKET_MOVERS_COUNT"
+    MinPriceEnv = "MARKET_MOVERS_MIN_PRICE"
+
+    ProviderCSV = "csv"
+
+    // {date} is replaced with the trading day, so a directory of daily exports works too
+    DefaultFile = "./market-data/{date}.csv"
+    DefaultMoversCount = 5
+    // Penny stocks move tens of percent on no news
+    DefaultMinPrice = 1.0
+
+    // Covers a long weekend
+    lookbackDays = 5
+)
+
+/*
+Provider supplies end-of-day quotes. CSVProvider reads exported files; a quote
+API client implements the same interface and is selected in New.
+*/
+type Provider interface {
+    Name() string
+    Quotes(day time.Time) ([]models.Quote, error)
+}
+
+func New() (Provider, error) {
+    switch provider := os.Getenv(ProviderEnv); provider {
+    case "", ProviderCSV:
+        path := os.Getenv(FileEnv)
+        if path == "" {
+            path = DefaultFile
+        }
+        return &CSVProvider{Path: path}, nil
+    default:
+        return nil, fmt.Errorf("unknown market data provider %q", provider)
+    }
+}
+
+/*
+CSVProvider reads quotes from a CSV file with a header row. Required columns
+are symbol, previous_close and close; name and volume are optional. Column
+order doesn't matter and names are case-insensitive.
+*/
+type CSVProvider struct {
+    Path string
+}
+
+func (provider *CSVProvider) Name() string {
+    return "csv:" + provider.Path
+}
+
+func (provider *CSVProvider) Quotes(day time.Time) ([]models.Quote, error) {
+    path := strings.ReplaceAll(provider.Path, "{date}", day.Format("2006-01-02"))
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    return ParseCSV(file)
+}
+
+func ParseCSV(reader io.Reader) ([]models.Quote, error) {
+    csvReader := csv.NewReader(reader)
+    csvReader.TrimLeadingSpace = true
+
+    header, err := csvReader.Read()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read header: %w", err)
+    }
+
+    columns := make(map[string]int, len(header))
+    for index, name := range header {
+        columns[strings.ToLower(strings.TrimSpace(name))] = index
+    }
+    for _, required := range []string{"symbol", "previous_close", "close"} {
+        if _, found := columns[required]; !found {
+            return nil, fmt.Errorf("missing column %q", required)
+        }
+    }
+
+    field := func(record []string, name string) string {
+        if index, found := columns[name]; found && index < len(record) {
+            return strings.TrimSpace(record[index])
+        }
+        return ""
+    }
+
+    var quotes []models.Quote
+    for line := 2; ; line++ {
+        record, err := csvReader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", line, err)
+        }
+
+        previousClose, err := strconv.ParseFloat(field(record, "previous_close"), 64)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: invalid previous_close: %w", line, err)
+        }
+        closePrice, err := strconv.ParseFloat(field(record, "close"), 64)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: invalid close: %w", line, err)
+        }
+        volume, _ := strconv.ParseInt(field(record, "volume"), 10, 64)
+
+        quotes = append(quotes, models.Quote{
+            Symbol:        strings.ToUpper(field(record, "symbol")),
+            Name:          field(record, "name"),
+            PreviousClose: previousClose,
+            Close:         closePrice,
+            Volume:        volume,
+        })
+    }
+
+    return quotes, nil
+}
+
+/*
+TopMovers returns the count biggest gainers and losers of the day, by percent
+change from the previous close. Quotes below minPrice or without a previous
+close are ignored.
+*/
+func TopMovers(quotes []models.Quote, count int, minPrice float64) ([]models.PriceChange, []models.PriceChange) {
+    var changes []models.PriceChange
+    for _, quote := range quotes {
+        if quote.Symbol == "" || quote.PreviousClose <= 0 || quote.Close < minPrice {
+            continue
+        }
+
+        changePercent := (quote.Close - quote.PreviousClose) / quote.PreviousClose * 100
+        changes = append(changes, models.PriceChange{
+            Symbol:        quote.Symbol,
+            Name:          quote.Name,
+            PreviousClose: quote.PreviousClose,
+            Close:         quote.Close,
+            ChangePercent: math.Round(changePercent*100) / 100,
+        })
+    }
+
+    sort.SliceStable(changes, func(i, j int) bool {
+        return changes[i].ChangePercent > changes[j].ChangePercent
+    })
+
+    var gainers, losers []models.PriceChange
+    for _, change := range changes {
+        if len(gainers) == count || change.ChangePercent <= 0 {
+            break
+        }
+        gainers = append(gainers, change)
+    }
+    for index := len(changes) - 1; index >= 0; index-- {
+        if len(losers) == count || changes[index].ChangePercent >= 0 {
+            break
+        }
+        losers = append(losers, changes[index])
+    }
+
+    return gainers, losers
+}
+
+func MoversCount() int {
+    if count, err := strconv.Atoi(os.Getenv(MoversCountEnv)); err == nil && count > 0 {
+        return count
+    }
+    return DefaultMoversCount
+}
+
+func MinPrice() float64 {
+    if price, err := strconv.ParseFloat(os.Getenv(MinPriceEnv), 64); err == nil && price >= 0 {
+        return price
+    }
+    return DefaultMinPrice
+}
+
+/*
+LatestMovers returns the movers of the most recent trading day with quotes,
+looking back a few days so weekends and holidays fall back to the last
+session.
+*/
+func LatestMovers(provider Provider, now time.Time) ([]models.PriceChange, []models.PriceChange, error) {
+    var lastErr error
+    for daysBack := 0; daysBack < lookbackDays; daysBack++ {
+        quotes, err := provider.Quotes(now.AddDate(0, 0, -daysBack))
+        if err != nil {
+            lastErr = err
+            continue
+        }
+        if len(quotes) == 0 {
+            continue
+        }
+
+        gainers, losers := TopMovers(quotes, MoversCount(), MinPrice())
+        return gainers, losers, nil
+    }
+
+    if lastErr == nil {
+        lastErr = fmt.Errorf("no quotes in the last %d days", lookbackDays)
+    }
+    return nil, nil, fmt.Errorf("%s: %w", provider.Name(), lastErr)
+}
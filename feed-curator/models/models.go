@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/minio/minio-go/v7"
@@ -18,10 +19,34 @@ var (
     MinIOClient *minio.Client
     MinIOCtx = context.Background()
 
+    // Timestamp in archive object names, in local time
+    ArchiveTimeLayout = "2006-01-02T15-04-05"
+    // Feed an archive holds, named after the prefix: raw-news-<kind>-<timestamp>.json
+    ArchiveHeadlines = "headlines"
+    ArchiveDiscover = "discover"
+    // Summarized articles are also archived one by one as articles/<stockicID>.json, for lookups by ID
+    ArticleIndexPrefix = "articles/"
+
     FreshNewsRedis *redis.Client
     RedisChannel   = "__keyspace@0__:*"
+    // feed-api replicas purge their in-process feed caches on this channel
+    FeedUpdatesChannel = "feed-updates"
 )
 
+type RawArchive struct {
+    ObjectName  string
+    // ArchiveHeadlines or ArchiveDiscover, empty for archives named before the kind was
+    Kind        string
+    ArchivedAt  time.Time
+}
+
+// An entry of the article index, Archive names the summarized archive the article was last stored in
+type IndexedArticle struct {
+    ArchivedAt  string              `json:"archivedAt"`
+    Archive     string              `json:"archive"`
+    Article     SummarizedArticle   `json:"article"`
+}
+
 type Source struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
@@ -36,6 +61,26 @@ type Article struct {
 	URLToImage  string `json:"urlToImage"`
 	PublishedAt string `json:"publishedAt"`
 	Content     string `json:"content"`
+	// Body text extracted from URL by the curator, empty when extraction failed
+	FullText    string `json:"fullText,omitempty"`
+	// Set on gainers/losers articles: the mover the article was fetched for
+	PriceChange *PriceChange `json:"priceChange,omitempty"`
+}
+
+type Quote struct {
+    Symbol          string
+    Name            string
+    PreviousClose   float64
+    Close           float64
+    Volume          int64
+}
+
+type PriceChange struct {
+    Symbol          string  `json:"symbol"`
+    Name            string  `json:"name,omitempty"`
+    PreviousClose   float64 `json:"previousClose"`
+    Close           float64 `json:"close"`
+    ChangePercent   float64 `json:"changePercent"`
 }
 
 type APIResponse struct {
@@ -56,6 +101,84 @@ type SummarizedArticle struct {
 	SummarizedContent   string          `json:"content"`
     CompaniesTags       []string        `json:"companyTags"`
     NewsHighlights      [][]int         `json:"highlightsIndex"`
+    // Whether highlightsIndex counts runes or UTF-16 code units
+    HighlightsUnit      string          `json:"highlightsUnit"`
+    TrustScore          float64         `json:"trustScore"`
+    // positive, neutral or negative
+    Sentiment           string          `json:"sentiment"`
+    // From -1 (bearish) to 1 (bullish)
+    SentimentScore      float64         `json:"sentimentScore"`
+    SentimentConfidence float64         `json:"sentimentConfidence"`
+    CompanyImpact       []CompanyImpact `json:"companyImpact"`
+    PriceChange         *PriceChange    `json:"priceChange,omitempty"`
+    // Discover category the AI filed the article under
+    Category            string          `json:"category,omitempty"`
+    // Story the article was clustered into, empty when no other article covers the same event
+    StoryID             string          `json:"storyID,omitempty"`
+    StorySize           int             `json:"storySize,omitempty"`
+    // Prompt versions and models of the AI stages that produced the article, empty when AI is disabled
+    Provenance          []Provenance    `json:"provenance,omitempty"`
+    // Language of title and content (ISO 639-1)
+    Language            string                  `json:"language,omitempty"`
+    // Machine translated variants by language, highlights only apply to the original
+    Translations        map[string]Translation  `json:"translations,omitempty"`
+}
+
+type Translation struct {
+    Title       string  `json:"title"`
+    Content     string  `json:"content"`
+    Provider    string  `json:"provider"`
+}
+
+type CompanyImpact struct {
+    Company     string  `json:"company"`
+    // positive, neutral or negative for the company's stock
+    Impact      string  `json:"impact"`
+    Confidence  float64 `json:"confidence"`
+}
+
+type SentimentResult struct {
+    Score       float64
+    Label       string
+    Confidence  float64
+    Companies   []CompanyImpact
+}
+
+// CurationOutput is the JSON the curate prompt is constrained to answer with
+type CurationOutput struct {
+    Summary     string      `json:"summary"`
+    KeyPoints   []string    `json:"keyPoints"`
+    Sentiment   string      `json:"sentiment"`
+    Companies   []string    `json:"companies"`
+    Category    string      `json:"category"`
+}
+
+type Provenance struct {
+    Stage           string  `json:"stage"`
+    PromptVersion   string  `json:"promptVersion"`
+    Model           string  `json:"model"`
+}
+
+/*
+PromptExperiment is one article processed by both the active and the
+candidate prompt of a stage in A/B mode. Only the active output is served.
+*/
+type PromptExperiment struct {
+    Stage       string              `json:"stage"`
+    ArticleURL  string              `json:"articleURL"`
+    Title       string              `json:"title"`
+    Input       string              `json:"input"`
+    CreatedAt   time.Time           `json:"createdAt"`
+    Outputs     []ExperimentOutput  `json:"outputs"`
+}
+
+type ExperimentOutput struct {
+    PromptVersion   string  `json:"promptVersion"`
+    Model           string  `json:"model"`
+    Role            string  `json:"role"`
+    Output          string  `json:"output"`
+    Error           string  `json:"error,omitempty"`
+    LatencyMs       int64   `json:"latencyMs"`
 }
 
 type SummarizedResponse struct {
@@ -71,3 +194,31 @@ type TaggerAIEntity struct {
 	Start       int     `json:"start"`
 	End         int     `json:"end"`
 }
+
+/*
+Story groups the articles of one version covering the same event. The
+summary is built from the representative's summary plus what the other
+sources add.
+*/
+type Story struct {
+    ID                  string          `json:"id"`
+    Title               string          `json:"title"`
+    Summary             string          `json:"summary"`
+    // StockicID of the article standing for the story
+    Representative      string          `json:"representative"`
+    Sources             []string        `json:"sources"`
+    Companies           []string        `json:"companies"`
+    Articles            []StoryMember   `json:"articles"`
+    FirstPublishedAt    string          `json:"firstPublishedAt"`
+    LastPublishedAt     string          `json:"lastPublishedAt"`
+}
+
+type StoryMember struct {
+    StockicID   string  `json:"stockicID"`
+    Title       string  `json:"title"`
+    Source      string  `json:"source"`
+    URL         string  `json:"url"`
+    PublishedAt string  `json:"publishedAt"`
+    // Where the article is served, as "headlines/us" or "discover/finance"
+    Feeds       []string `json:"feeds"`
+}
@@ -0,0 +1,267 @@
+package policy
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/url"
+    "os"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+
+    "feed-curator/models"
+    "feed-curator/utils"
+)
+
+const (
+    PolicyFileEnv = "SOURCE_POLICY_FILE"
+    DefaultPolicyFile = "./source-policy.json"
+
+    ModeBlocklist = "blocklist"
+    ModeAllowlist = "allowlist"
+)
+
+// NewsAPI appends "... [+1234 chars]" to truncated content
+var truncationMarker = regexp.MustCompile(`\s*\[\+\d+ chars\]\s*$`)
+
+/*
+Policy is the declarative replacement for the source quirks that used to be
+hardcoded in the summarizer. Sources are matched by NewsAPI source name or by
+the domain of the article URL (sub-domains included), case-insensitively.
+*/
+type Policy struct {
+    // blocklist (default): everything but Block is accepted. allowlist: only Allow is accepted.
+    Mode        string          `json:"mode"`
+    Allow       []string        `json:"allow"`
+    Block       []string        `json:"block"`
+    Defaults    Rule            `json:"defaults"`
+    Sources     []SourceRule    `json:"sources"`
+}
+
+type Rule struct {
+    Author              string      `json:"author,omitempty"`
+    SourceName          string      `json:"sourceName,omitempty"`
+    // Used when the article has no image
+    DefaultImage        string      `json:"defaultImage,omitempty"`
+    // Always replaces the article image, for sources whose image URLs don't load in the app
+    ReplaceImage        string      `json:"replaceImage,omitempty"`
+    RequireImage        *bool       `json:"requireImage,omitempty"`
+    MinContentLength    *int        `json:"minContentLength,omitempty"`
+    PaywallMarkers      []string    `json:"paywallMarkers,omitempty"`
+    DropPaywalled       *bool       `json:"dropPaywalled,omitempty"`
+    TrustScore          *float64    `json:"trustScore,omitempty"`
+}
+
+type SourceRule struct {
+    Match   []string    `json:"match"`
+    Rule
+}
+
+type Decision struct {
+    Keep        bool
+    Reason      string
+    TrustScore  float64
+}
+
+func boolPtr(value bool) *bool { return &value }
+func intPtr(value int) *int { return &value }
+func floatPtr(value float64) *float64 { return &value }
+
+/*
+Default reproduces the behaviour the summarizer had before policies existed,
+so a missing policy file changes nothing.
+*/
+func Default() *Policy {
+    return &Policy{
+        Mode: ModeBlocklist,
+        Defaults: Rule{
+            Author:             "Aditya Patil",
+            SourceName:         "Stockic Editors",
+            RequireImage:       boolPtr(true),
+            MinContentLength:   intPtr(0),
+            PaywallMarkers:     []string{
+                "subscribe to continue reading",
+                "subscribers only",
+                "this article is for subscribers",
+                "sign in to read the full article",
+            },
+            DropPaywalled:      boolPtr(false),
+            TrustScore:         floatPtr(0.5),
+        },
+        Sources: []SourceRule{
+            {
+                Match: []string{"The Washington Post", "washingtonpost.com"},
+                Rule: Rule{
+                    ReplaceImage: "https://theintercept.com/wp-content/uploads/2017/01/the-washington-post-newspaper-2-1484771977.jpg",
+                },
+            },
+        },
+    }
+}
+
+/*
+Load reads the policy from the file named by SOURCE_POLICY_FILE (or
+./source-policy.json). The curator calls it at the start of every run so the
+file can be edited without redeploying. A missing or broken file falls back to
+the default policy rather than stopping the run.
+*/
+func Load() *Policy {
+    path := os.Getenv(PolicyFileEnv)
+    if path == "" {
+        path = DefaultPolicyFile
+    }
+
+    policy, err := LoadFile(path)
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Using default source policy, could not load %s", path), "red", err)
+        return Default()
+    }
+
+    utils.LogMessage(fmt.Sprintf("Loaded source policy from %s: %d source rules", path, len(policy.Sources)), "green")
+    return policy
+}
+
+func LoadFile(path string) (*Policy, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var policy Policy
+    if err := json.Unmarshal(data, &policy); err != nil {
+        return nil, fmt.Errorf("invalid source policy: %w", err)
+    }
+
+    if policy.Mode == "" {
+        policy.Mode = ModeBlocklist
+    }
+    if policy.Mode != ModeBlocklist && policy.Mode != ModeAllowlist {
+        return nil, fmt.Errorf("invalid source policy mode: %s", policy.Mode)
+    }
+
+    // Settings absent from the file keep their historical defaults
+    policy.Defaults = merge(Default().Defaults, policy.Defaults)
+    return &policy, nil
+}
+
+/*
+Apply decides whether an article is curated and fills in per-source defaults
+in place. Articles that are dropped are left partially modified, callers are
+expected to discard them.
+*/
+func (policy *Policy) Apply(article *models.Article) Decision {
+    domain := articleDomain(article.URL)
+
+    if policy.Mode == ModeAllowlist && !matchesAny(policy.Allow, article.Source.Name, domain) {
+        return Decision{Reason: "source not in allowlist"}
+    }
+    if matchesAny(policy.Block, article.Source.Name, domain) {
+        return Decision{Reason: "source blocked"}
+    }
+
+    rule := policy.Defaults
+    for _, source := range policy.Sources {
+        if matchesAny(source.Match, article.Source.Name, domain) {
+            rule = merge(rule, source.Rule)
+            break
+        }
+    }
+
+    if article.Source.Name == "" {
+        article.Source.Name = rule.SourceName
+    }
+    if article.Author == "" {
+        article.Author = rule.Author
+    }
+
+    if rule.ReplaceImage != "" {
+        article.URLToImage = rule.ReplaceImage
+    }
+    if article.URLToImage == "" {
+        article.URLToImage = rule.DefaultImage
+    }
+    if article.URLToImage == "" && *rule.RequireImage {
+        return Decision{Reason: "no image"}
+    }
+
+    if contentLength(article.Content) < *rule.MinContentLength {
+        return Decision{Reason: "content too short"}
+    }
+
+    if *rule.DropPaywalled && isPaywalled(article, rule.PaywallMarkers) {
+        return Decision{Reason: "paywalled"}
+    }
+
+    return Decision{Keep: true, TrustScore: *rule.TrustScore}
+}
+
+// Fields set on override win over base
+func merge(base, override Rule) Rule {
+    if override.Author != "" {
+        base.Author = override.Author
+    }
+    if override.SourceName != "" {
+        base.SourceName = override.SourceName
+    }
+    if override.DefaultImage != "" {
+        base.DefaultImage = override.DefaultImage
+    }
+    if override.ReplaceImage != "" {
+        base.ReplaceImage = override.ReplaceImage
+    }
+    if override.RequireImage != nil {
+        base.RequireImage = override.RequireImage
+    }
+    if override.MinContentLength != nil {
+        base.MinContentLength = override.MinContentLength
+    }
+    if override.PaywallMarkers != nil {
+        base.PaywallMarkers = override.PaywallMarkers
+    }
+    if override.DropPaywalled != nil {
+        base.DropPaywalled = override.DropPaywalled
+    }
+    if override.TrustScore != nil {
+        base.TrustScore = override.TrustScore
+    }
+    return base
+}
+
+func articleDomain(articleURL string) string {
+    parsed, err := url.Parse(articleURL)
+    if err != nil {
+        return ""
+    }
+    return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// A pattern matches the source name exactly or the domain and its sub-domains
+func matchesAny(patterns []string, sourceName, domain string) bool {
+    for _, pattern := range patterns {
+        pattern = strings.ToLower(strings.TrimSpace(pattern))
+        if pattern == "" {
+            continue
+        }
+        if pattern == strings.ToLower(sourceName) {
+            return true
+        }
+        if domain != "" && (domain == pattern || strings.HasSuffix(domain, "."+pattern)) {
+            return true
+        }
+    }
+    return false
+}
+
+func contentLength(content string) int {
+    return utf8.RuneCountInString(strings.TrimSpace(truncationMarker.ReplaceAllString(content, "")))
+}
+
+func isPaywalled(article *models.Article, markers []string) bool {
+    text := strings.ToLower(article.Title + "\n" + article.Description + "\n" + article.Content)
+    for _, marker := range markers {
+        if marker != "" && strings.Contains(text, strings.ToLower(marker)) {
+            return true
+        }
+    }
+    return false
+}
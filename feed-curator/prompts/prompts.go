@@ -0,0 +1,261 @@
+package prompts
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "embed"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path"
+    "sort"
+    "strings"
+    "text/template"
+
+    "feed-curator/utils"
+)
+
+const (
+    PromptsDirEnv = "PROMPTS_DIR"
+    DefaultPromptsDir = "./prompts"
+    RegistryFile = "registry.json"
+
+    // One structured call producing summary, key points, sentiment, companies and category
+    StageCurate = "curate"
+    // Sent with the validation problems when a curate response is invalid
+    StageRepair = "repair"
+)
+
+// Used for a stage whose template doesn't name a model, kept for deployments predating prompt files
+var modelEnvFallbacks = map[string]string{
+    StageCurate: "SUMMARIZATION_AI_MODEL",
+    StageRepair: "SUMMARIZATION_AI_MODEL",
+}
+
+// Stages the summarizer runs, a registry without one of them (written for an older curator) is rejected
+var requiredStages = []string{StageCurate, StageRepair}
+
+// The prompts shipped with the curator, used when PROMPTS_DIR has no registry
+//go:embed registry.json curate repair
+var builtin embed.FS
+
+/*
+Registry holds every prompt version found in the prompts directory and which
+of them each AI stage uses. Templates live in <dir>/<stage>/<version>.tmpl
+and registry.json selects the versions:
+
+    {"stages": {"summarize": {"active": "v2", "candidate": "v3", "sampleRate": 0.1}}}
+
+A stage with a candidate runs in A/B mode: a sampleRate share of articles is
+also processed with the candidate so both outputs can be compared.
+*/
+type Registry struct {
+    Stages  map[string]StageConfig      `json:"stages"`
+    prompts map[string]map[string]*Prompt
+}
+
+type StageConfig struct {
+    Active      string      `json:"active"`
+    Candidate   string      `json:"candidate,omitempty"`
+    SampleRate  float64     `json:"sampleRate,omitempty"`
+}
+
+/*
+Prompt is one version of a stage's template. A template file starts with a
+"key: value" header (model, description) closed by a "---" line, followed by
+a text/template body using the fields of Data.
+*/
+type Prompt struct {
+    Stage       string
+    Version     string
+    Model       string
+    Description string
+    template    *template.Template
+}
+
+// Data are the variables available to templates
+type Data struct {
+    Title       string
+    Source      string
+    Text        string
+    // Comma separated categories the article can be filed under
+    Categories  string
+    // Set for the repair stage: the rejected answer and what was wrong with it
+    Output      string
+    Problems    string
+}
+
+func Load() *Registry {
+    promptsDir := os.Getenv(PromptsDirEnv)
+    if promptsDir == "" {
+        promptsDir = DefaultPromptsDir
+    }
+
+    if _, err := os.Stat(path.Join(promptsDir, RegistryFile)); err == nil {
+        registry, err := LoadFS(os.DirFS(promptsDir))
+        if err == nil {
+            utils.LogMessage(fmt.Sprintf("Loaded prompts from %s: %s", promptsDir, registry), "green")
+            return registry
+        }
+        utils.LogMessage(fmt.Sprintf("Invalid prompts in %s, using built-in prompts", promptsDir), "red", err)
+    }
+
+    registry, err := LoadFS(builtin)
+    if err != nil {
+        // The embedded prompts are part of the binary, failing to parse them is a build defect
+        panic(fmt.Sprintf("built-in prompts are invalid: %v", err))
+    }
+    return registry
+}
+
+func LoadFS(fileSystem fs.FS) (*Registry, error) {
+    registryJSON, err := fs.ReadFile(fileSystem, RegistryFile)
+    if err != nil {
+        return nil, err
+    }
+
+    registry := &Registry{prompts: make(map[string]map[string]*Prompt)}
+    if err := json.Unmarshal(registryJSON, registry); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %w", RegistryFile, err)
+    }
+    for _, stage := range requiredStages {
+        if _, ok := registry.Stages[stage]; !ok {
+            return nil, fmt.Errorf("%s has no %s stage", RegistryFile, stage)
+        }
+    }
+
+    for stage, config := range registry.Stages {
+        files, err := fs.Glob(fileSystem, path.Join(stage, "*.tmpl"))
+        if err != nil {
+            return nil, err
+        }
+
+        registry.prompts[stage] = make(map[string]*Prompt)
+        for _, file := range files {
+            prompt, err := parsePrompt(fileSystem, stage, file)
+            if err != nil {
+                return nil, err
+            }
+            registry.prompts[stage][prompt.Version] = prompt
+        }
+
+        if registry.Get(stage, config.Active) == nil {
+            return nil, fmt.Errorf("active prompt %s/%s not found", stage, config.Active)
+        }
+        if config.Candidate != "" && registry.Get(stage, config.Candidate) == nil {
+            return nil, fmt.Errorf("candidate prompt %s/%s not found", stage, config.Candidate)
+        }
+        if config.SampleRate < 0 || config.SampleRate > 1 {
+            return nil, fmt.Errorf("sampleRate of %s must be between 0 and 1", stage)
+        }
+    }
+
+    return registry, nil
+}
+
+func parsePrompt(fileSystem fs.FS, stage, file string) (*Prompt, error) {
+    content, err := fs.ReadFile(fileSystem, file)
+    if err != nil {
+        return nil, err
+    }
+
+    prompt := &Prompt{
+        Stage:   stage,
+        Version: strings.TrimSuffix(path.Base(file), ".tmpl"),
+    }
+
+    body := string(content)
+    if header, rest, found := strings.Cut(body, "\n---\n"); found {
+        body = rest
+        scanner := bufio.NewScanner(strings.NewReader(header))
+        for scanner.Scan() {
+            key, value, ok := strings.Cut(scanner.Text(), ":")
+            if !ok {
+                continue
+            }
+            switch strings.TrimSpace(key) {
+            case "model":
+                prompt.Model = strings.TrimSpace(value)
+            case "description":
+                prompt.Description = strings.TrimSpace(value)
+            }
+        }
+    }
+
+    if prompt.Model == "" {
+        prompt.Model = os.Getenv(modelEnvFallbacks[stage])
+    }
+    if prompt.Model == "" {
+        return nil, fmt.Errorf("%s names no model", file)
+    }
+
+    prompt.template, err = template.New(file).Option("missingkey=error").Parse(strings.TrimSpace(body))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+    }
+
+    return prompt, nil
+}
+
+func (registry *Registry) Get(stage, version string) *Prompt {
+    return registry.prompts[stage][version]
+}
+
+func (registry *Registry) Active(stage string) *Prompt {
+    return registry.Get(stage, registry.Stages[stage].Active)
+}
+
+/*
+Candidate returns the prompt to compare against the active one for this
+article, or nil. Sampling hashes the article key rather than drawing a random
+number, so a replay of the same articles samples the same ones.
+*/
+func (registry *Registry) Candidate(stage, articleKey string) *Prompt {
+    config := registry.Stages[stage]
+    if config.Candidate == "" || config.SampleRate <= 0 {
+        return nil
+    }
+
+    hash := sha256.Sum256([]byte(stage + ":" + articleKey))
+    if float64(binary.BigEndian.Uint64(hash[:8]))/float64(^uint64(0)) >= config.SampleRate {
+        return nil
+    }
+
+    return registry.Get(stage, config.Candidate)
+}
+
+func (registry *Registry) String() string {
+    var stages []string
+    for _, stage := range registry.stageNames() {
+        config := registry.Stages[stage]
+        description := stage + "@" + config.Active
+        if config.Candidate != "" {
+            description += fmt.Sprintf(" (A/B vs %s at %.0f%%)", config.Candidate, config.SampleRate*100)
+        }
+        stages = append(stages, description)
+    }
+    return strings.Join(stages, ", ")
+}
+
+func (registry *Registry) stageNames() []string {
+    names := make([]string, 0, len(registry.Stages))
+    for stage := range registry.Stages {
+        names = append(names, stage)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func (prompt *Prompt) Render(data Data) (string, error) {
+    var rendered strings.Builder
+    if err := prompt.template.Execute(&rendered, data); err != nil {
+        return "", fmt.Errorf("failed to render %s: %w", prompt.ID(), err)
+    }
+    return rendered.String(), nil
+}
+
+func (prompt *Prompt) ID() string {
+    return prompt.Stage + "@" + prompt.Version
+}
@@ -0,0 +1,239 @@
+package replay
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "feed-curator/database"
+    "feed-curator/extractor"
+    "feed-curator/feedstore"
+    "feed-curator/fetcher"
+    "feed-curator/models"
+    "feed-curator/policy"
+    "feed-curator/prompts"
+    "feed-curator/sentiment"
+    "feed-curator/summarizer"
+    "feed-curator/translate"
+    "feed-curator/utils"
+)
+
+const (
+    RawNewsBucket = "raw-news-archive"
+    SummarizedNewsBucket = "summarized-news-archive"
+)
+
+/*
+Options select what a replay does besides summarizing. With none of them set
+a replay is a dry run that only reports how each run would curate.
+*/
+type Options struct {
+    From        time.Time
+    To          time.Time
+    // Extract full texts again, extraction is cached so this mostly hits MinIO
+    FullText    bool
+    // Overwrite the summarized archives of the replayed runs
+    Archive     bool
+    // Stage every replayed run as a feed version kept for a day, for inspection or manual promotion
+    Stage       bool
+    // Validate and promote the most recent replayed run
+    Publish     bool
+}
+
+/*
+Run is one curator run rebuilt from the archive: the curator archives the
+headlines and the discover responses as separate objects a few seconds apart.
+ArchivedAt is the time of the run's first archive, each half keeps the time
+of the archive it came from, which its summarized archive is written under.
+*/
+type Run struct {
+    ArchivedAt          time.Time
+    HeadlinesArchivedAt time.Time
+    DiscoverArchivedAt  time.Time
+    Headlines           map[string]models.APIResponse
+    Discover            map[string]models.APIResponse
+}
+
+type Result struct {
+    ArchivedAt  time.Time       `json:"archivedAt"`
+    Headlines   map[string]int  `json:"headlines"`
+    Discover    map[string]int  `json:"discover"`
+    Version     int64           `json:"version,omitempty"`
+    Published   bool            `json:"published"`
+    Error       string          `json:"error,omitempty"`
+}
+
+/*
+Replay runs the archived NewsAPI responses between From and To through the
+current policy, extraction, prompts and summarizer, without calling NewsAPI.
+Pointing PROMPTS_DIR at a prompt set under development tries it on real
+archived news.
+*/
+func Replay(options Options) ([]Result, error) {
+    runs, err := LoadRuns(options.From, options.To)
+    if err != nil {
+        return nil, err
+    }
+    if len(runs) == 0 {
+        return nil, fmt.Errorf("no raw archives between %s and %s", options.From.Format(time.RFC3339), options.To.Format(time.RFC3339))
+    }
+
+    sourcePolicy := policy.Load()
+    registry := prompts.Load()
+    analyzer := sentiment.New()
+    translator := translate.New()
+    // Archives don't record the search language, runs are assumed to have used the current one
+    discoverLanguage := fetcher.DiscoverLanguage()
+    var fullTextExtractor *extractor.Extractor
+    if options.FullText {
+        fullTextExtractor = extractor.New(extractor.NewMinIOCache(models.MinIOClient))
+    }
+
+    results := make([]Result, 0, len(runs))
+    for index, run := range runs {
+        utils.LogMessage(fmt.Sprintf("Replaying run archived at %s", run.ArchivedAt.Format(time.RFC3339)), "green")
+
+        if fullTextExtractor != nil {
+            fullTextExtractor.EnrichArticles(run.Headlines)
+            fullTextExtractor.EnrichArticles(run.Discover)
+        }
+
+        summarizedHeadlines := summarizer.SummarizeCountryCategorizedHeadlines(run.Headlines, sourcePolicy, registry, analyzer)
+        summarizedDiscover := summarizer.SummarizeCategorizedNews(run.Discover, sourcePolicy, registry, analyzer)
+        translate.LocalizeFeed(summarizedHeadlines, translate.CountryLanguage, translator, translate.Languages())
+        translate.LocalizeFeed(summarizedDiscover, func(string) string { return discoverLanguage }, translator, translate.Languages())
+
+        result := Result{
+            ArchivedAt: run.ArchivedAt,
+            Headlines:  articleCounts(summarizedHeadlines),
+            Discover:   articleCounts(summarizedDiscover),
+        }
+
+        if options.Archive {
+            archiveReplayed(summarizedHeadlines, models.ArchiveHeadlines, run.HeadlinesArchivedAt)
+            archiveReplayed(summarizedDiscover, models.ArchiveDiscover, run.DiscoverArchivedAt)
+        }
+
+        feeds := map[string]map[string]models.SummarizedResponse{
+            "headlines": summarizedHeadlines,
+            "discover":  summarizedDiscover,
+        }
+        source := "replay:" + run.ArchivedAt.Format(models.ArchiveTimeLayout)
+
+        if options.Publish && index == len(runs)-1 {
+            // Validated against what was fetched then, the country list may have changed since
+            version, err := feedstore.Publish(feeds, map[string][]string{
+                "headlines": keys(run.Headlines),
+                "discover":  keys(run.Discover),
+            }, source)
+            result.Version = version
+            result.Published = err == nil
+            if err != nil {
+                result.Error = err.Error()
+            }
+        } else if options.Stage {
+            version, err := feedstore.Stage(feeds, source)
+            if err != nil {
+                result.Error = err.Error()
+            } else {
+                result.Version = version
+                feedstore.Reject(version)
+            }
+        }
+
+        results = append(results, result)
+    }
+
+    return results, nil
+}
+
+/*
+LoadRuns reads the raw archives between from and to and pairs them into
+runs. Archives are named after their kind; in one named before, keys that
+are all discover categories make a discover response, anything else holds
+headlines by country. A run is closed when a kind repeats, so a run missing
+one half (a failed upload) is still replayed.
+*/
+func LoadRuns(from, to time.Time) ([]Run, error) {
+    archives, err := database.ListRawNewsArchives(models.MinIOClient, RawNewsBucket, from, to)
+    if err != nil {
+        return nil, err
+    }
+
+    var runs []Run
+    var current *Run
+    for _, archive := range archives {
+        newsData, err := database.GetRawNewsArchive(models.MinIOClient, RawNewsBucket, archive.ObjectName)
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Skipping unreadable archive %s", archive.ObjectName), "red", err)
+            continue
+        }
+
+        discover := archive.Kind == models.ArchiveDiscover || (archive.Kind == "" && isDiscover(newsData))
+        if current == nil || (discover && current.Discover != nil) || (!discover && current.Headlines != nil) {
+            if current != nil {
+                runs = append(runs, *current)
+            }
+            current = &Run{ArchivedAt: archive.ArchivedAt}
+        }
+
+        if discover {
+            current.Discover = newsData
+            current.DiscoverArchivedAt = archive.ArchivedAt
+        } else {
+            current.Headlines = newsData
+            current.HeadlinesArchivedAt = archive.ArchivedAt
+        }
+    }
+    if current != nil {
+        runs = append(runs, *current)
+    }
+
+    return runs, nil
+}
+
+// archiveReplayed overwrites the summarized archive written for the raw archive of kind and archivedAt
+func archiveReplayed(summarized map[string]models.SummarizedResponse, kind string, archivedAt time.Time) {
+    if len(summarized) == 0 || archivedAt.IsZero() {
+        return
+    }
+    err := database.UploadNewsAPISummarizedDataToMinIOAt(models.MinIOClient, summarized, SummarizedNewsBucket, kind, archivedAt)
+    if err != nil {
+        utils.LogMessage(fmt.Sprintf("Failed to archive replayed summaries of %s", archivedAt.Format(time.RFC3339)), "red", err)
+    }
+}
+
+func isDiscover(newsData map[string]models.APIResponse) bool {
+    if len(newsData) == 0 {
+        return false
+    }
+
+    categories := make(map[string]bool, len(fetcher.DiscoverTags))
+    for _, category := range fetcher.DiscoverTags {
+        categories[category] = true
+    }
+
+    for key := range newsData {
+        if !categories[key] {
+            return false
+        }
+    }
+    return true
+}
+
+func articleCounts(summarized map[string]models.SummarizedResponse) map[string]int {
+    counts := make(map[string]int, len(summarized))
+    for key, response := range summarized {
+        counts[key] = len(response.Articles)
+    }
+    return counts
+}
+
+func keys(newsData map[string]models.APIResponse) []string {
+    result := make([]string, 0, len(newsData))
+    for key := range newsData {
+        result = append(result, key)
+    }
+    sort.Strings(result)
+    return result
+}
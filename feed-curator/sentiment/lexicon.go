@@ -0,0 +1,58 @@
+package sentiment
+
+/*
+Built-in finance lexicon, in the spirit of Loughran-McDonald: words read as
+good or bad news for a company's stock, weighted 1 (mild) to 3 (strong).
+Words are matched after lowercasing; phrases are matched before words so
+"beat expectations" isn't scored as "beat" alone.
+*/
+var defaultLexicon = Lexicon{
+    Positive: map[string]float64{
+        "gain": 1.5, "gains": 1.5, "gained": 1.5, "rise": 1.5, "rises": 1.5, "rose": 1.5, "rising": 1,
+        "jump": 2, "jumps": 2, "jumped": 2, "surge": 2.5, "surges": 2.5, "surged": 2.5, "soar": 2.5,
+        "soars": 2.5, "soared": 2.5, "rally": 2, "rallies": 2, "rallied": 2, "climb": 1.5, "climbed": 1.5,
+        "rebound": 1.5, "rebounded": 1.5, "recover": 1, "recovered": 1, "recovery": 1,
+        "profit": 1.5, "profits": 1.5, "profitable": 2, "growth": 1.5, "grow": 1, "grew": 1.5,
+        "record": 1, "beat": 1.5, "beats": 1.5, "exceed": 1.5, "exceeded": 1.5, "outperform": 2,
+        "outperformed": 2, "upgrade": 2, "upgraded": 2, "bullish": 2.5, "strong": 1.5, "stronger": 1.5,
+        "robust": 1.5, "boost": 1.5, "boosted": 1.5, "expand": 1, "expansion": 1, "improve": 1.5,
+        "improved": 1.5, "improvement": 1.5, "optimistic": 2, "optimism": 2, "upbeat": 2,
+        "dividend": 1, "buyback": 1.5, "innovative": 1, "breakthrough": 2, "approval": 1.5,
+        "approved": 1.5, "win": 1.5, "wins": 1.5, "won": 1.5, "success": 1.5, "successful": 1.5,
+        "efficient": 1, "momentum": 1, "high": 0.5, "higher": 1, "upside": 1.5, "raise": 1, "raised": 1,
+    },
+    Negative: map[string]float64{
+        "loss": 2, "losses": 2, "lose": 1.5, "lost": 1.5, "fall": 1.5, "falls": 1.5, "fell": 1.5,
+        "falling": 1.5, "drop": 1.5, "drops": 1.5, "dropped": 1.5, "decline": 1.5, "declines": 1.5,
+        "declined": 1.5, "slump": 2.5, "slumped": 2.5, "plunge": 2.5, "plunged": 2.5, "plunges": 2.5,
+        "tumble": 2.5, "tumbled": 2.5, "crash": 3, "crashed": 3, "sink": 2, "sank": 2, "slide": 1.5,
+        "slid": 1.5, "miss": 1.5, "missed": 1.5, "misses": 1.5, "downgrade": 2, "downgraded": 2,
+        "bearish": 2.5, "weak": 1.5, "weaker": 1.5, "weakness": 1.5, "cut": 1, "cuts": 1,
+        "layoff": 2, "layoffs": 2, "lawsuit": 2, "sued": 2, "fine": 1, "fined": 2, "penalty": 2,
+        "investigation": 2, "probe": 2, "fraud": 3, "scandal": 3, "bankrupt": 3, "bankruptcy": 3,
+        "default": 2.5, "debt": 1, "recall": 2, "recalled": 2, "warning": 1.5, "warns": 1.5,
+        "warned": 1.5, "risk": 1, "risks": 1, "uncertainty": 1.5, "volatile": 1, "volatility": 1,
+        "concern": 1, "concerns": 1, "fear": 1.5, "fears": 1.5, "pessimistic": 2, "recession": 2.5,
+        "inflation": 1, "tariff": 1, "tariffs": 1, "sanctions": 1.5, "delay": 1, "delayed": 1,
+        "shortage": 1.5, "disappointing": 2, "disappointed": 2, "lower": 1, "low": 0.5, "downside": 1.5,
+        "halt": 1.5, "halted": 1.5, "breach": 2, "hack": 2, "outage": 1.5,
+    },
+    Phrases: map[string]float64{
+        "beat expectations": 2.5, "beat estimates": 2.5, "above expectations": 2, "above estimates": 2,
+        "raised guidance": 2.5, "raises guidance": 2.5, "all-time high": 2, "record high": 2,
+        "missed expectations": -2.5, "missed estimates": -2.5, "below expectations": -2, "below estimates": -2,
+        "cut guidance": -2.5, "cuts guidance": -2.5, "lowered guidance": -2.5, "profit warning": -3,
+        "all-time low": -2, "record low": -2, "job cuts": -2, "rate cut": 1, "rate hike": -1,
+    },
+}
+
+var negators = map[string]bool{
+    "not": true, "no": true, "never": true, "without": true, "neither": true, "nor": true,
+    "isn't": true, "wasn't": true, "didn't": true, "doesn't": true, "don't": true, "won't": true,
+    "can't": true, "cannot": true, "hardly": true, "fails": true, "failed": true,
+}
+
+var intensifiers = map[string]float64{
+    "sharply": 1.5, "significantly": 1.4, "strongly": 1.4, "substantially": 1.4, "dramatically": 1.6,
+    "massive": 1.5, "huge": 1.4, "steep": 1.4, "slightly": 0.6, "modestly": 0.7, "marginally": 0.6,
+}
@@ -0,0 +1,292 @@
+package sentiment
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+
+    "feed-curator/models"
+    "feed-curator/utils"
+)
+
+const (
+    AnalyzerEnv = "SENTIMENT_ANALYZER"
+    LexiconFileEnv = "SENTIMENT_LEXICON_FILE"
+
+    AnalyzerLexicon = "lexicon"
+
+    LabelPositive = "positive"
+    LabelNeutral = "neutral"
+    LabelNegative = "negative"
+
+    // Scores within this distance of 0 are neutral
+    neutralBand = 0.05
+    // Normalizes the raw weight sum into (-1, 1), as in VADER
+    normalizationAlpha = 15.0
+    // How many following words a negator or intensifier applies to
+    modifierWindow = 3
+)
+
+var (
+    sentencePattern = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+    wordPattern = regexp.MustCompile(`[a-z0-9]+(?:['-][a-z0-9]+)*`)
+)
+
+/*
+Analyzer scores an article and its impact on each company it mentions.
+Lexicon is the local implementation, an AI or hosted model can implement the
+same interface.
+*/
+type Analyzer interface {
+    Analyze(text string, companies []string) models.SentimentResult
+}
+
+type Lexicon struct {
+    Positive    map[string]float64  `json:"positive"`
+    Negative    map[string]float64  `json:"negative"`
+    // Multi-word expressions with a signed weight
+    Phrases     map[string]float64  `json:"phrases"`
+}
+
+/*
+New returns the analyzer selected by SENTIMENT_ANALYZER. Only the lexicon
+exists today; SENTIMENT_LEXICON_FILE replaces the built-in word lists with a
+JSON file of the same shape as Lexicon.
+*/
+func New() Analyzer {
+    name := os.Getenv(AnalyzerEnv)
+    if name != "" && name != AnalyzerLexicon {
+        utils.LogMessage(fmt.Sprintf("Unknown sentiment analyzer %q, using the lexicon", name), "red")
+    }
+
+    lexiconFile := os.Getenv(LexiconFileEnv)
+    if lexiconFile == "" {
+        return &defaultLexicon
+    }
+
+    lexicon, err := LoadLexicon(lexiconFile)
+    if err != nil {
+        utils.LogMessage("Failed to load sentiment lexicon, using the built-in one", "red", err)
+        return &defaultLexicon
+    }
+    return lexicon
+}
+
+func LoadLexicon(path string) (*Lexicon, error) {
+    content, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var lexicon Lexicon
+    if err := json.Unmarshal(content, &lexicon); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+    }
+    return &lexicon, nil
+}
+
+/*
+Analyze scores the whole text, then each company on the sentences that
+mention it. A company the text never mentions is neutral with no confidence.
+*/
+func (lexicon *Lexicon) Analyze(text string, companies []string) models.SentimentResult {
+    sentences := sentencePattern.FindAllString(text, -1)
+
+    total, matches := 0.0, 0
+    for _, sentence := range sentences {
+        score, found := lexicon.scoreSentence(sentence)
+        total += score
+        matches += found
+    }
+
+    result := models.SentimentResult{Companies: []models.CompanyImpact{}}
+    result.Score, result.Label, result.Confidence = summarize(total, matches)
+
+    for _, company := range companies {
+        impact := models.CompanyImpact{Company: company, Impact: LabelNeutral}
+
+        companyTotal, companyMatches := 0.0, 0
+        for _, sentence := range sentences {
+            if !mentions(sentence, company) {
+                continue
+            }
+            score, found := lexicon.scoreSentence(sentence)
+            companyTotal += score
+            companyMatches += found
+        }
+
+        _, impact.Impact, impact.Confidence = summarize(companyTotal, companyMatches)
+        result.Companies = append(result.Companies, impact)
+    }
+
+    return result
+}
+
+/*
+Reconcile makes a lexicon result agree with a label chosen elsewhere (the
+AI's). A score of the other sign is flipped, a neutral label zeroes it, and a
+score too weak for the label is raised to the edge of the neutral band.
+Company impacts opposite to the label take it. Whatever had to change keeps
+half its confidence, the lexicon disagreed. Unknown labels change nothing.
+*/
+func Reconcile(result models.SentimentResult, label string) models.SentimentResult {
+    sign := 0.0
+    switch label {
+    case LabelPositive:
+        sign = 1
+    case LabelNegative:
+        sign = -1
+    case LabelNeutral:
+    default:
+        return result
+    }
+    if result.Label == label {
+        return result
+    }
+
+    reconciled := result
+    reconciled.Label = label
+    reconciled.Confidence = round(result.Confidence / 2)
+    if sign == 0 {
+        reconciled.Score = 0
+    } else {
+        reconciled.Score = round(sign * math.Max(math.Abs(result.Score), neutralBand))
+    }
+
+    reconciled.Companies = make([]models.CompanyImpact, len(result.Companies))
+    for index, impact := range result.Companies {
+        if sign != 0 && impact.Impact == opposite(label) {
+            impact.Impact = label
+            impact.Confidence = round(impact.Confidence / 2)
+        }
+        reconciled.Companies[index] = impact
+    }
+    return reconciled
+}
+
+func opposite(label string) string {
+    switch label {
+    case LabelPositive:
+        return LabelNegative
+    case LabelNegative:
+        return LabelPositive
+    }
+    return LabelNeutral
+}
+
+// scoreSentence returns the signed weight of a sentence and how many lexicon entries it matched
+func (lexicon *Lexicon) scoreSentence(sentence string) (float64, int) {
+    // Padded with spaces so phrases only match whole words
+    normalized := " " + strings.Join(wordPattern.FindAllString(strings.ToLower(sentence), -1), " ") + " "
+    score, matches := 0.0, 0
+
+    for _, phrase := range lexicon.phrasesLongestFirst() {
+        padded := " " + phrase + " "
+        if count := strings.Count(normalized, padded); count > 0 {
+            score += lexicon.Phrases[phrase] * float64(count)
+            matches += count
+            // Blank the phrase out so its words aren't counted again
+            normalized = strings.ReplaceAll(normalized, padded, " ")
+        }
+    }
+
+    words := strings.Fields(normalized)
+    negatedUntil, intensity, intensifiedUntil := -1, 1.0, -1
+    for index, word := range words {
+        if negators[word] {
+            negatedUntil = index + modifierWindow
+            continue
+        }
+        if factor, found := intensifiers[word]; found {
+            intensity, intensifiedUntil = factor, index+modifierWindow
+            continue
+        }
+
+        weight := lexicon.Positive[word] - lexicon.Negative[word]
+        if weight == 0 {
+            continue
+        }
+        if index <= intensifiedUntil {
+            weight *= intensity
+        }
+        if index <= negatedUntil {
+            // "not strong" is weaker news than "weak", as in VADER
+            weight *= -0.74
+        }
+
+        score += weight
+        matches++
+    }
+
+    return score, matches
+}
+
+// Longer phrases first, so "profit warning" wins over a shorter phrase inside it
+func (lexicon *Lexicon) phrasesLongestFirst() []string {
+    phrases := make([]string, 0, len(lexicon.Phrases))
+    for phrase := range lexicon.Phrases {
+        phrases = append(phrases, phrase)
+    }
+    sort.Slice(phrases, func(i, j int) bool {
+        if len(phrases[i]) != len(phrases[j]) {
+            return len(phrases[i]) > len(phrases[j])
+        }
+        return phrases[i] < phrases[j]
+    })
+    return phrases
+}
+
+/*
+summarize turns a raw weight sum into a score in [-1, 1], a label and a
+confidence in [0, 1]. Confidence grows with the number of matched entries and
+with how far the score is from neutral.
+*/
+func summarize(total float64, matches int) (float64, string, float64) {
+    if matches == 0 {
+        return 0, LabelNeutral, 0
+    }
+
+    score := total / math.Sqrt(total*total+normalizationAlpha)
+    label := LabelNeutral
+    if score >= neutralBand {
+        label = LabelPositive
+    } else if score <= -neutralBand {
+        label = LabelNegative
+    }
+
+    evidence := float64(matches) / float64(matches+3)
+    strength := math.Abs(score)
+    if label == LabelNeutral {
+        // Mixed signals that cancel out are a confident neutral, a lone weak match is not
+        strength = 1 - strength/neutralBand
+    }
+    confidence := evidence * (0.5 + strength/2)
+
+    return round(score), label, round(confidence)
+}
+
+/*
+mentions matches a company by its full name, or by its first word when that
+is distinctive enough ("Apple" for "Apple Inc."), case-insensitively and on
+word boundaries.
+*/
+func mentions(sentence, company string) bool {
+    sentence = " " + strings.Join(wordPattern.FindAllString(strings.ToLower(sentence), -1), " ") + " "
+    words := wordPattern.FindAllString(strings.ToLower(company), -1)
+    if len(words) == 0 {
+        return false
+    }
+
+    if strings.Contains(sentence, " "+strings.Join(words, " ")+" ") {
+        return true
+    }
+    return len(words[0]) >= 4 && strings.Contains(sentence, " "+words[0]+" ")
+}
+
+func round(value float64) float64 {
+    return math.Round(value*1000) / 1000
+}
@@ -0,0 +1,415 @@
+package stories
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "math"
+    "os"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "feed-curator/models"
+    "feed-curator/utils"
+)
+
+const (
+    ThresholdEnv = "STORY_SIMILARITY_THRESHOLD"
+    WindowEnv = "STORY_WINDOW_HOURS"
+    SummarySentencesEnv = "STORY_SUMMARY_SENTENCES"
+
+    // TF-IDF cosine between an article and a story's centroid
+    DefaultThreshold = 0.35
+    DefaultWindow = 48 * time.Hour
+    // Sentences other sources may add to the representative's summary
+    DefaultSummarySentences = 3
+
+    // A sentence this similar to one already in a story summary adds nothing
+    redundantSentence = 0.5
+    // Titles say what the event is, so their words count double
+    titleWeight = 2
+)
+
+var (
+    wordPattern = regexp.MustCompile(`[a-z0-9]+(?:['.][a-z0-9]+)*`)
+    sentencePattern = regexp.MustCompile(`[^.!?\n]+[.!?]*`)
+)
+
+var stopWords = map[string]bool{
+    "the": true, "and": true, "for": true, "that": true, "with": true, "this": true, "from": true,
+    "are": true, "was": true, "were": true, "has": true, "have": true, "had": true, "its": true,
+    "but": true, "not": true, "they": true, "their": true, "them": true, "will": true, "would": true,
+    "can": true, "could": true, "said": true, "says": true, "after": true, "over": true, "into": true,
+    "about": true, "than": true, "more": true, "also": true, "been": true, "which": true, "who": true,
+    "what": true, "when": true, "while": true, "there": true, "his": true, "her": true, "she": true,
+    "our": true, "you": true, "your": true, "all": true, "out": true, "new": true, "news": true,
+}
+
+type document struct {
+    article     models.SummarizedArticle
+    feeds       []string
+    publishedAt time.Time
+    vector      map[string]float64
+}
+
+type cluster struct {
+    members         []*document
+    // Sum of the member vectors
+    centroid        map[string]float64
+    lastPublished   time.Time
+}
+
+/*
+Cluster groups the articles of a run covering the same event into stories
+and tags each clustered article with its story. Articles are compared on the
+TF-IDF vectors of their title and summary: in publication order, each joins
+the most similar story published within STORY_WINDOW_HOURS, when it is at
+least STORY_SIMILARITY_THRESHOLD similar, or starts a new one. Stories need
+two distinct URLs, the same link filed under two categories isn't a second
+source.
+*/
+func Cluster(feeds map[string]map[string]models.SummarizedResponse) map[string]models.Story {
+    documents := collect(feeds)
+    idf := inverseDocumentFrequencies(documents)
+    for _, doc := range documents {
+        doc.vector = vectorize(doc.article.Title, doc.article.SummarizedContent, idf)
+    }
+
+    sort.SliceStable(documents, func(i, j int) bool {
+        return documents[i].publishedAt.Before(documents[j].publishedAt)
+    })
+
+    threshold := envFloat(ThresholdEnv, DefaultThreshold)
+    window := time.Duration(envFloat(WindowEnv, DefaultWindow.Hours()) * float64(time.Hour))
+
+    var clusters []*cluster
+    for _, doc := range documents {
+        var best *cluster
+        bestSimilarity := threshold
+        for _, candidate := range clusters {
+            if !doc.publishedAt.IsZero() && !candidate.lastPublished.IsZero() && doc.publishedAt.Sub(candidate.lastPublished) > window {
+                continue
+            }
+            if similarity := centroidSimilarity(doc.vector, candidate.centroid); similarity >= bestSimilarity {
+                best, bestSimilarity = candidate, similarity
+            }
+        }
+
+        if best == nil {
+            best = &cluster{centroid: make(map[string]float64)}
+            clusters = append(clusters, best)
+        }
+        best.members = append(best.members, doc)
+        for term, weight := range doc.vector {
+            best.centroid[term] += weight
+        }
+        if doc.publishedAt.After(best.lastPublished) {
+            best.lastPublished = doc.publishedAt
+        }
+    }
+
+    summarySentences := int(envFloat(SummarySentencesEnv, DefaultSummarySentences))
+    stories := make(map[string]models.Story)
+    membership := make(map[string]models.Story)
+    for _, candidate := range clusters {
+        if distinctURLs(candidate.members) < 2 {
+            continue
+        }
+
+        story := buildStory(candidate, idf, summarySentences)
+        stories[story.ID] = story
+        for _, member := range story.Articles {
+            membership[member.StockicID] = story
+        }
+    }
+
+    annotate(feeds, membership)
+    utils.LogMessage(fmt.Sprintf("Clustered %d articles into %d stories", len(documents), len(stories)), "green")
+    return stories
+}
+
+// collect returns every distinct article once, with all the places it is served
+func collect(feeds map[string]map[string]models.SummarizedResponse) []*document {
+    byID := make(map[string]*document)
+    var documents []*document
+
+    for _, feedName := range sortedKeys(feeds) {
+        feed := feeds[feedName]
+        keys := make([]string, 0, len(feed))
+        for key := range feed {
+            keys = append(keys, key)
+        }
+        sort.Strings(keys)
+
+        for _, key := range keys {
+            for _, article := range feed[key].Articles {
+                location := feedName + "/" + key
+                if doc, exists := byID[article.StockicID]; exists {
+                    doc.feeds = append(doc.feeds, location)
+                    continue
+                }
+
+                publishedAt, _ := time.Parse(time.RFC3339, article.PublishedAt)
+                doc := &document{article: article, feeds: []string{location}, publishedAt: publishedAt}
+                byID[article.StockicID] = doc
+                documents = append(documents, doc)
+            }
+        }
+    }
+
+    return documents
+}
+
+func buildStory(candidate *cluster, idf map[string]float64, summarySentences int) models.Story {
+    members := candidate.members
+
+    // The most central article stands for the story, trusted sources are favoured
+    representative := members[0]
+    bestScore := -1.0
+    for _, member := range members {
+        score := centroidSimilarity(member.vector, candidate.centroid) + 0.25*member.article.TrustScore
+        if score > bestScore {
+            representative, bestScore = member, score
+        }
+    }
+
+    // Other sources are read most trusted first when adding to the summary
+    others := make([]*document, 0, len(members)-1)
+    for _, member := range members {
+        if member != representative {
+            others = append(others, member)
+        }
+    }
+    sort.SliceStable(others, func(i, j int) bool {
+        return others[i].article.TrustScore > others[j].article.TrustScore
+    })
+
+    story := models.Story{
+        // Derived from the earliest article so the ID holds while the story grows over later runs
+        ID:               storyID(members[0].article.StockicID),
+        Title:            representative.article.Title,
+        Summary:          aggregateSummary(representative, others, idf, summarySentences),
+        Representative:   representative.article.StockicID,
+        Sources:          []string{},
+        Companies:        []string{},
+        Articles:         make([]models.StoryMember, 0, len(members)),
+        FirstPublishedAt: members[0].article.PublishedAt,
+        LastPublishedAt:  members[len(members)-1].article.PublishedAt,
+    }
+
+    var companies []string
+    for _, member := range append([]*document{representative}, others...) {
+        if member.article.Source != "" && !contains(story.Sources, member.article.Source) {
+            story.Sources = append(story.Sources, member.article.Source)
+        }
+        companies = append(companies, member.article.CompaniesTags...)
+    }
+    if unique, err := utils.RemoveDuplicates(companies); err == nil && unique != nil {
+        story.Companies = unique
+    }
+
+    for _, member := range members {
+        story.Articles = append(story.Articles, models.StoryMember{
+            StockicID:   member.article.StockicID,
+            Title:       member.article.Title,
+            Source:      member.article.Source,
+            URL:         member.article.URL,
+            PublishedAt: member.article.PublishedAt,
+            Feeds:       member.feeds,
+        })
+    }
+
+    return story
+}
+
+/*
+aggregateSummary starts from the representative's summary and appends up to
+limit sentences from the other sources that say something it doesn't, so a
+reader of the story card sees every angle once.
+*/
+func aggregateSummary(representative *document, others []*document, idf map[string]float64, limit int) string {
+    sentences := splitSentences(representative.article.SummarizedContent)
+    var included []map[string]float64
+    for _, sentence := range sentences {
+        included = append(included, vectorize("", sentence, idf))
+    }
+
+    added := 0
+    for _, member := range others {
+        for _, sentence := range splitSentences(member.article.SummarizedContent) {
+            if added >= limit {
+                return strings.Join(sentences, " ")
+            }
+
+            vector := vectorize("", sentence, idf)
+            if len(vector) == 0 {
+                continue
+            }
+            redundant := false
+            for _, existing := range included {
+                if cosine(vector, existing) >= redundantSentence {
+                    redundant = true
+                    break
+                }
+            }
+            if redundant {
+                continue
+            }
+
+            sentences = append(sentences, sentence)
+            included = append(included, vector)
+            added++
+        }
+    }
+
+    return strings.Join(sentences, " ")
+}
+
+// annotate tags every served copy of a clustered article with its story
+func annotate(feeds map[string]map[string]models.SummarizedResponse, membership map[string]models.Story) {
+    for _, feed := range feeds {
+        for _, response := range feed {
+            for index := range response.Articles {
+                article := &response.Articles[index]
+                if story, found := membership[article.StockicID]; found {
+                    article.StoryID = story.ID
+                    article.StorySize = len(story.Articles)
+                }
+            }
+        }
+    }
+}
+
+func inverseDocumentFrequencies(documents []*document) map[string]float64 {
+    frequencies := make(map[string]int)
+    for _, doc := range documents {
+        seen := make(map[string]bool)
+        for _, term := range tokenize(doc.article.Title + " " + doc.article.SummarizedContent) {
+            if !seen[term] {
+                seen[term] = true
+                frequencies[term]++
+            }
+        }
+    }
+
+    idf := make(map[string]float64, len(frequencies))
+    for term, frequency := range frequencies {
+        idf[term] = math.Log(float64(len(documents)+1)/float64(frequency+1)) + 1
+    }
+    return idf
+}
+
+// vectorize returns the unit TF-IDF vector of a title and body, with sublinear term frequencies
+func vectorize(title, body string, idf map[string]float64) map[string]float64 {
+    counts := make(map[string]float64)
+    for _, term := range tokenize(title) {
+        counts[term] += titleWeight
+    }
+    for _, term := range tokenize(body) {
+        counts[term]++
+    }
+
+    vector := make(map[string]float64, len(counts))
+    norm := 0.0
+    for term, count := range counts {
+        weight, found := idf[term]
+        if !found {
+            continue
+        }
+        weight *= 1 + math.Log(count)
+        vector[term] = weight
+        norm += weight * weight
+    }
+
+    norm = math.Sqrt(norm)
+    for term := range vector {
+        vector[term] /= norm
+    }
+    return vector
+}
+
+func tokenize(text string) []string {
+    var terms []string
+    for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+        if len(word) < 2 || stopWords[word] {
+            continue
+        }
+        terms = append(terms, word)
+    }
+    return terms
+}
+
+func cosine(a, b map[string]float64) float64 {
+    if len(a) > len(b) {
+        a, b = b, a
+    }
+    dot := 0.0
+    for term, weight := range a {
+        dot += weight * b[term]
+    }
+    return dot
+}
+
+// centroidSimilarity is the cosine between a unit vector and an unnormalized centroid
+func centroidSimilarity(vector, centroid map[string]float64) float64 {
+    norm := 0.0
+    for _, weight := range centroid {
+        norm += weight * weight
+    }
+    if norm == 0 {
+        return 0
+    }
+    return cosine(vector, centroid) / math.Sqrt(norm)
+}
+
+func splitSentences(text string) []string {
+    var sentences []string
+    for _, sentence := range sentencePattern.FindAllString(text, -1) {
+        if sentence = strings.TrimSpace(sentence); sentence != "" {
+            sentences = append(sentences, sentence)
+        }
+    }
+    return sentences
+}
+
+func distinctURLs(members []*document) int {
+    urls := make(map[string]bool, len(members))
+    for _, member := range members {
+        urls[member.article.URL] = true
+    }
+    return len(urls)
+}
+
+func storyID(stockicID string) string {
+    hash := sha256.Sum256([]byte("story:" + stockicID))
+    return hex.EncodeToString(hash[:16])
+}
+
+func sortedKeys(feeds map[string]map[string]models.SummarizedResponse) []string {
+    keys := make([]string, 0, len(feeds))
+    for key := range feeds {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func contains(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+    return false
+}
+
+func envFloat(name string, fallback float64) float64 {
+    value, err := strconv.ParseFloat(os.Getenv(name), 64)
+    if err != nil || value < 0 {
+        return fallback
+    }
+    return value
+}
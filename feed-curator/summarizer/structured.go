@@ -0,0 +1,195 @@
+package summarizer
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+
+    "feed-curator/fetcher"
+    "feed-curator/models"
+    "feed-curator/prompts"
+    "feed-curator/utils"
+
+    "github.com/google/generative-ai-go/genai"
+)
+
+const (
+    MaxRepairsEnv = "CURATION_MAX_REPAIRS"
+    DefaultMaxRepairs = 2
+
+    // Articles that fit no discover category
+    GeneralCategory = "general"
+
+    maxKeyPoints = 8
+)
+
+var sentiments = []string{"positive", "neutral", "negative"}
+
+func curationCategories() []string {
+    return append(append([]string{}, fetcher.DiscoverTags...), GeneralCategory)
+}
+
+/*
+curationSchema constrains the curate response. Gemini enforces it when
+generating, validateCuration checks it again since a schema-constrained
+response can still be truncated or leave strings empty.
+*/
+func curationSchema() *genai.Schema {
+    return &genai.Schema{
+        Type: genai.TypeObject,
+        Properties: map[string]*genai.Schema{
+            "summary": {
+                Type:        genai.TypeString,
+                Description: "Summary of the article content",
+            },
+            "keyPoints": {
+                Type:        genai.TypeArray,
+                Description: "Important lines or metrics, copied word for word from the summary",
+                Items:       &genai.Schema{Type: genai.TypeString},
+            },
+            "sentiment": {
+                Type:   genai.TypeString,
+                Format: "enum",
+                Enum:   sentiments,
+            },
+            "companies": {
+                Type:  genai.TypeArray,
+                Items: &genai.Schema{Type: genai.TypeString},
+            },
+            "category": {
+                Type:   genai.TypeString,
+                Format: "enum",
+                Enum:   curationCategories(),
+            },
+        },
+        Required: []string{"summary", "keyPoints", "sentiment", "companies", "category"},
+    }
+}
+
+/*
+decodeCuration parses a curate response and lists everything wrong with it,
+worded so the list can be sent back to the model in the repair prompt.
+*/
+func decodeCuration(output string) (models.CurationOutput, []string) {
+    var curation models.CurationOutput
+
+    // Models occasionally wrap JSON in a markdown fence despite the MIME type
+    output = strings.TrimSpace(output)
+    output = strings.TrimPrefix(output, "```json")
+    output = strings.TrimPrefix(output, "```")
+    output = strings.TrimSuffix(output, "```")
+
+    decoder := json.NewDecoder(bytes.NewReader([]byte(output)))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&curation); err != nil {
+        return curation, []string{fmt.Sprintf("the answer is not a valid JSON object of the expected shape: %v", err)}
+    }
+
+    return curation, validateCuration(&curation)
+}
+
+// validateCuration normalizes the curation in place and returns the problems left
+func validateCuration(curation *models.CurationOutput) []string {
+    var problems []string
+
+    curation.Summary = strings.TrimSpace(curation.Summary)
+    if curation.Summary == "" {
+        problems = append(problems, "summary is empty")
+    }
+
+    var keyPoints []string
+    for _, point := range curation.KeyPoints {
+        if point = strings.TrimSpace(point); point != "" {
+            keyPoints = append(keyPoints, point)
+        }
+    }
+    curation.KeyPoints = keyPoints
+    if len(curation.KeyPoints) == 0 {
+        problems = append(problems, "keyPoints is empty")
+    }
+    if len(curation.KeyPoints) > maxKeyPoints {
+        problems = append(problems, fmt.Sprintf("keyPoints has %d entries, at most %d are allowed", len(curation.KeyPoints), maxKeyPoints))
+    }
+
+    curation.Sentiment = strings.ToLower(strings.TrimSpace(curation.Sentiment))
+    if !contains(sentiments, curation.Sentiment) {
+        problems = append(problems, fmt.Sprintf("sentiment %q is not one of %s", curation.Sentiment, strings.Join(sentiments, ", ")))
+    }
+
+    curation.Category = strings.ToLower(strings.TrimSpace(curation.Category))
+    if !contains(curationCategories(), curation.Category) {
+        problems = append(problems, fmt.Sprintf("category %q is not one of %s", curation.Category, strings.Join(curationCategories(), ", ")))
+    }
+
+    companies, _ := utils.RemoveDuplicates(trimAll(curation.Companies))
+    curation.Companies = companies
+
+    return problems
+}
+
+/*
+curate runs a curate prompt and returns the validated response as JSON. An
+invalid response is sent back with its problems through the repair prompt,
+up to CURATION_MAX_REPAIRS times, before the article is given up on.
+*/
+func curate(registry *prompts.Registry, prompt *prompts.Prompt, data prompts.Data) (string, error) {
+    data.Categories = strings.Join(curationCategories(), ", ")
+
+    output, err := generate(prompt, data, curationSchema())
+    if err != nil {
+        return "", err
+    }
+
+    maxRepairs := DefaultMaxRepairs
+    if value, err := strconv.Atoi(os.Getenv(MaxRepairsEnv)); err == nil && value >= 0 {
+        maxRepairs = value
+    }
+
+    for attempt := 0; ; attempt++ {
+        curation, problems := decodeCuration(output)
+        if len(problems) == 0 {
+            validated, err := json.Marshal(curation)
+            return string(validated), err
+        }
+
+        if attempt == maxRepairs {
+            return "", fmt.Errorf("%s returned invalid output after %d repairs: %s", prompt.ID(), maxRepairs, strings.Join(problems, "; "))
+        }
+
+        utils.LogMessage(fmt.Sprintf("Repairing %s output for %s: %s", prompt.ID(), data.Title, strings.Join(problems, "; ")), "red")
+        repairData := data
+        repairData.Output = output
+        repairData.Problems = "- " + strings.Join(problems, "\n- ")
+
+        repair := registry.Active(prompts.StageRepair)
+        if repair == nil {
+            return "", fmt.Errorf("%s returned invalid output and no repair prompt is configured", prompt.ID())
+        }
+        output, err = generate(repair, repairData, curationSchema())
+        if err != nil {
+            return "", err
+        }
+    }
+}
+
+func contains(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+    return false
+}
+
+func trimAll(values []string) []string {
+    trimmed := make([]string, 0, len(values))
+    for _, value := range values {
+        if value = strings.TrimSpace(value); value != "" {
+            trimmed = append(trimmed, value)
+        }
+    }
+    return trimmed
+}
@@ -4,59 +4,128 @@ import (
     "fmt"
     "context"
     "os"
-    "log"
-    // "time"
+    "time"
     "encoding/hex"
     "encoding/json"
     "crypto/sha256"
     "io"
     "net/http"
     "bytes"
+    "sort"
 
+    "feed-curator/database"
+    "feed-curator/highlight"
     "feed-curator/models"
+    "feed-curator/policy"
+    "feed-curator/prompts"
+    "feed-curator/sentiment"
     "feed-curator/utils"
 
     "github.com/google/generative-ai-go/genai"
     "google.golang.org/api/option"
 )
 
-func summarizer(modelName string, title string, text string) (*genai.GenerateContentResponse, error) {
+const (
+    AIEnabledEnv = "AI_ENABLED"
+    PromptExperimentsBucket = "prompt-experiments"
+)
+
+// Without AI the curator serves NewsAPI content as is, which keeps development runs free of Gemini quota
+func aiEnabled() bool {
+    return os.Getenv(AIEnabledEnv) == "true"
+}
+
+// generate runs one prompt, constraining the answer to JSON matching schema when one is given
+func generate(prompt *prompts.Prompt, data prompts.Data, schema *genai.Schema) (string, error) {
+    promptInput, err := prompt.Render(data)
+    if err != nil {
+        return "", err
+    }
+
     geminiCtx := context.Background()
     client, err := genai.NewClient(geminiCtx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
     if err != nil {
-        return nil, err
+        return "", err
     }
     defer client.Close()
 
-    model := client.GenerativeModel(modelName)
+    model := client.GenerativeModel(prompt.Model)
+    if schema != nil {
+        model.ResponseMIMEType = "application/json"
+        model.ResponseSchema = schema
+    }
 
-    promptInput := fmt.Sprintf("Focus on content, main points and not on source/author. Summarize given news only called %s in the url: %s", title, text)
     response, err := model.GenerateContent(geminiCtx, genai.Text(promptInput))
     if err != nil {
-        return nil, err
+        return "", err
+    }
+
+    var output string
+    for _, candidate := range response.Candidates {
+        if candidate.Content != nil {
+            for _, part := range candidate.Content.Parts {
+                output = fmt.Sprintf("%s%s", output, part)
+            }
+        }
     }
 
-    return response, err
+    return output, nil
 }
 
+/*
+runStage runs the active prompt of an AI stage through run and returns its
+output with the provenance to store on the article. In A/B mode sampled
+articles are also run through the candidate prompt and both outputs are
+archived; the candidate's output is never served.
+*/
+func runStage(registry *prompts.Registry, stage string, articleURL string, data prompts.Data, run func(*prompts.Prompt, prompts.Data) (string, error)) (string, models.Provenance, error) {
+    active := registry.Active(stage)
+    if active == nil {
+        return "", models.Provenance{Stage: stage}, fmt.Errorf("no active prompt is configured for %s", stage)
+    }
+    provenance := models.Provenance{Stage: stage, PromptVersion: active.Version, Model: active.Model}
 
-func highlighter(modelName string, text string) (*genai.GenerateContentResponse, error) {
-    geminiCtx := context.Background()
-    client, err := genai.NewClient(geminiCtx, option.WithAPIKey(os.Getenv("GEMINI_API_KEY")))
+    started := time.Now()
+    output, err := run(active, data)
     if err != nil {
-        return nil, err
+        return "", provenance, err
+    }
+    activeOutput := models.ExperimentOutput{
+        PromptVersion: active.Version,
+        Model:         active.Model,
+        Role:          "active",
+        Output:        output,
+        LatencyMs:     time.Since(started).Milliseconds(),
     }
-    defer client.Close()
 
-    model := client.GenerativeModel(modelName)
+    if candidate := registry.Candidate(stage, articleURL); candidate != nil {
+        started = time.Now()
+        candidateOutput, err := run(candidate, data)
+        experimentOutput := models.ExperimentOutput{
+            PromptVersion: candidate.Version,
+            Model:         candidate.Model,
+            Role:          "candidate",
+            Output:        candidateOutput,
+            LatencyMs:     time.Since(started).Milliseconds(),
+        }
+        if err != nil {
+            experimentOutput.Error = err.Error()
+        }
 
-    promptInput := fmt.Sprintf("Extract the important and impactful lines/metrics from given news content (only lines/words): %s", text)
-    response, err := model.GenerateContent(geminiCtx, genai.Text(promptInput))
-    if err != nil {
-        return nil, err
+        experiment := models.PromptExperiment{
+            Stage:      stage,
+            ArticleURL: articleURL,
+            Title:      data.Title,
+            Input:      data.Text,
+            CreatedAt:  time.Now().UTC(),
+            Outputs:    []models.ExperimentOutput{activeOutput, experimentOutput},
+        }
+        if err := database.UploadPromptExperimentToMinIO(models.MinIOClient, experiment, PromptExperimentsBucket); err != nil {
+            utils.LogMessage(fmt.Sprintf("Failed to archive %s experiment for: %s", stage, data.Title), "red", err)
+        }
     }
 
-    return response, err
+    return output, provenance, nil
 }
 
 func CompaniesTagger(text string) []models.TaggerAIEntity {
@@ -95,151 +164,38 @@ func CompaniesTagger(text string) []models.TaggerAIEntity {
     return entities
 }
 
-func SummarizeCountryCategorizedHeadlines(categorizedHeadlines map[string]models.APIResponse) map[string]models.SummarizedResponse {
-    summarizedResponses := make(map[string]models.SummarizedResponse)
+func SummarizeCountryCategorizedHeadlines(categorizedHeadlines map[string]models.APIResponse, sourcePolicy *policy.Policy, registry *prompts.Registry, analyzer sentiment.Analyzer) map[string]models.SummarizedResponse {
+    return summarizeCategorized(categorizedHeadlines, sourcePolicy, registry, analyzer)
+}
 
-    for category, apiResponse := range categorizedHeadlines {
+func SummarizeCategorizedNews(categorizedNews map[string]models.APIResponse, sourcePolicy *policy.Policy, registry *prompts.Registry, analyzer sentiment.Analyzer) map[string]models.SummarizedResponse {
+    return summarizeCategorized(categorizedNews, sourcePolicy, registry, analyzer)
+}
+
+/*
+Headlines (keyed by country) and discover news (keyed by category) go through
+the same per-article curation. Within each key, articles from more trusted
+sources are ranked first; the NewsAPI order is kept among equals.
+*/
+func summarizeCategorized(categorizedNews map[string]models.APIResponse, sourcePolicy *policy.Policy, registry *prompts.Registry, analyzer sentiment.Analyzer) map[string]models.SummarizedResponse {
+    summarizedResponses := make(map[string]models.SummarizedResponse)
 
+    for category, apiResponse := range categorizedNews {
         var summarizedArticles []models.SummarizedArticle
 
         for _, article := range apiResponse.Articles {
-
-            var ( 
-                // taggerOutput []models.TaggerAIEntity
-                taggerCompanies []string 
-                // highlights []string
-                highlightsIndex [][]int 
-            )
-
-            // utils.LogMessage("Feeding AI with 1 news", "green")
-            // summaryResp, err := summarizer(os.Getenv("SUMMARIZATION_AI_MODEL"), article.Title, article.Content)
-            // if err != nil {
-            //    utils.LogMessage(fmt.Sprintf("AI Failed to process: %s", article.Title), "red", err)
-            //    continue
-            // }
-
-            // time.Sleep(30 * time.Second)
-
-            var contentString string = ""
-            // for _, candidate := range summaryResp.Candidates {
-            //     if candidate.Content != nil {
-            //         for _, part := range candidate.Content.Parts {
-            //             contentString = fmt.Sprintf("%s%s", contentString, part) 
-            //         }
-            //     }
-            // }
-
-            contentString = article.Content
-
-            // highlightResp, err := highlighter(os.Getenv("HIGHLIGHTS_AI_MODEL"), contentString)
-            // if err != nil {
-            //   utils.LogMessage(fmt.Sprintf("AI Failed to process highlights: %s", article.Title), "red", err)
-            // }
-
-            // var highlightInput string 
-            // for _, candidate := range highlightResp.Candidates {
-            //     if candidate.Content != nil {
-            //        for _, part := range candidate.Content.Parts {
-            //            highlightInput = fmt.Sprintf("%s%s", highlightInput, part) 
-            //        }
-            //    }
-            // }
-            
-            // highlights = utils.ExtractPoints(highlightInput)
-
-            // highlightsIndex = utils.FindHighlightIndexes(contentString, highlights) 
-
-            highlightsIndex = [][]int{{1,5}, {7,10}}
-
-            // for _, highlight := range highlights {
-            //     fmt.Println("highlight ->" + highlight)
-            // }
-
-            fmt.Println(highlightsIndex)
-
-            // taggerOutput = CompaniesTagger(contentString)
-
-            // for _, entity := range taggerOutput {
-            //     if entity.Entity == "ORG" {
-            //         taggerCompanies = append(taggerCompanies, entity.Word)
-            //     }
-            // }
-
-            taggerCompanies = []string{"Nvidia", "Google"}
-
-            // taggerCompanies, err = utils.RemoveHashPrefix(taggerCompanies)
-            // if err != nil {
-            //     utils.LogMessage("Failed to remove prepending #", "red", err)
-            // }
-
-            // taggerCompanies, err = utils.RemoveDuplicates(taggerCompanies)
-            // if err != nil {
-            //     utils.LogMessage("Failed to remove duplicates", "red", err)
-            // }
-
-            for _, tag := range taggerCompanies {
-                fmt.Println("tag ->" + tag)
-            }
-
-            // time.Sleep(30 * time.Second)
-
-            // contentString := article.Content
-
-            // utils.LogMessage("===== AI NEWS! ====", "green")
-            // fmt.Println(contentString)
-            // utils.LogMessage("===================", "green")
-
-            if article.URLToImage == "" {
-                utils.LogMessage(fmt.Sprintf("Skipping article without image: %s", article.Title), "yellow")
+            summarizedArticle, ok := summarizeArticle(article, sourcePolicy, registry, analyzer)
+            if !ok {
                 continue
             }
 
-            if article.Author == "" {
-                utils.LogMessage("No Author, replacing with Aditya Patil", "red")
-                article.Author = "Aditya Patil"
-            }
-
-            if article.Source.Name == "" {
-                utils.LogMessage("No source Name - Replacing with Stockic Editors", "red")
-                article.Source.Name = "Stockic Editors"
-            }
-
-            if article.Source.Name == "The Washington Post" {
-                utils.LogMessage("The Washington Post News, changing URL", "red")
-                article.URLToImage = "https://theintercept.com/wp-content/uploads/2017/01/the-washington-post-newspaper-2-1484771977.jpg"
-            }
-
-            // Create summarized article
-            summarizedArticle := models.SummarizedArticle{
-                Source:             article.Source.Name,
-                Author:             article.Author,
-                Title:              article.Title,
-                URL:                article.URL,
-                URLToImage:         article.URLToImage,
-                PublishedAt:        article.PublishedAt,
-                SummarizedContent:  contentString,
-                CompaniesTags:      taggerCompanies,
-                NewsHighlights:     highlightsIndex,
-            }
-
-            // Concatenate fields to generate StockicID
-            concatenatedFields := fmt.Sprintf("%s%s%s%s%s%s%s",
-                summarizedArticle.Source,
-                summarizedArticle.Author,
-                summarizedArticle.Title,
-                summarizedArticle.URL,
-                summarizedArticle.URLToImage,
-                summarizedArticle.PublishedAt,
-                summarizedArticle.SummarizedContent,
-            )
-
-            // Generate SHA256 hash
-            hash := sha256.Sum256([]byte(concatenatedFields))
-            summarizedArticle.StockicID = hex.EncodeToString(hash[:])
-
-            // Append to list of summarized articles
             summarizedArticles = append(summarizedArticles, summarizedArticle)
         }
+
+        sort.SliceStable(summarizedArticles, func(i, j int) bool {
+            return summarizedArticles[i].TrustScore > summarizedArticles[j].TrustScore
+        })
+
         summarizedResponses[category] = models.SummarizedResponse{
             Status:       "ok",
             TotalResults: len(summarizedArticles),
@@ -250,171 +206,136 @@ func SummarizeCountryCategorizedHeadlines(categorizedHeadlines map[string]models
     return summarizedResponses
 }
 
-func SummarizeCategorizedNews(categorizedNews map[string]models.APIResponse) map[string]models.SummarizedResponse {
-    summarizedResponses := make(map[string]models.SummarizedResponse)
-
-    var summarizedArticles []models.SummarizedArticle
-
-    for category, apiResponse := range categorizedNews {
-        var ( 
-            // taggerOutput []models.TaggerAIEntity
-            taggerCompanies []string 
-            // highlights []string
-            highlightsIndex [][]int 
-        )
-
-
-        for _, article := range apiResponse.Articles {
-
-            // utils.LogMessage("Feeding AI with 1 news", "green")
-            // summaryResp, err := summarizer(os.Getenv("SUMMARIZATION_AI_MODEL"), article.Title, article.Content)
-            // if err != nil {
-            //    utils.LogMessage(fmt.Sprintf("AI Failed to process: %s", article.Title), "red", err)
-            //    continue
-            // }
-
-            // time.Sleep(30 * time.Second)
-
-            var contentString string = ""
-            // for _, candidate := range summaryResp.Candidates {
-            //     if candidate.Content != nil {
-            //         for _, part := range candidate.Content.Parts {
-            //             contentString = fmt.Sprintf("%s%s", contentString, part) 
-            //         }
-            //     }
-            // }
-
-            contentString = article.Content
-
-            // highlightResp, err := highlighter(os.Getenv("HIGHLIGHTS_AI_MODEL"), contentString)
-            // if err != nil {
-            //   utils.LogMessage(fmt.Sprintf("AI Failed to process highlights: %s", article.Title), "red", err)
-            // }
-
-            // var highlightInput string 
-            // for _, candidate := range highlightResp.Candidates {
-            //     if candidate.Content != nil {
-            //        for _, part := range candidate.Content.Parts {
-            //            highlightInput = fmt.Sprintf("%s%s", highlightInput, part) 
-            //        }
-            //    }
-            // }
-            
-            // highlights = utils.ExtractPoints(highlightInput)
-
-            // highlightsIndex = utils.FindHighlightIndexes(contentString, highlights) 
-
-            highlightsIndex = [][]int{{1,5}, {7,10}}
-
-            // for _, highlight := range highlights {
-            //     fmt.Println("highlight ->" + highlight)
-            // }
-
-            fmt.Println(highlightsIndex)
-
-            // taggerOutput = CompaniesTagger(contentString)
-
-            // for _, entity := range taggerOutput {
-            //     if entity.Entity == "ORG" {
-            //         taggerCompanies = append(taggerCompanies, entity.Word)
-            //     }
-            // }
-
-            taggerCompanies = []string{"Nvidia", "Google"}
-
-            // taggerCompanies, err = utils.RemoveHashPrefix(taggerCompanies)
-            // if err != nil {
-            //     utils.LogMessage("Failed to remove prepending #", "red", err)
-            // }
-
-            // taggerCompanies, err = utils.RemoveDuplicates(taggerCompanies)
-            // if err != nil {
-            //     utils.LogMessage("Failed to remove duplicates", "red", err)
-            // }
-
-            for _, tag := range taggerCompanies {
-                fmt.Println("tag ->" + tag)
-            }
-
-            // time.Sleep(30 * time.Second)
-
-            // contentString := article.Content
-
-            // utils.LogMessage("===== AI NEWS! ====", "green")
-            // fmt.Println(contentString)
-            // utils.LogMessage("===================", "green")
-
-            if article.URLToImage == "" {
-                utils.LogMessage(fmt.Sprintf("Skipping article without image: %s", article.Title), "yellow")
-                continue
-            }
-
-            if article.Author == "" {
-                utils.LogMessage("No Author, replacing with Aditya Patil", "red")
-                article.Author = "Aditya Patil"
-            }
-
-            if article.Source.Name == "" {
-                utils.LogMessage("No source Name - Replacing with Stockic Editors", "red")
-                article.Source.Name = "Stockic Editors"
-            }
+func summarizeArticle(article models.Article, sourcePolicy *policy.Policy, registry *prompts.Registry, analyzer sentiment.Analyzer) (models.SummarizedArticle, bool) {
+    var ( 
+        // taggerOutput []models.TaggerAIEntity
+        taggerCompanies []string 
+        highlights []string
+        highlightsIndex [][]int 
+        provenance []models.Provenance
+        articleSentiment string
+        category string
+    )
+
+    highlightsUnit := highlight.ConfiguredUnit()
+
+    decision := sourcePolicy.Apply(&article)
+    if !decision.Keep {
+        utils.LogMessage(fmt.Sprintf("Skipping article (%s): %s", decision.Reason, article.Title), "yellow")
+        return models.SummarizedArticle{}, false
+    }
 
-            if article.Source.Name == "The Washington Post" {
-                utils.LogMessage("The Washington Post News, changing URL", "red")
-                article.URLToImage = "https://www.washingtonpost.com/wp-apps/imrs.php?src=https%3A%2F%2Farc-anglerfish-washpost-prod-washpost%252Es3%252Eamazonaws%252Ecom%2Fpublic%2FBA3LQ27PFVG5RCTQ7P2D2SMBJU%252Ejpg&w=924&h=694"
-            }
+    // Prefer the extracted article body over NewsAPI's truncated content
+    sourceText := article.Content
+    if article.FullText != "" {
+        sourceText = article.FullText
+    }
 
-            summarizedArticle := models.SummarizedArticle{
-                Source:             article.Source.Name,
-                Author:             article.Author,
-                Title:              article.Title,
-                URL:                article.URL,
-                URLToImage:         article.URLToImage,
-                PublishedAt:        article.PublishedAt,
-                SummarizedContent:  contentString,
-                CompaniesTags:      taggerCompanies,
-                NewsHighlights:     highlightsIndex,
-            }
+    var contentString string = sourceText
+
+    if aiEnabled() {
+        utils.LogMessage("Feeding AI with 1 news", "green")
+        output, curateProvenance, err := runStage(registry, prompts.StageCurate, article.URL, prompts.Data{
+            Title:  article.Title,
+            Source: article.Source.Name,
+            Text:   sourceText,
+        }, func(prompt *prompts.Prompt, data prompts.Data) (string, error) {
+            return curate(registry, prompt, data)
+        })
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("AI Failed to process: %s", article.Title), "red", err)
+            return models.SummarizedArticle{}, false
+        }
 
-            concatenatedFields := fmt.Sprintf("%s%s%s%s%s%s%s",
-                summarizedArticle.Source,
-                summarizedArticle.Author,
-                summarizedArticle.Title,
-                summarizedArticle.URL,
-                summarizedArticle.URLToImage,
-                summarizedArticle.PublishedAt,
-                summarizedArticle.SummarizedContent,
-            )
+        var curation models.CurationOutput
+        if err := json.Unmarshal([]byte(output), &curation); err != nil {
+            utils.LogMessage(fmt.Sprintf("AI Failed to process: %s", article.Title), "red", err)
+            return models.SummarizedArticle{}, false
+        }
 
-            hash := sha256.Sum256([]byte(concatenatedFields))
-            summarizedArticle.StockicID = hex.EncodeToString(hash[:])
+        // time.Sleep(30 * time.Second)
 
-            summarizedArticles = append(summarizedArticles, summarizedArticle)
-        }
+        contentString = curation.Summary
+        highlights = curation.KeyPoints
+        taggerCompanies = curation.Companies
+        articleSentiment = curation.Sentiment
+        category = curation.Category
+        provenance = append(provenance, curateProvenance)
 
-        summarizedResponses[category] = models.SummarizedResponse{
-            Status:       "ok",
-            TotalResults: len(summarizedArticles),
-            Articles:     summarizedArticles,
-        }
+        highlightsIndex = highlight.Locate(contentString, highlights, highlightsUnit)
+    } else {
+        highlightsIndex = [][]int{{1,5}, {7,10}}
+        taggerCompanies = []string{"Nvidia", "Google"}
     }
 
-    return summarizedResponses
-}
+    // Offsets are only stored if a client can apply them to the content as served
+    if err := highlight.Validate(contentString, highlightsIndex, highlightsUnit); err != nil {
+        utils.LogMessage(fmt.Sprintf("Dropping invalid highlights for: %s", article.Title), "red", err)
+        highlightsIndex = [][]int{}
+    }
 
-func StoreSummarizedRedis(redisKey string, summarizedHeadlines map[string]models.SummarizedResponse) error {
-    summarizedJSONData, err := json.Marshal(summarizedHeadlines)
-	if err != nil {
-        utils.LogMessage("Error serializing data", "red", err)
-        return err
-	}
+    // taggerOutput = CompaniesTagger(contentString)
+
+    // for _, entity := range taggerOutput {
+    //     if entity.Entity == "ORG" {
+    //         taggerCompanies = append(taggerCompanies, entity.Word)
+    //     }
+    // }
+
+    // taggerCompanies, err = utils.RemoveHashPrefix(taggerCompanies)
+    // if err != nil {
+    //     utils.LogMessage("Failed to remove prepending #", "red", err)
+    // }
+
+    // taggerCompanies, err = utils.RemoveDuplicates(taggerCompanies)
+    // if err != nil {
+    //     utils.LogMessage("Failed to remove duplicates", "red", err)
+    // }
+
+    // The lexicon scores every article; the AI's label, when there is one, takes precedence and the scores follow it
+    sentimentResult := analyzer.Analyze(contentString, taggerCompanies)
+    if articleSentiment == "" {
+        articleSentiment = sentimentResult.Label
+    } else {
+        sentimentResult = sentiment.Reconcile(sentimentResult, articleSentiment)
+    }
 
-	err = models.FreshNewsRedis.Set(models.FreshNewsRedisCtx, redisKey, summarizedJSONData, 0).Err()
-	if err != nil {
-		log.Fatalf("Error setting data in Redis: %v", err)
-        return err
-	}
+    // Create summarized article
+    summarizedArticle := models.SummarizedArticle{
+        Source:             article.Source.Name,
+        Author:             article.Author,
+        Title:              article.Title,
+        URL:                article.URL,
+        URLToImage:         article.URLToImage,
+        PublishedAt:        article.PublishedAt,
+        SummarizedContent:  contentString,
+        CompaniesTags:      taggerCompanies,
+        NewsHighlights:     highlightsIndex,
+        HighlightsUnit:     string(highlightsUnit),
+        TrustScore:         decision.TrustScore,
+        Sentiment:          articleSentiment,
+        SentimentScore:     sentimentResult.Score,
+        SentimentConfidence: sentimentResult.Confidence,
+        CompanyImpact:      sentimentResult.Companies,
+        PriceChange:        article.PriceChange,
+        Category:           category,
+        Provenance:         provenance,
+    }
 
-    utils.LogMessage(fmt.Sprintf("Data stored in Redis successfully: %s", redisKey), "green", err)
-    return nil
+    // Concatenate fields to generate StockicID
+    concatenatedFields := fmt.Sprintf("%s%s%s%s%s%s%s",
+        summarizedArticle.Source,
+        summarizedArticle.Author,
+        summarizedArticle.Title,
+        summarizedArticle.URL,
+        summarizedArticle.URLToImage,
+        summarizedArticle.PublishedAt,
+        summarizedArticle.SummarizedContent,
+    )
+
+    // Generate SHA256 hash
+    hash := sha256.Sum256([]byte(concatenatedFields))
+    summarizedArticle.StockicID = hex.EncodeToString(hash[:])
+
+    return summarizedArticle, true
 }
@@ -0,0 +1,256 @@
+package translate
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "regexp"
+    "sort"
+    "strings"
+
+    "feed-curator/models"
+    "feed-curator/utils"
+)
+
+const (
+    ProviderEnv = "TRANSLATION_PROVIDER"
+    LanguagesEnv = "TRANSLATION_LANGUAGES"
+    DictionaryFileEnv = "TRANSLATION_DICTIONARY_FILE"
+
+    // Translation stage disabled, articles only get their language set
+    ProviderNone = "none"
+    // Copies the text unchanged, exercises the stage without a translation service
+    ProviderNoop = "noop"
+    ProviderDictionary = "dictionary"
+
+    DefaultLanguages = "en"
+)
+
+// Language NewsAPI headlines of each country are written in
+var CountryLanguages = map[string]string{
+    "us": "en", "gb": "en", "in": "en", "sg": "en", "au": "en", "nz": "en",
+    "de": "de", "fr": "fr", "it": "it", "es": "es", "pl": "pl", "nl": "nl",
+    "cn": "zh", "hk": "zh", "jp": "ja", "kr": "ko",
+}
+
+/*
+Translator translates article text between ISO 639-1 languages. Noop and
+Dictionary are local fakes for development and replays; a machine
+translation service implements the same interface and is selected in New.
+*/
+type Translator interface {
+    Name() string
+    Translate(text, source, target string) (string, error)
+}
+
+/*
+New returns the translator selected by TRANSLATION_PROVIDER, nil when
+translation is disabled (the default).
+*/
+func New() Translator {
+    switch provider := os.Getenv(ProviderEnv); provider {
+    case "", ProviderNone:
+        return nil
+    case ProviderNoop:
+        return Noop{}
+    case ProviderDictionary:
+        dictionary, err := LoadDictionary(os.Getenv(DictionaryFileEnv))
+        if err != nil {
+            utils.LogMessage("Failed to load translation dictionary, translation disabled", "red", err)
+            return nil
+        }
+        return dictionary
+    default:
+        utils.LogMessage(fmt.Sprintf("Unknown translation provider %q, translation disabled", provider), "red")
+        return nil
+    }
+}
+
+// Languages returns the languages every article is offered in, from TRANSLATION_LANGUAGES
+func Languages() []string {
+    value := os.Getenv(LanguagesEnv)
+    if value == "" {
+        value = DefaultLanguages
+    }
+
+    var languages []string
+    for _, language := range strings.Split(value, ",") {
+        if language = NormalizeLanguage(language); language != "" {
+            languages = append(languages, language)
+        }
+    }
+    languages, _ = utils.RemoveDuplicates(languages)
+    return languages
+}
+
+// NormalizeLanguage reduces a language tag ("en-US", "DE") to its primary subtag
+func NormalizeLanguage(language string) string {
+    language = strings.ToLower(strings.TrimSpace(language))
+    if index := strings.IndexAny(language, "-_"); index >= 0 {
+        language = language[:index]
+    }
+    return language
+}
+
+/*
+LocalizeFeed sets the language of every article, sourceLanguage giving it
+per country or category, and adds a translation into each target language
+the article isn't written in. With a nil translator only languages are set.
+A failed translation is logged and left out, the article stays servable in
+its own language.
+*/
+func LocalizeFeed(feed map[string]models.SummarizedResponse, sourceLanguage func(key string) string, translator Translator, targets []string) {
+    translated := 0
+    for key, response := range feed {
+        source := sourceLanguage(key)
+
+        for index := range response.Articles {
+            article := &response.Articles[index]
+            if article.Language == "" {
+                article.Language = source
+            }
+            if translator == nil {
+                continue
+            }
+
+            for _, target := range targets {
+                if target == article.Language || article.Translations[target].Content != "" {
+                    continue
+                }
+
+                translation, err := translateArticle(translator, *article, target)
+                if err != nil {
+                    utils.LogMessage(fmt.Sprintf("Failed to translate %s from %s to %s", article.StockicID, article.Language, target), "red", err)
+                    continue
+                }
+
+                if article.Translations == nil {
+                    article.Translations = make(map[string]models.Translation)
+                }
+                article.Translations[target] = translation
+                translated++
+            }
+        }
+    }
+
+    if translator != nil {
+        utils.LogMessage(fmt.Sprintf("Added %d translations with %s", translated, translator.Name()), "green")
+    }
+}
+
+func translateArticle(translator Translator, article models.SummarizedArticle, target string) (models.Translation, error) {
+    title, err := translator.Translate(article.Title, article.Language, target)
+    if err != nil {
+        return models.Translation{}, err
+    }
+    content, err := translator.Translate(article.SummarizedContent, article.Language, target)
+    if err != nil {
+        return models.Translation{}, err
+    }
+
+    return models.Translation{Title: title, Content: content, Provider: translator.Name()}, nil
+}
+
+// CountryLanguage is the source language of a headlines feed key, English when unknown
+func CountryLanguage(country string) string {
+    if language, found := CountryLanguages[country]; found {
+        return language
+    }
+    return "en"
+}
+
+type Noop struct{}
+
+func (Noop) Name() string {
+    return ProviderNoop
+}
+
+func (Noop) Translate(text, source, target string) (string, error) {
+    return text, nil
+}
+
+/*
+Dictionary replaces words and phrases from a JSON file of
+{"<source>": {"<target>": {"<phrase>": "<translation>"}}}, case-insensitively
+on word boundaries, longest phrases first. Anything not in the dictionary is
+left as is, so it is only a stand-in for a real translation service. Word
+boundaries are ASCII, phrases in other scripts only match as whole tokens
+between ASCII characters.
+*/
+type Dictionary struct {
+    // Lowercased phrases to translations, by "<source>><target>"
+    phrases     map[string]map[string]string
+    patterns    map[string]*regexp.Regexp
+}
+
+func LoadDictionary(path string) (*Dictionary, error) {
+    if path == "" {
+        return nil, fmt.Errorf("%s is not set", DictionaryFileEnv)
+    }
+
+    content, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var entries map[string]map[string]map[string]string
+    if err := json.Unmarshal(content, &entries); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+    }
+
+    dictionary := &Dictionary{
+        phrases:  make(map[string]map[string]string),
+        patterns: make(map[string]*regexp.Regexp),
+    }
+    for source, targets := range entries {
+        for target, phrases := range targets {
+            if len(phrases) == 0 {
+                continue
+            }
+
+            pair := NormalizeLanguage(source) + ">" + NormalizeLanguage(target)
+            dictionary.phrases[pair] = make(map[string]string, len(phrases))
+            for phrase, translation := range phrases {
+                dictionary.phrases[pair][strings.ToLower(phrase)] = translation
+            }
+            dictionary.patterns[pair] = phrasePattern(phrases)
+        }
+    }
+
+    return dictionary, nil
+}
+
+func (dictionary *Dictionary) Name() string {
+    return ProviderDictionary
+}
+
+func (dictionary *Dictionary) Translate(text, source, target string) (string, error) {
+    pair := source + ">" + target
+    pattern, found := dictionary.patterns[pair]
+    if !found {
+        return "", fmt.Errorf("no dictionary from %s to %s", source, target)
+    }
+
+    return pattern.ReplaceAllStringFunc(text, func(match string) string {
+        return dictionary.phrases[pair][strings.ToLower(match)]
+    }), nil
+}
+
+// phrasePattern matches any of the phrases as whole words, preferring the longest
+func phrasePattern(phrases map[string]string) *regexp.Regexp {
+    keys := make([]string, 0, len(phrases))
+    for phrase := range phrases {
+        keys = append(keys, phrase)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if len(keys[i]) != len(keys[j]) {
+            return len(keys[i]) > len(keys[j])
+        }
+        return keys[i] < keys[j]
+    })
+
+    for index, phrase := range keys {
+        keys[index] = regexp.QuoteMeta(phrase)
+    }
+    return regexp.MustCompile(`(?i)\b(?:` + strings.Join(keys, "|") + `)\b`)
+}
@@ -84,36 +84,3 @@ func RemoveHashPrefix(input []string) ([]string, error) {
     
     return result, nil
 }
-
-func ExtractPoints(input string) []string {
-	var points []string
-	lines := strings.Split(input, "\n")
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "*") {
-			points = append(points, strings.TrimSpace(trimmed[1:]))
-		}
-	}
-
-	return points
-}
-
-func FindHighlightIndexes(content string, highlights []string) [][]int {
-	var result [][]int
-
-	for _, highlight := range highlights {
-		start := 0
-		for start < len(content) {
-			start = strings.Index(content[start:], highlight)
-			if start == -1 {
-				break
-			}
-			start += len(result) // Adjust start position by previous offset
-			end := start + len(highlight)
-			result = append(result, []int{start, end})
-			start = end // Move the cursor forward
-		}
-	}
-	return result
-}
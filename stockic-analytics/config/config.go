@@ -0,0 +1,40 @@
+package config
+
+import (
+    "context"
+
+    "github.com/minio/minio-go/v7"
+)
+
+var (
+    MinIOCtx = context.Background()
+    MinIOClient *minio.Client
+)
+
+const (
+    Logfile = "stockic-analytics.log"
+
+    UserLogsBucket = "user-logs"
+    RawNewsBucket = "raw-news-archive"
+    SummarizedNewsBucket = "summarized-news-archive"
+
+    // Archive objects are named <prefix><timestamp>.json by the curator and log pushers
+    RawNewsPrefix = "raw-news-"
+    SummarizedNewsPrefix = "summarized-news-"
+    DetailLogPrefix = "detail-log-"
+    ArchiveTimeLayout = "2006-01-02T15-04-05"
+
+    DateLayout = "2006-01-02"
+)
+
+// News archives name their feed after the prefix, <prefix><feed>-<timestamp>.json, older ones don't
+var ArchiveFeeds = []string{"headlines-", "discover-"}
+
+// Country codes the curator fetches headlines for. Every other key in an
+// archive is a discover category.
+var HeadlineCountries = []string{
+    "us",
+    "gb", "de", "fr", "it", "es", "pl", "nl",
+    "cn", "in", "jp", "kr", "sg", "hk",
+    "au", "nz",
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "path"
+    "strings"
+    "time"
+
+    "github.com/joho/godotenv"
+    "github.com/minio/minio-go/v7"
+    "github.com/minio/minio-go/v7/pkg/credentials"
+
+    "stockic-analytics/config"
+    "stockic-analytics/utils"
+)
+
+func Initialize() {
+    logFile, err := os.OpenFile(config.Logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+    if err != nil {
+        log.Fatalf("Failed to open log file: %v", err)
+    }
+
+    log.SetOutput(logFile)
+    log.SetFlags(0)
+
+    err = godotenv.Load()
+    if err != nil {
+        log.Printf("Warning: Error loading .env file: %v", err)
+    }
+
+    config.MinIOClient = MinIOInit("MINIO_ENDPOINT", "MINIO_ACCESSKEY", "MINIO_SECRETKEY")
+}
+
+/*
+The analytics CLI only ever reads from the archives, so unlike the services
+it never creates buckets. A missing bucket simply produces an empty report.
+*/
+func MinIOInit(MinIOEndpoint string, MinIOAccessKey string, MinIOSecretKey string) *minio.Client {
+    endpoint := os.Getenv(MinIOEndpoint)
+    accessKey := os.Getenv(MinIOAccessKey)
+    secretKey := os.Getenv(MinIOSecretKey)
+
+    minioClient, err := minio.New(endpoint, &minio.Options{
+        Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+        Secure: false,
+    })
+    if err != nil {
+        log.Fatalf("Failed to initialize MinIO client: %v", err)
+    }
+
+    return minioClient
+}
+
+type ArchiveObject struct {
+    Key       string
+    Timestamp time.Time
+}
+
+/*
+ListArchiveObjects returns the objects of a bucket whose file name starts
+with namePrefix and whose embedded timestamp lies within [from, to).
+Zero from/to leave that side of the range open. Objects that don't follow
+the <prefix>[<feed>-]<timestamp>.json convention are skipped.
+*/
+func ListArchiveObjects(minioClient *minio.Client, bucket, namePrefix string, from, to time.Time) ([]ArchiveObject, error) {
+    exists, err := minioClient.BucketExists(config.MinIOCtx, bucket)
+    if err != nil {
+        return nil, fmt.Errorf("error checking bucket %s: %w", bucket, err)
+    }
+    if !exists {
+        utils.LogMessage(fmt.Sprintf("Bucket %s does not exist, nothing to read", bucket), "red")
+        return nil, nil
+    }
+
+    var objects []ArchiveObject
+    for object := range minioClient.ListObjects(config.MinIOCtx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+        if object.Err != nil {
+            return nil, fmt.Errorf("error listing bucket %s: %w", bucket, object.Err)
+        }
+
+        name := path.Base(object.Key)
+        if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, ".json") {
+            continue
+        }
+
+        stamp := strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), ".json")
+        for _, feed := range config.ArchiveFeeds {
+            stamp = strings.TrimPrefix(stamp, feed)
+        }
+        timestamp, err := time.Parse(config.ArchiveTimeLayout, stamp)
+        if err != nil {
+            utils.LogMessage(fmt.Sprintf("Skipping object with unexpected name: %s", object.Key), "red", err)
+            continue
+        }
+
+        if !from.IsZero() && timestamp.Before(from) {
+            continue
+        }
+        if !to.IsZero() && !timestamp.Before(to) {
+            continue
+        }
+
+        objects = append(objects, ArchiveObject{Key: object.Key, Timestamp: timestamp})
+    }
+
+    return objects, nil
+}
+
+func GetJSONObject(minioClient *minio.Client, bucket, key string, target interface{}) error {
+    object, err := minioClient.GetObject(config.MinIOCtx, bucket, key, minio.GetObjectOptions{})
+    if err != nil {
+        return fmt.Errorf("error fetching %s/%s: %w", bucket, key, err)
+    }
+    defer object.Close()
+
+    if err := json.NewDecoder(object).Decode(target); err != nil {
+        return fmt.Errorf("error decoding %s/%s: %w", bucket, key, err)
+    }
+
+    return nil
+}
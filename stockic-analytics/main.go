@@ -0,0 +1,172 @@
+package main
+
+// Ad-hoc analytics over the MinIO archives written by feed-api, the log pusher and the curator
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "stockic-analytics/config"
+    "stockic-analytics/database"
+    "stockic-analytics/models"
+    "stockic-analytics/services"
+    "stockic-analytics/utils"
+)
+
+var reports = []string{"views-article", "views-category", "views-country", "views-day", "top-sources", "retention"}
+
+func usage() {
+    fmt.Fprintf(os.Stderr, "Usage: stockic-analytics <report> [flags]\n\n")
+    fmt.Fprintf(os.Stderr, "Reports: %s\n\nFlags:\n", strings.Join(reports, ", "))
+    flag.PrintDefaults()
+}
+
+func main() {
+    flag.Usage = usage
+    if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+        usage()
+        os.Exit(2)
+    }
+    reportName := os.Args[1]
+
+    fromStr := flag.String("from", "", "first day to include (YYYY-MM-DD), open if empty")
+    toStr := flag.String("to", "", "last day to include (YYYY-MM-DD), open if empty")
+    format := flag.String("format", "csv", "output format: csv or json")
+    outPath := flag.String("out", "", "write the report to this file instead of stdout")
+    limit := flag.Int("limit", 0, "maximum number of rows for ranked reports (0 = all)")
+    country := flag.String("country", "", "only count views of articles in this country's headlines")
+    category := flag.String("category", "", "only count views of articles in this discover category")
+    article := flag.String("article", "", "only count views of this StockicID")
+    lookback := flag.Int("lookback", 7, "days before -from to scan the summarized archive for article metadata")
+    retentionDays := flag.String("retention-days", "1,7,30", "comma separated day offsets for the retention report")
+    flag.CommandLine.Parse(os.Args[2:])
+
+    if *format != "csv" && *format != "json" {
+        fmt.Fprintf(os.Stderr, "Unknown format: %s\n", *format)
+        os.Exit(2)
+    }
+
+    from, err := parseDay(*fromStr)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Invalid -from: %v\n", err)
+        os.Exit(2)
+    }
+    to, err := parseDay(*toStr)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Invalid -to: %v\n", err)
+        os.Exit(2)
+    }
+    if !to.IsZero() {
+        // -to is inclusive, the archive listing is not
+        to = to.AddDate(0, 0, 1)
+    }
+
+    offsets, err := parseOffsets(*retentionDays)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Invalid -retention-days: %v\n", err)
+        os.Exit(2)
+    }
+
+    database.Initialize()
+
+    report, err := buildReport(reportName, from, to, *lookback, offsets, *limit, services.Filter{
+        Country:  *country,
+        Category: *category,
+        NewsID:   *article,
+    })
+    if err != nil {
+        utils.LogMessage("Failed to build report", "red", err)
+        os.Exit(1)
+    }
+
+    var writer io.Writer = os.Stdout
+    if *outPath != "" {
+        file, err := os.Create(*outPath)
+        if err != nil {
+            utils.LogMessage("Failed to create output file", "red", err)
+            os.Exit(1)
+        }
+        defer file.Close()
+        writer = file
+    }
+
+    if *format == "json" {
+        err = services.WriteJSON(writer, report)
+    } else {
+        err = services.WriteCSV(writer, report)
+    }
+    if err != nil {
+        utils.LogMessage("Failed to write report", "red", err)
+        os.Exit(1)
+    }
+}
+
+func buildReport(name string, from, to time.Time, lookback int, offsets []int, limit int, filter services.Filter) (models.Report, error) {
+    known := false
+    for _, report := range reports {
+        known = known || report == name
+    }
+    if !known {
+        return models.Report{}, fmt.Errorf("unknown report: %s", name)
+    }
+
+    events, err := services.LoadViewEvents(from, to)
+    if err != nil {
+        return models.Report{}, err
+    }
+
+    // Articles are viewed after they were curated, so metadata has to come from further back
+    indexFrom := from
+    if !indexFrom.IsZero() {
+        indexFrom = indexFrom.AddDate(0, 0, -lookback)
+    }
+
+    index, err := services.LoadArticleIndex(indexFrom, to)
+    if err != nil {
+        return models.Report{}, err
+    }
+
+    events = services.FilterEvents(events, index, filter)
+
+    switch name {
+    case "views-article":
+        return services.ViewsPerArticle(events, index, limit), nil
+    case "views-category":
+        return services.ViewsPerCategory(events, index, limit), nil
+    case "views-country":
+        return services.ViewsPerCountry(events, index, limit), nil
+    case "views-day":
+        return services.ViewsPerDay(events), nil
+    case "top-sources":
+        rawCounts, err := services.LoadRawSourceCounts(from, to)
+        if err != nil {
+            return models.Report{}, err
+        }
+        return services.TopSources(events, index, rawCounts, limit), nil
+    default:
+        return services.Retention(events, offsets), nil
+    }
+}
+
+func parseDay(value string) (time.Time, error) {
+    if value == "" {
+        return time.Time{}, nil
+    }
+    return time.Parse(config.DateLayout, value)
+}
+
+func parseOffsets(value string) ([]int, error) {
+    var offsets []int
+    for _, part := range strings.Split(value, ",") {
+        offset, err := strconv.Atoi(strings.TrimSpace(part))
+        if err != nil || offset < 1 {
+            return nil, fmt.Errorf("offset %q must be a positive integer", part)
+        }
+        offsets = append(offsets, offset)
+    }
+    return offsets, nil
+}
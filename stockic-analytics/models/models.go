@@ -0,0 +1,91 @@
+package models
+
+import (
+    "encoding/json"
+    "time"
+)
+
+type Source struct {
+    ID   string `json:"id"`
+    Name string `json:"name"`
+}
+
+type Article struct {
+    Source      Source `json:"source"`
+    Author      string `json:"author"`
+    Title       string `json:"title"`
+    URL         string `json:"url"`
+    PublishedAt string `json:"publishedAt"`
+}
+
+type APIResponse struct {
+    Status       string    `json:"status"`
+    TotalResults int       `json:"totalResults"`
+    Articles     []Article `json:"articles"`
+}
+
+type SummarizedArticle struct {
+    StockicID   string `json:"stockicID"`
+    Source      string `json:"source"`
+    Author      string `json:"author"`
+    Title       string `json:"title"`
+    URL         string `json:"url"`
+    PublishedAt string `json:"publishedAt"`
+}
+
+type SummarizedResponse struct {
+    Status       string              `json:"status"`
+    TotalResults int                 `json:"totalResults"`
+    Articles     []SummarizedArticle `json:"articles"`
+}
+
+// Layout of raw-news-<feed>-<ts>.json (raw-news-<ts>.json before) in raw-news-archive
+type RawNewsArchive struct {
+    Time     string                 `json:"time"`
+    NewsData map[string]APIResponse `json:"news-data"`
+}
+
+// Layout of summarized-news-<feed>-<ts>.json (summarized-news-<ts>.json before) in summarized-news-archive
+type SummarizedNewsArchive struct {
+    Time     string                        `json:"time"`
+    NewsData map[string]SummarizedResponse `json:"news-data"`
+}
+
+/*
+One entry of user-logs/<apiKey>/detail-log-<ts>.json. accessCount is
+written from a Redis GET so it arrives as a string, but older objects
+may hold a number, hence json.Number.
+*/
+type DetailLog struct {
+    NewsID      string      `json:"newsID"`
+    AccessCount json.Number `json:"accessCount"`
+    LastSynced  string      `json:"lastSynced"`
+}
+
+// A single detail view batch attributed to a user
+type ViewEvent struct {
+    APIKey string
+    NewsID string
+    Count  int64
+    Time   time.Time
+}
+
+// What the archives tell us about a StockicID
+type ArticleInfo struct {
+    StockicID   string
+    Title       string
+    Source      string
+    PublishedAt string
+    Countries   []string
+    Categories  []string
+}
+
+/*
+Report is the tabular result of an aggregation. Rows hold typed values
+so that the JSON writer can keep numbers as numbers.
+*/
+type Report struct {
+    Name    string
+    Columns []string
+    Rows    [][]interface{}
+}
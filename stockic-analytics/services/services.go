@@ -0,0 +1,448 @@
+package services
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "path"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "stockic-analytics/config"
+    "stockic-analytics/database"
+    "stockic-analytics/models"
+    "stockic-analytics/utils"
+)
+
+const unknownDimension = "unknown"
+
+// Restricts which view events make it into a report
+type Filter struct {
+    Country  string
+    Category string
+    NewsID   string
+}
+
+/*
+LoadViewEvents reads every detail log in user-logs synced within [from, to).
+Objects are stored as <apiKey>/detail-log-<ts>.json, so the API key is the
+first path segment of the object key.
+*/
+func LoadViewEvents(from, to time.Time) ([]models.ViewEvent, error) {
+    objects, err := database.ListArchiveObjects(config.MinIOClient, config.UserLogsBucket, config.DetailLogPrefix, from, to)
+    if err != nil {
+        return nil, err
+    }
+
+    var events []models.ViewEvent
+    for _, object := range objects {
+        var logs []models.DetailLog
+        if err := database.GetJSONObject(config.MinIOClient, config.UserLogsBucket, object.Key, &logs); err != nil {
+            utils.LogMessage("Skipping unreadable detail log", "red", err)
+            continue
+        }
+
+        apiKey := strings.SplitN(object.Key, "/", 2)[0]
+        if apiKey == path.Base(object.Key) {
+            apiKey = unknownDimension
+        }
+
+        for _, entry := range logs {
+            count, err := strconv.ParseInt(entry.AccessCount.String(), 10, 64)
+            if err != nil {
+                utils.LogMessage(fmt.Sprintf("Invalid access count in %s: %q", object.Key, entry.AccessCount), "red", err)
+                continue
+            }
+
+            syncedAt, err := time.Parse(time.RFC3339, entry.LastSynced)
+            if err != nil {
+                syncedAt = object.Timestamp
+            }
+
+            events = append(events, models.ViewEvent{
+                APIKey: apiKey,
+                NewsID: entry.NewsID,
+                Count:  count,
+                Time:   syncedAt,
+            })
+        }
+    }
+
+    utils.LogMessage(fmt.Sprintf("Loaded %d view events from %d detail logs", len(events), len(objects)), "green")
+    return events, nil
+}
+
+/*
+LoadArticleIndex maps StockicIDs to their metadata using the summarized
+archives. An article can appear in several archive keys (countries for
+headlines, categories for discover) and in several runs; all of them are
+merged.
+*/
+func LoadArticleIndex(from, to time.Time) (map[string]*models.ArticleInfo, error) {
+    objects, err := database.ListArchiveObjects(config.MinIOClient, config.SummarizedNewsBucket, config.SummarizedNewsPrefix, from, to)
+    if err != nil {
+        return nil, err
+    }
+
+    index := make(map[string]*models.ArticleInfo)
+    for _, object := range objects {
+        var archive models.SummarizedNewsArchive
+        if err := database.GetJSONObject(config.MinIOClient, config.SummarizedNewsBucket, object.Key, &archive); err != nil {
+            utils.LogMessage("Skipping unreadable summarized archive", "red", err)
+            continue
+        }
+
+        for key, response := range archive.NewsData {
+            isCountry := utils.IsHeadlineCountry(key, config.HeadlineCountries)
+            for _, article := range response.Articles {
+                info, exists := index[article.StockicID]
+                if !exists {
+                    info = &models.ArticleInfo{
+                        StockicID:   article.StockicID,
+                        Title:       article.Title,
+                        Source:      article.Source,
+                        PublishedAt: article.PublishedAt,
+                    }
+                    index[article.StockicID] = info
+                }
+
+                if isCountry {
+                    info.Countries = appendUnique(info.Countries, key)
+                } else {
+                    info.Categories = appendUnique(info.Categories, key)
+                }
+            }
+        }
+    }
+
+    utils.LogMessage(fmt.Sprintf("Indexed %d articles from %d summarized archives", len(index), len(objects)), "green")
+    return index, nil
+}
+
+// LoadRawSourceCounts counts how many articles each source contributed to the raw NewsAPI responses
+func LoadRawSourceCounts(from, to time.Time) (map[string]int64, error) {
+    objects, err := database.ListArchiveObjects(config.MinIOClient, config.RawNewsBucket, config.RawNewsPrefix, from, to)
+    if err != nil {
+        return nil, err
+    }
+
+    counts := make(map[string]int64)
+    for _, object := range objects {
+        var archive models.RawNewsArchive
+        if err := database.GetJSONObject(config.MinIOClient, config.RawNewsBucket, object.Key, &archive); err != nil {
+            utils.LogMessage("Skipping unreadable raw archive", "red", err)
+            continue
+        }
+
+        for _, response := range archive.NewsData {
+            for _, article := range response.Articles {
+                source := article.Source.Name
+                if source == "" {
+                    source = unknownDimension
+                }
+                counts[source]++
+            }
+        }
+    }
+
+    return counts, nil
+}
+
+func FilterEvents(events []models.ViewEvent, index map[string]*models.ArticleInfo, filter Filter) []models.ViewEvent {
+    if filter == (Filter{}) {
+        return events
+    }
+
+    var filtered []models.ViewEvent
+    for _, event := range events {
+        if filter.NewsID != "" && event.NewsID != filter.NewsID {
+            continue
+        }
+
+        info := index[event.NewsID]
+        if filter.Country != "" && (info == nil || !contains(info.Countries, filter.Country)) {
+            continue
+        }
+        if filter.Category != "" && (info == nil || !contains(info.Categories, filter.Category)) {
+            continue
+        }
+
+        filtered = append(filtered, event)
+    }
+
+    return filtered
+}
+
+func ViewsPerArticle(events []models.ViewEvent, index map[string]*models.ArticleInfo, limit int) models.Report {
+    views := make(map[string]int64)
+    users := make(map[string]map[string]struct{})
+    for _, event := range events {
+        views[event.NewsID] += event.Count
+        if users[event.NewsID] == nil {
+            users[event.NewsID] = make(map[string]struct{})
+        }
+        users[event.NewsID][event.APIKey] = struct{}{}
+    }
+
+    report := models.Report{
+        Name:    "views-article",
+        Columns: []string{"stockicID", "title", "source", "views", "uniqueUsers"},
+    }
+    for _, newsID := range sortedByCount(views, limit) {
+        title, source := "", unknownDimension
+        if info, exists := index[newsID]; exists {
+            title, source = info.Title, info.Source
+        }
+        report.Rows = append(report.Rows, []interface{}{newsID, title, source, views[newsID], int64(len(users[newsID]))})
+    }
+
+    return report
+}
+
+// Views per discover category. Articles listed under several categories count towards each of them.
+func ViewsPerCategory(events []models.ViewEvent, index map[string]*models.ArticleInfo, limit int) models.Report {
+    return viewsPerDimension("views-category", "category", events, limit, func(info *models.ArticleInfo) []string {
+        return info.Categories
+    }, index)
+}
+
+// Views per headline country. Articles listed under several countries count towards each of them.
+func ViewsPerCountry(events []models.ViewEvent, index map[string]*models.ArticleInfo, limit int) models.Report {
+    return viewsPerDimension("views-country", "country", events, limit, func(info *models.ArticleInfo) []string {
+        return info.Countries
+    }, index)
+}
+
+func ViewsPerDay(events []models.ViewEvent) models.Report {
+    views := make(map[string]int64)
+    users := make(map[string]map[string]struct{})
+    for _, event := range events {
+        day := event.Time.UTC().Format(config.DateLayout)
+        views[day] += event.Count
+        if users[day] == nil {
+            users[day] = make(map[string]struct{})
+        }
+        users[day][event.APIKey] = struct{}{}
+    }
+
+    days := make([]string, 0, len(views))
+    for day := range views {
+        days = append(days, day)
+    }
+    sort.Strings(days)
+
+    report := models.Report{
+        Name:    "views-day",
+        Columns: []string{"day", "views", "activeUsers"},
+    }
+    for _, day := range days {
+        report.Rows = append(report.Rows, []interface{}{day, views[day], int64(len(users[day]))})
+    }
+
+    return report
+}
+
+/*
+TopSources ranks sources by views and puts them next to how many articles
+the source contributed to the raw NewsAPI responses and how many survived
+curation, which makes sources that are fetched a lot but never read stand out.
+*/
+func TopSources(events []models.ViewEvent, index map[string]*models.ArticleInfo, rawCounts map[string]int64, limit int) models.Report {
+    views := make(map[string]int64)
+    for _, event := range events {
+        source := unknownDimension
+        if info, exists := index[event.NewsID]; exists && info.Source != "" {
+            source = info.Source
+        }
+        views[source] += event.Count
+    }
+
+    curated := make(map[string]int64)
+    for _, info := range index {
+        curated[info.Source]++
+    }
+
+    // Sources that were fetched but never viewed still deserve a row
+    for source := range rawCounts {
+        if _, exists := views[source]; !exists {
+            views[source] = 0
+        }
+    }
+
+    report := models.Report{
+        Name:    "top-sources",
+        Columns: []string{"source", "views", "curatedArticles", "fetchedArticles"},
+    }
+    for _, source := range sortedByCount(views, limit) {
+        report.Rows = append(report.Rows, []interface{}{source, views[source], curated[source], rawCounts[source]})
+    }
+
+    return report
+}
+
+/*
+Retention groups users into cohorts by the UTC day of their first view and
+reports, for every offset in days, the share of the cohort that viewed at
+least one article exactly that many days later.
+*/
+func Retention(events []models.ViewEvent, offsets []int) models.Report {
+    activeDays := make(map[string]map[string]struct{})
+    firstSeen := make(map[string]time.Time)
+    for _, event := range events {
+        day := event.Time.UTC().Truncate(24 * time.Hour)
+        if activeDays[event.APIKey] == nil {
+            activeDays[event.APIKey] = make(map[string]struct{})
+        }
+        activeDays[event.APIKey][day.Format(config.DateLayout)] = struct{}{}
+
+        if first, exists := firstSeen[event.APIKey]; !exists || day.Before(first) {
+            firstSeen[event.APIKey] = day
+        }
+    }
+
+    cohorts := make(map[string][]string)
+    for apiKey, first := range firstSeen {
+        cohort := first.Format(config.DateLayout)
+        cohorts[cohort] = append(cohorts[cohort], apiKey)
+    }
+
+    cohortDays := make([]string, 0, len(cohorts))
+    for cohort := range cohorts {
+        cohortDays = append(cohortDays, cohort)
+    }
+    sort.Strings(cohortDays)
+
+    report := models.Report{
+        Name:    "retention",
+        Columns: []string{"cohort", "users"},
+    }
+    for _, offset := range offsets {
+        report.Columns = append(report.Columns, fmt.Sprintf("day%d", offset))
+    }
+
+    for _, cohort := range cohortDays {
+        members := cohorts[cohort]
+        row := []interface{}{cohort, int64(len(members))}
+        cohortDay, _ := time.Parse(config.DateLayout, cohort)
+
+        for _, offset := range offsets {
+            target := cohortDay.AddDate(0, 0, offset).Format(config.DateLayout)
+            retained := 0
+            for _, apiKey := range members {
+                if _, active := activeDays[apiKey][target]; active {
+                    retained++
+                }
+            }
+            row = append(row, float64(retained)/float64(len(members)))
+        }
+
+        report.Rows = append(report.Rows, row)
+    }
+
+    return report
+}
+
+func WriteCSV(writer io.Writer, report models.Report) error {
+    csvWriter := csv.NewWriter(writer)
+    if err := csvWriter.Write(report.Columns); err != nil {
+        return err
+    }
+
+    for _, row := range report.Rows {
+        record := make([]string, len(row))
+        for i, value := range row {
+            switch typed := value.(type) {
+            case float64:
+                record[i] = strconv.FormatFloat(typed, 'f', 4, 64)
+            default:
+                record[i] = fmt.Sprint(typed)
+            }
+        }
+        if err := csvWriter.Write(record); err != nil {
+            return err
+        }
+    }
+
+    csvWriter.Flush()
+    return csvWriter.Error()
+}
+
+func WriteJSON(writer io.Writer, report models.Report) error {
+    rows := make([]map[string]interface{}, 0, len(report.Rows))
+    for _, row := range report.Rows {
+        object := make(map[string]interface{}, len(row))
+        for i, value := range row {
+            object[report.Columns[i]] = value
+        }
+        rows = append(rows, object)
+    }
+
+    encoder := json.NewEncoder(writer)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(map[string]interface{}{
+        "report": report.Name,
+        "rows":   rows,
+    })
+}
+
+func viewsPerDimension(name, column string, events []models.ViewEvent, limit int, dimension func(*models.ArticleInfo) []string, index map[string]*models.ArticleInfo) models.Report {
+    views := make(map[string]int64)
+    for _, event := range events {
+        values := []string{unknownDimension}
+        if info, exists := index[event.NewsID]; exists && len(dimension(info)) > 0 {
+            values = dimension(info)
+        }
+        for _, value := range values {
+            views[value] += event.Count
+        }
+    }
+
+    report := models.Report{
+        Name:    name,
+        Columns: []string{column, "views"},
+    }
+    for _, value := range sortedByCount(views, limit) {
+        report.Rows = append(report.Rows, []interface{}{value, views[value]})
+    }
+
+    return report
+}
+
+// Keys ordered by descending count, ties broken alphabetically. limit <= 0 means no limit.
+func sortedByCount(counts map[string]int64, limit int) []string {
+    keys := make([]string, 0, len(counts))
+    for key := range counts {
+        keys = append(keys, key)
+    }
+
+    sort.Slice(keys, func(i, j int) bool {
+        if counts[keys[i]] != counts[keys[j]] {
+            return counts[keys[i]] > counts[keys[j]]
+        }
+        return keys[i] < keys[j]
+    })
+
+    if limit > 0 && len(keys) > limit {
+        keys = keys[:limit]
+    }
+    return keys
+}
+
+func appendUnique(values []string, value string) []string {
+    if contains(values, value) {
+        return values
+    }
+    return append(values, value)
+}
+
+func contains(values []string, value string) bool {
+    for _, existing := range values {
+        if existing == value {
+            return true
+        }
+    }
+    return false
+}
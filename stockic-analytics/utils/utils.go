@@ -0,0 +1,42 @@
+package utils
+
+import (
+    "fmt"
+    "log"
+    "os"
+    "time"
+)
+
+/*
+Reports are written to stdout, so unlike the services this CLI prints
+its log lines to stderr to keep CSV/JSON output clean for piping.
+*/
+func LogMessage(message, color string, errs ...error) {
+    var err error
+    if len(errs) > 0 {
+        err = errs[0]
+    } else {
+        err = nil
+    }
+
+    timestamp := time.Now().Format("2006-01-02 15:04:05")
+
+    log.Printf("[ANALYTICS-LOG] [%s] %s ERROR: %v", timestamp, message, err)
+
+    if color == "red" {
+        fmt.Fprintf(os.Stderr, "\033[31m [%s] %s \033[0m ERROR: %v\n", timestamp, message, err)
+    } else if color == "green" {
+        fmt.Fprintf(os.Stderr, "\033[32m [%s] %s \033[0m ERROR: %v\n", timestamp, message, err)
+    } else {
+        fmt.Fprintf(os.Stderr, "\033[31m [%s] %s \033[0m ERROR: %v\n", timestamp, message, err)
+    }
+}
+
+func IsHeadlineCountry(key string, countries []string) bool {
+    for _, country := range countries {
+        if country == key {
+            return true
+        }
+    }
+    return false
+}